@@ -4,6 +4,8 @@ import (
 	"context"
 	"net"
 	"net/http"
+	"os"
+	"strconv"
 	"strings"
 	"time"
 
@@ -19,6 +21,7 @@ import (
 	"go.uber.org/zap"
 
 	"github.com/ernado/stor/internal/front"
+	"github.com/ernado/stor/internal/node"
 )
 
 func getYDBDSN() string {
@@ -32,6 +35,45 @@ func getYDBDSN() string {
 	return ""
 }
 
+// getEnvInt returns integer value of environment variable or zero if not set.
+func getEnvInt(name string) (int, error) {
+	v := os.Getenv(name)
+	if v == "" {
+		return 0, nil
+	}
+	n, err := strconv.Atoi(v)
+	if err != nil {
+		return 0, errors.Wrapf(err, "parse %s", name)
+	}
+	return n, nil
+}
+
+// getEnvFloat returns float value of environment variable or zero if not set.
+func getEnvFloat(name string) (float64, error) {
+	v := os.Getenv(name)
+	if v == "" {
+		return 0, nil
+	}
+	f, err := strconv.ParseFloat(v, 64)
+	if err != nil {
+		return 0, errors.Wrapf(err, "parse %s", name)
+	}
+	return f, nil
+}
+
+// getEnvDuration returns duration value of environment variable or zero if not set.
+func getEnvDuration(name string) (time.Duration, error) {
+	v := os.Getenv(name)
+	if v == "" {
+		return 0, nil
+	}
+	d, err := time.ParseDuration(v)
+	if err != nil {
+		return 0, errors.Wrapf(err, "parse %s", name)
+	}
+	return d, nil
+}
+
 func main() {
 	app.Run(func(ctx context.Context, lg *zap.Logger, m *app.Telemetry) error {
 		db, err := ydb.Open(ctx, getYDBDSN(),
@@ -90,12 +132,213 @@ func main() {
 			),
 		}
 
+		var opts front.HandlerOptions
+		if opts.ReplicationFactor, err = getEnvInt("REPLICATION_FACTOR"); err != nil {
+			return errors.Wrap(err, "replication factor")
+		}
+		if opts.WriteQuorum, err = getEnvInt("WRITE_QUORUM"); err != nil {
+			return errors.Wrap(err, "write quorum")
+		}
+		if opts.HeartbeatTimeout, err = getEnvDuration("HEARTBEAT_TIMEOUT"); err != nil {
+			return errors.Wrap(err, "heartbeat timeout")
+		}
+		if opts.CapacityReserve, err = getEnvFloat("CAPACITY_RESERVE"); err != nil {
+			return errors.Wrap(err, "capacity reserve")
+		}
+		opts.FailureDomain = os.Getenv("FAILURE_DOMAIN")
+		opts.Chunking.Mode = os.Getenv("CHUNKING")
+		for name, v := range map[string]*int64{
+			"CHUNK_SIZE":     &opts.Chunking.Size,
+			"CHUNK_MIN_SIZE": &opts.Chunking.MinSize,
+			"CHUNK_MAX_SIZE": &opts.Chunking.MaxSize,
+		} {
+			size, err := getEnvInt(name)
+			if err != nil {
+				return errors.Wrap(err, name)
+			}
+			*v = int64(size)
+		}
+		if opts.UploadWindow, err = getEnvInt("UPLOAD_WINDOW"); err != nil {
+			return errors.Wrap(err, "upload window")
+		}
+		uploadMemory, err := getEnvInt("UPLOAD_MEMORY")
+		if err != nil {
+			return errors.Wrap(err, "upload memory")
+		}
+		opts.UploadMemory = int64(uploadMemory)
+		if opts.UploadTTL, err = getEnvDuration("UPLOAD_TTL"); err != nil {
+			return errors.Wrap(err, "upload ttl")
+		}
+		if opts.ReadAhead, err = getEnvInt("READ_AHEAD"); err != nil {
+			return errors.Wrap(err, "read ahead")
+		}
+		readAheadMemory, err := getEnvInt("READ_AHEAD_MEMORY")
+		if err != nil {
+			return errors.Wrap(err, "read ahead memory")
+		}
+		opts.ReadAheadMemory = int64(readAheadMemory)
+		if opts.HedgeQuantile, err = getEnvFloat("HEDGE_QUANTILE"); err != nil {
+			return errors.Wrap(err, "hedge quantile")
+		}
+		if opts.HedgeDelay, err = getEnvDuration("HEDGE_DELAY"); err != nil {
+			return errors.Wrap(err, "hedge delay")
+		}
+		opts.DisableHedging = os.Getenv("DISABLE_HEDGING") == "1"
+		if opts.KeepVersions, err = getEnvInt("KEEP_VERSIONS"); err != nil {
+			return errors.Wrap(err, "keep versions")
+		}
+		if opts.VersionTTL, err = getEnvDuration("VERSION_TTL"); err != nil {
+			return errors.Wrap(err, "version ttl")
+		}
+
 		// Initialize and instrument http server.
-		clientConstructor := front.NewDefaultNodeClientConstructor(httpClient, m.TracerProvider())
-		handler, err := front.NewHandler(ctx, clientConstructor, storage, m.TracerProvider(), m.MeterProvider())
+		var clientOpts node.ClientOptions
+		if clientOpts.Attempts, err = getEnvInt("NODE_ATTEMPTS"); err != nil {
+			return errors.Wrap(err, "node attempts")
+		}
+		if clientOpts.RetryInterval, err = getEnvDuration("NODE_RETRY_INTERVAL"); err != nil {
+			return errors.Wrap(err, "node retry interval")
+		}
+		clientConstructor := front.NewDefaultNodeClientConstructor(httpClient, m.TracerProvider(), clientOpts)
+		handler, err := front.NewHandler(ctx, clientConstructor, storage, m.TracerProvider(), m.MeterProvider(), opts)
 		if err != nil {
 			return errors.Wrap(err, "create handler")
 		}
+
+		// Start background repair of lost chunks.
+		var repairOpts front.RepairOptions
+		if repairOpts.Interval, err = getEnvDuration("REPAIR_INTERVAL"); err != nil {
+			return errors.Wrap(err, "repair interval")
+		}
+		if repairOpts.Rate, err = getEnvInt("REPAIR_RATE"); err != nil {
+			return errors.Wrap(err, "repair rate")
+		}
+		repairer, err := front.NewRepairer(handler, repairOpts, m.TracerProvider(), m.MeterProvider())
+		if err != nil {
+			return errors.Wrap(err, "create repairer")
+		}
+		go func() {
+			if err := repairer.Run(ctx); err != nil && !errors.Is(err, context.Canceled) {
+				lg.Error("Repairer", zap.Error(err))
+			}
+		}()
+
+		// Start background deletion of removed chunks.
+		var collectorOpts front.CollectorOptions
+		if collectorOpts.Interval, err = getEnvDuration("GC_INTERVAL"); err != nil {
+			return errors.Wrap(err, "gc interval")
+		}
+		if collectorOpts.GracePeriod, err = getEnvDuration("GC_GRACE"); err != nil {
+			return errors.Wrap(err, "gc grace")
+		}
+		collector, err := front.NewCollector(handler, collectorOpts, m.TracerProvider(), m.MeterProvider())
+		if err != nil {
+			return errors.Wrap(err, "create collector")
+		}
+		go func() {
+			if err := collector.Run(ctx); err != nil && !errors.Is(err, context.Canceled) {
+				lg.Error("Collector", zap.Error(err))
+			}
+		}()
+
+		// Start background removal of incomplete uploads.
+		var expirerOpts front.UploadExpirerOptions
+		if expirerOpts.Interval, err = getEnvDuration("UPLOAD_EXPIRY_INTERVAL"); err != nil {
+			return errors.Wrap(err, "upload expiry interval")
+		}
+		expirer, err := front.NewUploadExpirer(handler, expirerOpts, m.TracerProvider(), m.MeterProvider())
+		if err != nil {
+			return errors.Wrap(err, "create upload expirer")
+		}
+		go func() {
+			if err := expirer.Run(ctx); err != nil && !errors.Is(err, context.Canceled) {
+				lg.Error("Upload expirer", zap.Error(err))
+			}
+		}()
+
+		// Start background removal of noncurrent versions after VERSION_TTL.
+		var versionExpirerOpts front.VersionExpirerOptions
+		if versionExpirerOpts.Interval, err = getEnvDuration("VERSION_EXPIRY_INTERVAL"); err != nil {
+			return errors.Wrap(err, "version expiry interval")
+		}
+		versionExpirer, err := front.NewVersionExpirer(handler, versionExpirerOpts, m.TracerProvider(), m.MeterProvider())
+		if err != nil {
+			return errors.Wrap(err, "create version expirer")
+		}
+		go func() {
+			if err := versionExpirer.Run(ctx); err != nil && !errors.Is(err, context.Canceled) {
+				lg.Error("Version expirer", zap.Error(err))
+			}
+		}()
+
+		// Start background deletion of chunks that are not recorded.
+		var orphanOpts front.OrphanOptions
+		if orphanOpts.Interval, err = getEnvDuration("ORPHAN_GC_INTERVAL"); err != nil {
+			return errors.Wrap(err, "orphan gc interval")
+		}
+		if orphanOpts.GracePeriod, err = getEnvDuration("ORPHAN_GC_GRACE"); err != nil {
+			return errors.Wrap(err, "orphan gc grace")
+		}
+		orphanOpts.DryRun = os.Getenv("ORPHAN_GC_DRY_RUN") == "1"
+		orphans, err := front.NewOrphanCollector(handler, orphanOpts, m.TracerProvider(), m.MeterProvider())
+		if err != nil {
+			return errors.Wrap(err, "create orphan collector")
+		}
+		handler.Handle("/admin/orphans", orphans)
+		go func() {
+			if err := orphans.Run(ctx); err != nil && !errors.Is(err, context.Canceled) {
+				lg.Error("Orphan collector", zap.Error(err))
+			}
+		}()
+
+		// Rebalancer is started and stopped through admin API.
+		var rebalanceOpts front.RebalanceOptions
+		rebalanceRate, err := getEnvInt("REBALANCE_RATE")
+		if err != nil {
+			return errors.Wrap(err, "rebalance rate")
+		}
+		rebalanceOpts.Rate = int64(rebalanceRate)
+		rebalancer, err := front.NewRebalancer(handler, rebalanceOpts, m.TracerProvider(), m.MeterProvider())
+		if err != nil {
+			return errors.Wrap(err, "create rebalancer")
+		}
+		handler.Handle("/admin/rebalance", rebalancer)
+
+		// S3-compatible API is served on separate address, if set.
+		if addr := os.Getenv("S3_ADDR"); addr != "" {
+			accessKey, secretKey := os.Getenv("S3_ACCESS_KEY"), os.Getenv("S3_SECRET_KEY")
+			if accessKey == "" || secretKey == "" {
+				return errors.New("S3_ACCESS_KEY and S3_SECRET_KEY are required for S3 API")
+			}
+			gateway, err := front.NewS3(handler, front.S3Options{
+				Credentials: map[string]string{accessKey: secretKey},
+				Region:      os.Getenv("S3_REGION"),
+			}, m.TracerProvider(), m.MeterProvider())
+			if err != nil {
+				return errors.Wrap(err, "create s3 gateway")
+			}
+			s3Srv := &http.Server{
+				Addr:              addr,
+				BaseContext:       func(listener net.Listener) context.Context { return ctx },
+				ReadHeaderTimeout: time.Second,
+				Handler: otelhttp.NewHandler(gateway, "http.S3",
+					otelhttp.WithTracerProvider(m.TracerProvider()),
+					otelhttp.WithMeterProvider(m.MeterProvider()),
+					otelhttp.WithPropagators(m.TextMapPropagator()),
+				),
+			}
+			go func() {
+				<-ctx.Done()
+				_ = s3Srv.Shutdown(context.Background())
+			}()
+			go func() {
+				lg.Info("S3 server started", zap.String("addr", s3Srv.Addr))
+				if err := s3Srv.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+					lg.Error("S3 server", zap.Error(err))
+				}
+			}()
+		}
+
 		srv := &http.Server{
 			Addr:              ":8080",
 			BaseContext:       func(listener net.Listener) context.Context { return ctx },
@@ -108,14 +351,34 @@ func main() {
 					switch r.URL.Path {
 					case "/register":
 						return "http.Register"
+					case "/report":
+						return "http.Report"
+					case "/heartbeat":
+						return "http.Heartbeat"
+					case "/admin/nodes":
+						return "http.AdminNodes"
+					case "/admin/nodes/decommission":
+						return "http.Decommission"
+					case "/admin/rebalance":
+						return "http.Rebalance"
 					case "/upload":
 						return "http.Upload"
 					case "/health":
 						return "http.Health"
+					case "/uploads":
+						return "http.CreateUpload"
+					case "/tus":
+						return "http.TusCreate"
 					default:
 						if strings.HasPrefix(r.URL.Path, "/download/") {
 							return "http.Download"
 						}
+						if strings.HasPrefix(r.URL.Path, "/uploads/") {
+							return "http.MultipartUpload"
+						}
+						if strings.HasPrefix(r.URL.Path, "/tus/") {
+							return "http.Tus"
+						}
 						return ""
 					}
 				}),
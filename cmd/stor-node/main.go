@@ -5,6 +5,7 @@ import (
 	"net"
 	"net/http"
 	"os"
+	"strconv"
 	"time"
 
 	"github.com/go-faster/errors"
@@ -16,6 +17,39 @@ import (
 	"github.com/ernado/stor/internal/node"
 )
 
+// getScrubberOptions reads scrubber options from environment.
+func getScrubberOptions() (node.ScrubberOptions, error) {
+	var opts node.ScrubberOptions
+	if v := os.Getenv("SCRUB_RATE"); v != "" {
+		rate, err := strconv.ParseInt(v, 10, 64)
+		if err != nil {
+			return opts, errors.Wrap(err, "parse SCRUB_RATE")
+		}
+		opts.Rate = rate
+	}
+	if v := os.Getenv("SCRUB_INTERVAL"); v != "" {
+		interval, err := time.ParseDuration(v)
+		if err != nil {
+			return opts, errors.Wrap(err, "parse SCRUB_INTERVAL")
+		}
+		opts.Interval = interval
+	}
+	return opts, nil
+}
+
+// getHeartbeatInterval reads heartbeat interval from environment.
+func getHeartbeatInterval() (time.Duration, error) {
+	v := os.Getenv("HEARTBEAT_INTERVAL")
+	if v == "" {
+		return 5 * time.Second, nil
+	}
+	interval, err := time.ParseDuration(v)
+	if err != nil {
+		return 0, errors.Wrap(err, "parse HEARTBEAT_INTERVAL")
+	}
+	return interval, nil
+}
+
 func main() {
 	app.Run(func(ctx context.Context, lg *zap.Logger, m *app.Telemetry) error {
 		ctx = zctx.WithOpenTelemetryZap(ctx)
@@ -54,22 +88,67 @@ func main() {
 			<-ctx.Done()
 			_ = srv.Shutdown(context.Background())
 		}()
-		go func() {
-			// Use instrumented http client to register node in front.
-			httpClient := &http.Client{
-				Transport: otelhttp.NewTransport(http.DefaultTransport,
-					otelhttp.WithTracerProvider(m.TracerProvider()),
-					otelhttp.WithMeterProvider(m.MeterProvider()),
-					otelhttp.WithPropagators(m.TextMapPropagator()),
-					otelhttp.WithSpanNameFormatter(func(operation string, r *http.Request) string {
+		// Use instrumented http client to call front.
+		httpClient := &http.Client{
+			Transport: otelhttp.NewTransport(http.DefaultTransport,
+				otelhttp.WithTracerProvider(m.TracerProvider()),
+				otelhttp.WithMeterProvider(m.MeterProvider()),
+				otelhttp.WithPropagators(m.TextMapPropagator()),
+				otelhttp.WithSpanNameFormatter(func(operation string, r *http.Request) string {
+					switch r.URL.Path {
+					case "/register":
 						return "http.client.Register"
-					}),
-				),
+					case "/report":
+						return "http.client.Report"
+					case "/heartbeat":
+						return "http.client.Heartbeat"
+					default:
+						return ""
+					}
+				}),
+			),
+		}
+		go func() {
+			topology := node.Topology{
+				Zone: os.Getenv("NODE_ZONE"),
+				Rack: os.Getenv("NODE_RACK"),
+				Host: os.Getenv("NODE_HOST"),
 			}
-			if err := node.Register(ctx, httpClient, listenPort); err != nil {
+			if err := node.Register(ctx, httpClient, listenPort, topology); err != nil {
 				lg.Fatal("Register", zap.Error(err))
 			}
 		}()
+
+		baseURL, err := node.BaseURL(listenPort)
+		if err != nil {
+			return errors.Wrap(err, "base url")
+		}
+		heartbeatInterval, err := getHeartbeatInterval()
+		if err != nil {
+			return errors.Wrap(err, "heartbeat interval")
+		}
+		go func() {
+			if err := node.Heartbeat(ctx, httpClient, baseURL, heartbeatInterval, chunks.Status); err != nil && !errors.Is(err, context.Canceled) {
+				lg.Error("Heartbeat", zap.Error(err))
+			}
+		}()
+
+		// Start background integrity checks.
+		scrubberOpts, err := getScrubberOptions()
+		if err != nil {
+			return errors.Wrap(err, "scrubber options")
+		}
+		scrubber, err := node.NewScrubber(chunks, node.NewReporter(httpClient, baseURL), scrubberOpts,
+			m.TracerProvider(), m.MeterProvider(),
+		)
+		if err != nil {
+			return errors.Wrap(err, "init scrubber")
+		}
+		go func() {
+			if err := scrubber.Run(ctx); err != nil && !errors.Is(err, context.Canceled) {
+				lg.Error("Scrubber", zap.Error(err))
+			}
+		}()
 		lg.Info("Server started", zap.String("addr", srv.Addr))
 		if err := srv.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
 			return errors.Wrap(err, "listen and serve")
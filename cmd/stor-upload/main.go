@@ -10,8 +10,10 @@ import (
 	"math/rand"
 	"mime/multipart"
 	"net/http"
+	"net/url"
 	"os"
 	"path/filepath"
+	"strconv"
 	"strings"
 
 	"github.com/dustin/go-humanize"
@@ -30,6 +32,16 @@ type Options struct {
 	RandomPrefix bool
 	Generate     bool
 	GenerateSize string
+	DataShards   int
+	ParityShards int
+	Stream       bool
+	ChunkSize    string
+	Chunking     string
+	Resume       bool
+	Retries      int
+	Multipart    bool
+	PartSize     string
+	Parallel     int
 }
 
 func do(arg Options) error {
@@ -76,15 +88,63 @@ func do(arg Options) error {
 	if err != nil {
 		return errors.Wrap(err, "stat file")
 	}
+	query := url.Values{}
+	if arg.DataShards > 0 || arg.ParityShards > 0 {
+		query.Set("dataShards", strconv.Itoa(arg.DataShards))
+		query.Set("parityShards", strconv.Itoa(arg.ParityShards))
+	}
+	if arg.ChunkSize != "" {
+		chunkSize, err := humanize.ParseBytes(arg.ChunkSize)
+		if err != nil {
+			return errors.Wrap(err, "parse chunk size")
+		}
+		query.Set("chunkSize", strconv.FormatUint(chunkSize, 10))
+	}
+	if arg.Chunking != "" {
+		query.Set("chunking", arg.Chunking)
+	}
 	var uploadedLink string
-	{
+	switch {
+	case arg.Multipart:
+		if query.Has("dataShards") {
+			return errors.New("erasure coding is not supported for multipart upload")
+		}
+		partSize, err := humanize.ParseBytes(arg.PartSize)
+		if err != nil {
+			return errors.Wrap(err, "parse part size")
+		}
+		client := &multipartClient{
+			serverURL: arg.ServerURL,
+			query:     query,
+			partSize:  int64(partSize),
+			parallel:  arg.Parallel,
+		}
+		if uploadedLink, err = client.upload(ctx, name, f, stat.Size()); err != nil {
+			return errors.Wrap(err, "multipart upload")
+		}
+		fmt.Println("uploaded link:", uploadedLink)
+	case arg.Resume:
+		client := &tusClient{serverURL: arg.ServerURL, retries: arg.Retries}
+		if err := client.upload(ctx, name, f, stat.Size()); err != nil {
+			return errors.Wrap(err, "resumable upload")
+		}
+		uploadedLink = arg.ServerURL + "/download/" + url.PathEscape(name)
+		fmt.Println("uploaded link:", uploadedLink)
+	default:
 		ctx, cancel := context.WithCancel(context.Background())
 		defer cancel()
 
 		// Using a pipe to stream multipart form to server.
 		r, w := io.Pipe()
 		g, gCtx := errgroup.WithContext(ctx)
-		req, err := http.NewRequestWithContext(gCtx, http.MethodPost, arg.ServerURL+"/upload", r)
+		uploadURL := arg.ServerURL + "/upload"
+		if arg.Stream {
+			uploadURL = arg.ServerURL + "/files"
+		}
+		if len(query) > 0 {
+			uploadURL += "?" + query.Encode()
+		}
+		req, err := http.NewRequestWithContext(gCtx, http.MethodPost, uploadURL, r)
 		if err != nil {
 			return errors.Wrap(err, "create request")
 		}
@@ -208,6 +268,16 @@ func run() error {
 	flag.BoolVar(&arg.RandomPrefix, "rnd", false, "use random prefix for the file name")
 	flag.StringVar(&arg.GenerateSize, "gen-size", "100M", "generate file of given size")
 	flag.BoolVar(&arg.Generate, "gen", false, "generate random file to temp dir")
+	flag.IntVar(&arg.DataShards, "data-shards", 0, "number of erasure coding data shards (disabled if zero)")
+	flag.IntVar(&arg.ParityShards, "parity-shards", 0, "number of erasure coding parity shards")
+	flag.BoolVar(&arg.Stream, "stream", false, "use streaming upload")
+	flag.StringVar(&arg.ChunkSize, "chunk-size", "", "chunk size (defaults to front setting)")
+	flag.StringVar(&arg.Chunking, "chunking", "", "chunking mode, fixed or cdc (defaults to front setting)")
+	flag.BoolVar(&arg.Resume, "resume", false, "use resumable upload that is continued after failures")
+	flag.IntVar(&arg.Retries, "retries", 10, "number of attempts to resume upload without progress")
+	flag.BoolVar(&arg.Multipart, "multipart", false, "upload parts of file in parallel with multipart upload")
+	flag.StringVar(&arg.PartSize, "part-size", "64M", "part size of multipart upload")
+	flag.IntVar(&arg.Parallel, "parallel", 4, "number of parts of multipart upload that are uploaded at once")
 	flag.Parse()
 
 	for i := 0; i < arg.Count; i++ {
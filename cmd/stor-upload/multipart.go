@@ -0,0 +1,145 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+
+	"github.com/go-faster/errors"
+	"github.com/schollz/progressbar/v3"
+	"golang.org/x/sync/errgroup"
+)
+
+// Maximum number of parts of multipart upload on front.
+const maxParts = 10000
+
+// multipartClient uploads parts of file in parallel with multipart upload.
+type multipartClient struct {
+	serverURL string
+	// Chunking parameters of parts.
+	query    url.Values
+	partSize int64
+	parallel int
+}
+
+func (c *multipartClient) do(req *http.Request, status int) ([]byte, error) {
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, errors.Wrap(err, "do request")
+	}
+	defer func() { _ = resp.Body.Close() }()
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, errors.Wrap(err, "read response")
+	}
+	if resp.StatusCode != status {
+		return nil, errors.Errorf("unexpected status code: %d: %s", resp.StatusCode, strings.TrimSpace(string(data)))
+	}
+	return data, nil
+}
+
+// create initiates upload and returns its id.
+func (c *multipartClient) create(ctx context.Context, name string) (string, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.serverURL+"/uploads?name="+url.QueryEscape(name), http.NoBody)
+	if err != nil {
+		return "", errors.Wrap(err, "create request")
+	}
+	data, err := c.do(req, http.StatusCreated)
+	if err != nil {
+		return "", err
+	}
+	var upload struct {
+		ID string `json:"id"`
+	}
+	if err := json.Unmarshal(data, &upload); err != nil {
+		return "", errors.Wrap(err, "decode upload")
+	}
+	return upload.ID, nil
+}
+
+// part uploads part with number from r.
+func (c *multipartClient) part(ctx context.Context, id string, number int, r io.Reader, size int64) error {
+	u := fmt.Sprintf("%s/uploads/%s/parts/%d", c.serverURL, id, number)
+	if len(c.query) > 0 {
+		u += "?" + c.query.Encode()
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPut, u, r)
+	if err != nil {
+		return errors.Wrap(err, "create request")
+	}
+	req.ContentLength = size
+	_, err = c.do(req, http.StatusOK)
+	return err
+}
+
+// complete publishes file of count parts and returns its link.
+func (c *multipartClient) complete(ctx context.Context, id string, count int) (string, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, fmt.Sprintf("%s/uploads/%s/complete?parts=%d", c.serverURL, id, count), http.NoBody)
+	if err != nil {
+		return "", errors.Wrap(err, "create request")
+	}
+	data, err := c.do(req, http.StatusOK)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(string(data)), nil
+}
+
+// abort removes upload with its parts.
+func (c *multipartClient) abort(ctx context.Context, id string) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodDelete, c.serverURL+"/uploads/"+id, http.NoBody)
+	if err != nil {
+		return errors.Wrap(err, "create request")
+	}
+	_, err = c.do(req, http.StatusNoContent)
+	return err
+}
+
+// upload uploads file by parts of partSize, at most parallel at once, and
+// returns link of uploaded file.
+func (c *multipartClient) upload(ctx context.Context, name string, f *os.File, size int64) (string, error) {
+	if c.partSize <= 0 || c.parallel <= 0 {
+		return "", errors.New("part size and parallelism must be positive")
+	}
+	count := int(max(1, (size+c.partSize-1)/c.partSize))
+	if count > maxParts {
+		return "", errors.Errorf("%d parts exceed limit of %d, increase part size", count, maxParts)
+	}
+	id, err := c.create(ctx, name)
+	if err != nil {
+		return "", errors.Wrap(err, "create upload")
+	}
+
+	bar := progressbar.DefaultBytes(size, "uploading")
+	g, gCtx := errgroup.WithContext(ctx)
+	g.SetLimit(c.parallel)
+	for i := range count {
+		offset := int64(i) * c.partSize
+		partSize := min(c.partSize, size-offset)
+		g.Go(func() error {
+			r := io.TeeReader(io.NewSectionReader(f, offset, partSize), bar)
+			if err := c.part(gCtx, id, i+1, r, partSize); err != nil {
+				return errors.Wrapf(err, "part %d", i+1)
+			}
+			return nil
+		})
+	}
+	err = g.Wait()
+	_ = bar.Close()
+	if err != nil {
+		// Parts that were uploaded are deleted by front.
+		_ = c.abort(ctx, id)
+		return "", err
+	}
+
+	link, err := c.complete(ctx, id, count)
+	if err != nil {
+		return "", errors.Wrap(err, "complete upload")
+	}
+	return link, nil
+}
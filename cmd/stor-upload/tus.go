@@ -0,0 +1,137 @@
+package main
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/go-faster/errors"
+	"github.com/schollz/progressbar/v3"
+)
+
+const tusVersion = "1.0.0"
+
+// tusClient uploads file with tus protocol, so upload that failed can be
+// continued from the last byte stored by server.
+type tusClient struct {
+	serverURL string
+	retries   int
+}
+
+func (c *tusClient) request(ctx context.Context, method, path string, body io.Reader) (*http.Request, error) {
+	req, err := http.NewRequestWithContext(ctx, method, c.serverURL+path, body)
+	if err != nil {
+		return nil, errors.Wrap(err, "create request")
+	}
+	req.Header.Set("Tus-Resumable", tusVersion)
+	return req, nil
+}
+
+// create creates upload and returns its location.
+func (c *tusClient) create(ctx context.Context, name string, size int64) (string, error) {
+	req, err := c.request(ctx, http.MethodPost, "/tus", http.NoBody)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Upload-Length", strconv.FormatInt(size, 10))
+	req.Header.Set("Upload-Metadata", "filename "+base64.StdEncoding.EncodeToString([]byte(name)))
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return "", errors.Wrap(err, "do request")
+	}
+	_ = resp.Body.Close()
+	if resp.StatusCode != http.StatusCreated {
+		return "", errors.Errorf("unexpected status code: %d", resp.StatusCode)
+	}
+	return resp.Header.Get("Location"), nil
+}
+
+// offset returns number of bytes stored by server.
+func (c *tusClient) offset(ctx context.Context, location string) (int64, error) {
+	req, err := c.request(ctx, http.MethodHead, location, http.NoBody)
+	if err != nil {
+		return 0, err
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return 0, errors.Wrap(err, "do request")
+	}
+	_ = resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return 0, errors.Errorf("unexpected status code: %d", resp.StatusCode)
+	}
+	offset, err := strconv.ParseInt(resp.Header.Get("Upload-Offset"), 10, 64)
+	if err != nil {
+		return 0, errors.Wrap(err, "parse offset")
+	}
+	return offset, nil
+}
+
+// patch sends the rest of file starting from offset.
+func (c *tusClient) patch(ctx context.Context, location string, f *os.File, offset, size int64, bar *progressbar.ProgressBar) error {
+	body := io.TeeReader(io.NewSectionReader(f, offset, size-offset), bar)
+	req, err := c.request(ctx, http.MethodPatch, location, body)
+	if err != nil {
+		return err
+	}
+	req.ContentLength = size - offset
+	req.Header.Set("Content-Type", "application/offset+octet-stream")
+	req.Header.Set("Upload-Offset", strconv.FormatInt(offset, 10))
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return errors.Wrap(err, "do request")
+	}
+	_ = resp.Body.Close()
+	if resp.StatusCode != http.StatusNoContent {
+		return errors.Errorf("unexpected status code: %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// upload uploads file, resuming it after failures at most retries times
+// in a row.
+func (c *tusClient) upload(ctx context.Context, name string, f *os.File, size int64) error {
+	location, err := c.create(ctx, name, size)
+	if err != nil {
+		return errors.Wrap(err, "create upload")
+	}
+	bar := progressbar.DefaultBytes(size, "uploading")
+	defer func() { _ = bar.Close() }()
+
+	var (
+		attempt int
+		offset  int64
+	)
+	for {
+		err := c.patch(ctx, location, f, offset, size, bar)
+		if err == nil {
+			return nil
+		}
+		attempt++
+		if attempt > c.retries {
+			return errors.Wrap(err, "upload")
+		}
+		fmt.Printf("\nupload interrupted: %v, resuming\n", err)
+		time.Sleep(time.Second)
+
+		current, err := c.offset(ctx, location)
+		if err != nil {
+			fmt.Printf("get offset: %v\n", err)
+			continue
+		}
+		if current > offset {
+			// Progress was made, so failures are counted again.
+			attempt = 0
+		}
+		offset = current
+		_ = bar.Set64(offset)
+		if offset == size {
+			return nil
+		}
+	}
+}
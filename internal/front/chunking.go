@@ -0,0 +1,206 @@
+package front
+
+import (
+	"crypto/sha256"
+	"math/bits"
+	"net/http"
+	"slices"
+	"strconv"
+
+	"github.com/go-faster/errors"
+	"github.com/google/uuid"
+)
+
+// Chunking modes.
+const (
+	// ChunkingFixed cuts file into chunks of the same size.
+	ChunkingFixed = "fixed"
+	// ChunkingCDC cuts file at content-defined boundaries, and chunks are
+	// addressed by their content, so equal chunks are stored once.
+	ChunkingCDC = "cdc"
+)
+
+// Chunker cuts file into chunks.
+type Chunker interface {
+	// MaxSize returns maximum size of chunk.
+	MaxSize() int64
+	// Cut returns size of the first chunk of data.
+	//
+	// Data holds MaxSize bytes, or less if it is the rest of file.
+	Cut(data []byte) int
+}
+
+// FixedChunker cuts file into chunks of Size bytes, the last chunk can be
+// smaller.
+type FixedChunker struct {
+	Size int64
+}
+
+func (c FixedChunker) MaxSize() int64 {
+	return c.Size
+}
+
+func (c FixedChunker) Cut(data []byte) int {
+	return int(min(int64(len(data)), c.Size))
+}
+
+// CDCChunker cuts file at content-defined boundaries with FastCDC, so
+// inserting or removing data changes only chunks around it.
+//
+// Boundary is found by gear rolling hash. Chunks are at least Min and at
+// most Max bytes, and are about Avg bytes on average.
+type CDCChunker struct {
+	Min int64
+	Avg int64
+	Max int64
+}
+
+// newCDCChunker returns chunker with average chunk size.
+func newCDCChunker(avgSize int64) CDCChunker {
+	return CDCChunker{
+		Min: avgSize / 4,
+		Avg: avgSize,
+		Max: avgSize * 2,
+	}
+}
+
+// gear is the table of random values for gear hash.
+//
+// It is fixed, so the same data is cut into the same chunks by every
+// version of front.
+var gear = func() (out [256]uint64) {
+	// SplitMix64.
+	state := uint64(0x5354_4f52_4344_4300)
+	for i := range out {
+		state += 0x9e3779b97f4a7c15
+		z := state
+		z = (z ^ (z >> 30)) * 0xbf58476d1ce4e5b9
+		z = (z ^ (z >> 27)) * 0x94d049bb133111eb
+		out[i] = z ^ (z >> 31)
+	}
+	return out
+}()
+
+// cdcMask returns mask of n highest bits, which depend on the last 64 bytes
+// of gear hash.
+func cdcMask(n int) uint64 {
+	n = min(max(n, 1), 64)
+	return ^uint64(0) << (64 - n)
+}
+
+func (c CDCChunker) MaxSize() int64 {
+	return c.Max
+}
+
+func (c CDCChunker) Cut(data []byte) int {
+	n := min(int64(len(data)), c.Max)
+	if n <= c.Min {
+		return int(n)
+	}
+	// Normalized chunking: boundary is harder to find before Avg and
+	// easier after it, so chunk sizes are closer to average.
+	var (
+		avgBits = bits.Len64(uint64(c.Avg)) - 1
+		maskS   = cdcMask(avgBits + 2)
+		maskL   = cdcMask(avgBits - 2)
+		normal  = min(c.Avg, n)
+		h       uint64
+		i       = c.Min
+	)
+	for ; i < normal; i++ {
+		h = h<<1 + gear[data[i]]
+		if h&maskS == 0 {
+			return int(i + 1)
+		}
+	}
+	for ; i < n; i++ {
+		h = h<<1 + gear[data[i]]
+		if h&maskL == 0 {
+			return int(i + 1)
+		}
+	}
+	return int(n)
+}
+
+// contentID returns ID of content-addressed chunk with SHA-256 sum.
+func contentID(sum []byte) uuid.UUID {
+	return uuid.NewHash(sha256.New(), uuid.Nil, sum, 8)
+}
+
+// ChunkPolicy configures how files are cut into chunks.
+//
+// For erasure-coded file, chunk is the data of single stripe that is split
+// into DataShards shards.
+type ChunkPolicy struct {
+	// Mode is ChunkingFixed or ChunkingCDC, used for uploads that don't
+	// request other one. Defaults to ChunkingFixed.
+	Mode string
+	// Size is the chunk size of uploads that don't request other one, or
+	// average chunk size for ChunkingCDC. Defaults to 64 MiB.
+	Size int64
+	// MinSize and MaxSize bound chunk size that can be requested by upload.
+	// MinSize defaults to 1 MiB, or to Size if it is smaller. MaxSize
+	// defaults to Size, so upload can't request larger chunks, which take
+	// more memory of front, unless policy allows it.
+	MinSize int64
+	MaxSize int64
+}
+
+var chunkingModes = []string{ChunkingFixed, ChunkingCDC}
+
+func (p *ChunkPolicy) setDefaults() {
+	if p.Mode == "" {
+		p.Mode = ChunkingFixed
+	}
+	if p.Size <= 0 {
+		p.Size = 64 * 1024 * 1024
+	}
+	if p.MinSize <= 0 {
+		p.MinSize = min(1024*1024, p.Size)
+	}
+	if p.MaxSize <= 0 {
+		p.MaxSize = p.Size
+	}
+}
+
+func (p ChunkPolicy) validate() error {
+	if !slices.Contains(chunkingModes, p.Mode) {
+		return errors.Errorf("unknown chunking mode %q", p.Mode)
+	}
+	if p.Size < p.MinSize || p.Size > p.MaxSize {
+		return errors.Errorf("chunk size %d is out of [%d, %d]", p.Size, p.MinSize, p.MaxSize)
+	}
+	return nil
+}
+
+// chunker returns chunker of upload request, that may override chunking
+// mode and chunk size with chunking and chunkSize parameters.
+func (p ChunkPolicy) chunker(r *http.Request) (Chunker, error) {
+	mode := p.Mode
+	if m := r.URL.Query().Get("chunking"); m != "" {
+		if !slices.Contains(chunkingModes, m) {
+			return nil, errors.Errorf("unknown chunking mode %q", m)
+		}
+		mode = m
+	}
+	size := p.Size
+	if s := r.URL.Query().Get("chunkSize"); s != "" {
+		v, err := strconv.ParseInt(s, 10, 64)
+		if err != nil {
+			return nil, errors.Wrap(err, "parse chunkSize")
+		}
+		if v < p.MinSize || v > p.MaxSize {
+			return nil, errors.Errorf("chunkSize %d is out of [%d, %d]", v, p.MinSize, p.MaxSize)
+		}
+		size = v
+	}
+	return newChunker(mode, size), nil
+}
+
+// newChunker returns chunker of mode with chunk size.
+func newChunker(mode string, size int64) Chunker {
+	if mode == ChunkingCDC {
+		return newCDCChunker(size)
+	}
+	return FixedChunker{Size: size}
+}
@@ -0,0 +1,285 @@
+package front
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	noopMeter "go.opentelemetry.io/otel/metric/noop"
+	noopTracer "go.opentelemetry.io/otel/trace/noop"
+)
+
+func TestChunkPolicy(t *testing.T) {
+	var p ChunkPolicy
+	p.setDefaults()
+	require.Equal(t, ChunkPolicy{
+		Mode:    ChunkingFixed,
+		Size:    64 * 1024 * 1024,
+		MinSize: 1024 * 1024,
+		MaxSize: 64 * 1024 * 1024,
+	}, p)
+	require.NoError(t, p.validate())
+
+	p = ChunkPolicy{Size: 1000}
+	p.setDefaults()
+	require.Equal(t, int64(1000), p.MinSize)
+	require.Equal(t, int64(1000), p.MaxSize)
+	require.NoError(t, p.validate())
+	// Upload can't request chunks larger than policy size.
+	_, err := p.chunker(httptest.NewRequest(http.MethodPost, "/upload?chunkSize=1001", http.NoBody))
+	require.Error(t, err)
+
+	require.Error(t, ChunkPolicy{Size: 10, MinSize: 100, MaxSize: 1000}.validate())
+	require.Error(t, ChunkPolicy{Size: 10000, MinSize: 100, MaxSize: 1000}.validate())
+	require.Error(t, ChunkPolicy{Mode: "rabin", Size: 500, MinSize: 100, MaxSize: 1000}.validate())
+
+	p = ChunkPolicy{Mode: ChunkingFixed, Size: 500, MinSize: 100, MaxSize: 1000}
+	for _, tt := range []struct {
+		Query   string
+		Chunker Chunker
+		Error   bool
+	}{
+		{Query: "", Chunker: FixedChunker{Size: 500}},
+		{Query: "chunkSize=100", Chunker: FixedChunker{Size: 100}},
+		{Query: "chunkSize=1000", Chunker: FixedChunker{Size: 1000}},
+		{Query: "chunking=cdc", Chunker: CDCChunker{Min: 125, Avg: 500, Max: 1000}},
+		{Query: "chunking=cdc&chunkSize=800", Chunker: CDCChunker{Min: 200, Avg: 800, Max: 1600}},
+		{Query: "chunkSize=99", Error: true},
+		{Query: "chunkSize=1001", Error: true},
+		{Query: "chunkSize=big", Error: true},
+		{Query: "chunking=rabin", Error: true},
+	} {
+		r := httptest.NewRequest(http.MethodPut, "/files/file.bin?"+tt.Query, http.NoBody)
+		chunker, err := p.chunker(r)
+		if tt.Error {
+			require.Error(t, err, tt.Query)
+			continue
+		}
+		require.NoError(t, err, tt.Query)
+		require.Equal(t, tt.Chunker, chunker, tt.Query)
+	}
+}
+
+// cut cuts data into chunk sizes.
+func cut(chunker Chunker, data []byte) []int {
+	var sizes []int
+	for len(data) > 0 {
+		n := chunker.Cut(data[:min(int64(len(data)), chunker.MaxSize())])
+		sizes = append(sizes, n)
+		data = data[n:]
+	}
+	return sizes
+}
+
+func TestCDCChunker(t *testing.T) {
+	chunker := newCDCChunker(1024)
+	data := randomBytes(t, 256*1024)
+	sizes := cut(chunker, data)
+	var total int
+	for i, n := range sizes {
+		if i < len(sizes)-1 {
+			require.GreaterOrEqual(t, int64(n), chunker.Min)
+		}
+		require.LessOrEqual(t, int64(n), chunker.Max)
+		total += n
+	}
+	require.Equal(t, len(data), total)
+	avg := total / len(sizes)
+	require.InDelta(t, 1024, avg, 512, "average chunk size")
+
+	// Same data is cut at the same boundaries.
+	require.Equal(t, sizes, cut(chunker, data))
+
+	// Inserted data changes only chunks around it.
+	shifted := append(randomBytes(t, 100), data...)
+	boundaries := func(sizes []int, offset int) map[int]bool {
+		out := make(map[int]bool)
+		for _, n := range sizes {
+			offset += n
+			out[offset] = true
+		}
+		return out
+	}
+	var (
+		original = boundaries(sizes, 100)
+		matched  int
+	)
+	for b := range boundaries(cut(chunker, shifted), 0) {
+		if original[b] {
+			matched++
+		}
+	}
+	require.Greater(t, matched, len(sizes)*9/10, "boundaries are not preserved")
+}
+
+func TestHandlerChunking(t *testing.T) {
+	var (
+		ctx   = context.Background()
+		stor  = newInMemoryStorage()
+		nodes = newInMemoryNodes()
+	)
+	_, err := NewHandler(ctx, nodes, stor, noopTracer.NewTracerProvider(), noopMeter.NewMeterProvider(), HandlerOptions{
+		Chunking: ChunkPolicy{Size: 10, MinSize: 100},
+	})
+	require.Error(t, err)
+
+	handler, err := NewHandler(ctx, nodes, stor, noopTracer.NewTracerProvider(), noopMeter.NewMeterProvider(), HandlerOptions{
+		Chunking: ChunkPolicy{Size: 1000, MinSize: 100, MaxSize: 2000},
+	})
+	require.NoError(t, err)
+	server := httptest.NewServer(handler)
+	t.Cleanup(server.Close)
+	registerNodes(t, server, nodes, "node1:8080", "node2:8080", "node3:8080")
+
+	for _, tt := range []struct {
+		Name   string
+		Path   string
+		Size   int
+		Chunks []int64
+	}{
+		{Name: "Default", Path: "/upload", Size: 2500, Chunks: []int64{1000, 1000, 500}},
+		{Name: "Exact", Path: "/upload", Size: 2000, Chunks: []int64{1000, 1000}},
+		{Name: "PerUpload", Path: "/upload?chunkSize=300", Size: 1000, Chunks: []int64{300, 300, 300, 100}},
+		{Name: "Tiny", Path: "/upload", Size: 1, Chunks: []int64{1}},
+		{Name: "Empty", Path: "/upload", Size: 0},
+		{Name: "EmptyErasure", Path: "/upload?dataShards=2&parityShards=1", Size: 0},
+		{Name: "Erasure", Path: "/upload?dataShards=2&parityShards=1&chunkSize=2000", Size: 3000, Chunks: []int64{1000, 1000, 1000, 500, 500, 500}},
+	} {
+		t.Run(tt.Name, func(t *testing.T) {
+			data := randomBytes(t, tt.Size)
+			resp := uploadFileTo(t, server, tt.Path, tt.Name, data)
+			require.Equal(t, http.StatusOK, resp.StatusCode)
+
+			file, err := stor.File(ctx, tt.Name)
+			require.NoError(t, err)
+			require.Equal(t, len(tt.Chunks), file.ChunkCount)
+			var sizes []int64
+			for _, chunk := range file.Chunks {
+				sizes = append(sizes, chunk.Size)
+			}
+			require.Equal(t, tt.Chunks, sizes)
+
+			resp, downloaded, err := downloadFile(t, server, tt.Name)
+			require.NoError(t, err)
+			require.Equal(t, http.StatusOK, resp.StatusCode)
+			require.Equal(t, data, downloaded)
+		})
+	}
+	t.Run("BadChunkSize", func(t *testing.T) {
+		resp := uploadFileTo(t, server, "/upload?chunkSize=10", "bad.bin", randomBytes(t, 100))
+		require.Equal(t, http.StatusBadRequest, resp.StatusCode)
+	})
+	t.Run("ErasureCDC", func(t *testing.T) {
+		resp := uploadFileTo(t, server, "/upload?chunking=cdc&dataShards=2&parityShards=1", "bad.bin", randomBytes(t, 100))
+		require.Equal(t, http.StatusBadRequest, resp.StatusCode)
+	})
+}
+
+func TestHandlerDeduplication(t *testing.T) {
+	var (
+		ctx   = context.Background()
+		stor  = newInMemoryStorage()
+		nodes = newInMemoryNodes()
+	)
+	handler, err := NewHandler(ctx, nodes, stor, noopTracer.NewTracerProvider(), noopMeter.NewMeterProvider(), HandlerOptions{
+		ReplicationFactor: 2,
+		Chunking:          ChunkPolicy{Mode: ChunkingCDC, Size: 1000, MinSize: 100},
+	})
+	require.NoError(t, err)
+	server := httptest.NewServer(handler)
+	t.Cleanup(server.Close)
+	registerNodes(t, server, nodes, "node1:8080", "node2:8080", "node3:8080")
+
+	// Number of chunk replicas on nodes.
+	stored := func() int {
+		var n int
+		for _, node := range nodes.nodes {
+			node.mux.Lock()
+			n += len(node.chunks)
+			node.mux.Unlock()
+		}
+		return n
+	}
+	upload := func(t *testing.T, name string, data []byte) *File {
+		t.Helper()
+		require.Equal(t, http.StatusOK, putFile(t, server, "/files/"+name, data).StatusCode)
+		resp, downloaded, err := downloadFile(t, server, name)
+		require.NoError(t, err)
+		require.Equal(t, http.StatusOK, resp.StatusCode)
+		require.Equal(t, data, downloaded)
+		file, err := stor.File(ctx, name)
+		require.NoError(t, err)
+		return file
+	}
+	collector, err := NewCollector(handler, CollectorOptions{GracePeriod: time.Nanosecond}, noopTracer.NewTracerProvider(), noopMeter.NewMeterProvider())
+	require.NoError(t, err)
+	remove := func(t *testing.T, name string) {
+		t.Helper()
+		require.NoError(t, stor.RemoveFile(ctx, name))
+		require.NoError(t, collector.Collect(ctx))
+	}
+
+	data := randomBytes(t, 20_000)
+	first := upload(t, "first.bin", data)
+	require.Greater(t, len(first.Chunks), 1)
+	replicas := stored()
+	require.Equal(t, 2*len(first.Chunks), replicas)
+
+	// The same content is not written again.
+	second := upload(t, "second.bin", data)
+	require.Equal(t, replicas, stored())
+	for i, chunk := range second.Chunks {
+		require.Equal(t, first.Chunks[i].ID, chunk.ID)
+		require.Equal(t, first.Chunks[i].Nodes, chunk.Nodes)
+	}
+
+	// Edited copy writes only changed chunks.
+	edited := slices.Concat(data[:10_000], []byte("edit"), data[10_000:])
+	third := upload(t, "third.bin", edited)
+	var changed int
+	for _, chunk := range third.Chunks {
+		if !slices.ContainsFunc(first.Chunks, func(c Chunk) bool { return c.ID == chunk.ID }) {
+			changed++
+		}
+	}
+	require.Less(t, changed, len(third.Chunks))
+	require.Equal(t, replicas+2*changed, stored())
+
+	// Chunks are deleted when the last file that references them is removed.
+	remove(t, "first.bin")
+	require.Equal(t, replicas+2*changed, stored())
+	remove(t, "third.bin")
+	require.Equal(t, replicas, stored())
+
+	// Overwrite releases chunks of previous version.
+	upload(t, "second.bin", randomBytes(t, 5000))
+	require.NoError(t, collector.Collect(ctx))
+	require.Less(t, stored(), replicas)
+	remove(t, "second.bin")
+	require.Zero(t, stored())
+
+	// Replicas of released chunks are kept for grace period, so upload that
+	// found chunks stored before they were released can reference them.
+	collector, err = NewCollector(handler, CollectorOptions{GracePeriod: time.Hour}, noopTracer.NewTracerProvider(), noopMeter.NewMeterProvider())
+	require.NoError(t, err)
+	first = upload(t, "first.bin", data)
+	replicas = stored()
+	remove(t, "first.bin")
+	require.Equal(t, replicas, stored())
+	copied := *first
+	copied.Name = "copied.bin"
+	require.NoError(t, stor.AddFile(ctx, copied))
+	handler.now = func() time.Time { return time.Now().Add(2 * time.Hour) }
+	defer func() { handler.now = time.Now }()
+	require.NoError(t, collector.Collect(ctx))
+	require.Equal(t, replicas, stored())
+	_, downloaded, err := downloadFile(t, server, "copied.bin")
+	require.NoError(t, err)
+	require.Equal(t, data, downloaded)
+	remove(t, "copied.bin")
+	require.Zero(t, stored())
+}
@@ -0,0 +1,240 @@
+package front
+
+import (
+	"context"
+	"slices"
+	"time"
+
+	"github.com/go-faster/errors"
+	"github.com/go-faster/sdk/zctx"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/trace"
+	"go.uber.org/zap"
+
+	"github.com/ernado/stor/internal/node"
+)
+
+// CollectorOptions configures Collector.
+type CollectorOptions struct {
+	// Interval between collection passes. Defaults to 30 seconds.
+	Interval time.Duration
+	// BatchSize is the number of garbage replicas that are fetched at once.
+	// Defaults to 1000.
+	BatchSize int
+	// DeleteTimeout limits deletion of single replica. Defaults to 10 seconds.
+	DeleteTimeout time.Duration
+	// GracePeriod is the time after chunk is released when its replicas
+	// are deleted, so upload that found chunk already stored just before
+	// it was released can still reference it. Replica that was written
+	// within grace period is not deleted either, as upload that wrote the
+	// same content can record it. Defaults to 10 minutes.
+	GracePeriod time.Duration
+}
+
+func (o *CollectorOptions) setDefaults() {
+	if o.Interval <= 0 {
+		o.Interval = 30 * time.Second
+	}
+	if o.BatchSize <= 0 {
+		o.BatchSize = 1000
+	}
+	if o.DeleteTimeout <= 0 {
+		o.DeleteTimeout = 10 * time.Second
+	}
+	if o.GracePeriod <= 0 {
+		o.GracePeriod = 10 * time.Minute
+	}
+}
+
+// Collector deletes replicas of chunks that are no longer referenced by any
+// file from nodes.
+//
+// Replica is removed from garbage only after node confirms deletion, so
+// deletion from unavailable node is retried on next passes. Replica that is
+// not to be deleted yet is left for later passes too.
+type Collector struct {
+	h             *Handler
+	interval      time.Duration
+	batchSize     int
+	deleteTimeout time.Duration
+	gracePeriod   time.Duration
+
+	tracer   trace.Tracer
+	replicas metric.Int64Counter
+	passes   metric.Int64Counter
+}
+
+// Collection result attribute values.
+const (
+	collectDeleted = "deleted"
+	collectFailed  = "failed"
+	// Replica was recorded again or its node was removed.
+	collectSkipped = "skipped"
+	// Replica is not to be deleted yet.
+	collectDelayed = "delayed"
+)
+
+func NewCollector(
+	h *Handler,
+	opts CollectorOptions,
+	tracerProvider trace.TracerProvider,
+	meterProvider metric.MeterProvider,
+) (*Collector, error) {
+	opts.setDefaults()
+	const name = "stor.front"
+	c := &Collector{
+		h:             h,
+		interval:      opts.Interval,
+		batchSize:     opts.BatchSize,
+		deleteTimeout: opts.DeleteTimeout,
+		gracePeriod:   opts.GracePeriod,
+		tracer:        tracerProvider.Tracer(name),
+	}
+
+	meter := meterProvider.Meter(name)
+	var err error
+	if c.replicas, err = meter.Int64Counter("gc.replicas"); err != nil {
+		return nil, errors.Wrap(err, "gc.replicas")
+	}
+	if c.passes, err = meter.Int64Counter("gc.passes"); err != nil {
+		return nil, errors.Wrap(err, "gc.passes")
+	}
+
+	return c, nil
+}
+
+// Run collects garbage every interval, or as soon as it is added by
+// handler, until ctx is done.
+func (c *Collector) Run(ctx context.Context) error {
+	ticker := time.NewTicker(c.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		case <-c.h.collect:
+		}
+		if err := c.Collect(ctx); err != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			zctx.From(ctx).Error("Garbage collection failed", zap.Error(err))
+		}
+	}
+}
+
+// Collect makes single pass over all garbage.
+func (c *Collector) Collect(ctx context.Context) (rerr error) {
+	ctx, span := c.tracer.Start(ctx, "Collector.Collect")
+	defer func() {
+		if rerr != nil {
+			span.RecordError(rerr)
+		} else {
+			c.passes.Add(ctx, 1)
+		}
+		span.End()
+	}()
+
+	nodes, err := c.h.storage.Nodes(ctx)
+	if err != nil {
+		return errors.Wrap(err, "nodes")
+	}
+	var after Replica
+	for {
+		replicas, err := c.h.storage.Garbage(ctx, after, c.batchSize)
+		if err != nil {
+			return errors.Wrap(err, "garbage")
+		}
+		for _, replica := range replicas {
+			result, err := c.collect(ctx, replica, nodes)
+			if err != nil {
+				if ctx.Err() != nil {
+					return ctx.Err()
+				}
+				zctx.From(ctx).Warn("Failed to collect replica",
+					zap.String("chunkID", replica.ChunkID.String()),
+					zap.String("node", replica.Node),
+					zap.Error(err),
+				)
+			}
+			c.replicas.Add(ctx, 1, metric.WithAttributes(
+				attribute.String("result", result),
+			))
+		}
+		if len(replicas) < c.batchSize {
+			return nil
+		}
+		after = replicas[len(replicas)-1]
+	}
+}
+
+// collect deletes replica from node and removes it from garbage.
+func (c *Collector) collect(ctx context.Context, replica Replica, nodes []Node) (string, error) {
+	now := c.h.now()
+	if replica.NotBefore.After(now) {
+		return collectDelayed, nil
+	}
+	if !replica.ReleasedAt.IsZero() && replica.ReleasedAt.Add(c.gracePeriod).After(now) {
+		return collectDelayed, nil
+	}
+	result := collectDeleted
+	if slices.ContainsFunc(nodes, func(n Node) bool { return n.BaseURL == replica.Node }) {
+		var err error
+		if result, err = c.delete(ctx, replica, now); err != nil {
+			return collectFailed, err
+		}
+		if result == collectDelayed {
+			return result, nil
+		}
+	} else {
+		// Node was decommissioned.
+		result = collectSkipped
+	}
+	if err := c.h.storage.RemoveGarbage(ctx, replica); err != nil {
+		return collectFailed, errors.Wrap(err, "remove garbage")
+	}
+	return result, nil
+}
+
+// delete deletes replica from node unless it is recorded again.
+//
+// Upload of the same content can write chunk to node and record it at any
+// time, so modification time of chunk is read before replica is checked to
+// be not recorded, and chunk is deleted only if it was not written since.
+func (c *Collector) delete(ctx context.Context, replica Replica, now time.Time) (string, error) {
+	client := c.h.GetClient(replica.Node)
+	statCtx, cancel := context.WithTimeout(ctx, c.deleteTimeout)
+	info, err := client.Stat(statCtx, replica.ChunkID)
+	cancel()
+	switch {
+	case errors.Is(err, node.ErrChunkNotFound):
+		// Already deleted.
+		return collectDeleted, nil
+	case err != nil:
+		return collectFailed, errors.Wrap(err, "stat")
+	case info.ModTime.Add(c.gracePeriod).After(now):
+		// Upload that wrote chunk can be still in progress.
+		return collectDelayed, nil
+	}
+	recorded, err := c.h.storage.ChunkReplicas(ctx, replica.ChunkID)
+	if err != nil {
+		return collectFailed, errors.Wrap(err, "chunk replicas")
+	}
+	if slices.Contains(recorded, replica.Node) {
+		// Chunk with the same content was uploaded again.
+		return collectSkipped, nil
+	}
+	deleteCtx, cancel := context.WithTimeout(ctx, c.deleteTimeout)
+	err = client.DeleteUnmodified(deleteCtx, replica.ChunkID, info.ModTime)
+	cancel()
+	if errors.Is(err, node.ErrChunkModified) {
+		// Written by upload meanwhile.
+		return collectDelayed, nil
+	}
+	if err != nil {
+		return collectFailed, errors.Wrap(err, "delete")
+	}
+	return collectDeleted, nil
+}
@@ -0,0 +1,171 @@
+package front
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	noopMeter "go.opentelemetry.io/otel/metric/noop"
+	noopTracer "go.opentelemetry.io/otel/trace/noop"
+)
+
+func deleteFile(t *testing.T, server *httptest.Server, name string) *http.Response {
+	t.Helper()
+	req, err := http.NewRequest(http.MethodDelete, server.URL+"/files/"+name, http.NoBody)
+	require.NoError(t, err)
+	resp, err := server.Client().Do(req)
+	require.NoError(t, err)
+	_ = resp.Body.Close()
+	return resp
+}
+
+func TestCollector(t *testing.T) {
+	var (
+		ctx   = context.Background()
+		stor  = newInMemoryStorage()
+		nodes = newInMemoryNodes()
+	)
+	handler, err := NewHandler(ctx, nodes, stor, noopTracer.NewTracerProvider(), noopMeter.NewMeterProvider(), HandlerOptions{
+		ReplicationFactor: 2,
+		Chunking:          ChunkPolicy{Size: 1000},
+	})
+	require.NoError(t, err)
+	server := httptest.NewServer(handler)
+	t.Cleanup(server.Close)
+	registerNodes(t, server, nodes, "node1:8080", "node2:8080", "node3:8080")
+	collector, err := NewCollector(handler, CollectorOptions{BatchSize: 2, GracePeriod: time.Nanosecond}, noopTracer.NewTracerProvider(), noopMeter.NewMeterProvider())
+	require.NoError(t, err)
+
+	// Number of chunk replicas on node.
+	stored := func(baseURL string) int {
+		node := nodes.nodes[baseURL]
+		node.mux.Lock()
+		defer node.mux.Unlock()
+		return len(node.chunks)
+	}
+	garbage := func() []Replica {
+		replicas, err := stor.Garbage(ctx, Replica{}, 100)
+		require.NoError(t, err)
+		return replicas
+	}
+
+	t.Run("NotFound", func(t *testing.T) {
+		require.Equal(t, http.StatusNotFound, deleteFile(t, server, "missing.bin").StatusCode)
+	})
+	t.Run("Retry", func(t *testing.T) {
+		require.Equal(t, http.StatusOK, putFile(t, server, "/files/file.bin", randomBytes(t, 3000)).StatusCode)
+		file, err := stor.File(ctx, "file.bin")
+		require.NoError(t, err)
+
+		require.Equal(t, http.StatusAccepted, deleteFile(t, server, "file.bin").StatusCode)
+		resp, _, err := downloadFile(t, server, "file.bin")
+		require.NoError(t, err)
+		require.NotEqual(t, http.StatusOK, resp.StatusCode)
+		// Chunks are deleted in background.
+		require.Len(t, garbage(), 2*len(file.Chunks))
+
+		down := nodes.nodes["node1:8080"]
+		down.setDown(true)
+		require.NoError(t, collector.Collect(ctx))
+		require.Zero(t, stored("node2:8080"))
+		require.Zero(t, stored("node3:8080"))
+		require.NotZero(t, stored("node1:8080"))
+		for _, replica := range garbage() {
+			require.Equal(t, "node1:8080", replica.Node)
+		}
+
+		down.setDown(false)
+		require.NoError(t, collector.Collect(ctx))
+		require.Zero(t, stored("node1:8080"))
+		require.Empty(t, garbage())
+	})
+	t.Run("Delayed", func(t *testing.T) {
+		require.Equal(t, http.StatusOK, putFile(t, server, "/files/moved.bin", randomBytes(t, 500)).StatusCode)
+		file, err := stor.File(ctx, "moved.bin")
+		require.NoError(t, err)
+		chunk := file.Chunks[0]
+		from := chunk.Nodes[0]
+		var to string
+		for baseURL := range nodes.nodes {
+			if !slices.Contains(chunk.Nodes, baseURL) {
+				to = baseURL
+			}
+		}
+		before := stored(from)
+		deleteAt := time.Now().Add(time.Hour)
+		require.NoError(t, stor.MoveReplica(ctx, chunk, from, to, deleteAt))
+
+		require.NoError(t, collector.Collect(ctx))
+		require.Equal(t, before, stored(from), "moved replica should not be deleted before delay")
+		require.Len(t, garbage(), 1)
+
+		handler.now = func() time.Time { return deleteAt.Add(time.Second) }
+		defer func() { handler.now = time.Now }()
+		require.NoError(t, collector.Collect(ctx))
+		require.Equal(t, before-1, stored(from), "moved replica should be deleted after delay")
+		require.Empty(t, garbage())
+
+		require.Equal(t, http.StatusAccepted, deleteFile(t, server, "moved.bin").StatusCode)
+		require.NoError(t, collector.Collect(ctx))
+		require.Empty(t, garbage())
+	})
+	t.Run("Interleaved", func(t *testing.T) {
+		data := randomBytes(t, 500)
+		require.Equal(t, http.StatusOK, putFile(t, server, "/files/same.bin", data).StatusCode)
+		file, err := stor.File(ctx, "same.bin")
+		require.NoError(t, err)
+		chunk := file.Chunks[0]
+		require.Equal(t, http.StatusAccepted, deleteFile(t, server, "same.bin").StatusCode)
+
+		// Upload of the same content writes and records chunk after
+		// collector checked that it is not recorded.
+		target := nodes.nodes[chunk.Nodes[0]]
+		target.mux.Lock()
+		target.beforeDelete = func() {
+			_, err := target.Write(ctx, chunk.ID, bytes.NewReader(data), nil)
+			require.NoError(t, err)
+			again := *file
+			again.Name = "again.bin"
+			again.Chunks = []Chunk{chunk}
+			again.Chunks[0].Nodes = []string{target.BaseURL()}
+			require.NoError(t, stor.AddFile(ctx, again))
+		}
+		target.mux.Unlock()
+
+		require.NoError(t, collector.Collect(ctx))
+		require.Empty(t, garbage())
+		resp, got, err := downloadFile(t, server, "again.bin")
+		require.NoError(t, err)
+		require.Equal(t, http.StatusOK, resp.StatusCode)
+		require.Equal(t, data, got, "chunk written by upload should be kept")
+
+		require.Equal(t, http.StatusAccepted, deleteFile(t, server, "again.bin").StatusCode)
+		require.NoError(t, collector.Collect(ctx))
+		require.Empty(t, garbage())
+	})
+	t.Run("Run", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(ctx)
+		defer cancel()
+		collector, err := NewCollector(handler, CollectorOptions{Interval: time.Hour, GracePeriod: time.Nanosecond}, noopTracer.NewTracerProvider(), noopMeter.NewMeterProvider())
+		require.NoError(t, err)
+		done := make(chan error, 1)
+		go func() { done <- collector.Run(ctx) }()
+
+		require.Equal(t, http.StatusOK, putFile(t, server, "/files/file.bin", randomBytes(t, 3000)).StatusCode)
+		require.Equal(t, http.StatusAccepted, deleteFile(t, server, "file.bin").StatusCode)
+		require.Eventually(t, func() bool {
+			return len(garbage()) == 0
+		}, 5*time.Second, 10*time.Millisecond)
+		for baseURL := range nodes.nodes {
+			require.Zero(t, stored(baseURL), baseURL)
+		}
+
+		cancel()
+		require.ErrorIs(t, <-done, context.Canceled)
+	})
+}
@@ -0,0 +1,356 @@
+package front
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"slices"
+	"time"
+
+	"github.com/go-faster/errors"
+	"github.com/go-faster/sdk/zctx"
+	"github.com/google/uuid"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/trace"
+	"go.uber.org/zap"
+)
+
+// Drain states.
+const (
+	DrainRunning = "running"
+	DrainDone    = "done"
+	DrainFailed  = "failed"
+)
+
+// DrainProgress describes progress of node decommissioning.
+type DrainProgress struct {
+	BaseURL string `json:"baseURL"`
+	State   string `json:"state"`
+	// Total is the number of chunks to move, including already moved.
+	Total  int `json:"total"`
+	Moved  int `json:"moved"`
+	Failed int `json:"failed"`
+	// Garbage is the number of moved chunks that are not deleted from
+	// node yet.
+	Garbage    int        `json:"garbage"`
+	Error      string     `json:"error,omitempty"`
+	StartedAt  time.Time  `json:"startedAt"`
+	FinishedAt *time.Time `json:"finishedAt,omitempty"`
+}
+
+// Drain result attribute values.
+const (
+	drainMoved  = "moved"
+	drainFailed = "failed"
+)
+
+// drainProgress returns copy of progress of node drain.
+func (h *Handler) drainProgress(baseURL string) (DrainProgress, bool) {
+	h.drainsMux.Lock()
+	defer h.drainsMux.Unlock()
+	p, ok := h.drains[baseURL]
+	if !ok {
+		return DrainProgress{}, false
+	}
+	return *p, true
+}
+
+// updateDrain updates progress of node drain.
+func (h *Handler) updateDrain(baseURL string, f func(p *DrainProgress)) {
+	h.drainsMux.Lock()
+	defer h.drainsMux.Unlock()
+	f(h.drains[baseURL])
+}
+
+// startDrain starts draining node in background, unless it is already
+// running.
+func (h *Handler) startDrain(baseURL string) bool {
+	h.drainsMux.Lock()
+	defer h.drainsMux.Unlock()
+	if p, ok := h.drains[baseURL]; ok && p.State == DrainRunning {
+		return false
+	}
+	h.drains[baseURL] = &DrainProgress{
+		BaseURL:   baseURL,
+		State:     DrainRunning,
+		StartedAt: h.now(),
+	}
+
+	// Use baseCtx as drain outlives request.
+	ctx := h.baseCtx
+	go func() {
+		err := h.Decommission(ctx, baseURL)
+		h.updateDrain(baseURL, func(p *DrainProgress) {
+			finished := h.now()
+			p.FinishedAt = &finished
+			p.State = DrainDone
+			if err != nil {
+				p.State = DrainFailed
+				p.Error = err.Error()
+			}
+		})
+		if err != nil {
+			zctx.From(ctx).Error("Failed to decommission node",
+				zap.String("node", baseURL),
+				zap.Error(err),
+			)
+			return
+		}
+		zctx.From(ctx).Info("Decommissioned node", zap.String("node", baseURL))
+	}()
+
+	return true
+}
+
+// Decommission marks node as draining, so it is no longer selected for new
+// chunks, moves every chunk replica from it to other nodes and removes node
+// once it is empty.
+//
+// Node is kept draining if some chunks can't be moved, so decommission can
+// be retried. Moved chunks are deleted from node by Collector after move
+// delete delay, so downloads that read them are not broken, and Collector
+// skips garbage of removed nodes, so node is removed only after moved chunks
+// are deleted. Chunks are left on node only if it is not up.
+func (h *Handler) Decommission(ctx context.Context, baseURL string) (rerr error) {
+	ctx, span := h.tracer.Start(ctx, "Handler.Decommission",
+		trace.WithAttributes(attribute.String("node", baseURL)),
+	)
+	defer func() {
+		if rerr != nil {
+			span.RecordError(rerr)
+		}
+		span.End()
+	}()
+
+	if err := h.storage.SetNodeDraining(ctx, baseURL, true); err != nil {
+		return errors.Wrap(err, "set draining")
+	}
+	// Chunks that were uploaded concurrently with setting draining flag
+	// are picked up by next pass.
+	for {
+		h.updateDrain(baseURL, func(p *DrainProgress) {
+			if p != nil {
+				p.Total = p.Moved
+				p.Failed = 0
+			}
+		})
+		var (
+			after         uuid.UUID
+			total, failed int
+		)
+		// Moved chunks no longer have replica on node, so pages that
+		// follow are not shifted.
+		for {
+			chunks, err := h.storage.NodeReplicas(ctx, baseURL, after, h.drainPageSize)
+			if err != nil {
+				return errors.Wrap(err, "node replicas")
+			}
+			total += len(chunks)
+			h.updateDrain(baseURL, func(p *DrainProgress) {
+				if p != nil {
+					p.Total += len(chunks)
+				}
+			})
+			failed += h.drainChunks(ctx, baseURL, chunks)
+			if len(chunks) < h.drainPageSize {
+				break
+			}
+			after = chunks[len(chunks)-1].ID
+		}
+		if failed > 0 {
+			return errors.Errorf("failed to move %d of %d chunks", failed, total)
+		}
+		if total == 0 {
+			break
+		}
+	}
+	if err := h.waitGarbage(ctx, baseURL); err != nil {
+		return errors.Wrap(err, "wait garbage")
+	}
+	if err := h.storage.RemoveNode(ctx, baseURL); err != nil {
+		return errors.Wrap(err, "remove node")
+	}
+
+	h.mux.Lock()
+	delete(h.clients, baseURL)
+	h.mux.Unlock()
+
+	return nil
+}
+
+// waitGarbage waits until Collector deletes chunks that were moved from node.
+// Chunks can't be deleted from node that is not up, so they are left on it.
+func (h *Handler) waitGarbage(ctx context.Context, baseURL string) error {
+	ticker := time.NewTicker(h.drainCheck)
+	defer ticker.Stop()
+	for {
+		garbage, err := h.storage.NodeGarbage(ctx, baseURL)
+		if err != nil {
+			return errors.Wrap(err, "node garbage")
+		}
+		h.updateDrain(baseURL, func(p *DrainProgress) {
+			if p != nil {
+				p.Garbage = garbage
+			}
+		})
+		if garbage == 0 {
+			return nil
+		}
+		stats, err := h.storage.NodeStats(ctx)
+		if err != nil {
+			return errors.Wrap(err, "node stats")
+		}
+		if !slices.ContainsFunc(stats, func(stat NodeStat) bool {
+			return stat.BaseURL == baseURL && h.alive(stat)
+		}) {
+			zctx.From(ctx).Warn("Leaving moved chunks on node that is not up",
+				zap.String("node", baseURL),
+				zap.Int("chunks", garbage),
+			)
+			return nil
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+// drainChunks moves chunks from node to least filled nodes that don't have
+// them, returning number of chunks that failed to move.
+func (h *Handler) drainChunks(ctx context.Context, baseURL string, chunks []Chunk) int {
+	var failed int
+	for _, chunk := range chunks {
+		if ctx.Err() != nil {
+			return failed + 1
+		}
+		// Stats are refreshed for every chunk, as nodes can leave or
+		// become full while draining.
+		stats, err := h.liveNodeStats(ctx)
+		if err == nil {
+			err = h.moveChunk(ctx, chunk, baseURL, stats)
+		}
+		result := drainMoved
+		if err != nil {
+			result = drainFailed
+			failed++
+			zctx.From(ctx).Error("Failed to move chunk",
+				zap.String("chunkID", chunk.ID.String()),
+				zap.String("node", baseURL),
+				zap.Error(err),
+			)
+		}
+		h.drainedChunks.Add(ctx, 1, metric.WithAttributes(
+			attribute.String("result", result),
+		))
+		h.updateDrain(baseURL, func(p *DrainProgress) {
+			if p == nil {
+				return
+			}
+			if err != nil {
+				p.Failed++
+			} else {
+				p.Moved++
+			}
+		})
+	}
+	return failed
+}
+
+// moveChunk copies chunk to least filled node that doesn't have it and
+// moves replica from node to it. Chunk is deleted from node like moved by
+// Rebalancer.
+func (h *Handler) moveChunk(ctx context.Context, chunk Chunk, from string, stats []NodeStat) error {
+	candidates := slices.DeleteFunc(slices.Clone(stats), func(stat NodeStat) bool {
+		return slices.Contains(chunk.Nodes, stat.BaseURL) || !h.fits(stat, chunk.Size)
+	})
+	if len(candidates) == 0 {
+		return ErrNoNodes
+	}
+	// Keep replicas in distinct failure domains if possible.
+	others := slices.DeleteFunc(slices.Clone(chunk.Nodes), func(n string) bool { return n == from })
+	candidates = h.spread(candidates, stats, others)
+	target := h.selectLeastFilledNodes(candidates, 1)[0]
+	return h.moveReplica(ctx, chunk, from, target.BaseURL, h.preferReplica(ctx, chunk, from))
+}
+
+// preferReplica returns source that reads chunk from replica on node,
+// falling back to other replicas if it is not available.
+func (h *Handler) preferReplica(ctx context.Context, chunk Chunk, node string) func(w io.Writer) error {
+	src := chunk
+	src.Nodes = append([]string{node}, slices.DeleteFunc(slices.Clone(chunk.Nodes), func(n string) bool {
+		return n == node
+	})...)
+	return func(w io.Writer) error {
+		return h.readReplicas(ctx, src, 0, src.Size, w)
+	}
+}
+
+// moveReplica writes chunk produced by source to node to and atomically
+// moves replica of chunk from node from to it in metadata.
+//
+// Chunk is not deleted from node from, its replica is moved to garbage
+// that is deleted by Collector after move delete delay.
+func (h *Handler) moveReplica(ctx context.Context, chunk Chunk, from, to string, source func(w io.Writer) error) error {
+	client := h.GetClient(to)
+	written, err := h.copyChunk(ctx, chunk, client, source)
+	if err != nil {
+		return errors.Wrapf(err, "copy to %s", to)
+	}
+	if err := h.storage.MoveReplica(ctx, chunk, from, to, h.now().Add(h.moveDeleteDelay)); err != nil {
+		if deleteErr := h.deleteWritten(ctx, client, chunk.ID, written); deleteErr != nil {
+			zctx.From(ctx).Warn("Failed to delete chunk",
+				zap.String("chunkID", chunk.ID.String()),
+				zap.Error(deleteErr),
+			)
+		}
+		return errors.Wrap(err, "move replica")
+	}
+	return nil
+}
+
+// decommission starts decommissioning of node on POST and returns its
+// progress on GET.
+func (h *Handler) decommission(w http.ResponseWriter, r *http.Request) {
+	ctx, span := h.tracer.Start(r.Context(), "handler.Decommission")
+	defer span.End()
+
+	baseURL := r.URL.Query().Get("baseURL")
+	if baseURL == "" {
+		httpError(w, "baseURL is required", http.StatusBadRequest)
+		return
+	}
+	switch r.Method {
+	case http.MethodGet:
+	case http.MethodPost:
+		nodes, err := h.storage.Nodes(ctx)
+		if err != nil {
+			writeError(w, err)
+			return
+		}
+		if !slices.ContainsFunc(nodes, func(n Node) bool { return n.BaseURL == baseURL }) {
+			httpError(w, "node not found", http.StatusNotFound)
+			return
+		}
+		if h.startDrain(baseURL) {
+			zctx.From(ctx).Info("Decommissioning node", zap.String("node", baseURL))
+		}
+	default:
+		httpError(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	progress, ok := h.drainProgress(baseURL)
+	if !ok {
+		httpError(w, "node is not decommissioned", http.StatusNotFound)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if r.Method == http.MethodPost {
+		w.WriteHeader(http.StatusAccepted)
+	}
+	_ = json.NewEncoder(w).Encode(progress)
+}
@@ -0,0 +1,212 @@
+package front
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	noopMeter "go.opentelemetry.io/otel/metric/noop"
+	noopTracer "go.opentelemetry.io/otel/trace/noop"
+
+	"github.com/ernado/stor/internal/node"
+)
+
+// startDecommission starts decommissioning of node.
+func startDecommission(t *testing.T, server *httptest.Server, baseURL string) {
+	t.Helper()
+	u := server.URL + "/admin/nodes/decommission?" + url.Values{"baseURL": {baseURL}}.Encode()
+	resp, err := server.Client().Post(u, "", http.NoBody)
+	require.NoError(t, err)
+	_ = resp.Body.Close()
+	require.Equal(t, http.StatusAccepted, resp.StatusCode)
+}
+
+// drainProgress returns progress of node decommissioning.
+func drainProgress(t *testing.T, server *httptest.Server, baseURL string) DrainProgress {
+	t.Helper()
+	u := server.URL + "/admin/nodes/decommission?" + url.Values{"baseURL": {baseURL}}.Encode()
+	resp, err := server.Client().Get(u)
+	require.NoError(t, err)
+	defer func() { _ = resp.Body.Close() }()
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	var progress DrainProgress
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&progress))
+	return progress
+}
+
+// decommissionNode starts decommissioning of node and waits until it is
+// finished.
+func decommissionNode(t *testing.T, server *httptest.Server, baseURL string) DrainProgress {
+	t.Helper()
+	startDecommission(t, server, baseURL)
+	var progress DrainProgress
+	require.Eventually(t, func() bool {
+		progress = drainProgress(t, server, baseURL)
+		return progress.State != DrainRunning
+	}, 5*time.Second, 10*time.Millisecond)
+	return progress
+}
+
+// runCollector runs collector in background until test is finished.
+func runCollector(t *testing.T, collector *Collector) {
+	t.Helper()
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		_ = collector.Run(ctx)
+	}()
+	t.Cleanup(func() {
+		cancel()
+		<-done
+	})
+}
+
+func TestHandlerDecommission(t *testing.T) {
+	ctx := context.Background()
+	newServer := func(t *testing.T) (*httptest.Server, *inMemoryStorage, *inMemoryNodes, *Collector) {
+		t.Helper()
+		var (
+			stor  = newInMemoryStorage()
+			nodes = newInMemoryNodes()
+		)
+		handler, err := NewHandler(ctx, nodes, stor, noopTracer.NewTracerProvider(), noopMeter.NewMeterProvider(), HandlerOptions{
+			ReplicationFactor: 2,
+			// Chunks are drained page by page.
+			DrainPageSize:      1,
+			DrainCheckInterval: time.Millisecond,
+			MoveDeleteDelay:    time.Nanosecond,
+		})
+		require.NoError(t, err)
+		collector, err := NewCollector(handler, CollectorOptions{
+			Interval:    10 * time.Millisecond,
+			GracePeriod: time.Nanosecond,
+		}, noopTracer.NewTracerProvider(), noopMeter.NewMeterProvider())
+		require.NoError(t, err)
+		server := httptest.NewServer(handler)
+		t.Cleanup(server.Close)
+		return server, stor, nodes, collector
+	}
+
+	t.Run("Drain", func(t *testing.T) {
+		server, stor, nodes, collector := newServer(t)
+		registerNodes(t, server, nodes, "node1:8080", "node2:8080", "node3:8080")
+		data := randomBytes(t, 4096)
+		require.Equal(t, http.StatusOK, uploadFile(t, server, "drain.bin", data).StatusCode)
+		erasureData := randomBytes(t, 3000)
+		require.Equal(t, http.StatusOK, uploadFileTo(t, server, "/upload?dataShards=1&parityShards=1", "erasure.bin", erasureData).StatusCode)
+
+		// Node is kept until moved chunks are deleted from it, as garbage
+		// of removed node is not collected.
+		startDecommission(t, server, "node1:8080")
+		require.Eventually(t, func() bool {
+			return drainProgress(t, server, "node1:8080").Garbage > 0
+		}, 5*time.Second, 10*time.Millisecond)
+		nodeList, err := stor.Nodes(ctx)
+		require.NoError(t, err)
+		require.Len(t, nodeList, 3)
+		require.NotEmpty(t, nodes.nodes["node1:8080"].chunks)
+
+		require.NoError(t, collector.Collect(ctx))
+		var progress DrainProgress
+		require.Eventually(t, func() bool {
+			progress = drainProgress(t, server, "node1:8080")
+			return progress.State != DrainRunning
+		}, 5*time.Second, 10*time.Millisecond)
+		require.Equal(t, DrainDone, progress.State, progress.Error)
+		require.Positive(t, progress.Total)
+		require.Equal(t, progress.Total, progress.Moved)
+		require.Zero(t, progress.Garbage)
+		require.NotNil(t, progress.FinishedAt)
+
+		nodeList, err = stor.Nodes(ctx)
+		require.NoError(t, err)
+		require.Len(t, nodeList, 2)
+		require.Empty(t, nodes.nodes["node1:8080"].chunks)
+		garbage, err := stor.Garbage(ctx, Replica{}, 100)
+		require.NoError(t, err)
+		require.Empty(t, garbage)
+		for _, name := range []string{"drain.bin", "erasure.bin"} {
+			file, err := stor.File(ctx, name)
+			require.NoError(t, err)
+			for _, chunk := range file.Chunks {
+				require.NotContains(t, chunk.Nodes, "node1:8080")
+			}
+		}
+		requireHealthy(t, stor, nodes, "drain.bin", 2)
+
+		// Data is readable after drained node is gone.
+		nodes.nodes["node1:8080"].setDown(true)
+		resp, body, err := downloadFile(t, server, "drain.bin")
+		require.NoError(t, err)
+		require.Equal(t, http.StatusOK, resp.StatusCode)
+		require.Equal(t, data, body)
+
+		// Heartbeat does not bring decommissioned node back.
+		resp = sendHeartbeat(t, server, "node1:8080", node.Status{State: node.StateOK})
+		require.Equal(t, http.StatusNotFound, resp.StatusCode)
+	})
+	t.Run("DeadNode", func(t *testing.T) {
+		server, stor, nodes, _ := newServer(t)
+		registerNodes(t, server, nodes, "node1:8080", "node2:8080")
+		data := randomBytes(t, 4096)
+		require.Equal(t, http.StatusOK, uploadFile(t, server, "drain.bin", data).StatusCode)
+		registerNodes(t, server, nodes, "node3:8080")
+
+		// Chunks are copied from other replicas, and are left on node that
+		// is not up.
+		nodes.nodes["node1:8080"].setDown(true)
+		resp := sendHeartbeat(t, server, "node1:8080", node.Status{State: node.StateUnhealthy})
+		require.Equal(t, http.StatusOK, resp.StatusCode)
+		progress := decommissionNode(t, server, "node1:8080")
+		require.Equal(t, DrainDone, progress.State, progress.Error)
+		require.Positive(t, progress.Garbage)
+		requireHealthy(t, stor, nodes, "drain.bin", 2)
+	})
+	t.Run("Failed", func(t *testing.T) {
+		server, stor, nodes, collector := newServer(t)
+		registerNodes(t, server, nodes, "node1:8080", "node2:8080")
+		require.Equal(t, http.StatusOK, uploadFile(t, server, "drain.bin", randomBytes(t, 4096)).StatusCode)
+
+		// Every chunk is already on the only other node.
+		progress := decommissionNode(t, server, "node1:8080")
+		require.Equal(t, DrainFailed, progress.State)
+		require.NotEmpty(t, progress.Error)
+		require.Equal(t, progress.Total, progress.Failed)
+
+		// Node is kept, but is not selected for new chunks.
+		nodeList, err := stor.Nodes(ctx)
+		require.NoError(t, err)
+		require.Len(t, nodeList, 2)
+		registerNodes(t, server, nodes, "node3:8080")
+		require.Equal(t, http.StatusOK, uploadFile(t, server, "new.bin", randomBytes(t, 4096)).StatusCode)
+		file, err := stor.File(ctx, "new.bin")
+		require.NoError(t, err)
+		for _, chunk := range file.Chunks {
+			require.NotContains(t, chunk.Nodes, "node1:8080")
+		}
+
+		// Retry succeeds once there is a place for chunks.
+		runCollector(t, collector)
+		progress = decommissionNode(t, server, "node1:8080")
+		require.Equal(t, DrainDone, progress.State, progress.Error)
+	})
+	t.Run("NotFound", func(t *testing.T) {
+		server, _, _, _ := newServer(t)
+		u := server.URL + "/admin/nodes/decommission?baseURL=node1:8080"
+		resp, err := server.Client().Post(u, "", http.NoBody)
+		require.NoError(t, err)
+		_ = resp.Body.Close()
+		require.Equal(t, http.StatusNotFound, resp.StatusCode)
+
+		resp, err = server.Client().Get(u)
+		require.NoError(t, err)
+		_ = resp.Body.Close()
+		require.Equal(t, http.StatusNotFound, resp.StatusCode)
+	})
+}
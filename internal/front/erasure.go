@@ -0,0 +1,273 @@
+package front
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net/http"
+	"strconv"
+	"sync"
+
+	"github.com/go-faster/errors"
+	"github.com/go-faster/sdk/zctx"
+	"github.com/google/uuid"
+	"github.com/klauspost/reedsolomon"
+	"go.uber.org/zap"
+	"golang.org/x/sync/errgroup"
+)
+
+// Erasure reports whether file is erasure-coded.
+func (f *File) Erasure() bool {
+	return f.DataShards > 0
+}
+
+// stripeWidth is the number of shards in a single stripe.
+func (f *File) stripeWidth() int {
+	return f.DataShards + f.ParityShards
+}
+
+// isParity reports whether chunk is a parity shard.
+func (f *File) isParity(c Chunk) bool {
+	return f.Erasure() && c.Index%f.stripeWidth() >= f.DataShards
+}
+
+// dataChunks returns chunks with file data in order, skipping parity shards.
+func (f *File) dataChunks() []Chunk {
+	if !f.Erasure() {
+		return f.Chunks
+	}
+	var out []Chunk
+	for _, c := range f.Chunks {
+		if !f.isParity(c) {
+			out = append(out, c)
+		}
+	}
+	return out
+}
+
+// stripe returns all data and parity shards of stripe that contains chunk.
+//
+// Chunks are laid out stripe by stripe: first DataShards data chunks,
+// then ParityShards parity chunks.
+func (f *File) stripe(c Chunk) []Chunk {
+	start := c.Index / f.stripeWidth() * f.stripeWidth()
+	return f.Chunks[start : start+f.stripeWidth()]
+}
+
+// parseErasure parses erasure coding parameters of upload request.
+//
+// Zero values mean that erasure coding is not requested.
+func parseErasure(r *http.Request) (dataShards, parityShards int, err error) {
+	q := r.URL.Query()
+	if q.Get("dataShards") == "" && q.Get("parityShards") == "" {
+		return 0, 0, nil
+	}
+	if dataShards, err = strconv.Atoi(q.Get("dataShards")); err != nil {
+		return 0, 0, errors.Wrap(err, "parse dataShards")
+	}
+	if parityShards, err = strconv.Atoi(q.Get("parityShards")); err != nil {
+		return 0, 0, errors.Wrap(err, "parse parityShards")
+	}
+	if dataShards < 1 || parityShards < 1 {
+		return 0, 0, errors.New("dataShards and parityShards should be positive")
+	}
+	const maxShards = 256 // GF(2^8) limit
+	if dataShards+parityShards > maxShards {
+		return 0, 0, errors.Errorf("too many shards: %d > %d", dataShards+parityShards, maxShards)
+	}
+	return dataShards, parityShards, nil
+}
+
+// writeErasure cuts r into stripes, splits every stripe into DataShards
+// data chunks, computes ParityShards parity chunks and writes all of them to
+// distinct nodes while next stripes are read.
+//
+// Returns clients that were used for every chunk for cleanup.
+func (h *Handler) writeErasure(ctx context.Context, r io.Reader, chunker Chunker, file *File) ([][]replicaWrite, error) {
+	k, m := file.DataShards, file.ParityShards
+	enc, err := reedsolomon.New(k, m)
+	if err != nil {
+		return nil, errors.Wrap(err, "create encoder")
+	}
+
+	var (
+		maxShardSize = (chunker.MaxSize() + int64(k) - 1) / int64(k)
+		// Parity shards are stored in buffer after data ones.
+		cw      = h.newChunkWriter(ctx, int64(k+m)*maxShardSize)
+		p       *placer
+		targets [][]replicaWrite
+		// Chunks are appended by reader and completed by background writes.
+		chunksMux sync.Mutex
+		chunks    []Chunk
+	)
+	err = cw.read(r, chunker, func(buf []byte, n int) error {
+		if p == nil {
+			// Nodes are selected only for non-empty file.
+			var err error
+			if p, err = h.distinctPlacer(ctx, k+m, maxShardSize); err != nil {
+				return errors.Wrap(err, "select nodes")
+			}
+		}
+		// All shards of stripe have the same size, data shards are padded
+		// with zeroes for encoding but stored without padding.
+		size := (n + k - 1) / k
+		clear(buf[n : k*size])
+		shards := make([][]byte, k+m)
+		for i := range shards {
+			shards[i] = buf[i*size : (i+1)*size]
+		}
+
+		nodes := p.next(k+m, int64(size))
+		if len(nodes) < k+m {
+			return errors.Wrapf(ErrInsufficientCapacity, "select nodes: stripe %d: %d nodes have space left, need %d",
+				len(chunks)/(k+m), len(nodes), k+m,
+			)
+		}
+		clients := h.clientsOf(nodes)
+		stripe := make([]Chunk, k+m)
+		chunksMux.Lock()
+		for i := range stripe {
+			stripe[i] = Chunk{
+				Index: len(chunks) + i,
+				ID:    uuid.New(),
+				Size:  int64(size),
+				Nodes: []string{clients[i].BaseURL()},
+			}
+			if i < k {
+				offset := min(i*size, n)
+				stripe[i].Offset = file.Size + int64(offset)
+				stripe[i].Size = int64(min(size, n-offset))
+			}
+			targets = append(targets, []replicaWrite{{client: clients[i]}})
+		}
+		chunks = append(chunks, stripe...)
+		chunksMux.Unlock()
+		file.Size += int64(n)
+
+		cw.write(buf, func(ctx context.Context) error {
+			if err := enc.Encode(shards); err != nil {
+				return errors.Wrap(err, "encode")
+			}
+			g, gCtx := errgroup.WithContext(ctx)
+			for i, chunk := range stripe {
+				client := clients[i]
+				g.Go(func() error {
+					written, err := client.Write(gCtx, chunk.ID, bytes.NewReader(shards[i][:chunk.Size]), nil)
+					if err != nil {
+						if i < k {
+							return errors.Wrapf(err, "write data shard %d", chunk.Index)
+						}
+						return errors.Wrapf(err, "write parity shard %d", chunk.Index)
+					}
+					chunksMux.Lock()
+					chunks[chunk.Index].Checksum = written.Checksum
+					targets[chunk.Index][0].written = written
+					chunksMux.Unlock()
+					return nil
+				})
+			}
+			return g.Wait()
+		})
+		return nil
+	})
+	file.Chunks = chunks
+	return targets, err
+}
+
+// reconstructChunk reconstructs data chunk from other shards of its stripe
+// and writes it to w.
+//
+// Any DataShards of remaining shards are used, shards that fail to read are
+// excluded and reconstruction continues from already written position.
+func (h *Handler) reconstructChunk(ctx context.Context, file *File, chunk Chunk, w io.Writer) error {
+	enc, err := reedsolomon.NewStream(file.DataShards, file.ParityShards)
+	if err != nil {
+		return errors.Wrap(err, "create encoder")
+	}
+
+	var (
+		cw       = &countingWriter{W: w}
+		excluded = make(map[int]bool)
+	)
+	for {
+		err := h.reconstructShard(ctx, enc, file, chunk, excluded, &skipWriter{W: cw, N: cw.N})
+		if err == nil {
+			break
+		}
+		var readErr reedsolomon.StreamReadError
+		if !errors.As(err, &readErr) || ctx.Err() != nil {
+			return errors.Wrap(err, "reconstruct")
+		}
+		zctx.From(ctx).Warn("Failed to read shard for reconstruction",
+			zap.Int("stripeIndex", readErr.Stream),
+			zap.Error(readErr.Err),
+		)
+		excluded[readErr.Stream] = true
+	}
+
+	zctx.From(ctx).Info("Reconstructed chunk",
+		zap.String("chunkID", chunk.ID.String()),
+		zap.Int("chunkIndex", chunk.Index),
+	)
+	return nil
+}
+
+// reconstructShard makes single attempt to reconstruct chunk, using first
+// DataShards shards that are not excluded.
+func (h *Handler) reconstructShard(
+	ctx context.Context,
+	enc reedsolomon.StreamEncoder,
+	file *File,
+	chunk Chunk,
+	excluded map[int]bool,
+	w io.Writer,
+) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var (
+		k         = file.DataShards
+		stripe    = file.stripe(chunk)
+		shardSize = stripe[k].Size // parity shards are never padded
+		valid     = make([]io.Reader, len(stripe))
+		fill      = make([]io.Writer, len(stripe))
+		pipes     []*io.PipeReader
+		g         errgroup.Group
+	)
+	for i, shard := range stripe {
+		if shard.Index == chunk.Index {
+			// Trim padding of reconstructed shard.
+			fill[i] = &limitWriter{W: w, N: chunk.Size}
+			continue
+		}
+		if excluded[i] || len(pipes) == k {
+			continue
+		}
+		pr, pw := io.Pipe()
+		valid[i] = pr
+		pipes = append(pipes, pr)
+		g.Go(func() error {
+			err := h.readReplicas(ctx, shard, 0, shard.Size, pw)
+			if err == nil {
+				_, err = io.CopyN(pw, zeroReader{}, shardSize-shard.Size)
+			}
+			_ = pw.CloseWithError(err)
+			return nil
+		})
+	}
+	if len(pipes) < k {
+		return &ChunkUnavailableErr{
+			Chunk: chunk.ID,
+			Err:   errors.Errorf("too few shards: %d < %d", len(pipes), k),
+		}
+	}
+
+	err := enc.Reconstruct(valid, fill)
+	cancel()
+	for _, pr := range pipes {
+		_ = pr.Close()
+	}
+	_ = g.Wait()
+
+	return err
+}
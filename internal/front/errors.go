@@ -0,0 +1,84 @@
+package front
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+
+	"github.com/go-faster/errors"
+	"github.com/google/uuid"
+
+	"github.com/ernado/stor/internal/node"
+)
+
+// ChunkUnavailableErr means that chunk can't be read from any of its
+// replicas.
+type ChunkUnavailableErr struct {
+	Chunk uuid.UUID
+	Err   error
+}
+
+func (e *ChunkUnavailableErr) Error() string {
+	return "chunk unavailable: " + e.Chunk.String() + ": " + e.Err.Error()
+}
+
+func (e *ChunkUnavailableErr) Unwrap() error {
+	return e.Err
+}
+
+// errorResponse is JSON body of error response.
+type errorResponse struct {
+	Error string `json:"error"`
+}
+
+// httpError is like http.Error, but responds with JSON body.
+func httpError(w http.ResponseWriter, message string, code int) {
+	h := w.Header()
+	// Headers of content that was going to be sent, like in http.Error.
+	h.Del("Content-Length")
+	h.Set("Content-Type", "application/json")
+	h.Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(code)
+	_ = json.NewEncoder(w).Encode(errorResponse{Error: message})
+}
+
+// writeError responds with err and its status code.
+func writeError(w http.ResponseWriter, err error) {
+	httpError(w, err.Error(), errorStatus(err))
+}
+
+// errorStatus returns status code of response to request that failed with
+// err.
+func errorStatus(err error) int {
+	var (
+		fileNotFound     *FileNotFoundErr
+		bucketNotFound   *BucketNotFoundErr
+		bucketExists     *BucketExistsErr
+		uploadNotFound   *UploadNotFoundErr
+		partChanged      *PartChangedErr
+		nodeNotFound     *NodeNotFoundErr
+		lastReplica      *LastReplicaErr
+		chunkReleased    *ChunkReleasedErr
+		chunkUnavailable *ChunkUnavailableErr
+	)
+	switch {
+	case errors.As(err, &fileNotFound), errors.As(err, &bucketNotFound), errors.As(err, &uploadNotFound),
+		errors.As(err, &nodeNotFound):
+		return http.StatusNotFound
+	case errors.As(err, &bucketExists), errors.As(err, &partChanged), errors.As(err, &lastReplica),
+		errors.As(err, &chunkReleased):
+		return http.StatusConflict
+	case errors.Is(err, errInvalidVersion), errors.Is(err, errInvalidFileName):
+		return http.StatusBadRequest
+	case errors.Is(err, errUnsatisfiableRange):
+		return http.StatusRequestedRangeNotSatisfiable
+	case errors.Is(err, ErrInsufficientCapacity), errors.Is(err, node.ErrNoSpace):
+		return http.StatusInsufficientStorage
+	case errors.Is(err, ErrNoNodes), errors.As(err, &chunkUnavailable):
+		return http.StatusServiceUnavailable
+	case errors.Is(err, context.DeadlineExceeded):
+		return http.StatusGatewayTimeout
+	default:
+		return http.StatusInternalServerError
+	}
+}
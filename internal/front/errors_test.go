@@ -0,0 +1,138 @@
+package front
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/go-faster/errors"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/require"
+	noopMeter "go.opentelemetry.io/otel/metric/noop"
+	noopTracer "go.opentelemetry.io/otel/trace/noop"
+
+	"github.com/ernado/stor/internal/node"
+)
+
+// requireErrorResponse requires resp to be JSON error response with status.
+func requireErrorResponse(t *testing.T, resp *http.Response, status int) errorResponse {
+	t.Helper()
+	defer func() { _ = resp.Body.Close() }()
+	require.Equal(t, status, resp.StatusCode)
+	require.Equal(t, "application/json", resp.Header.Get("Content-Type"))
+	var body errorResponse
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&body))
+	require.NotEmpty(t, body.Error)
+	return body
+}
+
+// downloadWithTrailers downloads file accepting trailers.
+func downloadWithTrailers(t *testing.T, server *httptest.Server, name string) (*http.Response, []byte) {
+	t.Helper()
+	req, err := http.NewRequest(http.MethodGet, server.URL+"/download/"+name, http.NoBody)
+	require.NoError(t, err)
+	req.Header.Set("TE", "trailers")
+	resp, err := server.Client().Do(req)
+	require.NoError(t, err)
+	defer func() { _ = resp.Body.Close() }()
+	data, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+	return resp, data
+}
+
+func TestErrors(t *testing.T) {
+	var (
+		ctx   = context.Background()
+		stor  = newInMemoryStorage()
+		nodes = &slowNodes{inMemoryNodes: newInMemoryNodes(), failed: map[uuid.UUID]bool{}}
+	)
+	handler, err := NewHandler(ctx, nodes, stor, noopTracer.NewTracerProvider(), noopMeter.NewMeterProvider(), HandlerOptions{
+		Chunking: ChunkPolicy{Size: 1000},
+	})
+	require.NoError(t, err)
+	server := httptest.NewServer(handler)
+	t.Cleanup(server.Close)
+
+	t.Run("NoNodes", func(t *testing.T) {
+		body := requireErrorResponse(t, uploadFile(t, server, "file.bin", randomBytes(t, 100)), http.StatusServiceUnavailable)
+		require.Contains(t, body.Error, ErrNoNodes.Error())
+	})
+	registerNodes(t, server, nodes.inMemoryNodes, "node1:8080")
+	data := randomBytes(t, 2500)
+	require.Equal(t, http.StatusOK, uploadFile(t, server, "file.bin", data).StatusCode)
+	file, err := stor.File(ctx, "file.bin")
+	require.NoError(t, err)
+
+	t.Run("NotFound", func(t *testing.T) {
+		resp, err := server.Client().Get(server.URL + "/download/missing.bin")
+		require.NoError(t, err)
+		body := requireErrorResponse(t, resp, http.StatusNotFound)
+		require.Equal(t, (&FileNotFoundErr{File: "missing.bin"}).Error(), body.Error)
+	})
+	setFailed := func(t *testing.T, chunk Chunk) {
+		nodes.mux.Lock()
+		defer nodes.mux.Unlock()
+		nodes.failed[chunk.ID] = true
+		t.Cleanup(func() {
+			nodes.mux.Lock()
+			defer nodes.mux.Unlock()
+			delete(nodes.failed, chunk.ID)
+		})
+	}
+
+	t.Run("Unavailable", func(t *testing.T) {
+		setFailed(t, file.Chunks[0])
+
+		resp, err := server.Client().Get(server.URL + "/download/file.bin")
+		require.NoError(t, err)
+		requireErrorResponse(t, resp, http.StatusServiceUnavailable)
+		require.Empty(t, resp.Header.Get("ETag"))
+	})
+	t.Run("Trailers", func(t *testing.T) {
+		resp, downloaded := downloadWithTrailers(t, server, "file.bin")
+		require.Equal(t, http.StatusOK, resp.StatusCode)
+		require.Equal(t, int64(-1), resp.ContentLength, "length is not sent with trailers")
+		require.Equal(t, data, downloaded)
+		require.Equal(t, "complete", resp.Trailer.Get(DownloadStatusTrailer))
+
+		setFailed(t, file.Chunks[1])
+		resp, downloaded = downloadWithTrailers(t, server, "file.bin")
+		require.Equal(t, http.StatusOK, resp.StatusCode)
+		require.Equal(t, data[:1000], downloaded)
+		require.Equal(t, "failed", resp.Trailer.Get(DownloadStatusTrailer))
+		require.Contains(t, resp.Trailer.Get(DownloadErrorTrailer), "read chunk 1")
+	})
+	t.Run("Abort", func(t *testing.T) {
+		setFailed(t, file.Chunks[1])
+		// Buffered status can be aborted too.
+		_, downloaded, err := downloadFile(t, server, "file.bin")
+		require.Error(t, err)
+		require.Less(t, len(downloaded), len(data))
+	})
+}
+
+func TestErrorStatus(t *testing.T) {
+	for _, tt := range []struct {
+		Err    error
+		Status int
+	}{
+		{errors.Wrap(&FileNotFoundErr{File: "file.bin"}, "file"), http.StatusNotFound},
+		{&BucketExistsErr{Bucket: "bucket"}, http.StatusConflict},
+		{errors.Wrap(&PartChangedErr{Upload: uuid.New(), Number: 2}, "complete"), http.StatusConflict},
+		{errors.Wrap(&NodeNotFoundErr{Node: "node1:8080"}, "report"), http.StatusNotFound},
+		{errors.Wrap(&LastReplicaErr{Chunk: uuid.New(), Node: "node1:8080"}, "report"), http.StatusConflict},
+		{errors.Wrap(&ChunkReleasedErr{Chunk: uuid.New()}, "write"), http.StatusConflict},
+		{errors.Wrap(errUnsatisfiableRange, "range"), http.StatusRequestedRangeNotSatisfiable},
+		{errors.Wrap(ErrInsufficientCapacity, "place"), http.StatusInsufficientStorage},
+		{errors.Wrap(&node.StatusErr{Code: http.StatusInsufficientStorage}, "write"), http.StatusInsufficientStorage},
+		{ErrNoNodes, http.StatusServiceUnavailable},
+		{&ChunkUnavailableErr{Chunk: uuid.New(), Err: errors.New("all replicas failed")}, http.StatusServiceUnavailable},
+		{context.DeadlineExceeded, http.StatusGatewayTimeout},
+		{errors.New("unexpected"), http.StatusInternalServerError},
+	} {
+		require.Equal(t, tt.Status, errorStatus(tt.Err), tt.Err.Error())
+	}
+}
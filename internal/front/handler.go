@@ -1,15 +1,24 @@
 package front
 
 import (
+	"bytes"
+	"cmp"
 	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
 	"fmt"
 	"io"
+	"mime/multipart"
 	"net"
 	"net/http"
+	"net/textproto"
 	"net/url"
 	"path/filepath"
 	"slices"
+	"strings"
 	"sync"
+	"time"
 
 	"github.com/go-faster/errors"
 	"github.com/go-faster/sdk/zctx"
@@ -18,65 +27,444 @@ import (
 	"go.opentelemetry.io/otel/metric"
 	"go.opentelemetry.io/otel/trace"
 	"go.uber.org/zap"
-	"golang.org/x/sync/errgroup"
+	"golang.org/x/sync/semaphore"
 
 	"github.com/ernado/stor/internal/node"
 )
 
 type Chunk struct {
-	Index       int
-	ID          uuid.UUID
-	Offset      int64
-	Size        int64
-	NodeBaseURL string // [Node.BaseURL]
+	Index  int
+	ID     uuid.UUID
+	Offset int64
+	Size   int64
+	Nodes  []string // [Node.BaseURL] of every replica
+	// Checksum is SHA-256 of chunk data, nil for chunks uploaded before
+	// checksums were introduced.
+	Checksum []byte
 }
 
 type File struct {
+	Size int64
+	Name string
+	// ContentType is the media type of file provided on upload, if any.
+	ContentType string
+	// DataShards and ParityShards are Reed-Solomon parameters of
+	// erasure-coded file. Zero for replicated file.
+	DataShards   int
+	ParityShards int
+	// Checksum is SHA-256 of whole file, or SHA-256 of concatenated
+	// checksums of parts if PartCount is set.
+	Checksum []byte
+	// PartCount is the number of parts of file that was assembled from
+	// multipart or resumable upload, zero for file uploaded at once.
+	PartCount int
+	// ChunkCount is the number of chunks recorded on upload, so missing
+	// chunks are detected, and empty file is distinguished from file with
+	// lost metadata. Zero for files uploaded before it was introduced.
+	ChunkCount int
+	// CreatedAt is the time of upload. Zero for files uploaded before it was
+	// introduced.
+	CreatedAt time.Time
+	// Version identifies upload of file, versions of the same name are
+	// ordered by time of upload. Nil for files uploaded before versioning
+	// was introduced.
+	Version uuid.UUID
+	Chunks  []Chunk
+}
+
+// Bucket is the namespace of S3 objects, which are stored as files named
+// s3KeysPrefix+"<bucket>/<key>".
+type Bucket struct {
+	Name      string
+	CreatedAt time.Time
+}
+
+// Upload is multipart upload of file, which is published on completion.
+type Upload struct {
+	ID          uuid.UUID
+	Name        string
+	ContentType string
+	// Length is the size of file declared on creation, zero if it is not
+	// declared.
+	Length    int64
+	CreatedAt time.Time
+	// UpdatedAt is the time when the last part was recorded, or CreatedAt
+	// if there are no parts. Upload expires upload TTL after it.
+	UpdatedAt time.Time
+}
+
+// Part is uploaded part of multipart upload.
+type Part struct {
+	Number int
 	Size   int64
-	Name   string
+	// Checksum is SHA-256 of part.
+	Checksum  []byte
+	CreatedAt time.Time
+	// Chunks of part, with offsets from the start of part.
 	Chunks []Chunk
 }
 
+// Replica is the copy of chunk on node.
+type Replica struct {
+	ChunkID uuid.UUID
+	Node    string // [Node.BaseURL]
+	// NotBefore is the time before which replica in garbage is not deleted,
+	// zero if it is deleted right away.
+	NotBefore time.Time
+	// ReleasedAt is the time when replica was moved to garbage because its
+	// chunk is no longer referenced by any file, zero for replicas that
+	// were never recorded or were moved to other node.
+	ReleasedAt time.Time
+}
+
 type Node struct {
 	BaseURL string
+	// LastSeen is time of last registration or heartbeat.
+	LastSeen time.Time
+	// Status is reported by node in last heartbeat.
+	Status node.Status
+	// Draining is set for node that is being decommissioned.
+	Draining bool
+	// Topology is reported by node on registration.
+	Topology node.Topology
 }
 
 type NodeStat struct {
 	BaseURL     string
 	TotalChunks int
 	TotalSize   int64
+	LastSeen    time.Time
+	Status      node.Status
+	Draining    bool
+	Topology    node.Topology
 }
 
 type HandlerStorage interface {
 	File(ctx context.Context, name string) (*File, error)
+	// AddFile makes file the current version of its name and counts its
+	// references to chunks. Replaced version is kept as noncurrent version
+	// named versionKey, which can be removed with RemoveFile.
 	AddFile(ctx context.Context, file File) error
+	// RemoveFile removes file with all its noncurrent versions or returns
+	// *FileNotFoundErr. Replicas of their chunks that are no longer
+	// referenced by any file are moved to garbage.
 	RemoveFile(ctx context.Context, name string) error
+	// ChunkReplicas returns nodes that have recorded replica of chunk.
+	ChunkReplicas(ctx context.Context, id uuid.UUID) ([]string, error)
+	// RecordedChunks returns IDs of chunks from ids that have recorded
+	// replica on node.
+	RecordedChunks(ctx context.Context, baseURL string, ids []uuid.UUID) ([]uuid.UUID, error)
+	// RecordedRange returns IDs of chunks that have recorded replica on node
+	// and are greater than after and not greater than last. IDs are
+	// compared as strings, like in node inventory.
+	RecordedRange(ctx context.Context, baseURL string, after, last uuid.UUID) ([]uuid.UUID, error)
+	// Replicas returns at most limit recorded replicas, ordered by chunk ID
+	// and node, that follow replica after.
+	Replicas(ctx context.Context, after Replica, limit int) ([]Replica, error)
+	// AddGarbage records replicas that should be deleted from nodes.
+	AddGarbage(ctx context.Context, replicas []Replica) error
+	// Garbage returns at most limit replicas that should be deleted,
+	// ordered by chunk ID and node, that follow replica after.
+	Garbage(ctx context.Context, after Replica, limit int) ([]Replica, error)
+	// RemoveGarbage removes replica from garbage after it is deleted.
+	RemoveGarbage(ctx context.Context, replica Replica) error
+	// NodeGarbage returns number of replicas on node that should be deleted.
+	NodeGarbage(ctx context.Context, baseURL string) (int, error)
+	// AddBucket adds bucket or returns *BucketExistsErr.
+	AddBucket(ctx context.Context, bucket Bucket) error
+	// Bucket returns bucket or *BucketNotFoundErr.
+	Bucket(ctx context.Context, name string) (*Bucket, error)
+	// Buckets returns all buckets ordered by name.
+	Buckets(ctx context.Context) ([]Bucket, error)
+	// RemoveBucket removes bucket or returns *BucketNotFoundErr. Files in
+	// bucket are not removed.
+	RemoveBucket(ctx context.Context, name string) error
+	// AddUpload records multipart upload.
+	AddUpload(ctx context.Context, upload Upload) error
+	// Upload returns multipart upload or *UploadNotFoundErr.
+	Upload(ctx context.Context, id uuid.UUID) (*Upload, error)
+	// Uploads returns at most limit multipart uploads that were last
+	// updated before given time.
+	Uploads(ctx context.Context, updatedBefore time.Time, limit int) ([]Upload, error)
+	// AddPart adds or replaces part of multipart upload, or returns
+	// *UploadNotFoundErr. Chunks of parts are referenced like chunks of
+	// files, so replicas of replaced part are moved to garbage. UpdatedAt of
+	// upload is set to CreatedAt of part.
+	AddPart(ctx context.Context, id uuid.UUID, part Part) error
+	// AppendPart adds part like AddPart only if it directly follows the
+	// last recorded part of upload, so concurrent appends to resumable
+	// upload can't both succeed. Returns *PartChangedErr otherwise.
+	AppendPart(ctx context.Context, id uuid.UUID, part Part) error
+	// Parts returns parts of multipart upload ordered by number.
+	Parts(ctx context.Context, id uuid.UUID) ([]Part, error)
+	// CompleteUpload atomically adds file like AddFile and removes multipart
+	// upload with all its parts, or returns *UploadNotFoundErr. File consists
+	// of chunks of given parts in order, as they are recorded at the time of
+	// completion, or *PartChangedErr is returned if any of them is missing
+	// or has different checksum.
+	CompleteUpload(ctx context.Context, id uuid.UUID, parts []Part, file File) error
+	// RemoveUpload removes multipart upload with all its parts, or returns
+	// *UploadNotFoundErr.
+	RemoveUpload(ctx context.Context, id uuid.UUID) error
+	// RemoveStaleUpload removes multipart upload like RemoveUpload only if
+	// it was last updated before given time, or returns *UploadNotFoundErr.
+	RemoveStaleUpload(ctx context.Context, id uuid.UUID, updatedBefore time.Time) error
 	Nodes(ctx context.Context) ([]Node, error)
 	NodeStats(ctx context.Context) ([]NodeStat, error)
+	// AddNode adds node or updates its liveness, keeping draining flag.
 	AddNode(ctx context.Context, node Node) error
+	// UpdateNode records last heartbeat time and status of registered node,
+	// keeping its topology and draining flag, or returns *NodeNotFoundErr.
+	UpdateNode(ctx context.Context, baseURL string, lastSeen time.Time, status node.Status) error
+	// SetNodeDraining sets draining flag of node.
+	SetNodeDraining(ctx context.Context, baseURL string, draining bool) error
+	// RemoveNode removes node without replicas.
+	RemoveNode(ctx context.Context, baseURL string) error
+	// NodeReplicas returns at most limit chunks with ID greater than after
+	// that have replica on node, ordered by ID, with all their replicas.
+	// Only ID, Size, Nodes and Checksum of chunks are set.
+	NodeReplicas(ctx context.Context, baseURL string, after uuid.UUID, limit int) ([]Chunk, error)
+	// ChunkFile returns any file that references chunk, or
+	// *FileNotFoundErr if there is none, e.g. for chunk of multipart upload.
+	ChunkFile(ctx context.Context, id uuid.UUID) (*File, error)
+	// Files returns at most limit files with name prefix, ordered by name,
+	// starting from name from.
+	Files(ctx context.Context, prefix, from string, limit int) ([]FileInfo, error)
+	// AddReplica records replica of chunk on node, or returns
+	// *ChunkReleasedErr if chunk was released concurrently.
+	AddReplica(ctx context.Context, chunk Chunk, node string) error
+	// RemoveReplica removes replica of chunk on node from metadata.
+	RemoveReplica(ctx context.Context, chunkID uuid.UUID, node string) error
+	// RemoveReportedReplica removes replica of chunk on node like
+	// RemoveReplica, unless node is not registered, which returns
+	// *NodeNotFoundErr, or chunk has no other replicas, which returns
+	// *LastReplicaErr.
+	RemoveReportedReplica(ctx context.Context, chunkID uuid.UUID, node string) error
+	// MoveReplica atomically replaces replica of chunk on node from with
+	// replica on node to, and moves replica on node from to garbage that is
+	// deleted not before deleteAt. Returns *ReplicaNotFoundErr if replica on
+	// node from was removed concurrently.
+	MoveReplica(ctx context.Context, chunk Chunk, from, to string, deleteAt time.Time) error
+}
+
+// HandlerOptions configures Handler.
+type HandlerOptions struct {
+	// ReplicationFactor is the number of distinct nodes every chunk
+	// is written to. Defaults to 1.
+	ReplicationFactor int
+	// WriteQuorum is the minimum number of acknowledged replica writes
+	// for chunk upload to succeed. Defaults to ReplicationFactor.
+	WriteQuorum int
+	// HeartbeatTimeout is the duration after last heartbeat when node is
+	// considered dead and is no longer selected. Defaults to 15 seconds.
+	HeartbeatTimeout time.Duration
+	// CapacityReserve is the fraction of node disk that is kept free.
+	// Defaults to 0.05.
+	CapacityReserve float64
+	// FailureDomain is the level of failure domains (DomainZone, DomainRack
+	// or DomainHost) that replicas of chunk or shards of stripe are
+	// required to be distinct at. Defaults to DomainHost.
+	FailureDomain string
+	// Chunking configures how uploaded files are cut into chunks.
+	Chunking ChunkPolicy
+	// UploadWindow is the maximum number of chunks of single upload that
+	// are buffered while being written to nodes. Defaults to 4.
+	UploadWindow int
+	// UploadMemory is the maximum total size of chunks that are buffered by
+	// all uploads. Defaults to 1 GiB.
+	UploadMemory int64
+	// UploadTTL is the time after creation when incomplete multipart or
+	// resumable upload expires. Defaults to 24 hours.
+	UploadTTL time.Duration
+	// KeepVersions is the number of noncurrent versions that are kept for
+	// every file, zero means no limit if VersionTTL is set.
+	KeepVersions int
+	// VersionTTL is the time after upload when noncurrent version is
+	// removed, zero means no limit if KeepVersions is set. If both are zero,
+	// replaced versions are not kept.
+	VersionTTL time.Duration
+	// ReadAhead is the maximum number of chunks of single download that are
+	// read from nodes at once, including the one that is being sent. One
+	// disables read-ahead. Defaults to 4.
+	ReadAhead int
+	// ReadAheadMemory is the maximum total size of chunks that are buffered
+	// by read-ahead of all downloads. Defaults to 512 MiB.
+	ReadAheadMemory int64
+	// HedgeQuantile is the quantile of time to first byte of chunk reads,
+	// after which read that has not sent any data is hedged to another
+	// replica. Defaults to 0.95.
+	HedgeQuantile float64
+	// HedgeDelay is the minimum time after which read is hedged, also used
+	// until enough reads are observed. Defaults to 20ms.
+	HedgeDelay time.Duration
+	// DisableHedging disables hedged reads.
+	DisableHedging bool
+	// MoveDeleteDelay is the delay before replica that was moved to other
+	// node by rebalance or drain is deleted from source node by Collector,
+	// so downloads that fetched metadata before move can finish. Defaults
+	// to 1 minute.
+	MoveDeleteDelay time.Duration
+	// DrainPageSize is the number of chunks of draining node that are
+	// fetched at once. Defaults to 1000.
+	DrainPageSize int
+	// DrainCheckInterval is the interval between checks whether chunks
+	// moved from draining node are deleted from it by Collector, as node is
+	// removed only after that. Defaults to 10 seconds.
+	DrainCheckInterval time.Duration
+}
+
+func (o *HandlerOptions) setDefaults() {
+	if o.ReplicationFactor <= 0 {
+		o.ReplicationFactor = 1
+	}
+	if o.WriteQuorum <= 0 {
+		o.WriteQuorum = o.ReplicationFactor
+	}
+	if o.HeartbeatTimeout <= 0 {
+		o.HeartbeatTimeout = 15 * time.Second
+	}
+	if o.CapacityReserve <= 0 {
+		o.CapacityReserve = 0.05
+	}
+	if o.FailureDomain == "" {
+		o.FailureDomain = DomainHost
+	}
+	o.Chunking.setDefaults()
+	if o.UploadWindow <= 0 {
+		o.UploadWindow = 4
+	}
+	if o.UploadMemory <= 0 {
+		o.UploadMemory = 1024 * 1024 * 1024
+	}
+	if o.UploadTTL <= 0 {
+		o.UploadTTL = 24 * time.Hour
+	}
+	if o.ReadAhead <= 0 {
+		o.ReadAhead = 4
+	}
+	if o.ReadAheadMemory <= 0 {
+		o.ReadAheadMemory = 512 * 1024 * 1024
+	}
+	if o.HedgeQuantile <= 0 {
+		o.HedgeQuantile = 0.95
+	}
+	if o.HedgeDelay <= 0 {
+		o.HedgeDelay = 20 * time.Millisecond
+	}
+	if o.MoveDeleteDelay <= 0 {
+		o.MoveDeleteDelay = time.Minute
+	}
+	if o.DrainPageSize <= 0 {
+		o.DrainPageSize = 1000
+	}
+	if o.DrainCheckInterval <= 0 {
+		o.DrainCheckInterval = 10 * time.Second
+	}
+}
+
+func (o HandlerOptions) validate() error {
+	if o.WriteQuorum > o.ReplicationFactor {
+		return errors.Errorf("write quorum %d is greater than replication factor %d",
+			o.WriteQuorum, o.ReplicationFactor,
+		)
+	}
+	if o.CapacityReserve >= 1 {
+		return errors.Errorf("capacity reserve %v should be less than 1", o.CapacityReserve)
+	}
+	if !slices.Contains(domainLevels[:], o.FailureDomain) {
+		return errors.Errorf("unknown failure domain %q", o.FailureDomain)
+	}
+	if o.KeepVersions < 0 || o.VersionTTL < 0 {
+		return errors.New("version retention should not be negative")
+	}
+	if o.HedgeQuantile > 1 {
+		return errors.Errorf("hedge quantile %v should not be greater than 1", o.HedgeQuantile)
+	}
+	if err := o.Chunking.validate(); err != nil {
+		return errors.Wrap(err, "chunking")
+	}
+	return nil
 }
 
 type Handler struct {
 	mux     sync.Mutex
 	clients map[string]NodeClient
+	routes  *http.ServeMux
 
-	clientConstructor      NodeClientConstructor
-	storage                HandlerStorage
-	chunksPerFile          int
-	maxMultipartFormMemory int64
-	tracerProvider         trace.TracerProvider
-	httpClient             node.HTTPClient
-	tracer                 trace.Tracer
-	baseCtx                context.Context
+	drainsMux sync.Mutex
+	drains    map[string]*DrainProgress
+
+	// Resumable uploads that are written by requests.
+	uploadsMux sync.Mutex
+	uploads    map[uuid.UUID]struct{}
+
+	// collect wakes up Collector when garbage is added.
+	collect chan struct{}
+
+	// readAheadBuffers limits memory of chunks buffered by read-ahead.
+	readAheadBuffers *semaphore.Weighted
+	// uploadBuffers limits memory of chunks buffered by uploads.
+	uploadBuffers *semaphore.Weighted
+
+	// latencies of the first byte of chunk reads, that hedge delay is
+	// estimated from.
+	latencies latencies
+
+	clientConstructor NodeClientConstructor
+	storage           HandlerStorage
+	replicationFactor int
+	writeQuorum       int
+	heartbeatTimeout  time.Duration
+	capacityReserve   float64
+	failureLevel      int
+	chunking          ChunkPolicy
+	uploadWindow      int
+	uploadMemory      int64
+	uploadTTL         time.Duration
+	keepVersions      int
+	versionTTL        time.Duration
+	readAhead         int
+	readAheadMemory   int64
+	hedging           bool
+	hedgeQuantile     float64
+	minHedgeDelay     time.Duration
+	moveDeleteDelay   time.Duration
+	drainPageSize     int
+	drainCheck        time.Duration
+	now               func() time.Time
+	tracerProvider    trace.TracerProvider
+	httpClient        node.HTTPClient
+	tracer            trace.Tracer
+	baseCtx           context.Context
 
 	nodeTotalSize   metric.Int64Observable
 	nodeTotalChunks metric.Int64Observable
+	nodeUp          metric.Int64Observable
+	chunksReported  metric.Int64Counter
+	drainedChunks   metric.Int64Counter
+	downloadStall   metric.Float64Histogram
+	hedgedReads     metric.Int64Counter
+	hedgedReadsWon  metric.Int64Counter
 }
 
 type NodeClient interface {
 	Read(ctx context.Context, chunkID uuid.UUID, w io.Writer) error
-	Write(ctx context.Context, chunkID uuid.UUID, r io.Reader) error
+	ReadRange(ctx context.Context, chunkID uuid.UUID, offset, length int64, w io.Writer) error
+	// Write writes chunk and returns its checksum, verified by node. If
+	// checksum is not nil, node rejects data that does not match it with
+	// node.ErrChecksumMismatch, keeping chunk that is already stored.
+	Write(ctx context.Context, chunkID uuid.UUID, r io.Reader, checksum []byte) (node.WriteResult, error)
 	Delete(ctx context.Context, id uuid.UUID) error
+	// DeleteUnmodified deletes chunk only if it was not written since
+	// modTime, or returns node.ErrChunkModified.
+	DeleteUnmodified(ctx context.Context, id uuid.UUID, modTime time.Time) error
+	// Stat returns size and modification time of chunk.
+	Stat(ctx context.Context, id uuid.UUID) (node.ChunkInfo, error)
+	// List returns IDs of all chunks stored on node.
+	List(ctx context.Context) ([]uuid.UUID, error)
+	// Inventory returns at most limit chunks stored on node with ID greater
+	// than after, ordered by ID.
+	Inventory(ctx context.Context, after uuid.UUID, limit int) ([]node.ChunkInfo, error)
 	BaseURL() string
 }
 
@@ -87,22 +475,26 @@ type NodeClientConstructor interface {
 type DefaultNodeClientConstructor struct {
 	HTTPClient     node.HTTPClient
 	TracerProvider trace.TracerProvider
+	Options        node.ClientOptions
 }
 
-func NewDefaultNodeClientConstructor(httpClient node.HTTPClient, tracerProvider trace.TracerProvider) *DefaultNodeClientConstructor {
+func NewDefaultNodeClientConstructor(httpClient node.HTTPClient, tracerProvider trace.TracerProvider, opts node.ClientOptions) *DefaultNodeClientConstructor {
 	return &DefaultNodeClientConstructor{
 		HTTPClient:     httpClient,
 		TracerProvider: tracerProvider,
+		Options:        opts,
 	}
 }
 
 func (c *DefaultNodeClientConstructor) NewClient(baseURL string) NodeClient {
-	return node.NewClient(baseURL, c.HTTPClient, c.TracerProvider)
+	return node.NewClient(baseURL, c.HTTPClient, c.TracerProvider, c.Options)
 }
 
 // selectLeastFilledNodes implement algorithm of balancing data between nodes.
 //
-// We select N nodes with the least amount of data to write new chunks.
+// We select N nodes with the largest ratio of free disk space to write new
+// chunks. If some node did not report its capacity, nodes with the least
+// amount of data are selected instead.
 // If there are fewer nodes than N, we return all nodes.
 //
 // Returned slice is guaranteed to be of length N if len(nodes) > 0.
@@ -112,8 +504,15 @@ func (h *Handler) selectLeastFilledNodes(nodes []NodeStat, n int) []NodeStat {
 		return nil
 	}
 
-	// Sort nodes by total size.
+	byCapacity := !slices.ContainsFunc(nodes, func(stat NodeStat) bool {
+		return !hasCapacity(stat)
+	})
 	slices.SortFunc(nodes, func(a, b NodeStat) int {
+		if byCapacity {
+			if c := cmp.Compare(freeRatio(b), freeRatio(a)); c != 0 {
+				return c
+			}
+		}
 		return int(a.TotalSize - b.TotalSize)
 	})
 
@@ -134,23 +533,98 @@ func (h *Handler) selectLeastFilledNodes(nodes []NodeStat, n int) []NodeStat {
 	}
 }
 
-// NextClients returns next N clients with least amount of data.
+// NextClients returns next N clients with least amount of data, spread
+// across as many failure domains as possible.
 func (h *Handler) NextClients(ctx context.Context, n int) ([]NodeClient, error) {
-	stat, err := h.storage.NodeStats(ctx)
+	stat, err := h.liveNodeStats(ctx)
 	if err != nil {
 		return nil, errors.Wrap(err, "node stats")
 	}
+	if len(stat) == 0 {
+		return nil, ErrNoNodes
+	}
 
-	nodes := h.selectLeastFilledNodes(stat, n)
-	if len(nodes) == 0 {
-		return nil, errors.New("no nodes")
+	clients := make([]NodeClient, n)
+	for i, v := range h.place(stat, n, 1, 0) {
+		if len(v) == 0 {
+			return nil, errors.Wrap(ErrInsufficientCapacity, "no nodes have inodes left")
+		}
+		clients[i] = h.GetClient(v[0].BaseURL)
 	}
+	return clients, nil
+}
 
+// nextReplicas returns distinct clients for every replica of n chunks of
+// at most size bytes.
+//
+// Each chunk gets ReplicationFactor distinct nodes, or all nodes if there
+// are fewer of them but still enough to satisfy WriteQuorum.
+func (h *Handler) nextReplicas(ctx context.Context, n int, size int64) ([][]NodeClient, error) {
+	p, replicas, err := h.replicaPlacer(ctx, size)
+	if err != nil {
+		return nil, err
+	}
+	out := make([][]NodeClient, n)
+	for i := range out {
+		nodes := p.next(replicas, size)
+		if len(nodes) < h.writeQuorum {
+			return nil, errors.Wrapf(ErrInsufficientCapacity, "chunk %d: %d nodes have space left, need %d",
+				i, len(nodes), h.writeQuorum,
+			)
+		}
+		out[i] = h.clientsOf(nodes)
+	}
+	return out, nil
+}
+
+// replicaPlacer returns placer for chunks of at most size bytes and number
+// of replicas of every chunk, see nextReplicas.
+func (h *Handler) replicaPlacer(ctx context.Context, size int64) (*placer, int, error) {
+	stat, err := h.fittingNodeStats(ctx, size, h.writeQuorum)
+	if err != nil {
+		return nil, 0, err
+	}
+	domains := h.countDomains(stat)
+	if domains < h.writeQuorum {
+		return nil, 0, errors.Wrapf(ErrNoNodes, "not enough failure domains for write quorum: %d < %d", domains, h.writeQuorum)
+	}
+	return h.newPlacer(stat), min(h.replicationFactor, domains), nil
+}
+
+// nextDistinctClients returns n clients on distinct nodes with least
+// amount of data that have space for chunk of size bytes.
+func (h *Handler) nextDistinctClients(ctx context.Context, n int, size int64) ([]NodeClient, error) {
+	p, err := h.distinctPlacer(ctx, n, size)
+	if err != nil {
+		return nil, err
+	}
+	nodes := p.next(n, size)
+	if len(nodes) < n {
+		return nil, errors.Wrapf(ErrInsufficientCapacity, "%d nodes have space for %d bytes, need %d", len(nodes), size, n)
+	}
+	return h.clientsOf(nodes), nil
+}
+
+// distinctPlacer returns placer for groups of n chunks of at most size
+// bytes on distinct failure domains, see nextDistinctClients.
+func (h *Handler) distinctPlacer(ctx context.Context, n int, size int64) (*placer, error) {
+	stat, err := h.fittingNodeStats(ctx, size, n)
+	if err != nil {
+		return nil, err
+	}
+	if domains := h.countDomains(stat); domains < n {
+		return nil, errors.Wrapf(ErrNoNodes, "not enough failure domains: %d < %d", domains, n)
+	}
+	return h.newPlacer(stat), nil
+}
+
+// clientsOf returns clients of nodes.
+func (h *Handler) clientsOf(nodes []NodeStat) []NodeClient {
 	clients := make([]NodeClient, len(nodes))
 	for i, v := range nodes {
 		clients[i] = h.GetClient(v.BaseURL)
 	}
-	return clients, nil
+	return clients
 }
 
 // GetClient creates or returns existing client to baseURL.
@@ -176,180 +650,552 @@ func (h *Handler) register(w http.ResponseWriter, r *http.Request) {
 	defer span.End()
 	baseURL := r.URL.Query().Get("baseURL")
 	if baseURL == "" {
-		http.Error(w, "baseURL is required", http.StatusBadRequest)
+		httpError(w, "baseURL is required", http.StatusBadRequest)
 		return
 	}
-	if err := h.storage.AddNode(ctx, Node{BaseURL: baseURL}); err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+	topology := node.ParseTopology(r.URL.Query())
+	if err := h.storage.AddNode(ctx, Node{
+		BaseURL:  baseURL,
+		LastSeen: h.now(),
+		Status:   node.Status{State: node.StateOK},
+		Topology: topology,
+	}); err != nil {
+		writeError(w, err)
 		return
 	}
 	zctx.From(ctx).Info("Registered node",
 		zap.String("baseURL", baseURL),
+		zap.String("zone", topology.Zone),
+		zap.String("rack", topology.Rack),
+		zap.String("host", topology.Host),
 	)
 }
 
-func (h *Handler) download(w http.ResponseWriter, r *http.Request) {
-	ctx, span := h.tracer.Start(r.Context(), "handler.Download")
+// report handles report of corrupted chunk replica from registered node.
+//
+// Replica is removed from metadata, so it is no longer read. The last
+// replica is kept, so chunk is not lost from metadata by mistaken report,
+// and corrupted data is still detected on read.
+func (h *Handler) report(w http.ResponseWriter, r *http.Request) {
+	ctx, span := h.tracer.Start(r.Context(), "handler.Report")
 	defer span.End()
 
-	fileName := r.PathValue("fileName")
-	if fileName == "" {
-		http.Error(w, "fileName is required", http.StatusBadRequest)
+	if r.Method != http.MethodPost {
+		httpError(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	baseURL := r.URL.Query().Get("baseURL")
+	if baseURL == "" {
+		httpError(w, "baseURL is required", http.StatusBadRequest)
 		return
 	}
-	file, err := h.storage.File(ctx, fileName)
+	chunkID, err := uuid.Parse(r.URL.Query().Get("chunkID"))
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		httpError(w, errors.Wrap(err, "parse chunkID").Error(), http.StatusBadRequest)
 		return
 	}
-
-	w.Header().Set("Content-Length", fmt.Sprint(file.Size))
-
-	// Read chunks continuously.
-	for _, chunk := range file.Chunks {
-		client := h.GetClient(chunk.NodeBaseURL)
-
-		if err := client.Read(ctx, chunk.ID, w); err != nil {
-			// Failed.
-			span.RecordError(err,
-				trace.WithAttributes(
-					attribute.Int("chunkIndex", chunk.Index),
-					attribute.String("chunkID", chunk.ID.String()),
-				),
+	if err := h.storage.RemoveReportedReplica(ctx, chunkID, baseURL); err != nil {
+		var lastReplica *LastReplicaErr
+		if errors.As(err, &lastReplica) {
+			zctx.From(ctx).Error("Last replica of chunk is reported as corrupted",
+				zap.String("chunkID", chunkID.String()),
+				zap.String("baseURL", baseURL),
 			)
-			return
 		}
+		writeError(w, err)
+		return
 	}
-
-	// Success.
+	h.chunksReported.Add(ctx, 1)
+	zctx.From(ctx).Warn("Removed reported chunk replica",
+		zap.String("chunkID", chunkID.String()),
+		zap.String("baseURL", baseURL),
+	)
 }
 
-func (h *Handler) upload(w http.ResponseWriter, r *http.Request) {
-	ctx := r.Context()
-	ctx, span := h.tracer.Start(ctx, "handler.Upload")
+// deleteFile removes file from metadata, its chunks are deleted from nodes
+// by Collector.
+func (h *Handler) deleteFile(w http.ResponseWriter, r *http.Request) {
+	ctx, span := h.tracer.Start(r.Context(), "handler.DeleteFile")
 	defer span.End()
 
-	if err := r.ParseMultipartForm(h.maxMultipartFormMemory); err != nil {
-		http.Error(w, err.Error(), http.StatusBadRequest)
+	fileName := r.PathValue("fileName")
+	if err := validateFileName(fileName); err != nil {
+		writeError(w, err)
+		return
+	}
+	if err := h.storage.RemoveFile(ctx, fileName); err != nil {
+		writeError(w, err)
 		return
 	}
-	var formKey string
-	for k := range r.MultipartForm.File {
-		formKey = k
-		break
+	zctx.From(ctx).Info("Removed file", zap.String("fileName", fileName))
+	h.notifyCollector()
+
+	w.WriteHeader(http.StatusAccepted)
+}
+
+// notifyCollector wakes up Collector without waiting for its interval.
+func (h *Handler) notifyCollector() {
+	select {
+	case h.collect <- struct{}{}:
+	default:
+		// Already notified.
+	}
+}
+
+func (h *Handler) download(w http.ResponseWriter, r *http.Request) {
+	ctx, span := h.tracer.Start(r.Context(), "handler.Download")
+	defer span.End()
+
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		httpError(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
 	}
-	if formKey == "" {
-		http.Error(w, "file is required", http.StatusBadRequest)
+	fileName := r.PathValue("fileName")
+	if fileName == "" {
+		httpError(w, "fileName is required", http.StatusBadRequest)
 		return
 	}
-	zctx.From(ctx).Info("Selected file from form", zap.String("formKey", formKey))
-	formFile, fileHeader, err := r.FormFile(formKey)
+	file, err := h.requestedFile(ctx, r, fileName)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusBadRequest)
+		writeError(w, err)
 		return
 	}
+	if err := h.serveFile(ctx, w, r, file); err != nil {
+		writeError(w, err)
+	}
+}
 
-	// Split file into N chunks.
-	size := fileHeader.Size
-	if size < int64(h.chunksPerFile) {
-		http.Error(w, "file is too small", http.StatusBadRequest)
-		return
+// Trailers of download response that report whether all content was sent,
+// see acceptsTrailers.
+const (
+	// DownloadStatusTrailer is "complete" if all content was sent, or
+	// "failed" otherwise.
+	DownloadStatusTrailer = "X-Download-Status"
+	// DownloadErrorTrailer is the error that interrupted download.
+	DownloadErrorTrailer = "X-Download-Error"
+)
+
+// acceptsTrailers reports whether client of request accepts trailers,
+// i.e. sent "TE: trailers".
+func acceptsTrailers(r *http.Request) bool {
+	if !r.ProtoAtLeast(1, 1) {
+		return false
 	}
-	chunkSize := size / int64(h.chunksPerFile)
-	span.AddEvent("Splitting file into chunks",
-		trace.WithAttributes(
-			attribute.String("formKey", formKey),
-			attribute.String("fileName", fileHeader.Filename),
-			attribute.Int("chunksPerFile", h.chunksPerFile),
-			attribute.Int64("chunkSize", chunkSize),
-		),
+	for _, v := range r.Header.Values("TE") {
+		for _, te := range strings.Split(v, ",") {
+			te, _, _ = strings.Cut(te, ";")
+			if strings.EqualFold(strings.TrimSpace(te), "trailers") {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// serveFile responds to GET or HEAD request with content of file, or with
+// requested ranges of it.
+//
+// Status is sent with the first byte of content, so if reading fails before
+// that, the error is returned for caller to respond with. Once content is
+// sent, failure is reported by DownloadStatusTrailer and DownloadErrorTrailer
+// to clients that accept trailers, and connection is aborted for the rest.
+func (h *Handler) serveFile(ctx context.Context, w http.ResponseWriter, r *http.Request, file *File) error {
+	w.Header().Set("Accept-Ranges", "bytes")
+	if file.ContentType != "" {
+		w.Header().Set("Content-Type", file.ContentType)
+	}
+	if file.Checksum != nil {
+		w.Header().Set("ETag", formatETag(file.Checksum, file.PartCount))
+	}
+	if !file.CreatedAt.IsZero() {
+		w.Header().Set("Last-Modified", file.CreatedAt.UTC().Format(http.TimeFormat))
+	}
+	w.Header().Set("X-File-Version", file.Version.String())
+	if r.Method == http.MethodHead {
+		setDigest(w.Header(), file)
+		// Metadata is enough, nodes are not touched.
+		w.Header().Set("Content-Length", fmt.Sprint(file.Size))
+		return nil
+	}
+
+	var (
+		ranges []httpRange
+		err    error
 	)
-	// Prepare chunks and allocate clients to storage nodes.
-	chunks := make([]Chunk, h.chunksPerFile)
-	clients, err := h.NextClients(ctx, h.chunksPerFile)
-	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
-		return
+	if rangeHeader := r.Header.Get("Range"); rangeHeader != "" {
+		if ranges, err = parseRange(rangeHeader, file.Size); err != nil {
+			w.Header().Set("Content-Range", fmt.Sprintf("bytes */%d", file.Size))
+			if !errors.Is(err, errUnsatisfiableRange) {
+				// Malformed ranges are not satisfiable either.
+				err = errors.Wrap(errUnsatisfiableRange, err.Error())
+			}
+			return err
+		}
+	}
+
+	// Length is not sent with trailers, as HTTP/1.1 sends them only in
+	// chunked encoding.
+	trailers := acceptsTrailers(r)
+	setLength := func(n int64) {
+		if !trailers {
+			w.Header().Set("Content-Length", fmt.Sprint(n))
+		}
+	}
+	if trailers {
+		w.Header().Set("Trailer", DownloadStatusTrailer+", "+DownloadErrorTrailer)
+	}
+	sw := &statusWriter{W: w, Status: http.StatusPartialContent}
+	switch len(ranges) {
+	case 0:
+		setDigest(w.Header(), file)
+		setLength(file.Size)
+		sw.Status = http.StatusOK
+		err = h.readRange(ctx, file, 0, file.Size, sw)
+	case 1:
+		ra := ranges[0]
+		w.Header().Set("Content-Range", ra.contentRange(file.Size))
+		setLength(ra.length)
+		err = h.readRange(ctx, file, ra.start, ra.length, sw)
+	default:
+		mw := multipart.NewWriter(sw)
+		w.Header().Set("Content-Type", "multipart/byteranges; boundary="+mw.Boundary())
+		for _, ra := range ranges {
+			var part io.Writer
+			if part, err = mw.CreatePart(textproto.MIMEHeader{
+				"Content-Range": {ra.contentRange(file.Size)},
+				"Content-Type":  {cmp.Or(file.ContentType, "application/octet-stream")},
+			}); err != nil {
+				break
+			}
+			if err = h.readRange(ctx, file, ra.start, ra.length, part); err != nil {
+				break
+			}
+		}
+		if err == nil {
+			err = mw.Close()
+		}
 	}
-	for i := 0; i < h.chunksPerFile; i++ {
-		client := clients[i]
-		chunks[i] = Chunk{
-			Index:       i,
-			ID:          uuid.New(),
-			Offset:      int64(i) * chunkSize,
-			Size:        chunkSize,
-			NodeBaseURL: client.BaseURL(),
+	if err == nil {
+		// Content can be empty.
+		sw.WriteHeader()
+		if trailers {
+			w.Header().Set(DownloadStatusTrailer, "complete")
 		}
-		if i == h.chunksPerFile-1 {
-			// Last chunk.
-			chunks[i].Size = size - chunks[i].Offset
+		return nil
+	}
+
+	zctx.From(ctx).Error("Failed to send file",
+		zap.String("fileName", file.Name),
+		zap.Bool("started", sw.Wrote),
+		zap.Error(err),
+	)
+	if !sw.Wrote {
+		// Nothing is sent, so headers of content are replaced by error.
+		for _, k := range []string{"Content-Length", "Content-Range", "Content-Type", "Digest", "ETag", "Trailer"} {
+			w.Header().Del(k)
 		}
+		return err
+	}
+	if trailers {
+		w.Header().Set(DownloadStatusTrailer, "failed")
+		// Header values can't span lines, and joined errors do.
+		w.Header().Set(DownloadErrorTrailer, strings.ReplaceAll(err.Error(), "\n", "; "))
+		return nil
+	}
+	// Status is already sent, so abort connection to prevent client
+	// from treating partial or corrupted response as complete.
+	panic(http.ErrAbortHandler)
+}
+
+// statusWriter writes Status header to W before the first write.
+type statusWriter struct {
+	W      http.ResponseWriter
+	Status int
+	// Wrote is whether header is written.
+	Wrote bool
+}
+
+// WriteHeader writes Status header if it is not written yet.
+func (s *statusWriter) WriteHeader() {
+	if !s.Wrote {
+		s.Wrote = true
+		s.W.WriteHeader(s.Status)
 	}
+}
 
-	// Upload and save metadata concurrently.
-	g, ctx := errgroup.WithContext(ctx)
-	for _, chunk := range chunks {
-		client := h.GetClient(chunk.NodeBaseURL)
+func (s *statusWriter) Write(p []byte) (int, error) {
+	s.WriteHeader()
+	return s.W.Write(p)
+}
 
-		g.Go(func() error {
-			return client.Write(ctx, chunk.ID, &LimitReaderFrom{
-				R:      formFile,
-				N:      chunk.Size,
-				Offset: chunk.Offset,
-			})
+// formatETag returns quoted ETag of file with checksum and number of parts.
+// ETag of assembled file has number of parts as suffix, like ETag of S3
+// multipart object, as its checksum is not checksum of content.
+func formatETag(checksum []byte, partCount int) string {
+	if partCount > 0 {
+		return fmt.Sprintf(`"%x-%d"`, checksum, partCount)
+	}
+	return `"` + hex.EncodeToString(checksum) + `"`
+}
+
+// setDigest sets Digest header (RFC 3230) of full file content. Digest of
+// assembled file is unknown.
+func setDigest(header http.Header, file *File) {
+	if file.Checksum == nil || file.PartCount > 0 {
+		return
+	}
+	header.Set("Digest", "sha-256="+base64.StdEncoding.EncodeToString(file.Checksum))
+}
+
+// readRange reads length bytes of file starting from offset to w,
+// fetching only chunks that overlap the range.
+func (h *Handler) readRange(ctx context.Context, file *File, offset, length int64, w io.Writer) error {
+	var (
+		end     = offset + length
+		windows []chunkWindow
+	)
+	for _, chunk := range file.dataChunks() {
+		start, stop := max(offset, chunk.Offset), min(end, chunk.Offset+chunk.Size)
+		if start >= stop {
+			continue
+		}
+		windows = append(windows, chunkWindow{
+			Chunk:  chunk,
+			Offset: start - chunk.Offset,
+			Length: stop - start,
 		})
 	}
-	g.Go(func() error {
-		// Add file to metadata storage.
-		file := File{
-			Size:   size,
-			Name:   fileHeader.Filename,
-			Chunks: chunks,
+	if h.readAhead > 1 && len(windows) > 1 {
+		return h.readWindowsAhead(ctx, file, windows, w)
+	}
+	for _, win := range windows {
+		if err := h.readChunk(ctx, file, win.Chunk, win.Offset, win.Length, w); err != nil {
+			return chunkReadErr(ctx, win.Chunk, err)
 		}
-		return h.storage.AddFile(ctx, file)
+	}
+
+	// Success.
+	return nil
+}
+
+// chunkReadErr records failed read of chunk in span of ctx.
+func chunkReadErr(ctx context.Context, chunk Chunk, err error) error {
+	trace.SpanFromContext(ctx).RecordError(err,
+		trace.WithAttributes(
+			attribute.Int("chunkIndex", chunk.Index),
+			attribute.String("chunkID", chunk.ID.String()),
+		),
+	)
+	return errors.Wrapf(err, "read chunk %d", chunk.Index)
+}
+
+// readChunk reads length bytes of file data chunk starting from offset to w.
+//
+// Chunk of erasure-coded file is reconstructed from other shards if it
+// can't be read.
+func (h *Handler) readChunk(ctx context.Context, file *File, chunk Chunk, offset, length int64, w io.Writer) error {
+	cw := &countingWriter{W: w}
+	err := h.readReplicas(ctx, chunk, offset, length, cw)
+	if err == nil || !file.Erasure() || ctx.Err() != nil || errors.Is(err, node.ErrChecksumMismatch) {
+		// Data is already sent on checksum mismatch, nothing to recover.
+		return err
+	}
+	zctx.From(ctx).Warn("Reconstructing chunk",
+		zap.String("chunkID", chunk.ID.String()),
+		zap.Error(err),
+	)
+	// Reconstruction produces whole chunk, so cut requested window from it.
+	return h.reconstructChunk(ctx, file, chunk, &skipWriter{
+		W: &limitWriter{W: cw, N: length - cw.N},
+		N: offset + cw.N,
 	})
-	if err := g.Wait(); err != nil {
-		// Remove uploaded chunks.
-		link := trace.LinkFromContext(ctx)
-		// Use baseCtx as ctx can be already canceled.
-		ctx, span = h.tracer.Start(h.baseCtx, "Cleanup")
-		span.AddLink(link)
-		defer span.End()
-
-		for _, chunk := range chunks {
-			// Start new span with link to the previous span.
-			client := h.GetClient(chunk.NodeBaseURL)
-
-			if err := client.Delete(ctx, chunk.ID); err != nil {
-				zctx.From(ctx).Warn("Failed to delete chunk",
-					zap.String("chunkID", chunk.ID.String()),
-					zap.Error(err),
+}
+
+// readReplicas reads length bytes of chunk starting from offset to w,
+// falling back to other replicas on failure.
+//
+// Until any data is sent, read is hedged to the next replica if the first one
+// is slow to respond, see readHedged. If replica fails mid-stream, next
+// replica continues from already written position.
+//
+// Whole chunk is verified against its checksum after it was read. Nodes
+// verify chunks before sending them, so mismatch here means corruption in
+// transit and is returned as node.ErrChecksumMismatch.
+func (h *Handler) readReplicas(ctx context.Context, chunk Chunk, offset, length int64, w io.Writer) error {
+	if len(chunk.Nodes) == 0 {
+		return &ChunkUnavailableErr{Chunk: chunk.ID, Err: errors.New("no replicas")}
+	}
+	verify := chunk.Checksum != nil && offset == 0 && length == chunk.Size
+	hash := sha256.New()
+	if verify {
+		w = io.MultiWriter(w, hash)
+	}
+	hedged := 1
+	if h.hedging {
+		hedged = 2
+	}
+	var (
+		cw = &countingWriter{W: w}
+		// Replicas that were not read or were canceled by hedged read.
+		pending = slices.Clone(chunk.Nodes)
+		errs    []error
+	)
+	for len(pending) > 0 {
+		var err error
+		switch {
+		case cw.N == 0:
+			var failed []string
+			replicas := pending[:min(hedged, len(pending))]
+			failed, err = h.readHedged(ctx, chunk, offset, length, replicas, cw)
+			pending = slices.DeleteFunc(pending, func(baseURL string) bool {
+				return slices.Contains(failed, baseURL)
+			})
+		case cw.N < length:
+			baseURL := pending[0]
+			pending = pending[1:]
+			if err = h.readReplica(ctx, baseURL, chunk, offset+cw.N, length-cw.N, cw); err != nil {
+				err = h.replicaFailed(ctx, chunk, baseURL, err)
+			}
+		}
+		if err == nil {
+			if sum := hash.Sum(nil); verify && !bytes.Equal(sum, chunk.Checksum) {
+				return errors.Wrapf(node.ErrChecksumMismatch, "chunk %s: expected %x, got %x",
+					chunk.ID, chunk.Checksum, sum,
 				)
 			}
+			return nil
 		}
-		if err := h.storage.RemoveFile(ctx, fileHeader.Filename); err != nil {
-			zctx.From(ctx).Warn("Failed to remove file",
-				zap.String("fileName", fileHeader.Filename),
-				zap.Error(err),
-			)
+		if ctx.Err() != nil {
+			return ctx.Err()
 		}
+		errs = append(errs, err)
+	}
+	return &ChunkUnavailableErr{
+		Chunk: chunk.ID,
+		Err:   errors.Wrap(errors.Join(errs...), "all replicas failed"),
+	}
+}
+
+// readReplica reads length bytes of chunk starting from offset to w from
+// replica on node.
+func (h *Handler) readReplica(ctx context.Context, baseURL string, chunk Chunk, offset, length int64, w io.Writer) error {
+	client := h.GetClient(baseURL)
+	if offset == 0 && length == chunk.Size {
+		return client.Read(ctx, chunk.ID, w)
+	}
+	return client.ReadRange(ctx, chunk.ID, offset, length, w)
+}
 
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+// replicaFailed logs failed read of chunk replica on node and returns err
+// annotated with node.
+func (h *Handler) replicaFailed(ctx context.Context, chunk Chunk, baseURL string, err error) error {
+	if ctx.Err() == nil {
+		zctx.From(ctx).Warn("Failed to read chunk replica",
+			zap.String("chunkID", chunk.ID.String()),
+			zap.String("node", baseURL),
+			zap.Error(err),
+		)
+	}
+	return errors.Wrap(err, baseURL)
+}
+
+// commitUpload records uploaded file and responds with its link, or removes
+// chunks written to targets if upload or recording failed.
+func (h *Handler) commitUpload(ctx context.Context, w http.ResponseWriter, r *http.Request, file File, targets [][]replicaWrite, err error) {
+	if err == nil {
+		err = h.addFile(ctx, &file)
+	}
+	if err != nil {
+		h.removeChunks(ctx, file.Chunks, targets)
+		writeError(w, err)
 		return
 	}
 
-	// Return uploaded file link.
+	writeLink(w, r, &file)
+}
+
+// writeLink responds with download link of uploaded file and its version.
+func writeLink(w http.ResponseWriter, r *http.Request, file *File) {
 	// Assume that we are on 127.0.0.1.
 	u := &url.URL{
 		Scheme: "http",
 		Host:   r.Host,
-		Path:   filepath.Join("download", fileHeader.Filename),
+		Path:   filepath.Join("download", file.Name),
 	}
 
+	w.Header().Set("X-File-Version", file.Version.String())
 	w.WriteHeader(http.StatusOK)
 	_, _ = fmt.Fprintln(w, u.String())
 }
 
+// replicaWrite is write of chunk replica by upload, that is undone if
+// upload fails.
+type replicaWrite struct {
+	client NodeClient
+	// written is zero if write failed or was not made.
+	written node.WriteResult
+}
+
+// removeChunks removes chunks of failed upload from nodes they were written
+// to.
+//
+// Chunks with the same content can be written by other uploads at once, so
+// only chunks that were created by upload and were not written again since
+// are deleted. Others can be recorded by other uploads, and are left to
+// OrphanCollector otherwise, like chunks of writes with lost response.
+func (h *Handler) removeChunks(ctx context.Context, chunks []Chunk, targets [][]replicaWrite) {
+	link := trace.LinkFromContext(ctx)
+	// Use baseCtx as ctx can be already canceled.
+	ctx, span := h.tracer.Start(h.baseCtx, "Cleanup")
+	span.AddLink(link)
+	defer span.End()
+
+	// Replicas that failed to be deleted are left to collector.
+	var garbage []Replica
+	for i, writes := range targets {
+		chunk := chunks[i]
+		for _, write := range writes {
+			if err := h.deleteWritten(ctx, write.client, chunk.ID, write.written); err != nil {
+				zctx.From(ctx).Warn("Failed to delete chunk",
+					zap.String("chunkID", chunk.ID.String()),
+					zap.String("node", write.client.BaseURL()),
+					zap.Error(err),
+				)
+				garbage = append(garbage, Replica{ChunkID: chunk.ID, Node: write.client.BaseURL()})
+			}
+		}
+	}
+	if len(garbage) > 0 {
+		if err := h.storage.AddGarbage(ctx, garbage); err != nil {
+			zctx.From(ctx).Error("Failed to record garbage", zap.Error(err))
+		}
+		h.notifyCollector()
+	}
+}
+
+// deleteWritten undoes write of chunk to node, deleting chunk only if it
+// was created by write and was not written again since.
+func (h *Handler) deleteWritten(ctx context.Context, client NodeClient, id uuid.UUID, written node.WriteResult) error {
+	if !written.Created {
+		return nil
+	}
+	err := client.DeleteUnmodified(ctx, id, written.ModTime)
+	if errors.Is(err, node.ErrChunkModified) {
+		// Written by other upload.
+		return nil
+	}
+	return err
+}
+
+// checksum returns SHA-256 of r.
+func checksum(r io.Reader) ([]byte, error) {
+	h := sha256.New()
+	if _, err := io.Copy(h, r); err != nil {
+		return nil, errors.Wrap(err, "checksum")
+	}
+	return h.Sum(nil), nil
+}
+
 func (h *Handler) observeMetrics(ctx context.Context, observer metric.Observer) error {
 	stats, err := h.storage.NodeStats(ctx)
 	if err != nil {
@@ -369,6 +1215,11 @@ func (h *Handler) observeMetrics(ctx context.Context, observer metric.Observer)
 		)
 		observer.ObserveInt64(h.nodeTotalChunks, int64(stat.TotalChunks), attrs)
 		observer.ObserveInt64(h.nodeTotalSize, stat.TotalSize, attrs)
+		var up int64
+		if h.alive(stat) {
+			up = 1
+		}
+		observer.ObserveInt64(h.nodeUp, up, attrs)
 	}
 
 	return nil
@@ -380,16 +1231,44 @@ func NewHandler(
 	storage HandlerStorage,
 	tracerProvider trace.TracerProvider,
 	meterProvider metric.MeterProvider,
-) (http.Handler, error) {
+	opts HandlerOptions,
+) (*Handler, error) {
+	opts.setDefaults()
+	if err := opts.validate(); err != nil {
+		return nil, errors.Wrap(err, "validate options")
+	}
 	const name = "stor.front"
 	h := &Handler{
-		storage:                storage,
-		maxMultipartFormMemory: 32 * 1024 * 1024,
-		chunksPerFile:          6,
-		tracer:                 tracerProvider.Tracer(name),
-		baseCtx:                baseCtx,
-		clients:                make(map[string]NodeClient),
-		clientConstructor:      clientConstructor,
+		storage:           storage,
+		replicationFactor: opts.ReplicationFactor,
+		writeQuorum:       opts.WriteQuorum,
+		heartbeatTimeout:  opts.HeartbeatTimeout,
+		capacityReserve:   opts.CapacityReserve,
+		failureLevel:      slices.Index(domainLevels[:], opts.FailureDomain),
+		chunking:          opts.Chunking,
+		uploadWindow:      opts.UploadWindow,
+		uploadMemory:      opts.UploadMemory,
+		uploadBuffers:     semaphore.NewWeighted(opts.UploadMemory),
+		uploadTTL:         opts.UploadTTL,
+		keepVersions:      opts.KeepVersions,
+		versionTTL:        opts.VersionTTL,
+		readAhead:         opts.ReadAhead,
+		readAheadMemory:   opts.ReadAheadMemory,
+		readAheadBuffers:  semaphore.NewWeighted(opts.ReadAheadMemory),
+		hedging:           !opts.DisableHedging,
+		hedgeQuantile:     opts.HedgeQuantile,
+		minHedgeDelay:     opts.HedgeDelay,
+		moveDeleteDelay:   opts.MoveDeleteDelay,
+		drainPageSize:     opts.DrainPageSize,
+		drainCheck:        opts.DrainCheckInterval,
+		now:               time.Now,
+		tracer:            tracerProvider.Tracer(name),
+		baseCtx:           baseCtx,
+		clients:           make(map[string]NodeClient),
+		drains:            make(map[string]*DrainProgress),
+		uploads:           make(map[uuid.UUID]struct{}),
+		collect:           make(chan struct{}, 1),
+		clientConstructor: clientConstructor,
 	}
 	{
 		// Initialize metrics.
@@ -401,20 +1280,77 @@ func NewHandler(
 		if h.nodeTotalSize, err = meter.Int64ObservableGauge("node.total_size"); err != nil {
 			return nil, errors.Wrap(err, "node.total_size")
 		}
+		if h.nodeUp, err = meter.Int64ObservableGauge("node.up"); err != nil {
+			return nil, errors.Wrap(err, "node.up")
+		}
+		if h.chunksReported, err = meter.Int64Counter("chunks.reported"); err != nil {
+			return nil, errors.Wrap(err, "chunks.reported")
+		}
+		if h.drainedChunks, err = meter.Int64Counter("drain.chunks"); err != nil {
+			return nil, errors.Wrap(err, "drain.chunks")
+		}
+		if h.downloadStall, err = meter.Float64Histogram("download.stall",
+			metric.WithUnit("s"),
+			metric.WithDescription("Time download waited for chunk that was not read ahead yet"),
+		); err != nil {
+			return nil, errors.Wrap(err, "download.stall")
+		}
+		if h.hedgedReads, err = meter.Int64Counter("read.hedged",
+			metric.WithDescription("Chunk reads that were hedged to another replica"),
+		); err != nil {
+			return nil, errors.Wrap(err, "read.hedged")
+		}
+		if h.hedgedReadsWon, err = meter.Int64Counter("read.hedge_won",
+			metric.WithDescription("Hedged chunk reads where another replica responded first"),
+		); err != nil {
+			return nil, errors.Wrap(err, "read.hedge_won")
+		}
 		if _, err := meter.RegisterCallback(h.observeMetrics,
 			h.nodeTotalChunks,
 			h.nodeTotalSize,
+			h.nodeUp,
 		); err != nil {
 			return nil, errors.Wrap(err, "register callback")
 		}
 	}
 
-	mux := http.NewServeMux()
-	mux.HandleFunc("/health", func(w http.ResponseWriter, r *http.Request) {
+	h.routes = http.NewServeMux()
+	h.routes.HandleFunc("/health", func(w http.ResponseWriter, r *http.Request) {
 		w.WriteHeader(http.StatusOK)
 	})
-	mux.HandleFunc("/register", h.register)
-	mux.HandleFunc("/download/{fileName}", h.download)
-	mux.HandleFunc("/upload", h.upload)
-	return mux, nil
+	h.routes.HandleFunc("/register", h.register)
+	h.routes.HandleFunc("/heartbeat", h.heartbeat)
+	h.routes.HandleFunc("/admin/nodes", h.adminNodes)
+	h.routes.HandleFunc("/admin/nodes/decommission", h.decommission)
+	h.routes.HandleFunc("/report", h.report)
+	h.routes.HandleFunc("/download/{fileName}", h.download)
+	h.routes.HandleFunc("/upload", h.uploadMultipart)
+	h.routes.HandleFunc("PUT /files/{fileName}", h.uploadBody)
+	h.routes.HandleFunc("GET /files", h.listFiles)
+	h.routes.HandleFunc("POST /files", h.uploadMultipart)
+	h.routes.HandleFunc("DELETE /files/{fileName}", h.deleteFile)
+	h.routes.HandleFunc("GET /files/{fileName}/meta", h.fileMeta)
+	h.routes.HandleFunc("GET /files/{fileName}/versions", h.listVersions)
+	h.routes.HandleFunc("POST /uploads", h.createUpload)
+	h.routes.HandleFunc("GET /uploads/{id}", h.getUpload)
+	h.routes.HandleFunc("PUT /uploads/{id}/parts/{number}", h.uploadPart)
+	h.routes.HandleFunc("POST /uploads/{id}/complete", h.completeUpload)
+	h.routes.HandleFunc("DELETE /uploads/{id}", h.abortUpload)
+	h.routes.HandleFunc("OPTIONS /tus", h.tusOptions)
+	h.routes.HandleFunc("POST /tus", h.tusCreate)
+	h.routes.HandleFunc("OPTIONS /tus/{id}", h.tusOptions)
+	h.routes.HandleFunc("HEAD /tus/{id}", h.tusOffset)
+	h.routes.HandleFunc("PATCH /tus/{id}", h.tusPatch)
+	h.routes.HandleFunc("DELETE /tus/{id}", h.tusTerminate)
+	return h, nil
+}
+
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	h.routes.ServeHTTP(w, r)
+}
+
+// Handle registers additional handler for pattern, e.g. admin API of
+// background workers.
+func (h *Handler) Handle(pattern string, handler http.Handler) {
+	h.routes.Handle(pattern, handler)
 }
@@ -3,25 +3,40 @@ package front
 import (
 	"bytes"
 	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
 	"io"
+	"maps"
 	"math/rand"
+	"mime"
 	"mime/multipart"
 	"net/http"
 	"net/http/httptest"
 	"net/url"
+	"slices"
+	"strings"
 	"sync"
 	"testing"
+	"time"
 
 	"github.com/google/uuid"
 	"github.com/stretchr/testify/require"
 	noopMeter "go.opentelemetry.io/otel/metric/noop"
 	noopTracer "go.opentelemetry.io/otel/trace/noop"
+
+	"github.com/ernado/stor/internal/node"
 )
 
 type inMemoryStorage struct {
-	files map[string]File
-	nodes map[string]Node
-	mux   sync.Mutex
+	files   map[string]File
+	nodes   map[string]Node
+	garbage map[Replica]Replica // by chunk and node
+	buckets map[string]Bucket
+	uploads map[uuid.UUID]Upload
+	parts   map[uuid.UUID]map[int]Part
+	mux     sync.Mutex
 }
 
 func (s *inMemoryStorage) NodeStats(ctx context.Context) ([]NodeStat, error) {
@@ -30,11 +45,17 @@ func (s *inMemoryStorage) NodeStats(ctx context.Context) ([]NodeStat, error) {
 	var stats []NodeStat
 	for _, node := range s.nodes {
 		stat := NodeStat{
-			BaseURL: node.BaseURL,
+			BaseURL:  node.BaseURL,
+			LastSeen: node.LastSeen,
+			Status:   node.Status,
+			Draining: node.Draining,
+			Topology: node.Topology,
 		}
+		seen := make(map[uuid.UUID]bool)
 		for _, file := range s.files {
 			for _, chunk := range file.Chunks {
-				if chunk.NodeBaseURL == node.BaseURL {
+				if slices.Contains(chunk.Nodes, node.BaseURL) && !seen[chunk.ID] {
+					seen[chunk.ID] = true
 					stat.TotalChunks++
 					stat.TotalSize += chunk.Size
 				}
@@ -52,23 +73,463 @@ func (s *inMemoryStorage) File(_ context.Context, name string) (*File, error) {
 	if !ok {
 		return nil, &FileNotFoundErr{File: name}
 	}
+	// Deep copy, as callers can modify chunks.
+	v.Chunks = slices.Clone(v.Chunks)
+	for i := range v.Chunks {
+		v.Chunks[i].Nodes = slices.Clone(v.Chunks[i].Nodes)
+	}
 	return &v, nil
 }
 
-func (s *inMemoryStorage) AddFile(_ context.Context, file File) error {
+func (s *inMemoryStorage) Files(_ context.Context, prefix, from string, limit int) ([]FileInfo, error) {
 	s.mux.Lock()
 	defer s.mux.Unlock()
+	var files []FileInfo
+	for _, file := range s.files {
+		if strings.HasPrefix(file.Name, prefix) && file.Name >= from {
+			files = append(files, FileInfo{
+				Name:       file.Name,
+				Size:       file.Size,
+				ChunkCount: file.ChunkCount,
+				CreatedAt:  file.CreatedAt,
+				Checksum:   file.Checksum,
+				PartCount:  file.PartCount,
+			})
+		}
+	}
+	slices.SortFunc(files, func(a, b FileInfo) int {
+		return strings.Compare(a.Name, b.Name)
+	})
+	return files[:min(len(files), limit)], nil
+}
+
+// replicas returns replicas of chunk if it is referenced by any file or
+// part of multipart upload.
+func (s *inMemoryStorage) replicas(id uuid.UUID) ([]string, bool) {
+	for _, file := range s.files {
+		for _, chunk := range file.Chunks {
+			if chunk.ID == id {
+				return slices.Clone(chunk.Nodes), true
+			}
+		}
+	}
+	for _, parts := range s.parts {
+		for _, part := range parts {
+			for _, chunk := range part.Chunks {
+				if chunk.ID == id {
+					return slices.Clone(chunk.Nodes), true
+				}
+			}
+		}
+	}
+	return nil, false
+}
+
+// recordChunks returns chunks with recorded replicas of referenced ones,
+// removing replicas of others from garbage.
+func (s *inMemoryStorage) recordChunks(chunks []Chunk) []Chunk {
+	chunks = slices.Clone(chunks)
+	for i, chunk := range chunks {
+		// Replicas of referenced chunk are kept as recorded.
+		if nodes, ok := s.replicas(chunk.ID); ok {
+			chunks[i].Nodes = nodes
+			continue
+		}
+		for _, node := range chunk.Nodes {
+			delete(s.garbage, Replica{ChunkID: chunk.ID, Node: node})
+		}
+	}
+	return chunks
+}
+
+// release moves replicas of chunks that are not referenced by any file
+// to garbage.
+func (s *inMemoryStorage) release(chunks []Chunk) {
+	for _, chunk := range chunks {
+		if _, ok := s.replicas(chunk.ID); ok {
+			continue
+		}
+		for _, node := range chunk.Nodes {
+			s.addGarbage(Replica{ChunkID: chunk.ID, Node: node, ReleasedAt: time.Now()})
+		}
+	}
+}
+
+// replaceFile makes file current, replaced file is kept as noncurrent version.
+func (s *inMemoryStorage) replaceFile(file File) {
+	if old, ok := s.files[file.Name]; ok {
+		old.Name = versionKey(file.Name, old.Version)
+		s.files[old.Name] = old
+	}
+	file.Chunks = s.recordChunks(file.Chunks)
 	s.files[file.Name] = file
+}
+
+func (s *inMemoryStorage) AddFile(_ context.Context, file File) error {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	s.replaceFile(file)
+	return nil
+}
+
+func (s *inMemoryStorage) AddBucket(_ context.Context, bucket Bucket) error {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	if _, ok := s.buckets[bucket.Name]; ok {
+		return &BucketExistsErr{Bucket: bucket.Name}
+	}
+	s.buckets[bucket.Name] = bucket
+	return nil
+}
+
+func (s *inMemoryStorage) Bucket(_ context.Context, name string) (*Bucket, error) {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	bucket, ok := s.buckets[name]
+	if !ok {
+		return nil, &BucketNotFoundErr{Bucket: name}
+	}
+	return &bucket, nil
+}
+
+func (s *inMemoryStorage) Buckets(_ context.Context) ([]Bucket, error) {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	buckets := slices.Collect(maps.Values(s.buckets))
+	slices.SortFunc(buckets, func(a, b Bucket) int {
+		return strings.Compare(a.Name, b.Name)
+	})
+	return buckets, nil
+}
+
+func (s *inMemoryStorage) RemoveBucket(_ context.Context, name string) error {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	if _, ok := s.buckets[name]; !ok {
+		return &BucketNotFoundErr{Bucket: name}
+	}
+	delete(s.buckets, name)
+	return nil
+}
+
+func (s *inMemoryStorage) AddUpload(_ context.Context, upload Upload) error {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	s.uploads[upload.ID] = upload
+	s.parts[upload.ID] = make(map[int]Part)
+	return nil
+}
+
+func (s *inMemoryStorage) Upload(_ context.Context, id uuid.UUID) (*Upload, error) {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	upload, ok := s.uploads[id]
+	if !ok {
+		return nil, &UploadNotFoundErr{Upload: id}
+	}
+	return &upload, nil
+}
+
+func (s *inMemoryStorage) Uploads(_ context.Context, updatedBefore time.Time, limit int) ([]Upload, error) {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	var uploads []Upload
+	for _, upload := range s.uploads {
+		if len(uploads) < limit && upload.UpdatedAt.Before(updatedBefore) {
+			uploads = append(uploads, upload)
+		}
+	}
+	return uploads, nil
+}
+
+func (s *inMemoryStorage) AddPart(_ context.Context, id uuid.UUID, part Part) error {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	return s.addPart(id, part, false)
+}
+
+func (s *inMemoryStorage) AppendPart(_ context.Context, id uuid.UUID, part Part) error {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	return s.addPart(id, part, true)
+}
+
+// addPart adds or replaces part, or only appends it after the last one.
+func (s *inMemoryStorage) addPart(id uuid.UUID, part Part, appendOnly bool) error {
+	parts, ok := s.parts[id]
+	if !ok {
+		return &UploadNotFoundErr{Upload: id}
+	}
+	if appendOnly && len(parts) != part.Number-1 {
+		return &PartChangedErr{Upload: id, Number: part.Number}
+	}
+	old := parts[part.Number]
+	delete(parts, part.Number)
+	part.Chunks = s.recordChunks(part.Chunks)
+	parts[part.Number] = part
+	s.release(old.Chunks)
+	upload := s.uploads[id]
+	upload.UpdatedAt = part.CreatedAt
+	s.uploads[id] = upload
+	return nil
+}
+
+func (s *inMemoryStorage) Parts(_ context.Context, id uuid.UUID) ([]Part, error) {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	parts := slices.Collect(maps.Values(s.parts[id]))
+	slices.SortFunc(parts, func(a, b Part) int {
+		return a.Number - b.Number
+	})
+	return parts, nil
+}
+
+// removeUpload removes multipart upload and returns chunks of its parts.
+func (s *inMemoryStorage) removeUpload(id uuid.UUID) ([]Chunk, error) {
+	parts, ok := s.parts[id]
+	if !ok {
+		return nil, &UploadNotFoundErr{Upload: id}
+	}
+	var chunks []Chunk
+	for _, part := range parts {
+		chunks = append(chunks, part.Chunks...)
+	}
+	delete(s.parts, id)
+	delete(s.uploads, id)
+	return chunks, nil
+}
+
+func (s *inMemoryStorage) CompleteUpload(_ context.Context, id uuid.UUID, parts []Part, file File) error {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	recorded, ok := s.parts[id]
+	if !ok {
+		return &UploadNotFoundErr{Upload: id}
+	}
+	selected, err := selectParts(id, slices.Collect(maps.Values(recorded)), parts)
+	if err != nil {
+		return err
+	}
+	assembleChunks(&file, selected)
+	s.replaceFile(file)
+	chunks, err := s.removeUpload(id)
+	if err != nil {
+		return err
+	}
+	s.release(chunks)
+	return nil
+}
+
+func (s *inMemoryStorage) RemoveUpload(_ context.Context, id uuid.UUID) error {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	chunks, err := s.removeUpload(id)
+	if err != nil {
+		return err
+	}
+	s.release(chunks)
+	return nil
+}
+
+func (s *inMemoryStorage) RemoveStaleUpload(_ context.Context, id uuid.UUID, updatedBefore time.Time) error {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	if upload, ok := s.uploads[id]; !ok || !upload.UpdatedAt.Before(updatedBefore) {
+		return &UploadNotFoundErr{Upload: id}
+	}
+	chunks, err := s.removeUpload(id)
+	if err != nil {
+		return err
+	}
+	s.release(chunks)
 	return nil
 }
 
 func (s *inMemoryStorage) RemoveFile(_ context.Context, name string) error {
 	s.mux.Lock()
 	defer s.mux.Unlock()
+	old, ok := s.files[name]
+	if !ok {
+		return &FileNotFoundErr{File: name}
+	}
 	delete(s.files, name)
+	chunks := old.Chunks
+	for key, version := range s.files {
+		if strings.HasPrefix(key, versionKeyPrefix(name)) {
+			delete(s.files, key)
+			chunks = append(chunks, version.Chunks...)
+		}
+	}
+	s.release(chunks)
 	return nil
 }
 
+func (s *inMemoryStorage) RecordedChunks(_ context.Context, baseURL string, ids []uuid.UUID) ([]uuid.UUID, error) {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	var recorded []uuid.UUID
+	for _, id := range ids {
+		if nodes, ok := s.replicas(id); ok && slices.Contains(nodes, baseURL) {
+			recorded = append(recorded, id)
+		}
+	}
+	return recorded, nil
+}
+
+// recorded returns chunk of every recorded replica.
+func (s *inMemoryStorage) recorded() map[Replica]Chunk {
+	out := make(map[Replica]Chunk)
+	add := func(chunks []Chunk) {
+		for _, chunk := range chunks {
+			for _, node := range chunk.Nodes {
+				out[Replica{ChunkID: chunk.ID, Node: node}] = chunk
+			}
+		}
+	}
+	for _, file := range s.files {
+		add(file.Chunks)
+	}
+	for _, parts := range s.parts {
+		for _, part := range parts {
+			add(part.Chunks)
+		}
+	}
+	return out
+}
+
+func (s *inMemoryStorage) RecordedRange(_ context.Context, baseURL string, after, last uuid.UUID) ([]uuid.UUID, error) {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	var recorded []uuid.UUID
+	for replica := range s.recorded() {
+		id := replica.ChunkID.String()
+		if replica.Node == baseURL && id > after.String() && id <= last.String() {
+			recorded = append(recorded, replica.ChunkID)
+		}
+	}
+	return recorded, nil
+}
+
+func (s *inMemoryStorage) Replicas(_ context.Context, after Replica, limit int) ([]Replica, error) {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	var replicas []Replica
+	for replica := range s.recorded() {
+		if compareReplicas(replica, after) > 0 {
+			replicas = append(replicas, replica)
+		}
+	}
+	slices.SortFunc(replicas, compareReplicas)
+	return replicas[:min(limit, len(replicas))], nil
+}
+
+func (s *inMemoryStorage) NodeReplicas(_ context.Context, baseURL string, after uuid.UUID, limit int) ([]Chunk, error) {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	var chunks []Chunk
+	for replica, chunk := range s.recorded() {
+		if replica.Node == baseURL && bytes.Compare(chunk.ID[:], after[:]) > 0 {
+			nodes, _ := s.replicas(chunk.ID)
+			chunks = append(chunks, Chunk{
+				ID:       chunk.ID,
+				Size:     chunk.Size,
+				Nodes:    nodes,
+				Checksum: chunk.Checksum,
+			})
+		}
+	}
+	slices.SortFunc(chunks, func(a, b Chunk) int {
+		return bytes.Compare(a.ID[:], b.ID[:])
+	})
+	return chunks[:min(limit, len(chunks))], nil
+}
+
+func (s *inMemoryStorage) ChunkFile(ctx context.Context, id uuid.UUID) (*File, error) {
+	s.mux.Lock()
+	var name string
+	for key, file := range s.files {
+		if slices.ContainsFunc(file.Chunks, func(c Chunk) bool { return c.ID == id }) {
+			name = key
+		}
+	}
+	s.mux.Unlock()
+	if name == "" {
+		return nil, &FileNotFoundErr{File: "with chunk " + id.String()}
+	}
+	return s.File(ctx, name)
+}
+
+func (s *inMemoryStorage) AddGarbage(_ context.Context, replicas []Replica) error {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	for _, replica := range replicas {
+		s.addGarbage(replica)
+	}
+	return nil
+}
+
+// addGarbage adds replica to garbage, keeping its times if it is already
+// there.
+func (s *inMemoryStorage) addGarbage(replica Replica) {
+	key := Replica{ChunkID: replica.ChunkID, Node: replica.Node}
+	if _, ok := s.garbage[key]; !ok {
+		s.garbage[key] = replica
+	}
+}
+
+// garbageKeys returns chunk and node of every replica in garbage.
+func (s *inMemoryStorage) garbageKeys() []Replica {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	return slices.Collect(maps.Keys(s.garbage))
+}
+
+func compareReplicas(a, b Replica) int {
+	if c := bytes.Compare(a.ChunkID[:], b.ChunkID[:]); c != 0 {
+		return c
+	}
+	return strings.Compare(a.Node, b.Node)
+}
+
+func (s *inMemoryStorage) Garbage(_ context.Context, after Replica, limit int) ([]Replica, error) {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	var replicas []Replica
+	for key, replica := range s.garbage {
+		if compareReplicas(key, after) > 0 {
+			replicas = append(replicas, replica)
+		}
+	}
+	slices.SortFunc(replicas, compareReplicas)
+	return replicas[:min(limit, len(replicas))], nil
+}
+
+func (s *inMemoryStorage) NodeGarbage(_ context.Context, baseURL string) (int, error) {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	var count int
+	for replica := range s.garbage {
+		if replica.Node == baseURL {
+			count++
+		}
+	}
+	return count, nil
+}
+
+func (s *inMemoryStorage) RemoveGarbage(_ context.Context, replica Replica) error {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	delete(s.garbage, Replica{ChunkID: replica.ChunkID, Node: replica.Node})
+	return nil
+}
+
+func (s *inMemoryStorage) ChunkReplicas(_ context.Context, id uuid.UUID) ([]string, error) {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	nodes, _ := s.replicas(id)
+	return nodes, nil
+}
+
 func (s *inMemoryStorage) Nodes(_ context.Context) ([]Node, error) {
 	s.mux.Lock()
 	defer s.mux.Unlock()
@@ -82,14 +543,156 @@ func (s *inMemoryStorage) Nodes(_ context.Context) ([]Node, error) {
 func (s *inMemoryStorage) AddNode(_ context.Context, node Node) error {
 	s.mux.Lock()
 	defer s.mux.Unlock()
+	node.Draining = s.nodes[node.BaseURL].Draining
 	s.nodes[node.BaseURL] = node
 	return nil
 }
 
+func (s *inMemoryStorage) UpdateNode(_ context.Context, baseURL string, lastSeen time.Time, status node.Status) error {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	n, ok := s.nodes[baseURL]
+	if !ok {
+		return &NodeNotFoundErr{Node: baseURL}
+	}
+	n.LastSeen = lastSeen
+	n.Status = status
+	s.nodes[baseURL] = n
+	return nil
+}
+
+func (s *inMemoryStorage) SetNodeDraining(_ context.Context, baseURL string, draining bool) error {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	node, ok := s.nodes[baseURL]
+	if ok {
+		node.Draining = draining
+		s.nodes[baseURL] = node
+	}
+	return nil
+}
+
+func (s *inMemoryStorage) RemoveNode(_ context.Context, baseURL string) error {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	delete(s.nodes, baseURL)
+	return nil
+}
+
+func (s *inMemoryStorage) MoveReplica(_ context.Context, chunk Chunk, from, to string, deleteAt time.Time) error {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	found := false
+	for _, file := range s.files {
+		for _, c := range file.Chunks {
+			if c.ID == chunk.ID && slices.Contains(c.Nodes, from) {
+				found = true
+			}
+		}
+	}
+	if !found {
+		return &ReplicaNotFoundErr{Chunk: chunk.ID, Node: from}
+	}
+	s.garbage[Replica{ChunkID: chunk.ID, Node: from}] = Replica{ChunkID: chunk.ID, Node: from, NotBefore: deleteAt}
+	for name, file := range s.files {
+		chunks := slices.Clone(file.Chunks)
+		for i, c := range chunks {
+			if c.ID == chunk.ID {
+				nodes := slices.DeleteFunc(slices.Clone(c.Nodes), func(n string) bool {
+					return n == from || n == to
+				})
+				chunks[i].Nodes = append(nodes, to)
+			}
+		}
+		file.Chunks = chunks
+		s.files[name] = file
+	}
+	return nil
+}
+
+// referenced reports whether chunk is referenced by file or part.
+func (s *inMemoryStorage) referenced(id uuid.UUID) bool {
+	hasChunk := func(chunks []Chunk) bool {
+		return slices.ContainsFunc(chunks, func(c Chunk) bool { return c.ID == id })
+	}
+	for _, file := range s.files {
+		if hasChunk(file.Chunks) {
+			return true
+		}
+	}
+	for _, parts := range s.parts {
+		for _, part := range parts {
+			if hasChunk(part.Chunks) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func (s *inMemoryStorage) AddReplica(_ context.Context, chunk Chunk, node string) error {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	if !s.referenced(chunk.ID) {
+		return &ChunkReleasedErr{Chunk: chunk.ID}
+	}
+	for name, file := range s.files {
+		chunks := slices.Clone(file.Chunks)
+		for i, c := range chunks {
+			if c.ID == chunk.ID && !slices.Contains(c.Nodes, node) {
+				chunks[i].Nodes = append(slices.Clone(c.Nodes), node)
+			}
+		}
+		file.Chunks = chunks
+		s.files[name] = file
+	}
+	return nil
+}
+
+func (s *inMemoryStorage) RemoveReplica(_ context.Context, chunkID uuid.UUID, node string) error {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	for name, file := range s.files {
+		chunks := slices.Clone(file.Chunks)
+		for i, chunk := range chunks {
+			if chunk.ID == chunkID {
+				chunks[i].Nodes = slices.DeleteFunc(slices.Clone(chunk.Nodes), func(n string) bool {
+					return n == node
+				})
+			}
+		}
+		file.Chunks = chunks
+		s.files[name] = file
+	}
+	return nil
+}
+
+func (s *inMemoryStorage) RemoveReportedReplica(ctx context.Context, chunkID uuid.UUID, node string) error {
+	s.mux.Lock()
+	if _, ok := s.nodes[node]; !ok {
+		s.mux.Unlock()
+		return &NodeNotFoundErr{Node: node}
+	}
+	for _, file := range s.files {
+		for _, chunk := range file.Chunks {
+			if chunk.ID == chunkID && !slices.ContainsFunc(chunk.Nodes, func(n string) bool { return n != node }) {
+				s.mux.Unlock()
+				return &LastReplicaErr{Chunk: chunkID, Node: node}
+			}
+		}
+	}
+	s.mux.Unlock()
+	return s.RemoveReplica(ctx, chunkID, node)
+}
+
 func newInMemoryStorage() *inMemoryStorage {
 	return &inMemoryStorage{
-		files: make(map[string]File),
-		nodes: make(map[string]Node),
+		files:   make(map[string]File),
+		garbage: make(map[Replica]Replica),
+		nodes:   make(map[string]Node),
+		buckets: make(map[string]Bucket),
+		uploads: make(map[uuid.UUID]Upload),
+		parts:   make(map[uuid.UUID]map[int]Part),
 	}
 }
 
@@ -100,36 +703,176 @@ type inMemoryNodes struct {
 type inMemoryNode struct {
 	baseURL string
 
-	mux    sync.Mutex
-	chunks map[uuid.UUID][]byte
+	mux       sync.Mutex
+	chunks    map[uuid.UUID][]byte
+	checksums map[uuid.UUID][]byte
+	modTimes  map[uuid.UUID]time.Time
+	down      bool
+	garble    bool
+	// beforeDelete is called once before next delete.
+	beforeDelete func()
+}
+
+var errNodeDown = errors.New("node is down")
+
+// setDown simulates node failure.
+func (i *inMemoryNode) setDown(down bool) {
+	i.mux.Lock()
+	defer i.mux.Unlock()
+	i.down = down
+}
+
+// corrupt simulates corruption of stored chunk.
+func (i *inMemoryNode) corrupt(chunkID uuid.UUID) {
+	i.mux.Lock()
+	defer i.mux.Unlock()
+	i.chunks[chunkID][0] ^= 0xff
+}
+
+// setGarble simulates corruption of chunks in transit, that is
+// not detected by node.
+func (i *inMemoryNode) setGarble(garble bool) {
+	i.mux.Lock()
+	defer i.mux.Unlock()
+	i.garble = garble
 }
 
 func (i *inMemoryNode) Read(_ context.Context, chunkID uuid.UUID, w io.Writer) error {
 	i.mux.Lock()
-	reader := bytes.NewReader(i.chunks[chunkID])
+	if i.down {
+		i.mux.Unlock()
+		return errNodeDown
+	}
+	data := bytes.Clone(i.chunks[chunkID])
+	sum := sha256.Sum256(data)
+	if !bytes.Equal(sum[:], i.checksums[chunkID]) {
+		i.mux.Unlock()
+		return node.ErrChecksumMismatch
+	}
+	if i.garble {
+		data[0] ^= 0xff
+	}
+	i.mux.Unlock()
+	_, err := w.Write(data)
+	return err
+}
+
+func (i *inMemoryNode) ReadRange(_ context.Context, chunkID uuid.UUID, offset, length int64, w io.Writer) error {
+	i.mux.Lock()
+	if i.down {
+		i.mux.Unlock()
+		return errNodeDown
+	}
+	data := i.chunks[chunkID]
 	i.mux.Unlock()
-	_, err := io.Copy(w, reader)
+	if offset+length > int64(len(data)) {
+		return errors.New("out of range")
+	}
+	_, err := w.Write(data[offset : offset+length])
 	return err
 }
 
-func (i *inMemoryNode) Write(_ context.Context, chunkID uuid.UUID, r io.Reader) error {
+func (i *inMemoryNode) Write(_ context.Context, chunkID uuid.UUID, r io.Reader, checksum []byte) (node.WriteResult, error) {
 	data, err := io.ReadAll(r)
 	if err != nil {
-		return err
+		return node.WriteResult{}, err
 	}
 	i.mux.Lock()
 	defer i.mux.Unlock()
+	if i.down {
+		return node.WriteResult{}, errNodeDown
+	}
+	sum := sha256.Sum256(data)
+	if checksum != nil && !bytes.Equal(sum[:], checksum) {
+		return node.WriteResult{}, node.ErrChecksumMismatch
+	}
+	_, exists := i.chunks[chunkID]
+	modTime := time.Now()
+	if !modTime.After(i.modTimes[chunkID]) {
+		// Every write has distinct modification time.
+		modTime = i.modTimes[chunkID].Add(time.Nanosecond)
+	}
 	i.chunks[chunkID] = data
-	return nil
+	i.checksums[chunkID] = sum[:]
+	i.modTimes[chunkID] = modTime
+	return node.WriteResult{
+		Checksum: sum[:],
+		ModTime:  modTime,
+		Created:  !exists,
+	}, nil
+}
+
+func (i *inMemoryNode) Delete(ctx context.Context, id uuid.UUID) error {
+	return i.DeleteUnmodified(ctx, id, time.Time{})
 }
 
-func (i *inMemoryNode) Delete(_ context.Context, id uuid.UUID) error {
+func (i *inMemoryNode) DeleteUnmodified(_ context.Context, id uuid.UUID, modTime time.Time) error {
 	i.mux.Lock()
+	if hook := i.beforeDelete; hook != nil {
+		i.beforeDelete = nil
+		i.mux.Unlock()
+		hook()
+		i.mux.Lock()
+	}
 	defer i.mux.Unlock()
+	if i.down {
+		return errNodeDown
+	}
+	if _, ok := i.chunks[id]; ok && !modTime.IsZero() && !i.modTimes[id].Equal(modTime) {
+		return node.ErrChunkModified
+	}
 	delete(i.chunks, id)
 	return nil
 }
 
+func (i *inMemoryNode) Stat(_ context.Context, id uuid.UUID) (node.ChunkInfo, error) {
+	i.mux.Lock()
+	defer i.mux.Unlock()
+	if i.down {
+		return node.ChunkInfo{}, errNodeDown
+	}
+	data, ok := i.chunks[id]
+	if !ok {
+		return node.ChunkInfo{}, node.ErrChunkNotFound
+	}
+	return node.ChunkInfo{ID: id, Size: int64(len(data)), ModTime: i.modTimes[id]}, nil
+}
+
+func (i *inMemoryNode) List(_ context.Context) ([]uuid.UUID, error) {
+	i.mux.Lock()
+	defer i.mux.Unlock()
+	if i.down {
+		return nil, errNodeDown
+	}
+	var ids []uuid.UUID
+	for id := range i.chunks {
+		ids = append(ids, id)
+	}
+	return ids, nil
+}
+
+func (i *inMemoryNode) Inventory(_ context.Context, after uuid.UUID, limit int) ([]node.ChunkInfo, error) {
+	i.mux.Lock()
+	defer i.mux.Unlock()
+	if i.down {
+		return nil, errNodeDown
+	}
+	var chunks []node.ChunkInfo
+	for id, data := range i.chunks {
+		if id.String() > after.String() {
+			chunks = append(chunks, node.ChunkInfo{
+				ID:      id,
+				Size:    int64(len(data)),
+				ModTime: i.modTimes[id],
+			})
+		}
+	}
+	slices.SortFunc(chunks, func(a, b node.ChunkInfo) int {
+		return strings.Compare(a.ID.String(), b.ID.String())
+	})
+	return chunks[:min(limit, len(chunks))], nil
+}
+
 func (i *inMemoryNode) BaseURL() string {
 	return i.baseURL
 }
@@ -140,8 +883,10 @@ func (i inMemoryNodes) NewClient(baseURL string) NodeClient {
 
 func (i inMemoryNodes) createClient(baseURL string) {
 	i.nodes[baseURL] = &inMemoryNode{
-		baseURL: baseURL,
-		chunks:  make(map[uuid.UUID][]byte),
+		baseURL:   baseURL,
+		chunks:    make(map[uuid.UUID][]byte),
+		checksums: make(map[uuid.UUID][]byte),
+		modTimes:  make(map[uuid.UUID]time.Time),
 	}
 }
 
@@ -157,7 +902,7 @@ func TestHandler(t *testing.T) {
 		stor  = newInMemoryStorage()
 		nodes = newInMemoryNodes()
 	)
-	handler, err := NewHandler(ctx, nodes, stor, noopTracer.NewTracerProvider(), noopMeter.NewMeterProvider())
+	handler, err := NewHandler(ctx, nodes, stor, noopTracer.NewTracerProvider(), noopMeter.NewMeterProvider(), HandlerOptions{})
 	require.NoError(t, err)
 	server := httptest.NewServer(handler)
 	client := server.Client()
@@ -183,7 +928,7 @@ func TestHandler(t *testing.T) {
 	}
 
 	t.Log("Upload file")
-	t.Run("FileTooSmall", func(t *testing.T) {
+	t.Run("SmallFile", func(t *testing.T) {
 		// Write multipart form.
 		b := new(bytes.Buffer)
 		mw := multipart.NewWriter(b)
@@ -206,7 +951,7 @@ func TestHandler(t *testing.T) {
 		resp, err := client.Do(req)
 		require.NoError(t, err)
 
-		require.Equal(t, http.StatusBadRequest, resp.StatusCode)
+		require.Equal(t, http.StatusOK, resp.StatusCode)
 	})
 	var uploadedData []byte
 	{
@@ -251,3 +996,451 @@ func TestHandler(t *testing.T) {
 		require.Equal(t, uploadedData, buf.Bytes())
 	}
 }
+
+func registerNodes(t *testing.T, server *httptest.Server, nodes *inMemoryNodes, baseURLs ...string) {
+	t.Helper()
+	for _, baseURL := range baseURLs {
+		nodes.createClient(baseURL)
+		u, err := url.Parse(server.URL)
+		require.NoError(t, err)
+		u.Path = "/register"
+		u.RawQuery = url.Values{
+			"baseURL": []string{baseURL},
+		}.Encode()
+		req, err := http.NewRequest(http.MethodPost, u.String(), http.NoBody)
+		require.NoError(t, err)
+
+		resp, err := server.Client().Do(req)
+		require.NoError(t, err)
+		_ = resp.Body.Close()
+
+		require.Equal(t, http.StatusOK, resp.StatusCode)
+	}
+}
+
+func randomBytes(t *testing.T, n int) []byte {
+	t.Helper()
+	rnd := rand.New(rand.NewSource(1))
+	data := make([]byte, n)
+	_, err := rnd.Read(data)
+	require.NoError(t, err)
+	return data
+}
+
+func uploadFile(t *testing.T, server *httptest.Server, name string, data []byte) *http.Response {
+	t.Helper()
+	return uploadFileTo(t, server, "/upload", name, data)
+}
+
+func uploadFileTo(t *testing.T, server *httptest.Server, path, name string, data []byte) *http.Response {
+	t.Helper()
+	b := new(bytes.Buffer)
+	mw := multipart.NewWriter(b)
+	w, err := mw.CreateFormFile("upload", name)
+	require.NoError(t, err)
+	_, err = w.Write(data)
+	require.NoError(t, err)
+	require.NoError(t, mw.Close())
+
+	req, err := http.NewRequest(http.MethodPost, server.URL+path, b)
+	require.NoError(t, err)
+	req.Header.Set("Content-Type", mw.FormDataContentType())
+	resp, err := server.Client().Do(req)
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = resp.Body.Close() })
+	return resp
+}
+
+// downloadFile downloads file, returning error if download was aborted
+// or body is incomplete.
+func downloadFile(t *testing.T, server *httptest.Server, name string) (*http.Response, []byte, error) {
+	t.Helper()
+	resp, err := server.Client().Get(server.URL + "/download/" + name)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer func() { _ = resp.Body.Close() }()
+	data, err := io.ReadAll(resp.Body)
+	return resp, data, err
+}
+
+func TestHandlerReplication(t *testing.T) {
+	var (
+		ctx   = context.Background()
+		stor  = newInMemoryStorage()
+		nodes = newInMemoryNodes()
+	)
+	handler, err := NewHandler(ctx, nodes, stor, noopTracer.NewTracerProvider(), noopMeter.NewMeterProvider(), HandlerOptions{
+		ReplicationFactor: 3,
+		WriteQuorum:       2,
+	})
+	require.NoError(t, err)
+	server := httptest.NewServer(handler)
+	t.Cleanup(server.Close)
+	registerNodes(t, server, nodes, "node1:8080", "node2:8080", "node3:8080", "node4:8080")
+
+	t.Run("Quorum", func(t *testing.T) {
+		nodes.nodes["node1:8080"].setDown(true)
+		defer nodes.nodes["node1:8080"].setDown(false)
+
+		data := randomBytes(t, 1024)
+		resp := uploadFile(t, server, "quorum.bin", data)
+		require.Equal(t, http.StatusOK, resp.StatusCode)
+
+		file, err := stor.File(ctx, "quorum.bin")
+		require.NoError(t, err)
+		for _, chunk := range file.Chunks {
+			require.GreaterOrEqual(t, len(chunk.Nodes), 2, "chunk %d", chunk.Index)
+			require.NotContains(t, chunk.Nodes, "node1:8080", "failed replica should not be recorded")
+			for i, baseURL := range chunk.Nodes {
+				require.NotContains(t, chunk.Nodes[i+1:], baseURL, "replicas should be on distinct nodes")
+			}
+		}
+	})
+	t.Run("NoQuorum", func(t *testing.T) {
+		for _, baseURL := range []string{"node1:8080", "node2:8080", "node3:8080"} {
+			nodes.nodes[baseURL].setDown(true)
+		}
+		defer func() {
+			for _, baseURL := range []string{"node1:8080", "node2:8080", "node3:8080"} {
+				nodes.nodes[baseURL].setDown(false)
+			}
+		}()
+
+		resp := uploadFile(t, server, "no-quorum.bin", randomBytes(t, 1024))
+		require.Equal(t, http.StatusInternalServerError, resp.StatusCode)
+
+		_, err := stor.File(ctx, "no-quorum.bin")
+		require.Error(t, err, "file should not be stored")
+	})
+	t.Run("Fallback", func(t *testing.T) {
+		data := randomBytes(t, 4096)
+		resp := uploadFile(t, server, "fallback.bin", data)
+		require.Equal(t, http.StatusOK, resp.StatusCode)
+
+		// Any single node failure should not affect download.
+		for baseURL, node := range nodes.nodes {
+			node.setDown(true)
+			resp, downloaded, err := downloadFile(t, server, "fallback.bin")
+			node.setDown(false)
+			require.NoError(t, err, baseURL)
+			require.Equal(t, http.StatusOK, resp.StatusCode, baseURL)
+			require.Equal(t, data, downloaded, baseURL)
+		}
+	})
+}
+
+func TestHandlerChecksum(t *testing.T) {
+	var (
+		ctx   = context.Background()
+		stor  = newInMemoryStorage()
+		nodes = newInMemoryNodes()
+	)
+	handler, err := NewHandler(ctx, nodes, stor, noopTracer.NewTracerProvider(), noopMeter.NewMeterProvider(), HandlerOptions{
+		ReplicationFactor: 2,
+		Chunking:          ChunkPolicy{Size: 1000},
+	})
+	require.NoError(t, err)
+	server := httptest.NewServer(handler)
+	t.Cleanup(server.Close)
+	registerNodes(t, server, nodes, "node1:8080", "node2:8080", "node3:8080")
+
+	data := randomBytes(t, 4096)
+	resp := uploadFile(t, server, "checksum.bin", data)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	file, err := stor.File(ctx, "checksum.bin")
+	require.NoError(t, err)
+	sum := sha256.Sum256(data)
+	require.Equal(t, sum[:], file.Checksum)
+	for _, chunk := range file.Chunks {
+		chunkSum := sha256.Sum256(data[chunk.Offset : chunk.Offset+chunk.Size])
+		require.Equal(t, chunkSum[:], chunk.Checksum, "chunk %d", chunk.Index)
+	}
+
+	t.Run("Headers", func(t *testing.T) {
+		etag := `"` + hex.EncodeToString(sum[:]) + `"`
+		digest := "sha-256=" + base64.StdEncoding.EncodeToString(sum[:])
+
+		resp, err := server.Client().Head(server.URL + "/download/checksum.bin")
+		require.NoError(t, err)
+		_ = resp.Body.Close()
+		require.Equal(t, etag, resp.Header.Get("ETag"))
+		require.Equal(t, digest, resp.Header.Get("Digest"))
+
+		resp, downloaded, err := downloadFile(t, server, "checksum.bin")
+		require.NoError(t, err)
+		require.Equal(t, data, downloaded)
+		require.Equal(t, etag, resp.Header.Get("ETag"))
+		require.Equal(t, digest, resp.Header.Get("Digest"))
+	})
+	t.Run("Failover", func(t *testing.T) {
+		// Node detects corruption of first replica, so other one is used.
+		for _, chunk := range file.Chunks {
+			nodes.nodes[chunk.Nodes[0]].corrupt(chunk.ID)
+		}
+		defer func() {
+			for _, chunk := range file.Chunks {
+				nodes.nodes[chunk.Nodes[0]].corrupt(chunk.ID)
+			}
+		}()
+		_, downloaded, err := downloadFile(t, server, "checksum.bin")
+		require.NoError(t, err)
+		require.Equal(t, data, downloaded)
+	})
+	t.Run("Abort", func(t *testing.T) {
+		// Corruption that is not detected by node aborts the download.
+		for _, node := range nodes.nodes {
+			node.setGarble(true)
+		}
+		defer func() {
+			for _, node := range nodes.nodes {
+				node.setGarble(false)
+			}
+		}()
+		_, _, err := downloadFile(t, server, "checksum.bin")
+		require.Error(t, err)
+	})
+}
+
+func TestHandlerReport(t *testing.T) {
+	var (
+		ctx   = context.Background()
+		stor  = newInMemoryStorage()
+		nodes = newInMemoryNodes()
+	)
+	handler, err := NewHandler(ctx, nodes, stor, noopTracer.NewTracerProvider(), noopMeter.NewMeterProvider(), HandlerOptions{
+		ReplicationFactor: 2,
+	})
+	require.NoError(t, err)
+	server := httptest.NewServer(handler)
+	t.Cleanup(server.Close)
+	registerNodes(t, server, nodes, "node1:8080", "node2:8080", "node3:8080")
+
+	data := randomBytes(t, 1024)
+	resp := uploadFile(t, server, "report.bin", data)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	file, err := stor.File(ctx, "report.bin")
+	require.NoError(t, err)
+	chunk := file.Chunks[0]
+	reported := chunk.Nodes[0]
+
+	report := func(t *testing.T, query url.Values) *http.Response {
+		t.Helper()
+		resp, err := server.Client().Post(server.URL+"/report?"+query.Encode(), "", http.NoBody)
+		require.NoError(t, err)
+		_ = resp.Body.Close()
+		return resp
+	}
+	resp = report(t, url.Values{"baseURL": {reported}})
+	require.Equal(t, http.StatusBadRequest, resp.StatusCode, "chunkID is required")
+	resp = report(t, url.Values{"baseURL": {reported}, "chunkID": {chunk.ID.String()}})
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+
+	file, err = stor.File(ctx, "report.bin")
+	require.NoError(t, err)
+	require.NotContains(t, file.Chunks[0].Nodes, reported, "reported replica should be removed")
+	require.Len(t, file.Chunks[0].Nodes, 1)
+
+	resp = report(t, url.Values{"baseURL": {"node4:8080"}, "chunkID": {chunk.ID.String()}})
+	require.Equal(t, http.StatusNotFound, resp.StatusCode, "unregistered node")
+	resp = report(t, url.Values{"baseURL": {file.Chunks[0].Nodes[0]}, "chunkID": {chunk.ID.String()}})
+	require.Equal(t, http.StatusConflict, resp.StatusCode, "last replica")
+	file, err = stor.File(ctx, "report.bin")
+	require.NoError(t, err)
+	require.Len(t, file.Chunks[0].Nodes, 1, "last replica should be kept")
+
+	_, downloaded, err := downloadFile(t, server, "report.bin")
+	require.NoError(t, err)
+	require.Equal(t, data, downloaded)
+}
+
+func TestHandlerErasure(t *testing.T) {
+	var (
+		ctx   = context.Background()
+		stor  = newInMemoryStorage()
+		nodes = newInMemoryNodes()
+	)
+	handler, err := NewHandler(ctx, nodes, stor, noopTracer.NewTracerProvider(), noopMeter.NewMeterProvider(), HandlerOptions{})
+	require.NoError(t, err)
+	server := httptest.NewServer(handler)
+	t.Cleanup(server.Close)
+	registerNodes(t, server, nodes, "node1:8080", "node2:8080", "node3:8080", "node4:8080", "node5:8080", "node6:8080")
+
+	t.Run("BadParams", func(t *testing.T) {
+		for _, query := range []string{
+			"dataShards=4",
+			"dataShards=0&parityShards=2",
+			"dataShards=four&parityShards=2",
+		} {
+			resp := uploadFileTo(t, server, "/upload?"+query, "bad.bin", randomBytes(t, 1024))
+			require.Equal(t, http.StatusBadRequest, resp.StatusCode, query)
+		}
+	})
+	t.Run("NotEnoughNodes", func(t *testing.T) {
+		resp := uploadFileTo(t, server, "/upload?dataShards=5&parityShards=2", "big.bin", randomBytes(t, 1024))
+		require.Equal(t, http.StatusServiceUnavailable, resp.StatusCode)
+	})
+
+	// Size is not divisible by data shards to check padding.
+	data := randomBytes(t, 4099)
+	resp := uploadFileTo(t, server, "/upload?dataShards=4&parityShards=2", "ec.bin", data)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+
+	file, err := stor.File(ctx, "ec.bin")
+	require.NoError(t, err)
+	require.Len(t, file.Chunks, 6)
+	require.Len(t, file.dataChunks(), 4)
+	var dataNodes []string
+	for _, chunk := range file.Chunks {
+		require.Len(t, chunk.Nodes, 1)
+		if !file.isParity(chunk) {
+			dataNodes = append(dataNodes, chunk.Nodes[0])
+		}
+	}
+
+	t.Run("Healthy", func(t *testing.T) {
+		resp, downloaded, err := downloadFile(t, server, "ec.bin")
+		require.NoError(t, err)
+		require.Equal(t, http.StatusOK, resp.StatusCode)
+		require.Equal(t, data, downloaded)
+	})
+	t.Run("Reconstruct", func(t *testing.T) {
+		// Any two shards can be lost.
+		for i := range dataNodes {
+			for j := i + 1; j < len(dataNodes); j++ {
+				nodes.nodes[dataNodes[i]].setDown(true)
+				nodes.nodes[dataNodes[j]].setDown(true)
+				resp, downloaded, err := downloadFile(t, server, "ec.bin")
+				nodes.nodes[dataNodes[i]].setDown(false)
+				nodes.nodes[dataNodes[j]].setDown(false)
+
+				require.NoError(t, err, "lost shards %d and %d", i, j)
+				require.Equal(t, http.StatusOK, resp.StatusCode)
+				require.Equal(t, data, downloaded, "lost shards %d and %d", i, j)
+			}
+		}
+	})
+	t.Run("TooManyLost", func(t *testing.T) {
+		for _, baseURL := range dataNodes[:3] {
+			nodes.nodes[baseURL].setDown(true)
+		}
+		defer func() {
+			for _, baseURL := range dataNodes[:3] {
+				nodes.nodes[baseURL].setDown(false)
+			}
+		}()
+		// The first chunk is lost, so nothing is sent before failure.
+		resp, _, err := downloadFile(t, server, "ec.bin")
+		require.NoError(t, err)
+		require.Equal(t, http.StatusServiceUnavailable, resp.StatusCode)
+	})
+}
+
+func TestHandlerRange(t *testing.T) {
+	var (
+		ctx   = context.Background()
+		stor  = newInMemoryStorage()
+		nodes = newInMemoryNodes()
+	)
+	handler, err := NewHandler(ctx, nodes, stor, noopTracer.NewTracerProvider(), noopMeter.NewMeterProvider(), HandlerOptions{
+		ReplicationFactor: 2,
+	})
+	require.NoError(t, err)
+	server := httptest.NewServer(handler)
+	t.Cleanup(server.Close)
+	registerNodes(t, server, nodes, "node1:8080", "node2:8080", "node3:8080", "node4:8080", "node5:8080", "node6:8080")
+
+	data := randomBytes(t, 1000)
+	for _, path := range []string{
+		"/upload",
+		"/upload?dataShards=4&parityShards=2",
+	} {
+		resp := uploadFileTo(t, server, path, "range.bin", data)
+		require.Equal(t, http.StatusOK, resp.StatusCode)
+
+		t.Run("Head", func(t *testing.T) {
+			for _, node := range nodes.nodes {
+				node.setDown(true)
+			}
+			defer func() {
+				for _, node := range nodes.nodes {
+					node.setDown(false)
+				}
+			}()
+			resp, err := server.Client().Head(server.URL + "/download/range.bin")
+			require.NoError(t, err)
+			_ = resp.Body.Close()
+			require.Equal(t, http.StatusOK, resp.StatusCode)
+			require.Equal(t, int64(len(data)), resp.ContentLength)
+			require.Equal(t, "bytes", resp.Header.Get("Accept-Ranges"))
+		})
+		get := func(t *testing.T, rangeHeader string) (*http.Response, []byte) {
+			t.Helper()
+			req, err := http.NewRequest(http.MethodGet, server.URL+"/download/range.bin", http.NoBody)
+			require.NoError(t, err)
+			req.Header.Set("Range", rangeHeader)
+			resp, err := server.Client().Do(req)
+			require.NoError(t, err)
+			defer func() { _ = resp.Body.Close() }()
+			body, err := io.ReadAll(resp.Body)
+			require.NoError(t, err)
+			return resp, body
+		}
+		t.Run("Single", func(t *testing.T) {
+			for _, tt := range []struct {
+				Range        string
+				ContentRange string
+				Data         []byte
+			}{
+				{"bytes=0-9", "bytes 0-9/1000", data[:10]},
+				{"bytes=150-549", "bytes 150-549/1000", data[150:550]}, // crosses chunks
+				{"bytes=990-", "bytes 990-999/1000", data[990:]},
+				{"bytes=-5", "bytes 995-999/1000", data[995:]},
+				{"bytes=900-5000", "bytes 900-999/1000", data[900:]},
+			} {
+				resp, body := get(t, tt.Range)
+				require.Equal(t, http.StatusPartialContent, resp.StatusCode, tt.Range)
+				require.Equal(t, tt.ContentRange, resp.Header.Get("Content-Range"), tt.Range)
+				require.Equal(t, tt.Data, body, tt.Range)
+			}
+		})
+		t.Run("Multi", func(t *testing.T) {
+			resp, body := get(t, "bytes=0-9, 500-509, -10")
+			require.Equal(t, http.StatusPartialContent, resp.StatusCode)
+			mediaType, params, err := mime.ParseMediaType(resp.Header.Get("Content-Type"))
+			require.NoError(t, err)
+			require.Equal(t, "multipart/byteranges", mediaType)
+
+			mr := multipart.NewReader(bytes.NewReader(body), params["boundary"])
+			for _, expected := range [][]byte{data[:10], data[500:510], data[990:]} {
+				part, err := mr.NextPart()
+				require.NoError(t, err)
+				got, err := io.ReadAll(part)
+				require.NoError(t, err)
+				require.Equal(t, expected, got)
+			}
+			_, err = mr.NextPart()
+			require.ErrorIs(t, err, io.EOF)
+		})
+		t.Run("Overlapping", func(t *testing.T) {
+			resp, body := get(t, "bytes=5-19, 0-9")
+			require.Equal(t, http.StatusPartialContent, resp.StatusCode)
+			require.Equal(t, "bytes 0-19/1000", resp.Header.Get("Content-Range"))
+			require.Equal(t, data[:20], body)
+		})
+		t.Run("NodeDown", func(t *testing.T) {
+			for baseURL, node := range nodes.nodes {
+				node.setDown(true)
+				resp, body := get(t, "bytes=100-899")
+				node.setDown(false)
+				require.Equal(t, http.StatusPartialContent, resp.StatusCode, baseURL)
+				require.Equal(t, data[100:900], body, baseURL)
+			}
+		})
+		t.Run("Unsatisfiable", func(t *testing.T) {
+			resp, _ := get(t, "bytes=1000-")
+			require.Equal(t, http.StatusRequestedRangeNotSatisfiable, resp.StatusCode)
+			require.Equal(t, "bytes */1000", resp.Header.Get("Content-Range"))
+		})
+	}
+}
@@ -0,0 +1,220 @@
+package front
+
+import (
+	"context"
+	"io"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/go-faster/errors"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Number of the last observed latencies that quantile is estimated from, and
+// the minimum number required for estimation.
+const (
+	latencySamples    = 1000
+	minLatencySamples = 20
+)
+
+// latencies keeps the last observed latencies to estimate their quantiles.
+type latencies struct {
+	mux     sync.Mutex
+	samples []time.Duration
+	// next is the index of sample that is replaced by the next observation
+	// once samples are full.
+	next int
+}
+
+func (l *latencies) observe(d time.Duration) {
+	l.mux.Lock()
+	defer l.mux.Unlock()
+	if len(l.samples) < latencySamples {
+		l.samples = append(l.samples, d)
+		return
+	}
+	l.samples[l.next] = d
+	l.next = (l.next + 1) % latencySamples
+}
+
+// quantile returns q-quantile of observed latencies, ok is false if there
+// are too few of them.
+func (l *latencies) quantile(q float64) (d time.Duration, ok bool) {
+	l.mux.Lock()
+	samples := slices.Clone(l.samples)
+	l.mux.Unlock()
+	if len(samples) < minLatencySamples {
+		return 0, false
+	}
+	slices.Sort(samples)
+	i := int(q * float64(len(samples)-1))
+	return samples[i], true
+}
+
+// hedgeDelay returns time after which read that has not sent any data is
+// hedged to another replica.
+func (h *Handler) hedgeDelay() time.Duration {
+	d, ok := h.latencies.quantile(h.hedgeQuantile)
+	if !ok {
+		return h.minHedgeDelay
+	}
+	return max(d, h.minHedgeDelay)
+}
+
+var errHedgeLost = errors.New("other replica responded first")
+
+// hedge is the set of concurrent reads of the same data, where only read
+// that responds first writes to W.
+type hedge struct {
+	W io.Writer
+
+	mux     sync.Mutex
+	winner  int
+	cancels []context.CancelFunc
+}
+
+// start registers read with cancel and returns its index, ok is false if
+// other read already won.
+func (g *hedge) start(cancel context.CancelFunc) (i int, ok bool) {
+	g.mux.Lock()
+	defer g.mux.Unlock()
+	if g.winner >= 0 {
+		return 0, false
+	}
+	g.cancels = append(g.cancels, cancel)
+	return len(g.cancels) - 1, true
+}
+
+// claim makes read i the winner if there is none yet and cancels other
+// reads. Reports whether read i is the winner.
+func (g *hedge) claim(i int) bool {
+	g.mux.Lock()
+	defer g.mux.Unlock()
+	if g.winner < 0 {
+		g.winner = i
+		for j, cancel := range g.cancels {
+			if j != i {
+				cancel()
+			}
+		}
+	}
+	return g.winner == i
+}
+
+// current returns index of the winner, or -1 if there is none yet.
+func (g *hedge) current() int {
+	g.mux.Lock()
+	defer g.mux.Unlock()
+	return g.winner
+}
+
+// hedgeWriter is writer of read i of hedge.
+type hedgeWriter struct {
+	h     *Handler
+	g     *hedge
+	i     int
+	start time.Time
+	won   bool
+}
+
+func (w *hedgeWriter) Write(p []byte) (int, error) {
+	if !w.won {
+		if !w.g.claim(w.i) {
+			return 0, errHedgeLost
+		}
+		w.won = true
+		w.h.latencies.observe(time.Since(w.start))
+	}
+	return w.g.W.Write(p)
+}
+
+// readHedged reads length bytes of chunk starting from offset to w from the
+// first of replicas. If it has not sent any data within hedge delay, the same
+// is read from the second replica, and read that sends data first is
+// continued while the other one is canceled.
+//
+// Returns replicas that failed. Other replicas were canceled or not read at
+// all, so they can be read again.
+func (h *Handler) readHedged(ctx context.Context, chunk Chunk, offset, length int64, replicas []string, w io.Writer) ([]string, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	type result struct {
+		i   int
+		err error
+	}
+	var (
+		g       = &hedge{W: w, winner: -1}
+		results = make(chan result, len(replicas))
+		started int
+	)
+	start := func() bool {
+		readCtx, readCancel := context.WithCancel(ctx)
+		i, ok := g.start(readCancel)
+		if !ok {
+			readCancel()
+			return false
+		}
+		started++
+		var (
+			hw      = &hedgeWriter{h: h, g: g, i: i, start: time.Now()}
+			baseURL = replicas[i]
+		)
+		go func() {
+			defer readCancel()
+			results <- result{i: i, err: h.readReplica(readCtx, baseURL, chunk, offset, length, hw)}
+		}()
+		return true
+	}
+	start()
+
+	var timeout <-chan time.Time
+	if len(replicas) > 1 {
+		timer := time.NewTimer(h.hedgeDelay())
+		defer timer.Stop()
+		timeout = timer.C
+	}
+	var (
+		errs   []error
+		failed []string
+	)
+	for done := 0; done < started; {
+		select {
+		case <-timeout:
+			timeout = nil
+			if start() {
+				h.hedgedReads.Add(ctx, 1)
+				trace.SpanFromContext(ctx).AddEvent("Hedged read", trace.WithAttributes(
+					attribute.String("chunkID", chunk.ID.String()),
+					attribute.String("node", replicas[1]),
+				))
+			}
+		case res := <-results:
+			done++
+			winner := g.current()
+			switch {
+			case res.err == nil:
+				// Read of empty window writes nothing, so it is claimed here.
+				g.claim(res.i)
+				if res.i > 0 {
+					h.hedgedReadsWon.Add(ctx, 1)
+				}
+				return nil, nil
+			case winner >= 0 && winner != res.i:
+				// Canceled in favor of the winner.
+				continue
+			default:
+				errs = append(errs, h.replicaFailed(ctx, chunk, replicas[res.i], res.err))
+				failed = append(failed, replicas[res.i])
+				if winner == res.i {
+					// Failed mid-stream, the other read is already
+					// canceled.
+					return failed, errors.Join(errs...)
+				}
+			}
+		}
+	}
+	return failed, errors.Join(errs...)
+}
@@ -0,0 +1,194 @@
+package front
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/go-faster/errors"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/require"
+	noopMeter "go.opentelemetry.io/otel/metric/noop"
+	noopTracer "go.opentelemetry.io/otel/trace/noop"
+)
+
+// laggingNodes are in-memory nodes where reads from lagging node are delayed.
+type laggingNodes struct {
+	*inMemoryNodes
+
+	mux      sync.Mutex
+	lagging  string
+	canceled int
+	// Reads from broken node fail after half of data is sent.
+	broken string
+}
+
+func (l *laggingNodes) NewClient(baseURL string) NodeClient {
+	return &laggingNode{inMemoryNode: l.nodes[baseURL], l: l}
+}
+
+type laggingNode struct {
+	*inMemoryNode
+	l *laggingNodes
+}
+
+func (n *laggingNode) lag(ctx context.Context) error {
+	n.l.mux.Lock()
+	lagging := n.l.lagging == n.baseURL
+	n.l.mux.Unlock()
+	if !lagging {
+		return nil
+	}
+	select {
+	case <-time.After(500 * time.Millisecond):
+		return nil
+	case <-ctx.Done():
+		n.l.mux.Lock()
+		n.l.canceled++
+		n.l.mux.Unlock()
+		return ctx.Err()
+	}
+}
+
+func (n *laggingNode) Read(ctx context.Context, chunkID uuid.UUID, w io.Writer) error {
+	if err := n.lag(ctx); err != nil {
+		return err
+	}
+	n.l.mux.Lock()
+	broken := n.l.broken == n.baseURL
+	n.l.mux.Unlock()
+	if broken {
+		buf := new(bytes.Buffer)
+		if err := n.inMemoryNode.Read(ctx, chunkID, buf); err != nil {
+			return err
+		}
+		if _, err := w.Write(buf.Bytes()[:buf.Len()/2]); err != nil {
+			return err
+		}
+		return errors.New("connection reset")
+	}
+	return n.inMemoryNode.Read(ctx, chunkID, w)
+}
+
+func (n *laggingNode) ReadRange(ctx context.Context, chunkID uuid.UUID, offset, length int64, w io.Writer) error {
+	if err := n.lag(ctx); err != nil {
+		return err
+	}
+	return n.inMemoryNode.ReadRange(ctx, chunkID, offset, length, w)
+}
+
+func TestHedgedRead(t *testing.T) {
+	for _, tt := range []struct {
+		Name     string
+		Opts     HandlerOptions
+		Canceled int
+	}{
+		{"Hedged", HandlerOptions{}, 2},
+		{"Disabled", HandlerOptions{DisableHedging: true}, 0},
+	} {
+		t.Run(tt.Name, func(t *testing.T) {
+			var (
+				ctx   = context.Background()
+				stor  = newInMemoryStorage()
+				nodes = &laggingNodes{inMemoryNodes: newInMemoryNodes()}
+			)
+			tt.Opts.Chunking = ChunkPolicy{Size: 1000}
+			tt.Opts.ReplicationFactor = 2
+			tt.Opts.ReadAhead = 1
+			handler, err := NewHandler(ctx, nodes, stor, noopTracer.NewTracerProvider(), noopMeter.NewMeterProvider(), tt.Opts)
+			require.NoError(t, err)
+			server := httptest.NewServer(handler)
+			t.Cleanup(server.Close)
+			registerNodes(t, server, nodes.inMemoryNodes, "node1:8080", "node2:8080")
+
+			data := randomBytes(t, 1500)
+			require.Equal(t, http.StatusOK, uploadFile(t, server, "file.bin", data).StatusCode)
+			// Replicas on lagging node are read first.
+			nodes.lagging = "node1:8080"
+			stor.mux.Lock()
+			for _, chunk := range stor.files["file.bin"].Chunks {
+				slices.SortFunc(chunk.Nodes, func(a, b string) int {
+					return strings.Compare(a, b)
+				})
+			}
+			stor.mux.Unlock()
+
+			start := time.Now()
+			resp, downloaded, err := downloadFile(t, server, "file.bin")
+			elapsed := time.Since(start)
+			require.NoError(t, err)
+			require.Equal(t, http.StatusOK, resp.StatusCode)
+			require.Equal(t, data, downloaded)
+			if tt.Opts.DisableHedging {
+				require.GreaterOrEqual(t, elapsed, time.Second)
+			} else {
+				require.Less(t, elapsed, 500*time.Millisecond)
+			}
+			// Losing reads are canceled, but not waited for.
+			require.Eventually(t, func() bool {
+				nodes.mux.Lock()
+				defer nodes.mux.Unlock()
+				return nodes.canceled == tt.Canceled
+			}, time.Second, 10*time.Millisecond)
+		})
+	}
+}
+
+func TestHedgedReadFailed(t *testing.T) {
+	var (
+		ctx   = context.Background()
+		stor  = newInMemoryStorage()
+		nodes = &laggingNodes{inMemoryNodes: newInMemoryNodes()}
+	)
+	handler, err := NewHandler(ctx, nodes, stor, noopTracer.NewTracerProvider(), noopMeter.NewMeterProvider(), HandlerOptions{
+		Chunking:          ChunkPolicy{Size: 1000},
+		ReplicationFactor: 2,
+		ReadAhead:         1,
+	})
+	require.NoError(t, err)
+	server := httptest.NewServer(handler)
+	t.Cleanup(server.Close)
+	registerNodes(t, server, nodes.inMemoryNodes, "node1:8080", "node2:8080")
+
+	data := randomBytes(t, 1500)
+	require.Equal(t, http.StatusOK, uploadFile(t, server, "file.bin", data).StatusCode)
+	// Hedged read wins over lagging one and fails mid-stream, so the rest
+	// is read from lagging replica that was canceled.
+	nodes.lagging = "node1:8080"
+	nodes.broken = "node2:8080"
+	stor.mux.Lock()
+	for _, chunk := range stor.files["file.bin"].Chunks {
+		slices.Sort(chunk.Nodes)
+	}
+	stor.mux.Unlock()
+
+	resp, downloaded, err := downloadFile(t, server, "file.bin")
+	require.NoError(t, err)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	require.Equal(t, data, downloaded)
+}
+
+func TestLatencies(t *testing.T) {
+	var l latencies
+	_, ok := l.quantile(0.5)
+	require.False(t, ok, "too few samples")
+
+	for i := range 2 * latencySamples {
+		l.observe(time.Duration(i) * time.Millisecond)
+	}
+	// Only the last samples are kept.
+	d, ok := l.quantile(0)
+	require.True(t, ok)
+	require.Equal(t, latencySamples*time.Millisecond, d)
+	d, _ = l.quantile(1)
+	require.Equal(t, (2*latencySamples-1)*time.Millisecond, d)
+	d, _ = l.quantile(0.5)
+	require.InDelta(t, 1500*time.Millisecond, d, float64(time.Millisecond))
+}
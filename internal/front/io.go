@@ -23,3 +23,63 @@ func (l *LimitReaderFrom) Read(p []byte) (n int, err error) {
 	l.N -= int64(n)      // decrement the remaining bytes
 	return
 }
+
+// countingWriter counts bytes written to W.
+type countingWriter struct {
+	W io.Writer
+	N int64
+}
+
+func (c *countingWriter) Write(p []byte) (n int, err error) {
+	n, err = c.W.Write(p)
+	c.N += int64(n)
+	return n, err
+}
+
+// skipWriter discards first N bytes and writes the rest to W.
+type skipWriter struct {
+	W io.Writer
+	N int64
+}
+
+func (s *skipWriter) Write(p []byte) (n int, err error) {
+	if s.N >= int64(len(p)) {
+		s.N -= int64(len(p))
+		return len(p), nil
+	}
+	skip := int(s.N)
+	s.N = 0
+	n, err = s.W.Write(p[skip:])
+	return skip + n, err
+}
+
+// limitWriter writes first N bytes to W and discards the rest.
+type limitWriter struct {
+	W io.Writer
+	N int64
+}
+
+func (l *limitWriter) Write(p []byte) (n int, err error) {
+	if l.N <= 0 {
+		return len(p), nil
+	}
+	if int64(len(p)) > l.N {
+		n, err = l.W.Write(p[:l.N])
+		l.N -= int64(n)
+		if err != nil {
+			return n, err
+		}
+		return len(p), nil
+	}
+	n, err = l.W.Write(p)
+	l.N -= int64(n)
+	return n, err
+}
+
+// zeroReader is an infinite source of zero bytes.
+type zeroReader struct{}
+
+func (zeroReader) Read(p []byte) (int, error) {
+	clear(p)
+	return len(p), nil
+}
@@ -35,3 +35,20 @@ func TestLimitReaderFrom(t *testing.T) {
 
 	require.Equal(t, "world", out.String())
 }
+
+func TestSkipWriter(t *testing.T) {
+	out := new(bytes.Buffer)
+	cw := &countingWriter{W: out}
+	_, err := cw.Write([]byte("hello, "))
+	require.NoError(t, err)
+
+	// Simulate retry from the beginning after partial write.
+	sw := &skipWriter{W: cw, N: cw.N}
+	for _, part := range []string{"hel", "lo, wo", "rld."} {
+		n, err := sw.Write([]byte(part))
+		require.NoError(t, err)
+		require.Equal(t, len(part), n)
+	}
+	require.Equal(t, "hello, world.", out.String())
+	require.Equal(t, int64(len("hello, world.")), cw.N)
+}
@@ -0,0 +1,170 @@
+package front
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/go-faster/errors"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Limits of files listing page.
+const (
+	DefaultListLimit = 1000
+	MaxListLimit     = 10000
+)
+
+// FileInfo describes listed file.
+type FileInfo struct {
+	Name string `json:"name"`
+	Size int64  `json:"size"`
+	// ChunkCount is zero for files uploaded before it was recorded.
+	ChunkCount int `json:"chunkCount"`
+	// CreatedAt is zero for files uploaded before it was recorded.
+	CreatedAt time.Time `json:"createdAt"`
+	// Checksum and PartCount are ones of File, for ETag of S3 listing.
+	Checksum  []byte `json:"-"`
+	PartCount int    `json:"-"`
+}
+
+// FileList is the page of files listing.
+type FileList struct {
+	Files []FileInfo `json:"files"`
+	// Prefixes are pseudo-directories, i.e. distinct prefixes of names up
+	// to the first delimiter after listed prefix, including delimiter.
+	Prefixes []string `json:"prefixes"`
+	// Cursor is passed to get the next page, empty for the last page.
+	Cursor string `json:"cursor,omitempty"`
+}
+
+// prefixEnd returns the least string that is greater than every string with
+// prefix, or empty string if there is none.
+func prefixEnd(prefix string) string {
+	for prefix != "" {
+		r, size := utf8.DecodeLastRuneInString(prefix)
+		prefix = prefix[:len(prefix)-size]
+		switch {
+		case r == utf8.RuneError && size == 1, r == utf8.MaxRune:
+			continue
+		case r == 0xD7FF:
+			// Skip surrogates.
+			return prefix + string(rune(0xE000))
+		default:
+			return prefix + string(r+1)
+		}
+	}
+	return ""
+}
+
+// listFiles lists files with name prefix by pages of limit entries. With
+// delimiter, names that contain it after prefix are grouped into prefixes,
+// so pseudo-directories can be browsed.
+func (h *Handler) listFiles(w http.ResponseWriter, r *http.Request) {
+	ctx, span := h.tracer.Start(r.Context(), "handler.ListFiles")
+	defer span.End()
+
+	var (
+		q         = r.URL.Query()
+		prefix    = q.Get("prefix")
+		delimiter = q.Get("delimiter")
+		from      = max(q.Get("cursor"), prefix)
+		limit     = DefaultListLimit
+	)
+	if v := q.Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil {
+			httpError(w, errors.Wrap(err, "parse limit").Error(), http.StatusBadRequest)
+			return
+		}
+		if n <= 0 || n > MaxListLimit {
+			httpError(w, errors.Errorf("limit %d is out of [1, %d]", n, MaxListLimit).Error(), http.StatusBadRequest)
+			return
+		}
+		limit = n
+	}
+	if strings.ContainsRune(prefix, 0) || strings.ContainsRune(from, 0) {
+		// Internal entries are named with NUL.
+		httpError(w, "prefix and cursor must not contain NUL", http.StatusBadRequest)
+		return
+	}
+	span.SetAttributes(
+		attribute.String("prefix", prefix),
+		attribute.String("delimiter", delimiter),
+		attribute.Int("limit", limit),
+	)
+
+	list, err := h.list(ctx, "", prefix, delimiter, from, limit)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	span.AddEvent("Listed files", trace.WithAttributes(
+		attribute.Int("files", len(list.Files)),
+		attribute.Int("prefixes", len(list.Prefixes)),
+	))
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(list)
+}
+
+// list returns page of at most limit files and prefixes with name
+// namespace+prefix, starting from name from. Cursor of page is the next name
+// to list.
+//
+// Namespace is the internal prefix of entries like S3 objects, which is
+// passed only by their callers, and is empty for files.
+func (h *Handler) list(ctx context.Context, namespace, prefix, delimiter, from string, limit int) (FileList, error) {
+	list := FileList{
+		Files:    []FileInfo{},
+		Prefixes: []string{},
+	}
+	prefix = namespace + prefix
+	if namespace == "" {
+		// Noncurrent versions and other internal entries are named below
+		// "\x01", and are listed only within their namespace.
+		from = max(from, "\x01")
+	}
+	// Entries of pseudo-directory are skipped, so page of limit entries can
+	// take several queries.
+	for {
+		files, err := h.storage.Files(ctx, prefix, from, limit)
+		if err != nil {
+			return list, err
+		}
+		done := len(files) < limit
+		for _, file := range files {
+			if file.Name < from {
+				// Rest of pseudo-directory.
+				continue
+			}
+			if len(list.Files)+len(list.Prefixes) == limit {
+				list.Cursor = file.Name
+				break
+			}
+			if delimiter != "" {
+				if i := strings.Index(file.Name[len(prefix):], delimiter); i >= 0 {
+					dir := file.Name[:len(prefix)+i+len(delimiter)]
+					list.Prefixes = append(list.Prefixes, dir)
+					if from = prefixEnd(dir); from == "" {
+						done = true
+						break
+					}
+					continue
+				}
+			}
+			list.Files = append(list.Files, file)
+			// The least name after file.
+			from = file.Name + "\x00"
+		}
+		if list.Cursor != "" || done {
+			break
+		}
+	}
+	return list, nil
+}
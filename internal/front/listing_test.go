@@ -0,0 +1,185 @@
+package front
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	noopMeter "go.opentelemetry.io/otel/metric/noop"
+	noopTracer "go.opentelemetry.io/otel/trace/noop"
+)
+
+func TestPrefixEnd(t *testing.T) {
+	for _, tt := range []struct {
+		Prefix string
+		End    string
+	}{
+		{"", ""},
+		{"a", "b"},
+		{"dir/", "dir0"},
+		{"a\U0010FFFF", "b"},
+		{"\U0010FFFF", ""},
+		{"a\uD7FF", "a\uE000"},
+		{"я", "ѐ"},
+	} {
+		require.Equal(t, tt.End, prefixEnd(tt.Prefix), "%q", tt.Prefix)
+	}
+}
+
+func listFiles(t *testing.T, server *httptest.Server, query url.Values) (*http.Response, FileList) {
+	t.Helper()
+	resp, err := server.Client().Get(server.URL + "/files?" + query.Encode())
+	require.NoError(t, err)
+	defer func() { _ = resp.Body.Close() }()
+	var list FileList
+	if resp.StatusCode == http.StatusOK {
+		require.NoError(t, json.NewDecoder(resp.Body).Decode(&list))
+	}
+	return resp, list
+}
+
+func TestListFiles(t *testing.T) {
+	var (
+		ctx   = context.Background()
+		stor  = newInMemoryStorage()
+		nodes = newInMemoryNodes()
+	)
+	handler, err := NewHandler(ctx, nodes, stor, noopTracer.NewTracerProvider(), noopMeter.NewMeterProvider(), HandlerOptions{
+		Chunking: ChunkPolicy{Size: 1000},
+	})
+	require.NoError(t, err)
+	server := httptest.NewServer(handler)
+	t.Cleanup(server.Close)
+	registerNodes(t, server, nodes, "node1:8080")
+
+	for _, name := range []string{
+		"e.txt",
+		"dir/sub/3.bin",
+		"dir/1.bin",
+		"a.txt",
+		"dir2/x",
+		"dir/2.bin",
+	} {
+		require.NoError(t, stor.AddFile(ctx, File{Name: name, Size: 10}))
+	}
+	// entries returns names of files and prefixes of listing.
+	entries := func(list FileList) (files, prefixes []string) {
+		files, prefixes = []string{}, []string{}
+		for _, file := range list.Files {
+			files = append(files, file.Name)
+		}
+		return files, append(prefixes, list.Prefixes...)
+	}
+
+	t.Run("Uploaded", func(t *testing.T) {
+		require.Equal(t, http.StatusOK, putFile(t, server, "/files/uploaded.bin", randomBytes(t, 2500)).StatusCode)
+		resp, list := listFiles(t, server, url.Values{"prefix": {"uploaded"}})
+		require.Equal(t, http.StatusOK, resp.StatusCode)
+		require.Equal(t, "application/json", resp.Header.Get("Content-Type"))
+		require.Len(t, list.Files, 1)
+		file := list.Files[0]
+		require.Equal(t, "uploaded.bin", file.Name)
+		require.Equal(t, int64(2500), file.Size)
+		require.Equal(t, 3, file.ChunkCount)
+		require.False(t, file.CreatedAt.IsZero())
+		require.Empty(t, list.Cursor)
+		require.Equal(t, http.StatusAccepted, deleteFile(t, server, "uploaded.bin").StatusCode)
+	})
+	t.Run("Prefix", func(t *testing.T) {
+		for _, tt := range []struct {
+			Query    url.Values
+			Files    []string
+			Prefixes []string
+		}{
+			{
+				Query: url.Values{},
+				Files: []string{"a.txt", "dir/1.bin", "dir/2.bin", "dir/sub/3.bin", "dir2/x", "e.txt"},
+			},
+			{
+				Query: url.Values{"prefix": {"dir/"}},
+				Files: []string{"dir/1.bin", "dir/2.bin", "dir/sub/3.bin"},
+			},
+			{
+				Query: url.Values{"prefix": {"missing/"}},
+			},
+			{
+				Query:    url.Values{"delimiter": {"/"}},
+				Files:    []string{"a.txt", "e.txt"},
+				Prefixes: []string{"dir/", "dir2/"},
+			},
+			{
+				Query:    url.Values{"prefix": {"dir/"}, "delimiter": {"/"}},
+				Files:    []string{"dir/1.bin", "dir/2.bin"},
+				Prefixes: []string{"dir/sub/"},
+			},
+			{
+				Query:    url.Values{"prefix": {"di"}, "delimiter": {"/"}},
+				Prefixes: []string{"dir/", "dir2/"},
+			},
+		} {
+			resp, list := listFiles(t, server, tt.Query)
+			require.Equal(t, http.StatusOK, resp.StatusCode)
+			files, prefixes := entries(list)
+			require.Equal(t, append([]string{}, tt.Files...), files, tt.Query)
+			require.Equal(t, append([]string{}, tt.Prefixes...), prefixes, tt.Query)
+			require.Empty(t, list.Cursor)
+		}
+	})
+	t.Run("Pagination", func(t *testing.T) {
+		for _, delimiter := range []string{"", "/"} {
+			full, all := listFiles(t, server, url.Values{"delimiter": {delimiter}})
+			require.Equal(t, http.StatusOK, full.StatusCode)
+			wantFiles, wantPrefixes := entries(all)
+			for limit := 1; limit <= 3; limit++ {
+				var (
+					files    = []string{}
+					prefixes = []string{}
+					cursor   string
+				)
+				for pages := 0; ; pages++ {
+					require.Less(t, pages, 10, "too many pages")
+					resp, list := listFiles(t, server, url.Values{
+						"delimiter": {delimiter},
+						"limit":     {strconv.Itoa(limit)},
+						"cursor":    {cursor},
+					})
+					require.Equal(t, http.StatusOK, resp.StatusCode)
+					pageFiles, pagePrefixes := entries(list)
+					files = append(files, pageFiles...)
+					prefixes = append(prefixes, pagePrefixes...)
+					if cursor = list.Cursor; cursor == "" {
+						break
+					}
+					require.Equal(t, limit, len(pageFiles)+len(pagePrefixes))
+				}
+				require.Equal(t, wantFiles, files, "delimiter=%q limit=%d", delimiter, limit)
+				require.Equal(t, wantPrefixes, prefixes, "delimiter=%q limit=%d", delimiter, limit)
+			}
+		}
+	})
+	t.Run("Internal", func(t *testing.T) {
+		require.NoError(t, stor.AddFile(ctx, File{Name: s3KeysPrefix + "bucket/secret.txt", Size: 10}))
+		for _, query := range []url.Values{
+			{"prefix": {"\x00"}},
+			{"prefix": {s3KeysPrefix}},
+			{"cursor": {"\x00"}},
+		} {
+			resp, _ := listFiles(t, server, query)
+			require.Equal(t, http.StatusBadRequest, resp.StatusCode, query)
+		}
+		list, err := handler.list(ctx, "", "\x00", "", "", 10)
+		require.NoError(t, err)
+		require.Empty(t, list.Files, "internal entries should be listed only within namespace")
+	})
+	t.Run("BadLimit", func(t *testing.T) {
+		for _, limit := range []string{"0", "-1", "x", "10001"} {
+			resp, _ := listFiles(t, server, url.Values{"limit": {limit}})
+			require.Equal(t, http.StatusBadRequest, resp.StatusCode, limit)
+		}
+	})
+}
@@ -0,0 +1,115 @@
+package front
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// ChunkMeta describes chunk of file in metadata API.
+type ChunkMeta struct {
+	Index    int       `json:"index"`
+	ID       uuid.UUID `json:"id"`
+	Offset   int64     `json:"offset"`
+	Size     int64     `json:"size"`
+	Checksum string    `json:"checksum,omitempty"`
+	Nodes    []string  `json:"nodes"`
+}
+
+// FileNode describes node that has replicas of file chunks in metadata API.
+type FileNode struct {
+	BaseURL string `json:"baseURL"`
+	// State is one of node states, or NodeStateUnknown if node is not
+	// registered.
+	State    string `json:"state"`
+	Draining bool   `json:"draining"`
+	// Chunks is the number of file chunks on node.
+	Chunks int `json:"chunks"`
+}
+
+// FileMeta describes file and layout of its chunks in metadata API.
+type FileMeta struct {
+	Name         string      `json:"name"`
+	Version      uuid.UUID   `json:"version"`
+	Size         int64       `json:"size"`
+	ContentType  string      `json:"contentType,omitempty"`
+	Checksum     string      `json:"checksum,omitempty"`
+	PartCount    int         `json:"partCount,omitempty"`
+	CreatedAt    time.Time   `json:"createdAt"`
+	DataShards   int         `json:"dataShards,omitempty"`
+	ParityShards int         `json:"parityShards,omitempty"`
+	ChunkCount   int         `json:"chunkCount"`
+	Chunks       []ChunkMeta `json:"chunks"`
+	// Nodes are nodes that download of file depends on.
+	Nodes []FileNode `json:"nodes"`
+}
+
+// fileMeta describes recorded file with its chunks and state of nodes that
+// have them, so it is visible which nodes download depends on.
+func (h *Handler) fileMeta(w http.ResponseWriter, r *http.Request) {
+	ctx, span := h.tracer.Start(r.Context(), "handler.FileMeta")
+	defer span.End()
+
+	file, err := h.requestedFile(ctx, r, r.PathValue("fileName"))
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	stats, err := h.storage.NodeStats(ctx)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	meta := FileMeta{
+		Name:         file.Name,
+		Version:      file.Version,
+		Size:         file.Size,
+		ContentType:  file.ContentType,
+		Checksum:     hex.EncodeToString(file.Checksum),
+		PartCount:    file.PartCount,
+		CreatedAt:    file.CreatedAt,
+		DataShards:   file.DataShards,
+		ParityShards: file.ParityShards,
+		ChunkCount:   file.ChunkCount,
+		Chunks:       make([]ChunkMeta, 0, len(file.Chunks)),
+		Nodes:        []FileNode{},
+	}
+	chunks := make(map[string]int)
+	for _, chunk := range file.Chunks {
+		meta.Chunks = append(meta.Chunks, ChunkMeta{
+			Index:    chunk.Index,
+			ID:       chunk.ID,
+			Offset:   chunk.Offset,
+			Size:     chunk.Size,
+			Checksum: hex.EncodeToString(chunk.Checksum),
+			Nodes:    append([]string{}, chunk.Nodes...),
+		})
+		for _, baseURL := range chunk.Nodes {
+			chunks[baseURL]++
+		}
+	}
+	for baseURL, n := range chunks {
+		fileNode := FileNode{
+			BaseURL: baseURL,
+			State:   NodeStateUnknown,
+			Chunks:  n,
+		}
+		if i := slices.IndexFunc(stats, func(s NodeStat) bool { return s.BaseURL == baseURL }); i >= 0 {
+			fileNode.State = h.nodeState(stats[i].LastSeen, stats[i].Status)
+			fileNode.Draining = stats[i].Draining
+		}
+		meta.Nodes = append(meta.Nodes, fileNode)
+	}
+	slices.SortFunc(meta.Nodes, func(a, b FileNode) int {
+		return strings.Compare(a.BaseURL, b.BaseURL)
+	})
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(meta)
+}
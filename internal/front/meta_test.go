@@ -0,0 +1,113 @@
+package front
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	noopMeter "go.opentelemetry.io/otel/metric/noop"
+	noopTracer "go.opentelemetry.io/otel/trace/noop"
+)
+
+func fileMeta(t *testing.T, server *httptest.Server, name string) (*http.Response, FileMeta) {
+	t.Helper()
+	resp, err := server.Client().Get(server.URL + "/files/" + name + "/meta")
+	require.NoError(t, err)
+	defer func() { _ = resp.Body.Close() }()
+	var meta FileMeta
+	if resp.StatusCode == http.StatusOK {
+		require.NoError(t, json.NewDecoder(resp.Body).Decode(&meta))
+	}
+	return resp, meta
+}
+
+func TestFileMeta(t *testing.T) {
+	var (
+		ctx   = context.Background()
+		stor  = newInMemoryStorage()
+		nodes = newInMemoryNodes()
+	)
+	handler, err := NewHandler(ctx, nodes, stor, noopTracer.NewTracerProvider(), noopMeter.NewMeterProvider(), HandlerOptions{
+		ReplicationFactor: 2,
+		Chunking:          ChunkPolicy{Size: 1000},
+	})
+	require.NoError(t, err)
+	server := httptest.NewServer(handler)
+	t.Cleanup(server.Close)
+	registerNodes(t, server, nodes, "node1:8080", "node2:8080", "node3:8080")
+
+	resp, _ := fileMeta(t, server, "missing.txt")
+	require.Equal(t, http.StatusNotFound, resp.StatusCode)
+
+	data := randomBytes(t, 2500)
+	req, err := http.NewRequest(http.MethodPut, server.URL+"/files/file.txt", bytes.NewReader(data))
+	require.NoError(t, err)
+	req.Header.Set("Content-Type", "text/plain")
+	resp, err = server.Client().Do(req)
+	require.NoError(t, err)
+	_ = resp.Body.Close()
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+
+	file, err := stor.File(ctx, "file.txt")
+	require.NoError(t, err)
+	// Replica on node that is not registered, and dead node.
+	require.NoError(t, stor.AddReplica(ctx, file.Chunks[0], "gone:8080"))
+	require.NoError(t, stor.AddNode(ctx, Node{BaseURL: "node3:8080", LastSeen: time.Now().Add(-time.Hour)}))
+	file, err = stor.File(ctx, "file.txt")
+	require.NoError(t, err)
+
+	resp, meta := fileMeta(t, server, "file.txt")
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	require.Equal(t, "application/json", resp.Header.Get("Content-Type"))
+	sum := sha256.Sum256(data)
+	require.Equal(t, "file.txt", meta.Name)
+	require.Equal(t, int64(2500), meta.Size)
+	require.Equal(t, "text/plain", meta.ContentType)
+	require.Equal(t, hex.EncodeToString(sum[:]), meta.Checksum)
+	require.Equal(t, file.CreatedAt.UTC(), meta.CreatedAt.UTC())
+	require.Equal(t, 3, meta.ChunkCount)
+	require.Len(t, meta.Chunks, 3)
+
+	chunks := make(map[string]int)
+	for i, chunk := range file.Chunks {
+		require.Equal(t, ChunkMeta{
+			Index:    chunk.Index,
+			ID:       chunk.ID,
+			Offset:   chunk.Offset,
+			Size:     chunk.Size,
+			Checksum: hex.EncodeToString(chunk.Checksum),
+			Nodes:    chunk.Nodes,
+		}, meta.Chunks[i])
+		for _, baseURL := range chunk.Nodes {
+			chunks[baseURL]++
+		}
+	}
+	states := map[string]string{
+		"gone:8080":  NodeStateUnknown,
+		"node1:8080": NodeStateUp,
+		"node2:8080": NodeStateUp,
+		"node3:8080": NodeStateDead,
+	}
+	var baseURLs []string
+	for _, n := range meta.Nodes {
+		baseURLs = append(baseURLs, n.BaseURL)
+		require.Equal(t, states[n.BaseURL], n.State, n.BaseURL)
+		require.Equal(t, chunks[n.BaseURL], n.Chunks, n.BaseURL)
+	}
+	require.Len(t, baseURLs, len(chunks))
+	require.IsIncreasing(t, baseURLs)
+
+	// Content type is served on download.
+	resp, downloaded, err := downloadFile(t, server, "file.txt")
+	require.NoError(t, err)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	require.Equal(t, "text/plain", resp.Header.Get("Content-Type"))
+	require.Equal(t, data, downloaded)
+}
@@ -0,0 +1,252 @@
+package front
+
+import (
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/go-faster/sdk/zctx"
+	"github.com/google/uuid"
+	"go.opentelemetry.io/otel/attribute"
+	"go.uber.org/zap"
+)
+
+// MaxUploadParts is the maximum number of parts of multipart upload.
+const MaxUploadParts = 10000
+
+// PartMeta describes uploaded part in multipart upload API.
+type PartMeta struct {
+	Number    int       `json:"number"`
+	Size      int64     `json:"size"`
+	Checksum  string    `json:"checksum"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+// UploadMeta describes multipart upload in multipart upload API.
+type UploadMeta struct {
+	ID          uuid.UUID  `json:"id"`
+	Name        string     `json:"name"`
+	ContentType string     `json:"contentType,omitempty"`
+	CreatedAt   time.Time  `json:"createdAt"`
+	ExpiresAt   time.Time  `json:"expiresAt"`
+	Parts       []PartMeta `json:"parts"`
+}
+
+func (h *Handler) uploadMeta(upload *Upload, parts []Part) UploadMeta {
+	meta := UploadMeta{
+		ID:          upload.ID,
+		Name:        upload.Name,
+		ContentType: upload.ContentType,
+		CreatedAt:   upload.CreatedAt,
+		ExpiresAt:   h.expiresAt(upload),
+		Parts:       []PartMeta{},
+	}
+	for _, part := range parts {
+		meta.Parts = append(meta.Parts, partMeta(part))
+	}
+	return meta
+}
+
+func partMeta(part Part) PartMeta {
+	return PartMeta{
+		Number:    part.Number,
+		Size:      part.Size,
+		Checksum:  hex.EncodeToString(part.Checksum),
+		CreatedAt: part.CreatedAt,
+	}
+}
+
+// multipartUpload returns multipart upload of request. Resumable and expired
+// uploads are not found.
+func (h *Handler) multipartUpload(ctx context.Context, r *http.Request) (*Upload, error) {
+	id, err := uuid.Parse(r.PathValue("id"))
+	if err != nil {
+		return nil, &UploadNotFoundErr{}
+	}
+	upload, err := h.storage.Upload(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if upload.Length != 0 || validateFileName(upload.Name) != nil || h.expired(upload) {
+		// Resumable uploads and uploads of S3 objects are not exposed.
+		return nil, &UploadNotFoundErr{Upload: id}
+	}
+	return upload, nil
+}
+
+// createUpload initiates multipart upload of file with name parameter.
+func (h *Handler) createUpload(w http.ResponseWriter, r *http.Request) {
+	ctx, span := h.tracer.Start(r.Context(), "handler.CreateUpload")
+	defer span.End()
+
+	now := h.now()
+	upload := Upload{
+		ID:          uuid.New(),
+		Name:        r.URL.Query().Get("name"),
+		ContentType: r.Header.Get("Content-Type"),
+		CreatedAt:   now,
+		UpdatedAt:   now,
+	}
+	if err := validateFileName(upload.Name); err != nil {
+		httpError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	span.SetAttributes(attribute.String("fileName", upload.Name))
+	if err := h.storage.AddUpload(ctx, upload); err != nil {
+		writeError(w, err)
+		return
+	}
+	zctx.From(ctx).Info("Created multipart upload",
+		zap.String("fileName", upload.Name),
+		zap.String("uploadID", upload.ID.String()),
+	)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Location", "/uploads/"+upload.ID.String())
+	w.WriteHeader(http.StatusCreated)
+	_ = json.NewEncoder(w).Encode(h.uploadMeta(&upload, nil))
+}
+
+// getUpload describes multipart upload with parts that are uploaded so far.
+func (h *Handler) getUpload(w http.ResponseWriter, r *http.Request) {
+	ctx, span := h.tracer.Start(r.Context(), "handler.GetUpload")
+	defer span.End()
+
+	upload, err := h.multipartUpload(ctx, r)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	parts, err := h.storage.Parts(ctx, upload.ID)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(h.uploadMeta(upload, parts))
+}
+
+// uploadPart writes request body as part of multipart upload. Parts can be
+// uploaded concurrently and in any order, part with the same number is
+// replaced.
+func (h *Handler) uploadPart(w http.ResponseWriter, r *http.Request) {
+	ctx, span := h.tracer.Start(r.Context(), "handler.UploadPart")
+	defer span.End()
+
+	number, err := strconv.Atoi(r.PathValue("number"))
+	if err != nil || number < 1 || number > MaxUploadParts {
+		httpError(w, fmt.Sprintf("part number must be in [1, %d]", MaxUploadParts), http.StatusBadRequest)
+		return
+	}
+	chunker, err := h.chunking.chunker(r)
+	if err != nil {
+		httpError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	upload, err := h.multipartUpload(ctx, r)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	span.SetAttributes(
+		attribute.String("fileName", upload.Name),
+		attribute.Int("part", number),
+	)
+
+	file := File{Name: upload.Name}
+	targets, err := h.writeFile(ctx, r.Body, chunker, &file)
+	part := Part{
+		Number:    number,
+		Size:      file.Size,
+		Checksum:  file.Checksum,
+		CreatedAt: h.now(),
+		Chunks:    file.Chunks,
+	}
+	if err == nil {
+		err = h.storage.AddPart(ctx, upload.ID, part)
+	}
+	if err != nil {
+		h.removeChunks(ctx, file.Chunks, targets)
+		writeError(w, err)
+		return
+	}
+	// Chunks of replaced part.
+	h.notifyCollector()
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(partMeta(part))
+}
+
+// completeUpload publishes file that consists of all parts of multipart
+// upload in order of their numbers. Parts must be numbered from one without
+// gaps, and their count must be passed as parts parameter, so upload with
+// missing parts is not completed.
+func (h *Handler) completeUpload(w http.ResponseWriter, r *http.Request) {
+	ctx, span := h.tracer.Start(r.Context(), "handler.CompleteUpload")
+	defer span.End()
+
+	count, err := strconv.Atoi(r.URL.Query().Get("parts"))
+	if err != nil || count < 1 {
+		httpError(w, "parts is required", http.StatusBadRequest)
+		return
+	}
+	upload, err := h.multipartUpload(ctx, r)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	parts, err := h.storage.Parts(ctx, upload.ID)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	if len(parts) != count {
+		httpError(w, fmt.Sprintf("expected %d parts, uploaded %d", count, len(parts)), http.StatusBadRequest)
+		return
+	}
+	for i, part := range parts {
+		if part.Number != i+1 {
+			httpError(w, fmt.Sprintf("part %d is missing", i+1), http.StatusBadRequest)
+			return
+		}
+	}
+
+	file := assembleFile(upload, parts, h.now())
+	if err := h.completeFile(ctx, upload.ID, parts, &file); err != nil {
+		writeError(w, err)
+		return
+	}
+	zctx.From(ctx).Info("Completed multipart upload",
+		zap.String("fileName", file.Name),
+		zap.String("uploadID", upload.ID.String()),
+		zap.Int("parts", len(parts)),
+	)
+	writeLink(w, r, &file)
+}
+
+// abortUpload removes multipart upload with its parts.
+func (h *Handler) abortUpload(w http.ResponseWriter, r *http.Request) {
+	ctx, span := h.tracer.Start(r.Context(), "handler.AbortUpload")
+	defer span.End()
+
+	upload, err := h.multipartUpload(ctx, r)
+	if err == nil {
+		err = h.storage.RemoveUpload(ctx, upload.ID)
+	}
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	zctx.From(ctx).Info("Aborted multipart upload",
+		zap.String("fileName", upload.Name),
+		zap.String("uploadID", upload.ID.String()),
+	)
+	h.notifyCollector()
+
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,279 @@
+package front
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	noopMeter "go.opentelemetry.io/otel/metric/noop"
+	noopTracer "go.opentelemetry.io/otel/trace/noop"
+	"golang.org/x/sync/errgroup"
+)
+
+// createMultipart initiates multipart upload of file with name.
+func createMultipart(t *testing.T, server *httptest.Server, name string) UploadMeta {
+	t.Helper()
+	resp, err := server.Client().Post(server.URL+"/uploads?name="+name, "text/plain", http.NoBody)
+	require.NoError(t, err)
+	defer func() { _ = resp.Body.Close() }()
+	require.Equal(t, http.StatusCreated, resp.StatusCode)
+	var upload UploadMeta
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&upload))
+	require.Equal(t, "/uploads/"+upload.ID.String(), resp.Header.Get("Location"))
+	return upload
+}
+
+// uploadMultipartPart uploads part of multipart upload.
+func uploadMultipartPart(server *httptest.Server, upload UploadMeta, number int, data []byte) (*http.Response, error) {
+	req, err := http.NewRequest(http.MethodPut, fmt.Sprintf("%s/uploads/%s/parts/%d", server.URL, upload.ID, number), bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	resp, err := server.Client().Do(req)
+	if err != nil {
+		return nil, err
+	}
+	_ = resp.Body.Close()
+	return resp, nil
+}
+
+// completeMultipart completes multipart upload of count parts.
+func completeMultipart(t *testing.T, server *httptest.Server, upload UploadMeta, count int) (*http.Response, string) {
+	t.Helper()
+	resp, err := server.Client().Post(fmt.Sprintf("%s/uploads/%s/complete?parts=%d", server.URL, upload.ID, count), "", http.NoBody)
+	require.NoError(t, err)
+	defer func() { _ = resp.Body.Close() }()
+	data, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+	return resp, strings.TrimSpace(string(data))
+}
+
+// getMultipart returns status and description of multipart upload.
+func getMultipart(t *testing.T, server *httptest.Server, upload UploadMeta) (int, UploadMeta) {
+	t.Helper()
+	resp, err := server.Client().Get(server.URL + "/uploads/" + upload.ID.String())
+	require.NoError(t, err)
+	defer func() { _ = resp.Body.Close() }()
+	var meta UploadMeta
+	if resp.StatusCode == http.StatusOK {
+		require.NoError(t, json.NewDecoder(resp.Body).Decode(&meta))
+	}
+	return resp.StatusCode, meta
+}
+
+func TestMultipartUpload(t *testing.T) {
+	var (
+		ctx   = context.Background()
+		stor  = newInMemoryStorage()
+		nodes = newInMemoryNodes()
+	)
+	handler, err := NewHandler(ctx, nodes, stor, noopTracer.NewTracerProvider(), noopMeter.NewMeterProvider(), HandlerOptions{
+		ReplicationFactor: 2,
+		Chunking:          ChunkPolicy{Size: 1000},
+		UploadTTL:         time.Hour,
+	})
+	require.NoError(t, err)
+	server := httptest.NewServer(handler)
+	t.Cleanup(server.Close)
+	registerNodes(t, server, nodes, "node1:8080", "node2:8080", "node3:8080")
+
+	t.Run("Parallel", func(t *testing.T) {
+		upload := createMultipart(t, server, "multipart.bin")
+		require.Equal(t, "multipart.bin", upload.Name)
+		require.Equal(t, upload.CreatedAt.Add(time.Hour), upload.ExpiresAt)
+
+		data := randomBytes(t, 5500)
+		parts := [][]byte{data[:2500], data[2500:5000], data[5000:]}
+		// Parts are uploaded concurrently, starting from the last one.
+		var g errgroup.Group
+		for i := len(parts) - 1; i >= 0; i-- {
+			g.Go(func() error {
+				resp, err := uploadMultipartPart(server, upload, i+1, parts[i])
+				if err != nil {
+					return err
+				}
+				if resp.StatusCode != http.StatusOK {
+					return fmt.Errorf("part %d: status %d", i+1, resp.StatusCode)
+				}
+				return nil
+			})
+		}
+		require.NoError(t, g.Wait())
+
+		code, meta := getMultipart(t, server, upload)
+		require.Equal(t, http.StatusOK, code)
+		require.Len(t, meta.Parts, 3)
+		for i, part := range meta.Parts {
+			require.Equal(t, i+1, part.Number)
+			require.Equal(t, int64(len(parts[i])), part.Size)
+		}
+
+		// File is not visible until upload is complete.
+		_, err := stor.File(ctx, "multipart.bin")
+		require.ErrorAs(t, err, new(*FileNotFoundErr))
+
+		resp, _ := completeMultipart(t, server, upload, 4)
+		require.Equal(t, http.StatusBadRequest, resp.StatusCode)
+		resp, link := completeMultipart(t, server, upload, 3)
+		require.Equal(t, http.StatusOK, resp.StatusCode)
+		require.True(t, strings.HasSuffix(link, "/download/multipart.bin"), link)
+
+		file, err := stor.File(ctx, "multipart.bin")
+		require.NoError(t, err)
+		require.Equal(t, int64(len(data)), file.Size)
+		require.Equal(t, "text/plain", file.ContentType)
+		// 1000, 1000, 500 for every of the first two parts.
+		require.Equal(t, 7, file.ChunkCount)
+		require.Equal(t, 3, file.PartCount)
+		resp, downloaded, err := downloadFile(t, server, "multipart.bin")
+		require.NoError(t, err)
+		require.Equal(t, http.StatusOK, resp.StatusCode)
+		require.Equal(t, data, downloaded)
+		// Checksum of assembled file is composite of part checksums.
+		var checksums []byte
+		for _, part := range parts {
+			sum := sha256.Sum256(part)
+			checksums = append(checksums, sum[:]...)
+		}
+		composite := sha256.Sum256(checksums)
+		require.Equal(t, `"`+hex.EncodeToString(composite[:])+`-3"`, resp.Header.Get("ETag"))
+		require.Empty(t, resp.Header.Get("Digest"))
+
+		code, _ = getMultipart(t, server, upload)
+		require.Equal(t, http.StatusNotFound, code)
+		resp, err = uploadMultipartPart(server, upload, 1, parts[0])
+		require.NoError(t, err)
+		require.Equal(t, http.StatusNotFound, resp.StatusCode)
+	})
+	t.Run("Replace", func(t *testing.T) {
+		upload := createMultipart(t, server, "replaced.bin")
+		resp, err := uploadMultipartPart(server, upload, 1, randomBytes(t, 100))
+		require.NoError(t, err)
+		require.Equal(t, http.StatusOK, resp.StatusCode)
+		parts, err := stor.Parts(ctx, upload.ID)
+		require.NoError(t, err)
+		replaced := parts[0].Chunks[0]
+
+		data := randomBytes(t, 200)
+		resp, err = uploadMultipartPart(server, upload, 1, data)
+		require.NoError(t, err)
+		require.Equal(t, http.StatusOK, resp.StatusCode)
+		resp, _ = completeMultipart(t, server, upload, 1)
+		require.Equal(t, http.StatusOK, resp.StatusCode)
+
+		_, downloaded, err := downloadFile(t, server, "replaced.bin")
+		require.NoError(t, err)
+		require.Equal(t, data, downloaded)
+		garbage := stor.garbageKeys()
+		for _, baseURL := range replaced.Nodes {
+			require.Contains(t, garbage, Replica{ChunkID: replaced.ID, Node: baseURL})
+		}
+	})
+	t.Run("ChangedPart", func(t *testing.T) {
+		upload := createMultipart(t, server, "changed.bin")
+		resp, err := uploadMultipartPart(server, upload, 1, randomBytes(t, 100))
+		require.NoError(t, err)
+		require.Equal(t, http.StatusOK, resp.StatusCode)
+		listed, err := stor.Parts(ctx, upload.ID)
+		require.NoError(t, err)
+
+		// Part is replaced after it is listed for completion.
+		resp, err = uploadMultipartPart(server, upload, 1, randomBytes(t, 200))
+		require.NoError(t, err)
+		require.Equal(t, http.StatusOK, resp.StatusCode)
+		u, err := stor.Upload(ctx, upload.ID)
+		require.NoError(t, err)
+		file := assembleFile(u, listed, handler.now())
+		require.ErrorAs(t, handler.completeFile(ctx, upload.ID, listed, &file), new(*PartChangedErr))
+		_, err = stor.File(ctx, "changed.bin")
+		require.ErrorAs(t, err, new(*FileNotFoundErr))
+
+		resp, _ = completeMultipart(t, server, upload, 1)
+		require.Equal(t, http.StatusOK, resp.StatusCode)
+		completed, err := stor.File(ctx, "changed.bin")
+		require.NoError(t, err)
+		require.Equal(t, int64(200), completed.Size)
+	})
+	t.Run("MissingPart", func(t *testing.T) {
+		upload := createMultipart(t, server, "missing.bin")
+		for _, number := range []int{1, 3} {
+			resp, err := uploadMultipartPart(server, upload, number, randomBytes(t, 100))
+			require.NoError(t, err)
+			require.Equal(t, http.StatusOK, resp.StatusCode)
+		}
+		resp, _ := completeMultipart(t, server, upload, 2)
+		require.Equal(t, http.StatusBadRequest, resp.StatusCode)
+		resp, _ = completeMultipart(t, server, upload, 3)
+		require.Equal(t, http.StatusBadRequest, resp.StatusCode)
+
+		resp, err := uploadMultipartPart(server, upload, MaxUploadParts+1, randomBytes(t, 100))
+		require.NoError(t, err)
+		require.Equal(t, http.StatusBadRequest, resp.StatusCode)
+	})
+	t.Run("Abort", func(t *testing.T) {
+		upload := createMultipart(t, server, "aborted.bin")
+		resp, err := uploadMultipartPart(server, upload, 1, randomBytes(t, 100))
+		require.NoError(t, err)
+		require.Equal(t, http.StatusOK, resp.StatusCode)
+
+		req, err := http.NewRequest(http.MethodDelete, server.URL+"/uploads/"+upload.ID.String(), http.NoBody)
+		require.NoError(t, err)
+		resp, err = server.Client().Do(req)
+		require.NoError(t, err)
+		_ = resp.Body.Close()
+		require.Equal(t, http.StatusNoContent, resp.StatusCode)
+
+		code, _ := getMultipart(t, server, upload)
+		require.Equal(t, http.StatusNotFound, code)
+		resp, _ = completeMultipart(t, server, upload, 1)
+		require.Equal(t, http.StatusNotFound, resp.StatusCode)
+		_, err = stor.File(ctx, "aborted.bin")
+		require.ErrorAs(t, err, new(*FileNotFoundErr))
+	})
+	t.Run("Expire", func(t *testing.T) {
+		upload := createMultipart(t, server, "expired.bin")
+		resp, err := uploadMultipartPart(server, upload, 1, randomBytes(t, 100))
+		require.NoError(t, err)
+		require.Equal(t, http.StatusOK, resp.StatusCode)
+
+		// Upload is prolonged by every part.
+		require.NoError(t, stor.AddPart(ctx, upload.ID, Part{
+			Number:    2,
+			CreatedAt: upload.CreatedAt.Add(30 * time.Minute),
+		}))
+		now := upload.CreatedAt.Add(time.Hour + time.Second)
+		handler.now = func() time.Time { return now }
+		t.Cleanup(func() { handler.now = time.Now })
+		code, meta := getMultipart(t, server, upload)
+		require.Equal(t, http.StatusOK, code)
+		require.Equal(t, upload.CreatedAt.Add(90*time.Minute), meta.ExpiresAt)
+
+		now = meta.ExpiresAt.Add(time.Second)
+		fresh := createMultipart(t, server, "fresh.bin")
+		code, _ = getMultipart(t, server, upload)
+		require.Equal(t, http.StatusNotFound, code)
+
+		expirer, err := NewUploadExpirer(handler, UploadExpirerOptions{}, noopTracer.NewTracerProvider(), noopMeter.NewMeterProvider())
+		require.NoError(t, err)
+		require.NoError(t, expirer.Expire(ctx))
+		_, err = stor.Upload(ctx, upload.ID)
+		require.ErrorAs(t, err, new(*UploadNotFoundErr))
+		_, err = stor.Upload(ctx, fresh.ID)
+		require.NoError(t, err)
+
+		// Upload that was updated since it was listed is kept.
+		require.ErrorAs(t, stor.RemoveStaleUpload(ctx, fresh.ID, now), new(*UploadNotFoundErr))
+		_, err = stor.Upload(ctx, fresh.ID)
+		require.NoError(t, err)
+	})
+}
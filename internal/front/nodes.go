@@ -0,0 +1,216 @@
+package front
+
+import (
+	"context"
+	"encoding/json"
+	"math"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/go-faster/errors"
+	"github.com/go-faster/sdk/zctx"
+	"go.uber.org/zap"
+
+	"github.com/ernado/stor/internal/node"
+)
+
+// Node states, as seen by front.
+const (
+	// NodeStateUp means that node sends heartbeats and reports it is ok.
+	NodeStateUp = "up"
+	// NodeStateUnhealthy means that node sends heartbeats, but reports
+	// that it is not able to store chunks.
+	NodeStateUnhealthy = "unhealthy"
+	// NodeStateDead means that node missed heartbeats.
+	NodeStateDead = "dead"
+	// NodeStateUnknown means that node is not registered, e.g. it was
+	// decommissioned while replica is still recorded.
+	NodeStateUnknown = "unknown"
+)
+
+// nodeState returns state of node with given last heartbeat and status.
+func (h *Handler) nodeState(lastSeen time.Time, status node.Status) string {
+	switch {
+	case h.now().Sub(lastSeen) > h.heartbeatTimeout:
+		return NodeStateDead
+	case status.State != node.StateOK:
+		return NodeStateUnhealthy
+	default:
+		return NodeStateUp
+	}
+}
+
+// alive reports whether node is up.
+func (h *Handler) alive(stat NodeStat) bool {
+	return h.nodeState(stat.LastSeen, stat.Status) == NodeStateUp
+}
+
+// liveNodeStats returns stats of nodes that are up and can be selected for
+// new chunks, i.e. are not draining.
+func (h *Handler) liveNodeStats(ctx context.Context) ([]NodeStat, error) {
+	stats, err := h.storage.NodeStats(ctx)
+	if err != nil {
+		return nil, errors.Wrap(err, "node stats")
+	}
+	return slices.DeleteFunc(stats, func(stat NodeStat) bool {
+		return !h.alive(stat) || stat.Draining
+	}), nil
+}
+
+// ErrInsufficientCapacity means that there are not enough nodes with free
+// space for chunk.
+var ErrInsufficientCapacity = errors.New("insufficient capacity")
+
+// ErrNoNodes means that there are not enough live nodes to place chunk on.
+var ErrNoNodes = errors.New("no nodes available")
+
+// hasCapacity reports whether node reported its disk capacity.
+func hasCapacity(stat NodeStat) bool {
+	return stat.Status.Capacity != nil && stat.Status.Capacity.TotalBytes > 0
+}
+
+// freeRatio returns fraction of free disk space of node.
+func freeRatio(stat NodeStat) float64 {
+	c := stat.Status.Capacity
+	return float64(c.FreeBytes) / float64(c.TotalBytes)
+}
+
+// freeSpace returns bytes and inodes of node that can be used for chunks,
+// keeping reserved space free. Both are -1 if node did not report its
+// capacity, and inodes are -1 if its file system does not limit them.
+func (h *Handler) freeSpace(stat NodeStat) (bytes, inodes int64) {
+	if !hasCapacity(stat) {
+		return -1, -1
+	}
+	c := stat.Status.Capacity
+	reserve := uint64(float64(c.TotalBytes) * h.capacityReserve)
+	if c.FreeBytes > reserve {
+		bytes = int64(min(c.FreeBytes-reserve, math.MaxInt64)) // #nosec G115
+	}
+	inodes = -1
+	if c.TotalInodes > 0 {
+		inodes = int64(min(c.FreeInodes, math.MaxInt64)) // #nosec G115
+	}
+	return bytes, inodes
+}
+
+// chunkInodes is the number of inodes taken by chunk and its checksum.
+const chunkInodes = 2
+
+// spaceFits reports whether chunk of given size fits into free space
+// returned by freeSpace.
+func spaceFits(bytes, inodes, size int64) bool {
+	return (bytes < 0 || bytes >= size) && (inodes < 0 || inodes >= chunkInodes)
+}
+
+// fits reports whether chunk of given size fits on node, keeping reserved
+// space free.
+//
+// Node that did not report its capacity is assumed to have enough space.
+func (h *Handler) fits(stat NodeStat, size int64) bool {
+	bytes, inodes := h.freeSpace(stat)
+	return spaceFits(bytes, inodes, size)
+}
+
+// fittingNodeStats returns stats of live nodes that have space for chunk of
+// given size, failing if there are fewer than n of them.
+func (h *Handler) fittingNodeStats(ctx context.Context, size int64, n int) ([]NodeStat, error) {
+	stats, err := h.liveNodeStats(ctx)
+	if err != nil {
+		return nil, errors.Wrap(err, "node stats")
+	}
+	if len(stats) < n {
+		return nil, errors.Wrapf(ErrNoNodes, "not enough nodes: %d < %d", len(stats), n)
+	}
+	live := len(stats)
+	stats = slices.DeleteFunc(stats, func(stat NodeStat) bool {
+		return !h.fits(stat, size)
+	})
+	if len(stats) < n {
+		return nil, errors.Wrapf(ErrInsufficientCapacity, "%d of %d nodes have space for %d bytes, need %d",
+			len(stats), live, size, n,
+		)
+	}
+	return stats, nil
+}
+
+// heartbeat handles periodic heartbeat from node with its status.
+func (h *Handler) heartbeat(w http.ResponseWriter, r *http.Request) {
+	ctx, span := h.tracer.Start(r.Context(), "handler.Heartbeat")
+	defer span.End()
+
+	if r.Method != http.MethodPut {
+		httpError(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	baseURL := r.URL.Query().Get("baseURL")
+	if baseURL == "" {
+		httpError(w, "baseURL is required", http.StatusBadRequest)
+		return
+	}
+	var status node.Status
+	if err := json.NewDecoder(r.Body).Decode(&status); err != nil {
+		httpError(w, errors.Wrap(err, "decode status").Error(), http.StatusBadRequest)
+		return
+	}
+	// Heartbeat does not register node, so decommissioned node is not
+	// brought back until it registers again.
+	if err := h.storage.UpdateNode(ctx, baseURL, h.now(), status); err != nil {
+		writeError(w, err)
+		return
+	}
+	if status.State != node.StateOK {
+		zctx.From(ctx).Warn("Node is unhealthy",
+			zap.String("baseURL", baseURL),
+			zap.String("error", status.Error),
+		)
+	}
+}
+
+// NodeInfo describes node in admin API.
+type NodeInfo struct {
+	BaseURL     string        `json:"baseURL"`
+	State       string        `json:"state"`
+	Status      node.Status   `json:"status"`
+	LastSeen    time.Time     `json:"lastSeen"`
+	Draining    bool          `json:"draining"`
+	Topology    node.Topology `json:"topology"`
+	TotalChunks int           `json:"totalChunks"`
+	TotalSize   int64         `json:"totalSize"`
+}
+
+// adminNodes lists all nodes with their state.
+func (h *Handler) adminNodes(w http.ResponseWriter, r *http.Request) {
+	ctx, span := h.tracer.Start(r.Context(), "handler.AdminNodes")
+	defer span.End()
+
+	if r.Method != http.MethodGet {
+		httpError(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	stats, err := h.storage.NodeStats(ctx)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	out := make([]NodeInfo, 0, len(stats))
+	for _, stat := range stats {
+		out = append(out, NodeInfo{
+			BaseURL:     stat.BaseURL,
+			State:       h.nodeState(stat.LastSeen, stat.Status),
+			Status:      stat.Status,
+			LastSeen:    stat.LastSeen,
+			Draining:    stat.Draining,
+			Topology:    stat.Topology,
+			TotalChunks: stat.TotalChunks,
+			TotalSize:   stat.TotalSize,
+		})
+	}
+	slices.SortFunc(out, func(a, b NodeInfo) int {
+		return strings.Compare(a.BaseURL, b.BaseURL)
+	})
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(out)
+}
@@ -0,0 +1,200 @@
+package front
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	noopMeter "go.opentelemetry.io/otel/metric/noop"
+	noopTracer "go.opentelemetry.io/otel/trace/noop"
+
+	"github.com/ernado/stor/internal/node"
+)
+
+func sendHeartbeat(t *testing.T, server *httptest.Server, baseURL string, status node.Status) *http.Response {
+	t.Helper()
+	body, err := json.Marshal(status)
+	require.NoError(t, err)
+	u := server.URL + "/heartbeat?" + url.Values{"baseURL": {baseURL}}.Encode()
+	req, err := http.NewRequest(http.MethodPut, u, bytes.NewReader(body))
+	require.NoError(t, err)
+	resp, err := server.Client().Do(req)
+	require.NoError(t, err)
+	_ = resp.Body.Close()
+	return resp
+}
+
+func TestHandlerHeartbeat(t *testing.T) {
+	var (
+		ctx   = context.Background()
+		stor  = newInMemoryStorage()
+		nodes = newInMemoryNodes()
+	)
+	handler, err := NewHandler(ctx, nodes, stor, noopTracer.NewTracerProvider(), noopMeter.NewMeterProvider(), HandlerOptions{
+		HeartbeatTimeout: 10 * time.Second,
+		Chunking:         ChunkPolicy{Size: 200},
+	})
+	require.NoError(t, err)
+	var (
+		nowMux sync.Mutex
+		now    = time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	)
+	handler.now = func() time.Time {
+		nowMux.Lock()
+		defer nowMux.Unlock()
+		return now
+	}
+	advance := func(d time.Duration) {
+		nowMux.Lock()
+		defer nowMux.Unlock()
+		now = now.Add(d)
+	}
+	server := httptest.NewServer(handler)
+	t.Cleanup(server.Close)
+	registerNodes(t, server, nodes, "node1:8080", "node2:8080", "node3:8080")
+
+	// Only node1 keeps sending heartbeats, node2 reports failure.
+	advance(8 * time.Second)
+	require.Equal(t, http.StatusOK, sendHeartbeat(t, server, "node1:8080", node.Status{State: node.StateOK}).StatusCode)
+	require.Equal(t, http.StatusOK, sendHeartbeat(t, server, "node2:8080", node.Status{
+		State: node.StateUnhealthy,
+		Error: "disk is full",
+	}).StatusCode)
+	advance(8 * time.Second)
+
+	resp := uploadFile(t, server, "live.bin", randomBytes(t, 1024))
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	file, err := stor.File(ctx, "live.bin")
+	require.NoError(t, err)
+	for _, chunk := range file.Chunks {
+		require.Equal(t, []string{"node1:8080"}, chunk.Nodes, "only live node should be selected")
+	}
+
+	t.Run("Admin", func(t *testing.T) {
+		resp, err := server.Client().Get(server.URL + "/admin/nodes")
+		require.NoError(t, err)
+		defer func() { _ = resp.Body.Close() }()
+		require.Equal(t, http.StatusOK, resp.StatusCode)
+		var infos []NodeInfo
+		require.NoError(t, json.NewDecoder(resp.Body).Decode(&infos))
+		require.Len(t, infos, 3)
+		states := make(map[string]string)
+		for _, info := range infos {
+			states[info.BaseURL] = info.State
+		}
+		require.Equal(t, map[string]string{
+			"node1:8080": NodeStateUp,
+			"node2:8080": NodeStateUnhealthy,
+			"node3:8080": NodeStateDead,
+		}, states)
+		require.Equal(t, "disk is full", infos[1].Status.Error)
+		require.Equal(t, 6, infos[0].TotalChunks)
+	})
+	t.Run("BadRequest", func(t *testing.T) {
+		req, err := http.NewRequest(http.MethodPut, server.URL+"/heartbeat?baseURL=node1:8080", bytes.NewReader([]byte("{")))
+		require.NoError(t, err)
+		resp, err := server.Client().Do(req)
+		require.NoError(t, err)
+		_ = resp.Body.Close()
+		require.Equal(t, http.StatusBadRequest, resp.StatusCode)
+	})
+	t.Run("NotRegistered", func(t *testing.T) {
+		resp := sendHeartbeat(t, server, "node4:8080", node.Status{State: node.StateOK})
+		require.Equal(t, http.StatusNotFound, resp.StatusCode)
+		registered, err := stor.Nodes(ctx)
+		require.NoError(t, err)
+		require.Len(t, registered, 3, "heartbeat should not register node")
+	})
+	t.Run("AllDead", func(t *testing.T) {
+		advance(time.Minute)
+		resp := uploadFile(t, server, "dead.bin", randomBytes(t, 1024))
+		require.Equal(t, http.StatusServiceUnavailable, resp.StatusCode)
+	})
+}
+
+func TestHandlerCapacity(t *testing.T) {
+	var (
+		ctx   = context.Background()
+		stor  = newInMemoryStorage()
+		nodes = newInMemoryNodes()
+	)
+	handler, err := NewHandler(ctx, nodes, stor, noopTracer.NewTracerProvider(), noopMeter.NewMeterProvider(), HandlerOptions{
+		CapacityReserve: 0.1,
+	})
+	require.NoError(t, err)
+	server := httptest.NewServer(handler)
+	t.Cleanup(server.Close)
+	registerNodes(t, server, nodes, "node1:8080", "node2:8080", "node3:8080", "node4:8080")
+
+	const gb = 1 << 30
+	capacities := map[string]*node.Capacity{
+		// Least filled by ratio, although largest by size.
+		"node1:8080": {TotalBytes: 100 * gb, FreeBytes: 80 * gb, TotalInodes: 1000, FreeInodes: 1000},
+		"node2:8080": {TotalBytes: 10 * gb, FreeBytes: 5 * gb},
+		// Free space is within reserve.
+		"node3:8080": {TotalBytes: 10 * gb, FreeBytes: gb / 2},
+		// No inodes left.
+		"node4:8080": {TotalBytes: 10 * gb, FreeBytes: 9 * gb, TotalInodes: 1000, FreeInodes: 1},
+	}
+	for baseURL, capacity := range capacities {
+		resp := sendHeartbeat(t, server, baseURL, node.Status{State: node.StateOK, Capacity: capacity})
+		require.Equal(t, http.StatusOK, resp.StatusCode)
+	}
+
+	t.Run("Select", func(t *testing.T) {
+		stats, err := handler.fittingNodeStats(ctx, 1024, 1)
+		require.NoError(t, err)
+		selected := handler.selectLeastFilledNodes(stats, 2)
+		require.Equal(t, "node1:8080", selected[0].BaseURL)
+		require.Equal(t, "node2:8080", selected[1].BaseURL)
+	})
+	t.Run("Exhausted", func(t *testing.T) {
+		stats, err := handler.fittingNodeStats(ctx, 30*gb, 1)
+		require.NoError(t, err)
+		// Node1 has 70 GB above reserve, so it holds only two chunks.
+		placed := handler.place(stats, 3, 1, 30*gb)
+		require.Len(t, placed[0], 1)
+		require.Equal(t, "node1:8080", placed[0][0].BaseURL)
+		require.Len(t, placed[1], 1)
+		require.Equal(t, "node1:8080", placed[1][0].BaseURL)
+		require.Empty(t, placed[2])
+
+		_, err = handler.nextReplicas(ctx, 3, 30*gb)
+		require.ErrorIs(t, err, ErrInsufficientCapacity)
+	})
+	t.Run("Upload", func(t *testing.T) {
+		resp := uploadFile(t, server, "file.bin", randomBytes(t, 1024))
+		require.Equal(t, http.StatusOK, resp.StatusCode)
+		file, err := stor.File(ctx, "file.bin")
+		require.NoError(t, err)
+		for _, chunk := range file.Chunks {
+			require.Subset(t, []string{"node1:8080", "node2:8080"}, chunk.Nodes)
+		}
+	})
+	t.Run("Insufficient", func(t *testing.T) {
+		// Three distinct nodes are required, but only two have space.
+		resp := uploadFileTo(t, server, "/upload?dataShards=2&parityShards=1", "ec.bin", randomBytes(t, 1024))
+		require.Equal(t, http.StatusInsufficientStorage, resp.StatusCode)
+		body, err := io.ReadAll(resp.Body)
+		require.NoError(t, err)
+		require.Contains(t, string(body), ErrInsufficientCapacity.Error())
+	})
+	t.Run("Admin", func(t *testing.T) {
+		resp, err := server.Client().Get(server.URL + "/admin/nodes")
+		require.NoError(t, err)
+		defer func() { _ = resp.Body.Close() }()
+		var infos []NodeInfo
+		require.NoError(t, json.NewDecoder(resp.Body).Decode(&infos))
+		for _, info := range infos {
+			require.Equal(t, capacities[info.BaseURL], info.Status.Capacity)
+		}
+	})
+}
@@ -0,0 +1,383 @@
+package front
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"slices"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/go-faster/errors"
+	"github.com/go-faster/sdk/zctx"
+	"github.com/google/uuid"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/trace"
+	"go.uber.org/zap"
+
+	"github.com/ernado/stor/internal/node"
+)
+
+// OrphanOptions configures OrphanCollector.
+type OrphanOptions struct {
+	// Interval between background passes. Defaults to 6 hours.
+	Interval time.Duration
+	// GracePeriod is the minimum time since chunk was first found not
+	// recorded in metadata and since it was written to be deleted, so chunks
+	// of uploads, repairs and moves that are not recorded yet are kept.
+	// Defaults to 24 hours.
+	GracePeriod time.Duration
+	// DryRun makes background passes only report orphaned chunks.
+	DryRun bool
+	// PageSize is the number of chunks that are listed from node at once.
+	// Defaults to 1000.
+	PageSize int
+	// ListTimeout limits listing of single page. Defaults to 10 seconds.
+	ListTimeout time.Duration
+}
+
+func (o *OrphanOptions) setDefaults() {
+	if o.Interval <= 0 {
+		o.Interval = 6 * time.Hour
+	}
+	if o.GracePeriod <= 0 {
+		o.GracePeriod = 24 * time.Hour
+	}
+	if o.PageSize <= 0 {
+		o.PageSize = 1000
+	}
+	if o.ListTimeout <= 0 {
+		o.ListTimeout = 10 * time.Second
+	}
+}
+
+// Orphan is the chunk on node that is not recorded in metadata.
+type Orphan struct {
+	Node    string    `json:"node"`
+	ChunkID uuid.UUID `json:"chunkID"`
+	Size    int64     `json:"size"`
+	ModTime time.Time `json:"modTime"`
+	// FirstSeen is the start of pass that first found chunk not recorded.
+	FirstSeen time.Time `json:"firstSeen"`
+}
+
+// orphanKey identifies chunk on node.
+type orphanKey struct {
+	Node    string
+	ChunkID uuid.UUID
+}
+
+// OrphanReport is the result of orphan collection pass.
+type OrphanReport struct {
+	DryRun bool `json:"dryRun"`
+	// Scanned is the number of listed chunks.
+	Scanned int      `json:"scanned"`
+	Orphans []Orphan `json:"orphans"`
+	// Pending is the number of chunks that are not recorded, but are kept
+	// until grace period since they were first found passes.
+	Pending int `json:"pending"`
+	// Bytes is the total size of orphans.
+	Bytes int64 `json:"bytes"`
+	// Deleted is the number of deleted orphans, zero for dry run.
+	Deleted int `json:"deleted"`
+	// Unavailable lists nodes that were not scanned completely.
+	Unavailable []string  `json:"unavailable,omitempty"`
+	StartedAt   time.Time `json:"startedAt"`
+	FinishedAt  time.Time `json:"finishedAt"`
+}
+
+// OrphanCollector deletes chunks that are left on nodes without being
+// recorded in metadata, e.g. when front crashed during upload, or deletion
+// of moved chunk failed.
+//
+// Inventory of every node is compared with replicas recorded in metadata,
+// and chunks that are not recorded for longer than grace period are deleted.
+// Chunk modification time alone is not used, as replica can be copied with
+// its time kept, so time when chunk was first found not recorded is kept
+// between passes too. Chunks are never deleted by the first pass after start,
+// and chunk is deleted only if it was not written again since it was listed.
+type OrphanCollector struct {
+	h           *Handler
+	interval    time.Duration
+	gracePeriod time.Duration
+	dryRun      bool
+	pageSize    int
+	listTimeout time.Duration
+
+	// Passes are not run concurrently.
+	passMux sync.Mutex
+	// seen is the time when chunk was first found not recorded, guarded by
+	// passMux.
+	seen map[orphanKey]time.Time
+	mux  sync.Mutex
+	last *OrphanReport
+
+	tracer  trace.Tracer
+	orphans metric.Int64Counter
+	passes  metric.Int64Counter
+}
+
+// Orphan collection result attribute values.
+const (
+	orphanDeleted = "deleted"
+	orphanFailed  = "failed"
+	orphanFound   = "found"
+	// Chunk was written again since it was listed.
+	orphanWritten = "written"
+)
+
+func NewOrphanCollector(
+	h *Handler,
+	opts OrphanOptions,
+	tracerProvider trace.TracerProvider,
+	meterProvider metric.MeterProvider,
+) (*OrphanCollector, error) {
+	opts.setDefaults()
+	const name = "stor.front"
+	c := &OrphanCollector{
+		h:           h,
+		interval:    opts.Interval,
+		gracePeriod: opts.GracePeriod,
+		dryRun:      opts.DryRun,
+		pageSize:    opts.PageSize,
+		listTimeout: opts.ListTimeout,
+		seen:        make(map[orphanKey]time.Time),
+		tracer:      tracerProvider.Tracer(name),
+	}
+
+	meter := meterProvider.Meter(name)
+	var err error
+	if c.orphans, err = meter.Int64Counter("gc.orphans"); err != nil {
+		return nil, errors.Wrap(err, "gc.orphans")
+	}
+	if c.passes, err = meter.Int64Counter("gc.orphan_passes"); err != nil {
+		return nil, errors.Wrap(err, "gc.orphan_passes")
+	}
+
+	return c, nil
+}
+
+// Run collects orphans every interval until ctx is done.
+func (c *OrphanCollector) Run(ctx context.Context) error {
+	ticker := time.NewTicker(c.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+		report, err := c.Collect(ctx, c.dryRun)
+		if err != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			zctx.From(ctx).Error("Orphan collection failed", zap.Error(err))
+			continue
+		}
+		zctx.From(ctx).Info("Orphan collection finished",
+			zap.Bool("dryRun", report.DryRun),
+			zap.Int("scanned", report.Scanned),
+			zap.Int("orphans", len(report.Orphans)),
+			zap.Int("pending", report.Pending),
+			zap.Int64("bytes", report.Bytes),
+			zap.Int("deleted", report.Deleted),
+		)
+	}
+}
+
+// Collect makes single pass over all nodes. With dryRun, orphans are only
+// reported.
+func (c *OrphanCollector) Collect(ctx context.Context, dryRun bool) (_ *OrphanReport, rerr error) {
+	ctx, span := c.tracer.Start(ctx, "OrphanCollector.Collect",
+		trace.WithAttributes(attribute.Bool("dryRun", dryRun)),
+	)
+	defer func() {
+		if rerr != nil {
+			span.RecordError(rerr)
+		} else {
+			c.passes.Add(ctx, 1)
+		}
+		span.End()
+	}()
+
+	c.passMux.Lock()
+	defer c.passMux.Unlock()
+
+	report := &OrphanReport{
+		DryRun:    dryRun,
+		Orphans:   []Orphan{},
+		StartedAt: c.h.now(),
+	}
+	nodes, err := c.h.storage.Nodes(ctx)
+	if err != nil {
+		return nil, errors.Wrap(err, "nodes")
+	}
+	// Chunks that were first found after deadline can be not recorded yet.
+	var (
+		deadline = report.StartedAt.Add(-c.gracePeriod)
+		seen     = make(map[orphanKey]time.Time)
+	)
+	for _, n := range nodes {
+		if err := c.collectNode(ctx, n.BaseURL, deadline, report, seen); err != nil {
+			if ctx.Err() != nil {
+				return nil, ctx.Err()
+			}
+			zctx.From(ctx).Warn("Failed to collect orphans",
+				zap.String("node", n.BaseURL),
+				zap.Error(err),
+			)
+			report.Unavailable = append(report.Unavailable, n.BaseURL)
+			// Chunks that were not listed are still not recorded.
+			for key, firstSeen := range c.seen {
+				if _, ok := seen[key]; !ok && key.Node == n.BaseURL {
+					seen[key] = firstSeen
+				}
+			}
+		}
+	}
+	// Chunks that are recorded, deleted or are on removed nodes are
+	// forgotten.
+	c.seen = seen
+	report.FinishedAt = c.h.now()
+
+	c.mux.Lock()
+	c.last = report
+	c.mux.Unlock()
+
+	return report, nil
+}
+
+// collectNode lists chunks of node page by page and collects orphans. Chunks
+// that are not recorded and are kept on node are added to seen.
+func (c *OrphanCollector) collectNode(
+	ctx context.Context,
+	baseURL string,
+	deadline time.Time,
+	report *OrphanReport,
+	seen map[orphanKey]time.Time,
+) error {
+	var (
+		client = c.h.GetClient(baseURL)
+		after  uuid.UUID
+	)
+	for {
+		listCtx, cancel := context.WithTimeout(ctx, c.listTimeout)
+		page, err := client.Inventory(listCtx, after, c.pageSize)
+		cancel()
+		if err != nil {
+			return errors.Wrap(err, "inventory")
+		}
+		report.Scanned += len(page)
+
+		ids := make([]uuid.UUID, 0, len(page))
+		for _, chunk := range page {
+			ids = append(ids, chunk.ID)
+		}
+		recorded, err := c.h.storage.RecordedChunks(ctx, baseURL, ids)
+		if err != nil {
+			return errors.Wrap(err, "recorded chunks")
+		}
+		for _, chunk := range page {
+			if slices.Contains(recorded, chunk.ID) {
+				continue
+			}
+			key := orphanKey{Node: baseURL, ChunkID: chunk.ID}
+			firstSeen, ok := c.seen[key]
+			if !ok {
+				firstSeen = report.StartedAt
+			}
+			if firstSeen.After(deadline) || chunk.ModTime.After(deadline) {
+				seen[key] = firstSeen
+				report.Pending++
+				continue
+			}
+			report.Orphans = append(report.Orphans, Orphan{
+				Node:      baseURL,
+				ChunkID:   chunk.ID,
+				Size:      chunk.Size,
+				ModTime:   chunk.ModTime,
+				FirstSeen: firstSeen,
+			})
+			report.Bytes += chunk.Size
+
+			result := orphanFound
+			if !report.DryRun {
+				result = orphanDeleted
+				// Upload of the same content can write chunk again and record it.
+				err := client.DeleteUnmodified(ctx, chunk.ID, chunk.ModTime)
+				switch {
+				case errors.Is(err, node.ErrChunkModified):
+					result = orphanWritten
+				case err != nil:
+					result = orphanFailed
+					zctx.From(ctx).Warn("Failed to delete orphan",
+						zap.String("node", baseURL),
+						zap.String("chunkID", chunk.ID.String()),
+						zap.Error(err),
+					)
+				default:
+					report.Deleted++
+				}
+			}
+			if result == orphanFound || result == orphanFailed {
+				seen[key] = firstSeen
+			}
+			c.orphans.Add(ctx, 1, metric.WithAttributes(
+				attribute.String("result", result),
+			))
+		}
+
+		if len(page) < c.pageSize {
+			return nil
+		}
+		after = page[len(page)-1].ID
+	}
+}
+
+// Last returns report of the last pass, or nil.
+func (c *OrphanCollector) Last() *OrphanReport {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+	return c.last
+}
+
+// ServeHTTP handles admin API of orphan collector: GET returns report of
+// the last pass, POST makes a pass and returns its report. Orphans are
+// only reported if dryRun parameter is set.
+func (c *OrphanCollector) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	ctx, span := c.tracer.Start(req.Context(), "handler.Orphans")
+	defer span.End()
+
+	var report *OrphanReport
+	switch req.Method {
+	case http.MethodGet:
+		if report = c.Last(); report == nil {
+			httpError(w, "no orphan collection was made", http.StatusNotFound)
+			return
+		}
+	case http.MethodPost:
+		var dryRun bool
+		if v := req.URL.Query().Get("dryRun"); v != "" {
+			var err error
+			if dryRun, err = strconv.ParseBool(v); err != nil {
+				httpError(w, errors.Wrap(err, "parse dryRun").Error(), http.StatusBadRequest)
+				return
+			}
+		}
+		zctx.From(ctx).Info("Orphan collection requested", zap.Bool("dryRun", dryRun))
+		var err error
+		if report, err = c.Collect(ctx, dryRun); err != nil {
+			writeError(w, err)
+			return
+		}
+	default:
+		httpError(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(report)
+}
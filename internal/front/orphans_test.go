@@ -0,0 +1,177 @@
+package front
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/require"
+	noopMeter "go.opentelemetry.io/otel/metric/noop"
+	noopTracer "go.opentelemetry.io/otel/trace/noop"
+)
+
+func TestOrphanCollector(t *testing.T) {
+	var (
+		ctx   = context.Background()
+		stor  = newInMemoryStorage()
+		nodes = newInMemoryNodes()
+	)
+	handler, err := NewHandler(ctx, nodes, stor, noopTracer.NewTracerProvider(), noopMeter.NewMeterProvider(), HandlerOptions{
+		ReplicationFactor: 2,
+		Chunking:          ChunkPolicy{Size: 1000},
+	})
+	require.NoError(t, err)
+	collector, err := NewOrphanCollector(handler, OrphanOptions{
+		GracePeriod: time.Hour,
+		PageSize:    2,
+	}, noopTracer.NewTracerProvider(), noopMeter.NewMeterProvider())
+	require.NoError(t, err)
+	handler.Handle("/admin/orphans", collector)
+	server := httptest.NewServer(handler)
+	t.Cleanup(server.Close)
+	registerNodes(t, server, nodes, "node1:8080", "node2:8080", "node3:8080")
+
+	data := randomBytes(t, 5000)
+	require.Equal(t, http.StatusOK, putFile(t, server, "/files/file.bin", data).StatusCode)
+	file, err := stor.File(ctx, "file.bin")
+	require.NoError(t, err)
+
+	// write writes chunk to node as if it was written at modTime.
+	write := func(baseURL string, id uuid.UUID, modTime time.Time) {
+		n := nodes.nodes[baseURL]
+		_, err := n.Write(ctx, id, bytes.NewReader(randomBytes(t, 100)), nil)
+		require.NoError(t, err)
+		n.mux.Lock()
+		n.modTimes[id] = modTime
+		n.mux.Unlock()
+	}
+	has := func(baseURL string, id uuid.UUID) bool {
+		n := nodes.nodes[baseURL]
+		n.mux.Lock()
+		defer n.mux.Unlock()
+		_, ok := n.chunks[id]
+		return ok
+	}
+	var (
+		old    = time.Now().Add(-2 * time.Hour)
+		orphan = uuid.New()
+		recent = uuid.New()
+		// Replica of recorded chunk on node that is not recorded.
+		stale     = file.Chunks[0]
+		staleNode string
+	)
+	for baseURL := range nodes.nodes {
+		if !slices.Contains(stale.Nodes, baseURL) {
+			staleNode = baseURL
+		}
+	}
+	// Modification time is kept by copies, so it is not used.
+	write("node1:8080", orphan, old)
+	write(staleNode, stale.ID, old)
+	now := time.Now()
+	handler.now = func() time.Time { return now }
+	defer func() { handler.now = time.Now }()
+
+	collect := func(t *testing.T, method, query string) (*http.Response, OrphanReport) {
+		t.Helper()
+		req, err := http.NewRequest(method, server.URL+"/admin/orphans"+query, http.NoBody)
+		require.NoError(t, err)
+		resp, err := server.Client().Do(req)
+		require.NoError(t, err)
+		defer func() { _ = resp.Body.Close() }()
+		var report OrphanReport
+		if resp.StatusCode == http.StatusOK {
+			require.NoError(t, json.NewDecoder(resp.Body).Decode(&report))
+		}
+		return resp, report
+	}
+	orphanIDs := func(report OrphanReport) map[uuid.UUID]string {
+		out := make(map[uuid.UUID]string)
+		for _, o := range report.Orphans {
+			out[o.ChunkID] = o.Node
+		}
+		return out
+	}
+
+	resp, _ := collect(t, http.MethodGet, "")
+	require.Equal(t, http.StatusNotFound, resp.StatusCode, "no report yet")
+
+	// Chunks that are first found not recorded are kept.
+	resp, report := collect(t, http.MethodPost, "")
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	require.Empty(t, report.Orphans)
+	require.Equal(t, 2, report.Pending)
+	require.Zero(t, report.Deleted)
+	require.True(t, has("node1:8080", orphan))
+	require.True(t, has(staleNode, stale.ID))
+
+	write("node2:8080", recent, old)
+	firstSeen := now
+	now = now.Add(2 * time.Hour)
+
+	// Dry run only reports orphans.
+	resp, report = collect(t, http.MethodPost, "?dryRun=true")
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	require.True(t, report.DryRun)
+	require.Equal(t, map[uuid.UUID]string{
+		orphan:   "node1:8080",
+		stale.ID: staleNode,
+	}, orphanIDs(report))
+	require.Equal(t, 2*len(file.Chunks)+3, report.Scanned)
+	require.Equal(t, int64(200), report.Bytes)
+	require.Equal(t, 1, report.Pending)
+	require.Zero(t, report.Deleted)
+	for _, o := range report.Orphans {
+		require.True(t, o.FirstSeen.Equal(firstSeen))
+	}
+	require.True(t, has("node1:8080", orphan))
+	require.True(t, has(staleNode, stale.ID))
+
+	resp, last := collect(t, http.MethodGet, "")
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	require.Equal(t, report.Orphans, last.Orphans)
+
+	resp, _ = collect(t, http.MethodPost, "?dryRun=maybe")
+	require.Equal(t, http.StatusBadRequest, resp.StatusCode)
+
+	// Orphans are deleted, recorded and recent chunks are kept.
+	resp, report = collect(t, http.MethodPost, "")
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	require.False(t, report.DryRun)
+	require.Len(t, report.Orphans, 2)
+	require.Equal(t, 2, report.Deleted)
+	require.False(t, has("node1:8080", orphan))
+	require.False(t, has(staleNode, stale.ID))
+	require.True(t, has("node2:8080", recent))
+	resp, downloaded, err := downloadFile(t, server, "file.bin")
+	require.NoError(t, err)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	require.Equal(t, data, downloaded)
+
+	// Unavailable node is reported, and chunks on it are still tracked.
+	recentSeen := now
+	now = now.Add(2 * time.Hour)
+	nodes.nodes["node2:8080"].setDown(true)
+	report2, err := collector.Collect(ctx, true)
+	nodes.nodes["node2:8080"].setDown(false)
+	require.NoError(t, err)
+	require.Equal(t, []string{"node2:8080"}, report2.Unavailable)
+	require.Empty(t, report2.Orphans)
+
+	report2, err = collector.Collect(ctx, false)
+	require.NoError(t, err)
+	require.Equal(t, []Orphan{{
+		Node:      "node2:8080",
+		ChunkID:   recent,
+		Size:      100,
+		ModTime:   old,
+		FirstSeen: recentSeen,
+	}}, report2.Orphans)
+	require.False(t, has("node2:8080", recent))
+}
@@ -0,0 +1,178 @@
+package front
+
+import (
+	"slices"
+)
+
+// Failure domain levels, from the widest to the narrowest.
+const (
+	DomainZone = "zone"
+	DomainRack = "rack"
+	DomainHost = "host"
+)
+
+var domainLevels = [...]string{DomainZone, DomainRack, DomainHost}
+
+// domains returns failure domains of node for every level of domainLevels.
+//
+// Domain includes all wider domains, so racks with the same name in
+// different zones are distinct. Missing label is replaced with node
+// BaseURL, so unlabeled node does not share domain with other nodes.
+func domains(stat NodeStat) [len(domainLevels)]string {
+	var (
+		out    [len(domainLevels)]string
+		prefix string
+	)
+	for i, label := range [...]string{
+		stat.Topology.Zone,
+		stat.Topology.Rack,
+		stat.Topology.Host,
+	} {
+		if label == "" {
+			label = stat.BaseURL
+		}
+		prefix += "/" + label
+		out[i] = prefix
+	}
+	return out
+}
+
+// domain returns failure domain of node at configured level.
+func (h *Handler) domain(stat NodeStat) string {
+	return domains(stat)[h.failureLevel]
+}
+
+// countDomains returns number of distinct failure domains of nodes at
+// configured level.
+func (h *Handler) countDomains(stats []NodeStat) int {
+	seen := make(map[string]struct{}, len(stats))
+	for _, stat := range stats {
+		seen[h.domain(stat)] = struct{}{}
+	}
+	return len(seen)
+}
+
+// placer selects nodes for replicas of chunks one by one.
+//
+// Replicas of every chunk are placed to distinct failure domains of
+// configured level. Chunks are spread across as many zones, racks and
+// hosts as possible, and least filled nodes are preferred among equally
+// spread ones. Space taken by previous chunks is subtracted from free space
+// of nodes, so node is not selected for more chunks than it can hold.
+type placer struct {
+	h     *Handler
+	nodes []NodeStat
+	// Number of replicas of previous chunks in every domain, for every
+	// level.
+	usage []map[string]int
+	// Free bytes and inodes of every node left by previous chunks, see
+	// Handler.freeSpace.
+	bytes, inodes []int64
+}
+
+func newUsage() []map[string]int {
+	usage := make([]map[string]int, len(domainLevels))
+	for i := range usage {
+		usage[i] = make(map[string]int)
+	}
+	return usage
+}
+
+// newPlacer returns placer over nodes.
+func (h *Handler) newPlacer(stats []NodeStat) *placer {
+	p := &placer{
+		h:      h,
+		nodes:  h.selectLeastFilledNodes(slices.Clone(stats), len(stats)),
+		usage:  newUsage(),
+		bytes:  make([]int64, len(stats)),
+		inodes: make([]int64, len(stats)),
+	}
+	for i, node := range p.nodes {
+		p.bytes[i], p.inodes[i] = h.freeSpace(node)
+	}
+	return p
+}
+
+// next selects nodes for replicas of next chunk of given size.
+//
+// Returns fewer nodes if there are not enough failure domains or nodes with
+// free space left, which should be checked by caller.
+func (p *placer) next(replicas int, size int64) []NodeStat {
+	var (
+		level      = p.h.failureLevel
+		chunkUsage = newUsage()
+		out        []NodeStat
+	)
+	for range replicas {
+		var (
+			best      = -1
+			bestScore []int
+		)
+		for j, node := range p.nodes {
+			d := domains(node)
+			if chunkUsage[level][d[level]] > 0 || !spaceFits(p.bytes[j], p.inodes[j], size) {
+				continue
+			}
+			// Spread of replicas is more important than spread of
+			// chunks, which is more important than fill.
+			score := make([]int, 0, 2*len(d)+1)
+			for level, domain := range d {
+				score = append(score, chunkUsage[level][domain])
+			}
+			for level, domain := range d {
+				score = append(score, p.usage[level][domain])
+			}
+			score = append(score, j)
+			if best < 0 || slices.Compare(score, bestScore) < 0 {
+				best, bestScore = j, score
+			}
+		}
+		if best < 0 {
+			break
+		}
+		node := p.nodes[best]
+		if p.bytes[best] >= 0 {
+			p.bytes[best] -= size
+		}
+		if p.inodes[best] >= 0 {
+			p.inodes[best] -= chunkInodes
+		}
+		for level, domain := range domains(node) {
+			chunkUsage[level][domain]++
+			p.usage[level][domain]++
+		}
+		out = append(out, node)
+	}
+	return out
+}
+
+// place selects nodes for replicas of n chunks of given size, see placer.
+func (h *Handler) place(stats []NodeStat, n, replicas int, size int64) [][]NodeStat {
+	p := h.newPlacer(stats)
+	out := make([][]NodeStat, n)
+	for i := range out {
+		out[i] = p.next(replicas, size)
+	}
+	return out
+}
+
+// inDomains reports whether node shares failure domain of configured level
+// with any of nodes, looking up their topology in stats.
+func (h *Handler) inDomains(stat NodeStat, stats []NodeStat, nodes []string) bool {
+	domain := h.domain(stat)
+	return slices.ContainsFunc(stats, func(other NodeStat) bool {
+		return slices.Contains(nodes, other.BaseURL) && h.domain(other) == domain
+	})
+}
+
+// spread returns candidates that don't share failure domain with any of
+// nodes, or all candidates if there are no such.
+func (h *Handler) spread(candidates, stats []NodeStat, nodes []string) []NodeStat {
+	out := slices.DeleteFunc(slices.Clone(candidates), func(stat NodeStat) bool {
+		return h.inDomains(stat, stats, nodes)
+	})
+	if len(out) == 0 {
+		return candidates
+	}
+	return out
+}
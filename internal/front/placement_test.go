@@ -0,0 +1,255 @@
+package front
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"slices"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	noopMeter "go.opentelemetry.io/otel/metric/noop"
+	noopTracer "go.opentelemetry.io/otel/trace/noop"
+
+	"github.com/ernado/stor/internal/node"
+)
+
+// registerTopology registers nodes with topology labels.
+func registerTopology(t *testing.T, server *httptest.Server, nodes *inMemoryNodes, topology map[string]node.Topology) {
+	t.Helper()
+	for baseURL, labels := range topology {
+		nodes.createClient(baseURL)
+		query := url.Values{"baseURL": {baseURL}}
+		for k, v := range map[string]string{
+			node.ZoneParam: labels.Zone,
+			node.RackParam: labels.Rack,
+			node.HostParam: labels.Host,
+		} {
+			query.Set(k, v)
+		}
+		req, err := http.NewRequest(http.MethodPut, server.URL+"/register?"+query.Encode(), http.NoBody)
+		require.NoError(t, err)
+		resp, err := server.Client().Do(req)
+		require.NoError(t, err)
+		_ = resp.Body.Close()
+		require.Equal(t, http.StatusOK, resp.StatusCode)
+	}
+}
+
+// grid returns topology of zones*racks*hosts nodes.
+func grid(zones, racks, hosts int) map[string]node.Topology {
+	out := make(map[string]node.Topology)
+	for z := range zones {
+		for r := range racks {
+			for h := range hosts {
+				baseURL := fmt.Sprintf("node-%d-%d-%d:8080", z, r, h)
+				out[baseURL] = node.Topology{
+					Zone: fmt.Sprintf("zone%d", z),
+					Rack: fmt.Sprintf("rack%d", r),
+					Host: fmt.Sprintf("host%d", h),
+				}
+			}
+		}
+	}
+	return out
+}
+
+func TestHandlerPlacement(t *testing.T) {
+	ctx := context.Background()
+	for _, tt := range []struct {
+		Name     string
+		Options  HandlerOptions
+		Topology map[string]node.Topology
+		Query    string
+		// Level that every chunk replica or stripe shard should be in
+		// distinct domain of.
+		Distinct string
+		// Level that chunks of file should be evenly spread over.
+		Spread string
+		Fail   bool
+	}{
+		{
+			Name:     "Zones",
+			Options:  HandlerOptions{ReplicationFactor: 3, FailureDomain: DomainZone},
+			Topology: grid(3, 2, 1),
+			Distinct: DomainZone,
+			Spread:   DomainRack,
+		},
+		{
+			Name:     "Racks",
+			Options:  HandlerOptions{ReplicationFactor: 2, FailureDomain: DomainRack},
+			Topology: grid(1, 2, 3),
+			Distinct: DomainRack,
+			Spread:   DomainHost,
+		},
+		{
+			Name:     "SingleReplica",
+			Options:  HandlerOptions{},
+			Topology: grid(2, 3, 1),
+			Spread:   DomainHost,
+		},
+		{
+			Name:    "SharedHost",
+			Options: HandlerOptions{ReplicationFactor: 2},
+			Topology: map[string]node.Topology{
+				"node1:8080": {Host: "host1"},
+				"node2:8080": {Host: "host1"},
+				"node3:8080": {Host: "host2"},
+				"node4:8080": {Host: "host2"},
+			},
+			Distinct: DomainHost,
+			Spread:   DomainHost,
+		},
+		{
+			Name:    "Unlabeled",
+			Options: HandlerOptions{ReplicationFactor: 2, FailureDomain: DomainZone},
+			Topology: map[string]node.Topology{
+				"node1:8080": {},
+				"node2:8080": {},
+				"node3:8080": {},
+			},
+			Distinct: DomainZone,
+			Spread:   DomainHost,
+		},
+		{
+			Name:     "Erasure",
+			Options:  HandlerOptions{FailureDomain: DomainRack},
+			Topology: grid(1, 3, 2),
+			Query:    "dataShards=2&parityShards=1",
+			Distinct: DomainRack,
+		},
+		{
+			Name:     "ErasureNotEnoughDomains",
+			Options:  HandlerOptions{FailureDomain: DomainRack},
+			Topology: grid(1, 2, 3),
+			Query:    "dataShards=2&parityShards=1",
+			Fail:     true,
+		},
+		{
+			Name:     "NotEnoughDomains",
+			Options:  HandlerOptions{ReplicationFactor: 2, FailureDomain: DomainZone},
+			Topology: grid(1, 2, 2),
+			Fail:     true,
+		},
+		{
+			Name: "ReducedReplication",
+			Options: HandlerOptions{
+				ReplicationFactor: 3,
+				WriteQuorum:       2,
+				FailureDomain:     DomainZone,
+			},
+			Topology: grid(2, 2, 1),
+			Distinct: DomainZone,
+			Spread:   DomainRack,
+		},
+	} {
+		t.Run(tt.Name, func(t *testing.T) {
+			var (
+				stor  = newInMemoryStorage()
+				nodes = newInMemoryNodes()
+			)
+			handler, err := NewHandler(ctx, nodes, stor, noopTracer.NewTracerProvider(), noopMeter.NewMeterProvider(), tt.Options)
+			require.NoError(t, err)
+			server := httptest.NewServer(handler)
+			t.Cleanup(server.Close)
+			registerTopology(t, server, nodes, tt.Topology)
+
+			resp := uploadFileTo(t, server, "/upload?"+tt.Query, "file.bin", randomBytes(t, 6000))
+			if tt.Fail {
+				require.Equal(t, http.StatusServiceUnavailable, resp.StatusCode)
+				return
+			}
+			require.Equal(t, http.StatusOK, resp.StatusCode)
+
+			file, err := stor.File(ctx, "file.bin")
+			require.NoError(t, err)
+			stats, err := stor.NodeStats(ctx)
+			require.NoError(t, err)
+			domainOf := func(baseURL, level string) string {
+				for _, stat := range stats {
+					if stat.BaseURL == baseURL {
+						return domains(stat)[slices.Index(domainLevels[:], level)]
+					}
+				}
+				t.Fatalf("unknown node %s", baseURL)
+				return ""
+			}
+
+			if tt.Distinct != "" {
+				// Replicas of every chunk, or shards of stripe for
+				// erasure-coded file.
+				groups := make([][]string, len(file.Chunks))
+				for i, chunk := range file.Chunks {
+					groups[i] = chunk.Nodes
+				}
+				if file.Erasure() {
+					groups = [][]string{nil}
+					for _, chunk := range file.Chunks {
+						groups[0] = append(groups[0], chunk.Nodes...)
+					}
+				}
+				for _, group := range groups {
+					seen := make(map[string]bool)
+					for _, baseURL := range group {
+						domain := domainOf(baseURL, tt.Distinct)
+						require.False(t, seen[domain], "%s is used twice in %v", domain, group)
+						seen[domain] = true
+					}
+				}
+			}
+			if tt.Spread != "" {
+				usage := make(map[string]int)
+				for _, stat := range stats {
+					usage[domainOf(stat.BaseURL, tt.Spread)] = 0
+				}
+				for _, chunk := range file.Chunks {
+					for _, baseURL := range chunk.Nodes {
+						usage[domainOf(baseURL, tt.Spread)]++
+					}
+				}
+				var least, most int
+				for _, n := range usage {
+					if least == 0 || n < least {
+						least = n
+					}
+					most = max(most, n)
+				}
+				require.LessOrEqual(t, most-least, 1, "uneven spread: %v", usage)
+			}
+		})
+	}
+}
+
+func TestHandlerTopology(t *testing.T) {
+	var (
+		ctx   = context.Background()
+		stor  = newInMemoryStorage()
+		nodes = newInMemoryNodes()
+	)
+	handler, err := NewHandler(ctx, nodes, stor, noopTracer.NewTracerProvider(), noopMeter.NewMeterProvider(), HandlerOptions{})
+	require.NoError(t, err)
+	server := httptest.NewServer(handler)
+	t.Cleanup(server.Close)
+	topology := node.Topology{Zone: "zone1", Rack: "rack1", Host: "host1"}
+	registerTopology(t, server, nodes, map[string]node.Topology{"node1:8080": topology})
+
+	// Heartbeat does not reset topology.
+	resp := sendHeartbeat(t, server, "node1:8080", node.Status{State: node.StateOK})
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+
+	resp, err = server.Client().Get(server.URL + "/admin/nodes")
+	require.NoError(t, err)
+	defer func() { _ = resp.Body.Close() }()
+	var infos []NodeInfo
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&infos))
+	require.Len(t, infos, 1)
+	require.Equal(t, topology, infos[0].Topology)
+
+	_, err = NewHandler(ctx, nodes, stor, noopTracer.NewTracerProvider(), noopMeter.NewMeterProvider(), HandlerOptions{
+		FailureDomain: "region",
+	})
+	require.Error(t, err)
+}
@@ -0,0 +1,120 @@
+package front
+
+import (
+	"cmp"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/go-faster/errors"
+)
+
+// httpRange specifies the byte range to be sent to the client.
+type httpRange struct {
+	start, length int64
+}
+
+func (r httpRange) contentRange(size int64) string {
+	return fmt.Sprintf("bytes %d-%d/%d", r.start, r.start+r.length-1, size)
+}
+
+var errUnsatisfiableRange = errors.New("range is not satisfiable")
+
+// maxRanges is the maximum number of ranges in Range header, so request
+// can't make response many times larger than file.
+const maxRanges = 100
+
+// parseRange parses a Range header string as per RFC 7233.
+//
+// Supports multiple ranges, suffix ranges ("-N") and open ranges ("N-").
+// Ranges that overlap or are adjacent are merged, so returned ranges are
+// sorted and disjoint. Returns errUnsatisfiableRange if none of ranges
+// overlap the content, which is always the case for empty content.
+func parseRange(s string, size int64) ([]httpRange, error) {
+	const b = "bytes="
+	if !strings.HasPrefix(s, b) {
+		return nil, errors.New("invalid range unit")
+	}
+	specs := strings.Split(s[len(b):], ",")
+	if len(specs) > maxRanges {
+		return nil, errors.Errorf("more than %d ranges", maxRanges)
+	}
+	var ranges []httpRange
+	noOverlap := false
+	for _, ra := range specs {
+		ra = strings.TrimSpace(ra)
+		if ra == "" {
+			continue
+		}
+		startStr, endStr, ok := strings.Cut(ra, "-")
+		if !ok {
+			return nil, errors.New("invalid range")
+		}
+		startStr, endStr = strings.TrimSpace(startStr), strings.TrimSpace(endStr)
+		var r httpRange
+		if startStr == "" {
+			// Suffix range, "-N" means last N bytes.
+			if endStr == "" || endStr[0] == '-' {
+				return nil, errors.New("invalid range")
+			}
+			i, err := strconv.ParseInt(endStr, 10, 64)
+			if i < 0 || err != nil {
+				return nil, errors.New("invalid range")
+			}
+			if i == 0 || size == 0 {
+				noOverlap = true
+				continue
+			}
+			i = min(i, size)
+			r.start = size - i
+			r.length = size - r.start
+		} else {
+			i, err := strconv.ParseInt(startStr, 10, 64)
+			if err != nil || i < 0 {
+				return nil, errors.New("invalid range")
+			}
+			if i >= size {
+				// Range begins after the end of content.
+				noOverlap = true
+				continue
+			}
+			r.start = i
+			if endStr == "" {
+				// Open range, "N-" means everything from N.
+				r.length = size - r.start
+			} else {
+				i, err := strconv.ParseInt(endStr, 10, 64)
+				if err != nil || r.start > i {
+					return nil, errors.New("invalid range")
+				}
+				i = min(i, size-1)
+				r.length = i - r.start + 1
+			}
+		}
+		ranges = append(ranges, r)
+	}
+	if noOverlap && len(ranges) == 0 {
+		return nil, errUnsatisfiableRange
+	}
+	return mergeRanges(ranges), nil
+}
+
+// mergeRanges sorts ranges and merges ones that overlap or are adjacent.
+func mergeRanges(ranges []httpRange) []httpRange {
+	slices.SortFunc(ranges, func(a, b httpRange) int {
+		return cmp.Compare(a.start, b.start)
+	})
+	var merged []httpRange
+	for _, r := range ranges {
+		if n := len(merged); n > 0 {
+			last := &merged[n-1]
+			if end := last.start + last.length; r.start <= end {
+				last.length = max(end, r.start+r.length) - last.start
+				continue
+			}
+		}
+		merged = append(merged, r)
+	}
+	return merged
+}
@@ -0,0 +1,48 @@
+package front
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseRange(t *testing.T) {
+	for _, tt := range []struct {
+		Header string
+		Size   int64
+		Ranges []httpRange
+		Err    bool
+	}{
+		{Header: "bytes=0-0", Size: 10, Ranges: []httpRange{{start: 0, length: 1}}},
+		{Header: "bytes=2-5", Size: 10, Ranges: []httpRange{{start: 2, length: 4}}},
+		{Header: "bytes=2-", Size: 10, Ranges: []httpRange{{start: 2, length: 8}}},
+		{Header: "bytes=-3", Size: 10, Ranges: []httpRange{{start: 7, length: 3}}},
+		{Header: "bytes=-30", Size: 10, Ranges: []httpRange{{start: 0, length: 10}}},
+		{Header: "bytes=5-100", Size: 10, Ranges: []httpRange{{start: 5, length: 5}}},
+		{Header: "bytes=0-1, 4-5", Size: 10, Ranges: []httpRange{{start: 0, length: 2}, {start: 4, length: 2}}},
+		{Header: "bytes=0-1, 20-30", Size: 10, Ranges: []httpRange{{start: 0, length: 2}}},
+		{Header: "bytes=4-5, 0-1", Size: 10, Ranges: []httpRange{{start: 0, length: 2}, {start: 4, length: 2}}},
+		{Header: "bytes=0-4, 2-6, 7-8", Size: 10, Ranges: []httpRange{{start: 0, length: 9}}},
+		{Header: "bytes=0-1, 0-1, -2", Size: 10, Ranges: []httpRange{{start: 0, length: 2}, {start: 8, length: 2}}},
+		{Header: "bytes=10-", Size: 10, Err: true},
+		{Header: "bytes=-1", Size: 0, Err: true},
+		{Header: "bytes=0-", Size: 0, Err: true},
+		{Header: "bytes=0-0" + strings.Repeat(", 0-0", maxRanges), Size: 10, Err: true},
+		{Header: "bytes=-0", Size: 10, Err: true},
+		{Header: "bytes=5-2", Size: 10, Err: true},
+		{Header: "bytes=a-b", Size: 10, Err: true},
+		{Header: "bytes=1", Size: 10, Err: true},
+		{Header: "items=0-1", Size: 10, Err: true},
+	} {
+		t.Run(tt.Header, func(t *testing.T) {
+			ranges, err := parseRange(tt.Header, tt.Size)
+			if tt.Err {
+				require.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, tt.Ranges, ranges)
+		})
+	}
+}
@@ -0,0 +1,119 @@
+package front
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"sync"
+	"time"
+)
+
+// chunkWindow is the part of chunk that is read for download.
+type chunkWindow struct {
+	Chunk  Chunk
+	Offset int64
+	Length int64
+}
+
+// prefetch is chunk window that is read ahead into buffer.
+type prefetch struct {
+	win    chunkWindow
+	buf    bytes.Buffer
+	weight int64
+	err    error
+	// direct is set for window that is larger than read-ahead memory, so it
+	// is not read ahead, but sent as it is read.
+	direct bool
+	// done is closed when window is read or failed.
+	done chan struct{}
+}
+
+// readWindowsAhead reads windows of file chunks to w in order, while the
+// following windows are read from nodes concurrently, at most readAhead at
+// once. The first window is sent as it is read, the rest are buffered within
+// read-ahead memory of handler. Window that does not fit into read-ahead
+// memory is sent as it is read too.
+func (h *Handler) readWindowsAhead(ctx context.Context, file *File, windows []chunkWindow, w io.Writer) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var (
+		// Window that is being sent is received from queue, so at most
+		// readAhead windows are read at once.
+		queue = make(chan *prefetch, h.readAhead-1)
+		wg    sync.WaitGroup
+	)
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		defer close(queue)
+		for _, win := range windows[1:] {
+			p := &prefetch{
+				win:    win,
+				weight: win.Length,
+				direct: win.Length > h.readAheadMemory,
+				done:   make(chan struct{}),
+			}
+			if p.direct {
+				p.weight = 0
+				close(p.done)
+			}
+			select {
+			case queue <- p:
+			case <-ctx.Done():
+				return
+			}
+			if p.direct {
+				continue
+			}
+			if err := h.readAheadBuffers.Acquire(ctx, p.weight); err != nil {
+				p.weight = 0
+				p.err = err
+				close(p.done)
+				return
+			}
+			go func() {
+				defer close(p.done)
+				p.buf.Grow(int(win.Length))
+				p.err = h.readChunk(ctx, file, win.Chunk, win.Offset, win.Length, &p.buf)
+			}()
+		}
+	}()
+	defer func() {
+		// Stop reading ahead and release buffers that were not sent.
+		cancel()
+		wg.Wait()
+		for p := range queue {
+			<-p.done
+			h.readAheadBuffers.Release(p.weight)
+		}
+	}()
+
+	first := windows[0]
+	if err := h.readChunk(ctx, file, first.Chunk, first.Offset, first.Length, w); err != nil {
+		return chunkReadErr(ctx, first.Chunk, err)
+	}
+	for p := range queue {
+		select {
+		case <-p.done:
+		default:
+			start := time.Now()
+			<-p.done
+			h.downloadStall.Record(ctx, time.Since(start).Seconds())
+		}
+		err := p.err
+		switch {
+		case p.direct:
+			err = h.readChunk(ctx, file, p.win.Chunk, p.win.Offset, p.win.Length, w)
+		case err == nil:
+			_, err = p.buf.WriteTo(w)
+		}
+		h.readAheadBuffers.Release(p.weight)
+		if err != nil {
+			return chunkReadErr(ctx, p.win.Chunk, err)
+		}
+	}
+
+	// Success.
+	return nil
+}
@@ -0,0 +1,122 @@
+package front
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/require"
+	noopMeter "go.opentelemetry.io/otel/metric/noop"
+	noopTracer "go.opentelemetry.io/otel/trace/noop"
+)
+
+// slowNodes are in-memory nodes with slow reads that count concurrent reads.
+type slowNodes struct {
+	*inMemoryNodes
+
+	mux      sync.Mutex
+	reads    int
+	maxReads int
+	failed   map[uuid.UUID]bool
+}
+
+func (s *slowNodes) NewClient(baseURL string) NodeClient {
+	return &slowNode{inMemoryNode: s.nodes[baseURL], s: s}
+}
+
+type slowNode struct {
+	*inMemoryNode
+	s *slowNodes
+}
+
+func (n *slowNode) Read(ctx context.Context, chunkID uuid.UUID, w io.Writer) error {
+	n.s.mux.Lock()
+	n.s.reads++
+	n.s.maxReads = max(n.s.maxReads, n.s.reads)
+	failed := n.s.failed[chunkID]
+	n.s.mux.Unlock()
+	defer func() {
+		n.s.mux.Lock()
+		n.s.reads--
+		n.s.mux.Unlock()
+	}()
+
+	time.Sleep(20 * time.Millisecond)
+	if failed {
+		return errors.New("read failed")
+	}
+	return n.inMemoryNode.Read(ctx, chunkID, w)
+}
+
+func TestReadAhead(t *testing.T) {
+	for _, tt := range []struct {
+		Name     string
+		Opts     HandlerOptions
+		MaxReads int
+	}{
+		{"Concurrent", HandlerOptions{ReadAhead: 3}, 3},
+		{"Disabled", HandlerOptions{ReadAhead: 1}, 1},
+		{"MemoryLimit", HandlerOptions{ReadAhead: 4, ReadAheadMemory: 1000}, 2},
+		// Chunks that don't fit into memory are sent as they are read.
+		{"LargerThanMemory", HandlerOptions{ReadAhead: 4, ReadAheadMemory: 400}, 1},
+	} {
+		t.Run(tt.Name, func(t *testing.T) {
+			var (
+				ctx   = context.Background()
+				stor  = newInMemoryStorage()
+				nodes = &slowNodes{inMemoryNodes: newInMemoryNodes()}
+			)
+			tt.Opts.Chunking = ChunkPolicy{Size: 1000}
+			handler, err := NewHandler(ctx, nodes, stor, noopTracer.NewTracerProvider(), noopMeter.NewMeterProvider(), tt.Opts)
+			require.NoError(t, err)
+			server := httptest.NewServer(handler)
+			t.Cleanup(server.Close)
+			registerNodes(t, server, nodes.inMemoryNodes, "node1:8080")
+
+			data := randomBytes(t, 5500)
+			require.Equal(t, http.StatusOK, uploadFile(t, server, "file.bin", data).StatusCode)
+			resp, downloaded, err := downloadFile(t, server, "file.bin")
+			require.NoError(t, err)
+			require.Equal(t, http.StatusOK, resp.StatusCode)
+			require.Equal(t, data, downloaded)
+			require.Equal(t, tt.MaxReads, nodes.maxReads)
+
+			// All buffers are released.
+			require.True(t, handler.readAheadBuffers.TryAcquire(handler.readAheadMemory))
+			handler.readAheadBuffers.Release(handler.readAheadMemory)
+		})
+	}
+	t.Run("Failure", func(t *testing.T) {
+		var (
+			ctx   = context.Background()
+			stor  = newInMemoryStorage()
+			nodes = &slowNodes{inMemoryNodes: newInMemoryNodes(), failed: map[uuid.UUID]bool{}}
+		)
+		handler, err := NewHandler(ctx, nodes, stor, noopTracer.NewTracerProvider(), noopMeter.NewMeterProvider(), HandlerOptions{
+			Chunking:  ChunkPolicy{Size: 1000},
+			ReadAhead: 3,
+		})
+		require.NoError(t, err)
+		server := httptest.NewServer(handler)
+		t.Cleanup(server.Close)
+		registerNodes(t, server, nodes.inMemoryNodes, "node1:8080")
+
+		data := randomBytes(t, 5500)
+		require.Equal(t, http.StatusOK, uploadFile(t, server, "file.bin", data).StatusCode)
+		file, err := stor.File(ctx, "file.bin")
+		require.NoError(t, err)
+		nodes.failed[file.Chunks[2].ID] = true
+
+		_, downloaded, err := downloadFile(t, server, "file.bin")
+		require.Error(t, err)
+		require.Less(t, len(downloaded), len(data))
+		require.True(t, handler.readAheadBuffers.TryAcquire(handler.readAheadMemory))
+		handler.readAheadBuffers.Release(handler.readAheadMemory)
+	})
+}
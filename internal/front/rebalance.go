@@ -0,0 +1,508 @@
+package front
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/go-faster/errors"
+	"github.com/go-faster/sdk/zctx"
+	"github.com/google/uuid"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/trace"
+	"go.uber.org/zap"
+)
+
+// RebalanceOptions configures Rebalancer.
+type RebalanceOptions struct {
+	// Rate limits moved data in bytes per second. Defaults to 10 MiB/s.
+	Rate int64
+	// Threshold is allowed deviation of node size from mean size of all
+	// nodes, as a fraction of mean. Defaults to 0.1.
+	Threshold float64
+	// PageSize is the number of chunks of node that are listed at once.
+	// Defaults to 1000.
+	PageSize int
+}
+
+func (o *RebalanceOptions) setDefaults() {
+	if o.Rate <= 0 {
+		o.Rate = 10 * 1024 * 1024
+	}
+	if o.Threshold <= 0 {
+		o.Threshold = 0.1
+	}
+	if o.PageSize <= 0 {
+		o.PageSize = 1000
+	}
+}
+
+// Rebalance states.
+const (
+	RebalanceIdle    = "idle"
+	RebalanceRunning = "running"
+	RebalanceDone    = "done"
+	RebalanceStopped = "stopped"
+	RebalanceFailed  = "failed"
+)
+
+// RebalanceStatus describes progress of rebalancing.
+type RebalanceStatus struct {
+	State      string `json:"state"`
+	Moved      int    `json:"moved"`
+	MovedBytes int64  `json:"movedBytes"`
+	Failed     int    `json:"failed"`
+	// PendingBytes is the amount of data above mean on over-filled nodes.
+	PendingBytes int64      `json:"pendingBytes"`
+	Error        string     `json:"error,omitempty"`
+	StartedAt    *time.Time `json:"startedAt,omitempty"`
+	FinishedAt   *time.Time `json:"finishedAt,omitempty"`
+}
+
+// Rebalancer moves chunks from over-filled to under-filled nodes, so data
+// is distributed evenly after nodes are added.
+//
+// Chunk is copied first, then its replica is moved in metadata, and source
+// replica is moved to garbage that Collector deletes only after
+// HandlerOptions.MoveDeleteDelay, so downloads never observe missing chunk.
+type Rebalancer struct {
+	h         *Handler
+	rate      int64
+	threshold float64
+	pageSize  int
+
+	mux    sync.Mutex
+	status RebalanceStatus
+	cancel context.CancelFunc
+	done   chan struct{}
+
+	tracer       trace.Tracer
+	chunks       metric.Int64Counter
+	bytes        metric.Int64Counter
+	pendingBytes metric.Int64Gauge
+}
+
+// Rebalance result attribute values.
+const (
+	rebalanceMoved  = "moved"
+	rebalanceFailed = "failed"
+)
+
+func NewRebalancer(
+	h *Handler,
+	opts RebalanceOptions,
+	tracerProvider trace.TracerProvider,
+	meterProvider metric.MeterProvider,
+) (*Rebalancer, error) {
+	opts.setDefaults()
+	const name = "stor.front"
+	r := &Rebalancer{
+		h:         h,
+		rate:      opts.Rate,
+		threshold: opts.Threshold,
+		pageSize:  opts.PageSize,
+		status:    RebalanceStatus{State: RebalanceIdle},
+		tracer:    tracerProvider.Tracer(name),
+	}
+
+	meter := meterProvider.Meter(name)
+	var err error
+	if r.chunks, err = meter.Int64Counter("rebalance.chunks"); err != nil {
+		return nil, errors.Wrap(err, "rebalance.chunks")
+	}
+	if r.bytes, err = meter.Int64Counter("rebalance.bytes"); err != nil {
+		return nil, errors.Wrap(err, "rebalance.bytes")
+	}
+	if r.pendingBytes, err = meter.Int64Gauge("rebalance.pending_bytes"); err != nil {
+		return nil, errors.Wrap(err, "rebalance.pending_bytes")
+	}
+
+	return r, nil
+}
+
+// Status returns current rebalance status.
+func (r *Rebalancer) Status() RebalanceStatus {
+	r.mux.Lock()
+	defer r.mux.Unlock()
+	return r.status
+}
+
+func (r *Rebalancer) update(f func(s *RebalanceStatus)) {
+	r.mux.Lock()
+	defer r.mux.Unlock()
+	f(&r.status)
+}
+
+// Start starts rebalancing in background, returning false if it is already
+// running.
+func (r *Rebalancer) Start() bool {
+	r.mux.Lock()
+	defer r.mux.Unlock()
+	if r.cancel != nil {
+		return false
+	}
+	// Use baseCtx as rebalance outlives request.
+	ctx, cancel := context.WithCancel(r.h.baseCtx)
+	done := make(chan struct{})
+	started := r.h.now()
+	r.cancel, r.done = cancel, done
+	r.status = RebalanceStatus{
+		State:     RebalanceRunning,
+		StartedAt: &started,
+	}
+
+	go func() {
+		defer close(done)
+		err := r.Rebalance(ctx)
+
+		r.mux.Lock()
+		defer r.mux.Unlock()
+		finished := r.h.now()
+		r.status.FinishedAt = &finished
+		switch {
+		case err == nil:
+			r.status.State = RebalanceDone
+		case ctx.Err() != nil:
+			r.status.State = RebalanceStopped
+		default:
+			r.status.State = RebalanceFailed
+			r.status.Error = err.Error()
+			zctx.From(ctx).Error("Rebalance failed", zap.Error(err))
+		}
+		r.cancel, r.done = nil, nil
+		cancel()
+	}()
+
+	return true
+}
+
+// Stop stops rebalancing and waits until it is stopped, returning false if
+// it is not running.
+func (r *Rebalancer) Stop() bool {
+	r.mux.Lock()
+	cancel, done := r.cancel, r.done
+	r.mux.Unlock()
+	if cancel == nil {
+		return false
+	}
+	cancel()
+	<-done
+	return true
+}
+
+// nodeChunks is the page of chunks of node that are considered for moving.
+type nodeChunks struct {
+	chunks []Chunk
+	after  uuid.UUID
+	done   bool
+}
+
+// Rebalance moves chunks from most filled node to least filled one until
+// size of every node is within threshold from mean.
+//
+// Chunks of every node are listed page by page, the largest chunk that can
+// be moved is picked from the current page of node.
+func (r *Rebalancer) Rebalance(ctx context.Context) (rerr error) {
+	ctx, span := r.tracer.Start(ctx, "Rebalancer.Rebalance")
+	defer func() {
+		if rerr != nil {
+			span.RecordError(rerr)
+		}
+		span.End()
+	}()
+
+	stats, err := r.h.liveNodeStats(ctx)
+	if err != nil {
+		return errors.Wrap(err, "node stats")
+	}
+	if len(stats) < 2 {
+		return nil
+	}
+	// Only live nodes are considered.
+	chunks := make(map[string]*nodeChunks, len(stats))
+	for _, stat := range stats {
+		chunks[stat.BaseURL] = &nodeChunks{}
+	}
+
+	var total int64
+	for _, stat := range stats {
+		total += stat.TotalSize
+	}
+	var (
+		mean      = total / int64(len(stats))
+		tolerance = int64(float64(mean) * r.threshold)
+		limiter   = newRateLimiter(r.rate)
+		lg        = zctx.From(ctx)
+	)
+	lg.Info("Rebalance started", zap.Int64("meanSize", mean))
+	for {
+		slices.SortFunc(stats, func(a, b NodeStat) int {
+			return int(a.TotalSize - b.TotalSize)
+		})
+		var pending int64
+		for _, stat := range stats {
+			pending += max(stat.TotalSize-mean, 0)
+		}
+		r.pendingBytes.Record(ctx, pending)
+		r.update(func(s *RebalanceStatus) { s.PendingBytes = pending })
+
+		src, dst := &stats[len(stats)-1], &stats[0]
+		if src.TotalSize-mean <= tolerance && mean-dst.TotalSize <= tolerance {
+			break
+		}
+		chunk, ok, err := r.next(ctx, chunks[src.BaseURL], *src, *dst, stats)
+		if err != nil {
+			return errors.Wrap(err, "next chunk")
+		}
+		if !ok {
+			lg.Info("No chunks to move",
+				zap.String("from", src.BaseURL),
+				zap.String("to", dst.BaseURL),
+			)
+			break
+		}
+
+		result := rebalanceMoved
+		if err := r.move(ctx, chunk, src.BaseURL, dst.BaseURL, limiter); err != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			result = rebalanceFailed
+			lg.Error("Failed to move chunk",
+				zap.String("chunkID", chunk.ID.String()),
+				zap.String("from", src.BaseURL),
+				zap.String("to", dst.BaseURL),
+				zap.Error(err),
+			)
+			r.update(func(s *RebalanceStatus) { s.Failed++ })
+		} else {
+			src.TotalSize -= chunk.Size
+			src.TotalChunks--
+			dst.TotalSize += chunk.Size
+			dst.TotalChunks++
+			r.bytes.Add(ctx, chunk.Size)
+			r.update(func(s *RebalanceStatus) {
+				s.Moved++
+				s.MovedBytes += chunk.Size
+			})
+		}
+		r.chunks.Add(ctx, 1, metric.WithAttributes(
+			attribute.String("result", result),
+		))
+	}
+
+	status := r.Status()
+	lg.Info("Rebalance finished",
+		zap.Int("moved", status.Moved),
+		zap.Int64("movedBytes", status.MovedBytes),
+		zap.Int("failed", status.Failed),
+	)
+	return nil
+}
+
+// next returns chunk to move from node src to node dst, listing next pages
+// of chunks of src until one is found. Chunk is not considered again, even
+// if move fails.
+func (r *Rebalancer) next(ctx context.Context, c *nodeChunks, src, dst NodeStat, stats []NodeStat) (Chunk, bool, error) {
+	for {
+		for {
+			i := r.pick(c.chunks, src, dst, stats)
+			if i < 0 {
+				break
+			}
+			chunk := c.chunks[i]
+			c.chunks = slices.Delete(c.chunks, i, i+1)
+			ok, err := r.stripeAllows(ctx, chunk, src, dst, stats)
+			if err != nil {
+				return Chunk{}, false, errors.Wrapf(err, "check stripe of chunk %s", chunk.ID)
+			}
+			if ok {
+				return chunk, true, nil
+			}
+		}
+		if c.done {
+			return Chunk{}, false, nil
+		}
+		// Chunks that are left on current page can't be moved to dst.
+		page, err := r.h.storage.NodeReplicas(ctx, src.BaseURL, c.after, r.pageSize)
+		if err != nil {
+			return Chunk{}, false, errors.Wrap(err, "node replicas")
+		}
+		c.chunks = page
+		c.done = len(page) < r.pageSize
+		if len(page) > 0 {
+			c.after = page[len(page)-1].ID
+		}
+	}
+}
+
+// pick returns index of the largest chunk that can be moved from node src
+// to node dst and decreases difference between nodes, or -1.
+func (r *Rebalancer) pick(chunks []Chunk, src, dst NodeStat, stats []NodeStat) int {
+	var (
+		best = -1
+		diff = src.TotalSize - dst.TotalSize
+	)
+	for i, chunk := range chunks {
+		// Moving chunk that is not smaller than difference only swaps
+		// nodes.
+		if chunk.Size >= diff || (best >= 0 && chunk.Size <= chunks[best].Size) {
+			continue
+		}
+		if slices.Contains(chunk.Nodes, dst.BaseURL) || !r.h.fits(dst, chunk.Size) {
+			continue
+		}
+		// Move should not put copies into the same failure domain.
+		others := slices.DeleteFunc(slices.Clone(chunk.Nodes), func(n string) bool { return n == src.BaseURL })
+		if r.h.inDomains(dst, stats, others) {
+			continue
+		}
+		best = i
+	}
+	return best
+}
+
+// stripeAllows reports whether shard of erasure-coded file can be moved
+// from node src to node dst, so single node or failure domain failure still
+// costs at most one shard of stripe. Chunks of replicated files are always
+// allowed.
+func (r *Rebalancer) stripeAllows(ctx context.Context, chunk Chunk, src, dst NodeStat, stats []NodeStat) (bool, error) {
+	file, err := r.h.storage.ChunkFile(ctx, chunk.ID)
+	var (
+		fileNotFound   *FileNotFoundErr
+		chunksNotFound *ChunksNotFound
+	)
+	if errors.As(err, &fileNotFound) || errors.As(err, &chunksNotFound) {
+		// Chunk of multipart upload, or removed concurrently.
+		return true, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	i := slices.IndexFunc(file.Chunks, func(c Chunk) bool { return c.ID == chunk.ID })
+	if !file.Erasure() || i < 0 {
+		return true, nil
+	}
+	var others []string
+	for _, shard := range file.stripe(file.Chunks[i]) {
+		if slices.Contains(shard.Nodes, dst.BaseURL) {
+			return false, nil
+		}
+		others = append(others, shard.Nodes...)
+	}
+	others = slices.DeleteFunc(others, func(n string) bool { return n == src.BaseURL })
+	return !r.h.inDomains(dst, stats, others), nil
+}
+
+// move moves chunk from node to another node at limited rate. Source replica
+// is deleted by Collector after move delete delay.
+func (r *Rebalancer) move(ctx context.Context, chunk Chunk, from, to string, limiter *rateLimiter) error {
+	ctx, span := r.tracer.Start(ctx, "Rebalancer.Move",
+		trace.WithAttributes(
+			attribute.String("chunkID", chunk.ID.String()),
+			attribute.String("from", from),
+			attribute.String("to", to),
+		),
+	)
+	defer span.End()
+
+	source := r.h.preferReplica(ctx, chunk, from)
+	if err := r.h.moveReplica(ctx, chunk, from, to, func(w io.Writer) error {
+		return source(&limitedWriter{ctx: ctx, w: w, limiter: limiter})
+	}); err != nil {
+		span.RecordError(err)
+		return err
+	}
+	return nil
+}
+
+// ServeHTTP handles admin API of rebalancer: GET returns status, POST
+// starts rebalancing and DELETE stops it.
+func (r *Rebalancer) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	ctx, span := r.tracer.Start(req.Context(), "handler.Rebalance")
+	defer span.End()
+
+	switch req.Method {
+	case http.MethodGet:
+	case http.MethodPost:
+		if !r.Start() {
+			httpError(w, "rebalance is already running", http.StatusConflict)
+			return
+		}
+		zctx.From(ctx).Info("Rebalance requested")
+	case http.MethodDelete:
+		if !r.Stop() {
+			httpError(w, "rebalance is not running", http.StatusConflict)
+			return
+		}
+		zctx.From(ctx).Info("Rebalance stopped")
+	default:
+		httpError(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if req.Method == http.MethodPost {
+		w.WriteHeader(http.StatusAccepted)
+	}
+	_ = json.NewEncoder(w).Encode(r.Status())
+}
+
+// rateLimiter limits rate of written bytes to rate bytes per second.
+type rateLimiter struct {
+	rate  int64
+	start time.Time
+	n     int64
+}
+
+func newRateLimiter(rate int64) *rateLimiter {
+	return &rateLimiter{
+		rate:  rate,
+		start: time.Now(),
+	}
+}
+
+// wait records n written bytes and sleeps until they fit into rate.
+func (l *rateLimiter) wait(ctx context.Context, n int) error {
+	l.n += int64(n)
+	expected := time.Duration(float64(l.n) / float64(l.rate) * float64(time.Second))
+	if wait := expected - time.Since(l.start); wait > 0 {
+		timer := time.NewTimer(wait)
+		defer timer.Stop()
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-timer.C:
+		}
+	}
+	return nil
+}
+
+// limitedWriter limits write rate to w.
+type limitedWriter struct {
+	ctx     context.Context
+	w       io.Writer
+	limiter *rateLimiter
+}
+
+func (l *limitedWriter) Write(p []byte) (int, error) {
+	var written int
+	for len(p) > 0 {
+		// Prevent bursts longer than a second.
+		n, err := l.w.Write(p[:min(int64(len(p)), l.limiter.rate)])
+		written += n
+		if err != nil {
+			return written, err
+		}
+		if err := l.limiter.wait(l.ctx, n); err != nil {
+			return written, err
+		}
+		p = p[n:]
+	}
+	return written, nil
+}
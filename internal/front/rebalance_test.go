@@ -0,0 +1,173 @@
+package front
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	noopMeter "go.opentelemetry.io/otel/metric/noop"
+	noopTracer "go.opentelemetry.io/otel/trace/noop"
+)
+
+func newTestRebalancer(t *testing.T, opts RebalanceOptions) (*Rebalancer, *httptest.Server, *inMemoryStorage, *inMemoryNodes) {
+	t.Helper()
+	var (
+		ctx   = context.Background()
+		stor  = newInMemoryStorage()
+		nodes = newInMemoryNodes()
+	)
+	handler, err := NewHandler(ctx, nodes, stor, noopTracer.NewTracerProvider(), noopMeter.NewMeterProvider(), HandlerOptions{
+		Chunking:        ChunkPolicy{Size: 1000},
+		MoveDeleteDelay: time.Millisecond,
+	})
+	require.NoError(t, err)
+	rebalancer, err := NewRebalancer(handler, opts, noopTracer.NewTracerProvider(), noopMeter.NewMeterProvider())
+	require.NoError(t, err)
+	// Moved chunks are deleted from source nodes by collector.
+	collector, err := NewCollector(handler, CollectorOptions{Interval: 10 * time.Millisecond, GracePeriod: time.Nanosecond}, noopTracer.NewTracerProvider(), noopMeter.NewMeterProvider())
+	require.NoError(t, err)
+	collectCtx, cancel := context.WithCancel(ctx)
+	t.Cleanup(cancel)
+	go func() { _ = collector.Run(collectCtx) }()
+	handler.Handle("/admin/rebalance", rebalancer)
+	server := httptest.NewServer(handler)
+	t.Cleanup(server.Close)
+	return rebalancer, server, stor, nodes
+}
+
+// requireStored checks that every node stores exactly chunks that are
+// referenced in metadata.
+func requireStored(t *testing.T, stor *inMemoryStorage, nodes *inMemoryNodes) {
+	t.Helper()
+	stats, err := stor.NodeStats(context.Background())
+	require.NoError(t, err)
+	require.Eventually(t, func() bool {
+		for _, stat := range stats {
+			node := nodes.nodes[stat.BaseURL]
+			node.mux.Lock()
+			n := len(node.chunks)
+			node.mux.Unlock()
+			if n != stat.TotalChunks {
+				return false
+			}
+		}
+		return true
+	}, 5*time.Second, 10*time.Millisecond)
+}
+
+func rebalanceStatus(t *testing.T, server *httptest.Server, method string) (int, RebalanceStatus) {
+	t.Helper()
+	req, err := http.NewRequest(method, server.URL+"/admin/rebalance", http.NoBody)
+	require.NoError(t, err)
+	resp, err := server.Client().Do(req)
+	require.NoError(t, err)
+	defer func() { _ = resp.Body.Close() }()
+	var status RebalanceStatus
+	if resp.StatusCode < 300 {
+		require.NoError(t, json.NewDecoder(resp.Body).Decode(&status))
+	}
+	return resp.StatusCode, status
+}
+
+func TestRebalancer(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("Replicated", func(t *testing.T) {
+		rebalancer, server, stor, nodes := newTestRebalancer(t, RebalanceOptions{
+			Rate:     1 << 30,
+			PageSize: 2,
+		})
+		registerNodes(t, server, nodes, "node1:8080", "node2:8080")
+		data := make(map[string][]byte)
+		for i := range 4 {
+			name := fmt.Sprintf("file%d.bin", i)
+			data[name] = randomBytes(t, 6000)
+			require.Equal(t, http.StatusOK, uploadFile(t, server, name, data[name]).StatusCode)
+		}
+		registerNodes(t, server, nodes, "node3:8080", "node4:8080")
+
+		require.NoError(t, rebalancer.Rebalance(ctx))
+		status := rebalancer.Status()
+		require.Equal(t, 12, status.Moved)
+		require.Equal(t, int64(12000), status.MovedBytes)
+		require.Zero(t, status.PendingBytes)
+
+		stats, err := stor.NodeStats(ctx)
+		require.NoError(t, err)
+		for _, stat := range stats {
+			require.Equal(t, int64(6000), stat.TotalSize, stat.BaseURL)
+		}
+		requireStored(t, stor, nodes)
+		for name, expected := range data {
+			resp, body, err := downloadFile(t, server, name)
+			require.NoError(t, err)
+			require.Equal(t, http.StatusOK, resp.StatusCode)
+			require.Equal(t, expected, body)
+		}
+
+		// Balanced cluster is not changed.
+		require.NoError(t, rebalancer.Rebalance(ctx))
+		require.Equal(t, 12, rebalancer.Status().Moved)
+	})
+	t.Run("Erasure", func(t *testing.T) {
+		rebalancer, server, stor, nodes := newTestRebalancer(t, RebalanceOptions{
+			Rate:     1 << 30,
+			PageSize: 2,
+		})
+		registerNodes(t, server, nodes, "node1:8080", "node2:8080", "node3:8080")
+		for i := range 4 {
+			resp := uploadFileTo(t, server, "/upload?dataShards=2&parityShards=1", fmt.Sprintf("ec%d.bin", i), randomBytes(t, 2000))
+			require.Equal(t, http.StatusOK, resp.StatusCode)
+		}
+		registerNodes(t, server, nodes, "node4:8080", "node5:8080", "node6:8080")
+
+		require.NoError(t, rebalancer.Rebalance(ctx))
+		require.Positive(t, rebalancer.Status().Moved)
+		for i := range 4 {
+			file, err := stor.File(ctx, fmt.Sprintf("ec%d.bin", i))
+			require.NoError(t, err)
+			for _, chunk := range file.Chunks {
+				require.Len(t, chunk.Nodes, 1)
+				seen := make(map[string]bool)
+				for _, shard := range file.stripe(chunk) {
+					require.False(t, seen[shard.Nodes[0]], "shards of stripe should be on distinct nodes")
+					seen[shard.Nodes[0]] = true
+				}
+			}
+		}
+		requireStored(t, stor, nodes)
+	})
+	t.Run("API", func(t *testing.T) {
+		_, server, _, nodes := newTestRebalancer(t, RebalanceOptions{
+			Rate: 1,
+		})
+		registerNodes(t, server, nodes, "node1:8080")
+		require.Equal(t, http.StatusOK, uploadFile(t, server, "file.bin", randomBytes(t, 6000)).StatusCode)
+		registerNodes(t, server, nodes, "node2:8080")
+
+		code, status := rebalanceStatus(t, server, http.MethodGet)
+		require.Equal(t, http.StatusOK, code)
+		require.Equal(t, RebalanceIdle, status.State)
+		code, _ = rebalanceStatus(t, server, http.MethodDelete)
+		require.Equal(t, http.StatusConflict, code)
+
+		code, status = rebalanceStatus(t, server, http.MethodPost)
+		require.Equal(t, http.StatusAccepted, code)
+		require.Equal(t, RebalanceRunning, status.State)
+		code, _ = rebalanceStatus(t, server, http.MethodPost)
+		require.Equal(t, http.StatusConflict, code)
+
+		// Move is stuck on rate limit.
+		code, _ = rebalanceStatus(t, server, http.MethodDelete)
+		require.Equal(t, http.StatusOK, code)
+		code, status = rebalanceStatus(t, server, http.MethodGet)
+		require.Equal(t, http.StatusOK, code)
+		require.Equal(t, RebalanceStopped, status.State)
+		require.NotNil(t, status.FinishedAt)
+	})
+}
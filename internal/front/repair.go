@@ -0,0 +1,548 @@
+package front
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/go-faster/errors"
+	"github.com/go-faster/sdk/zctx"
+	"github.com/google/uuid"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/trace"
+	"go.uber.org/zap"
+	"golang.org/x/sync/errgroup"
+
+	"github.com/ernado/stor/internal/node"
+)
+
+// RepairOptions configures Repairer.
+type RepairOptions struct {
+	// Interval between repair passes. Defaults to 1 minute.
+	Interval time.Duration
+	// Rate is the maximum number of chunk repairs per second. Defaults to 10.
+	Rate int
+	// PageSize is the number of chunks that are listed from node, and of
+	// replicas that are listed from metadata at once. Defaults to 1000.
+	PageSize int
+	// ListTimeout limits listing of single page of node inventory.
+	// Defaults to 10 seconds.
+	ListTimeout time.Duration
+}
+
+func (o *RepairOptions) setDefaults() {
+	if o.Interval <= 0 {
+		o.Interval = time.Minute
+	}
+	if o.Rate <= 0 {
+		o.Rate = 10
+	}
+	if o.PageSize <= 0 {
+		o.PageSize = 1000
+	}
+	if o.ListTimeout <= 0 {
+		o.ListTimeout = 10 * time.Second
+	}
+}
+
+// Repairer periodically compares chunks metadata with inventories of
+// healthy nodes and re-creates chunks that have fewer healthy copies than
+// desired.
+//
+// Replicated chunks are copied from healthy replicas, chunks of
+// erasure-coded files are reconstructed if no healthy copy is left.
+//
+// Inventory of every node is listed page by page along with replicas that
+// are recorded on node, so replicas that are missing are removed from
+// metadata. Then all replicas are listed page by page, and files are loaded
+// only for chunks that have fewer healthy replicas than replication factor.
+type Repairer struct {
+	h           *Handler
+	interval    time.Duration
+	rate        int
+	pageSize    int
+	listTimeout time.Duration
+
+	tracer        trace.Tracer
+	repairs       metric.Int64Counter
+	passes        metric.Int64Counter
+	degraded      metric.Int64Gauge
+	staleReplicas metric.Int64Counter
+}
+
+// Repair result attribute values.
+const (
+	repairRepaired = "repaired"
+	repairFailed   = "failed"
+	repairLost     = "lost"
+)
+
+var errChunkLost = errors.New("no healthy copies left")
+
+func NewRepairer(
+	h *Handler,
+	opts RepairOptions,
+	tracerProvider trace.TracerProvider,
+	meterProvider metric.MeterProvider,
+) (*Repairer, error) {
+	opts.setDefaults()
+	const name = "stor.front"
+	r := &Repairer{
+		h:           h,
+		interval:    opts.Interval,
+		rate:        opts.Rate,
+		pageSize:    opts.PageSize,
+		listTimeout: opts.ListTimeout,
+		tracer:      tracerProvider.Tracer(name),
+	}
+
+	meter := meterProvider.Meter(name)
+	var err error
+	if r.repairs, err = meter.Int64Counter("repair.chunks"); err != nil {
+		return nil, errors.Wrap(err, "repair.chunks")
+	}
+	if r.passes, err = meter.Int64Counter("repair.passes"); err != nil {
+		return nil, errors.Wrap(err, "repair.passes")
+	}
+	if r.degraded, err = meter.Int64Gauge("repair.degraded"); err != nil {
+		return nil, errors.Wrap(err, "repair.degraded")
+	}
+	if r.staleReplicas, err = meter.Int64Counter("repair.stale_replicas"); err != nil {
+		return nil, errors.Wrap(err, "repair.stale_replicas")
+	}
+
+	return r, nil
+}
+
+// Run repairs chunks every interval until ctx is done.
+func (r *Repairer) Run(ctx context.Context) error {
+	ticker := time.NewTicker(r.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+		if err := r.Repair(ctx); err != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			zctx.From(ctx).Error("Repair failed", zap.Error(err))
+		}
+	}
+}
+
+// Repair makes single repair pass over all chunks.
+func (r *Repairer) Repair(ctx context.Context) (rerr error) {
+	ctx, span := r.tracer.Start(ctx, "Repairer.Repair")
+	defer func() {
+		if rerr != nil {
+			span.RecordError(rerr)
+		} else {
+			r.passes.Add(ctx, 1)
+		}
+		span.End()
+	}()
+
+	healthy, lost, err := r.checkNodes(ctx)
+	if err != nil {
+		return errors.Wrap(err, "check nodes")
+	}
+	stats, err := r.h.liveNodeStats(ctx)
+	if err != nil {
+		return errors.Wrap(err, "node stats")
+	}
+	// Only healthy nodes can be repair targets.
+	stats = slices.DeleteFunc(stats, func(stat NodeStat) bool {
+		_, ok := healthy[stat.BaseURL]
+		return !ok
+	})
+
+	limiter := time.NewTicker(time.Second / time.Duration(r.rate))
+	defer limiter.Stop()
+
+	var (
+		after    Replica
+		degraded int
+		// Chunks of erasure-coded files that were loaded in this pass, so
+		// file is not loaded again for every shard that has single replica.
+		shards = make(map[uuid.UUID]struct{})
+	)
+	for {
+		replicas, err := r.h.storage.Replicas(ctx, after, r.pageSize)
+		if err != nil {
+			return errors.Wrap(err, "replicas")
+		}
+		chunks := groupReplicas(replicas)
+		full := len(replicas) == r.pageSize
+		if full && len(chunks) > 1 {
+			// Replicas of the last chunk can continue on the next page.
+			chunks = chunks[:len(chunks)-1]
+		}
+		for _, chunk := range chunks {
+			var nodes []string
+			for _, baseURL := range chunk.Nodes {
+				replica := Replica{ChunkID: chunk.ID, Node: baseURL}
+				if _, ok := healthy[baseURL]; ok && !slices.Contains(lost, replica) {
+					nodes = append(nodes, baseURL)
+				}
+			}
+			if len(nodes) >= r.h.replicationFactor {
+				continue
+			}
+			if _, ok := shards[chunk.ID]; ok && len(nodes) > 0 {
+				delete(shards, chunk.ID)
+				continue
+			}
+			file, err := r.h.storage.ChunkFile(ctx, chunk.ID)
+			var (
+				fileNotFound   *FileNotFoundErr
+				chunksNotFound *ChunksNotFound
+			)
+			if errors.As(err, &fileNotFound) || errors.As(err, &chunksNotFound) {
+				// Chunk of multipart upload, or removed concurrently.
+				continue
+			}
+			if err != nil {
+				return errors.Wrapf(err, "file of chunk %s", chunk.ID)
+			}
+			if file.Erasure() {
+				for _, c := range file.Chunks {
+					shards[c.ID] = struct{}{}
+				}
+				delete(shards, chunk.ID)
+			}
+
+			i := slices.IndexFunc(file.Chunks, func(c Chunk) bool { return c.ID == chunk.ID })
+			if i < 0 {
+				continue
+			}
+			c := &file.Chunks[i]
+			// Lost replicas are not healthy, and are removed once chunk is
+			// repaired.
+			var stale []string
+			c.Nodes = slices.DeleteFunc(c.Nodes, func(baseURL string) bool {
+				if slices.Contains(lost, Replica{ChunkID: c.ID, Node: baseURL}) {
+					stale = append(stale, baseURL)
+					return true
+				}
+				return false
+			})
+			healthyNodes := slices.DeleteFunc(slices.Clone(c.Nodes), func(baseURL string) bool {
+				_, ok := healthy[baseURL]
+				return !ok
+			})
+			missing := r.desired(file) - len(healthyNodes)
+			if missing <= 0 {
+				continue
+			}
+			degraded++
+
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case <-limiter.C:
+			}
+			result := repairRepaired
+			if err := r.repairChunk(ctx, file, c, healthyNodes, missing, stats); err != nil {
+				if ctx.Err() != nil {
+					return ctx.Err()
+				}
+				result = repairFailed
+				if errors.Is(err, errChunkLost) {
+					result = repairLost
+				}
+				zctx.From(ctx).Error("Failed to repair chunk",
+					zap.String("fileName", file.Name),
+					zap.String("chunkID", c.ID.String()),
+					zap.String("result", result),
+					zap.Error(err),
+				)
+			} else {
+				for _, baseURL := range stale {
+					if !slices.Contains(c.Nodes, baseURL) {
+						r.removeStale(ctx, c.ID, baseURL)
+					}
+				}
+			}
+			r.repairs.Add(ctx, 1, metric.WithAttributes(
+				attribute.String("result", result),
+			))
+		}
+		if !full {
+			break
+		}
+		last := chunks[len(chunks)-1]
+		after = Replica{ChunkID: last.ID, Node: last.Nodes[len(last.Nodes)-1]}
+	}
+	r.degraded.Record(ctx, int64(degraded))
+
+	return nil
+}
+
+// groupReplicas returns chunks with nodes of replicas that are ordered by
+// chunk ID.
+func groupReplicas(replicas []Replica) []Chunk {
+	var chunks []Chunk
+	for _, replica := range replicas {
+		if n := len(chunks); n == 0 || chunks[n-1].ID != replica.ChunkID {
+			chunks = append(chunks, Chunk{ID: replica.ChunkID})
+		}
+		last := &chunks[len(chunks)-1]
+		last.Nodes = append(last.Nodes, replica.Node)
+	}
+	return chunks
+}
+
+// desired returns desired number of healthy copies of every file chunk.
+func (r *Repairer) desired(file *File) int {
+	if file.Erasure() {
+		// Redundancy is provided by parity shards.
+		return 1
+	}
+	return r.h.replicationFactor
+}
+
+// checkNodes removes replicas that are missing on nodes from metadata, and
+// returns set of healthy nodes. Node is considered healthy if its whole
+// inventory can be listed.
+//
+// Replicas that are kept in metadata, e.g. the last replica of chunk, so
+// chunk is still found by repair, are returned as lost.
+func (r *Repairer) checkNodes(ctx context.Context) (map[string]struct{}, []Replica, error) {
+	nodes, err := r.h.storage.Nodes(ctx)
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "nodes")
+	}
+
+	var (
+		mux     sync.Mutex
+		healthy = make(map[string]struct{}, len(nodes))
+		lost    []Replica
+		g       errgroup.Group
+	)
+	for _, n := range nodes {
+		g.Go(func() error {
+			kept, err := r.checkNode(ctx, n.BaseURL)
+			if err != nil {
+				zctx.From(ctx).Warn("Node is unhealthy",
+					zap.String("node", n.BaseURL),
+					zap.Error(err),
+				)
+				return nil
+			}
+			mux.Lock()
+			healthy[n.BaseURL] = struct{}{}
+			lost = append(lost, kept...)
+			mux.Unlock()
+			return nil
+		})
+	}
+	_ = g.Wait()
+	if err := ctx.Err(); err != nil {
+		return nil, nil, err
+	}
+
+	return healthy, lost, nil
+}
+
+// checkNode lists inventory of node page by page and removes replicas that
+// are recorded on node but are missing there, returning ones that are kept.
+func (r *Repairer) checkNode(ctx context.Context, baseURL string) ([]Replica, error) {
+	var (
+		client = r.h.GetClient(baseURL)
+		after  uuid.UUID
+		kept   []Replica
+	)
+	for {
+		page, err := r.list(ctx, client, after)
+		if err != nil {
+			return nil, errors.Wrap(err, "inventory")
+		}
+		last := uuid.Max
+		if len(page) == r.pageSize {
+			last = page[len(page)-1].ID
+		}
+		recorded, err := r.h.storage.RecordedRange(ctx, baseURL, after, last)
+		if err != nil {
+			return nil, errors.Wrap(err, "recorded range")
+		}
+		missing := slices.DeleteFunc(recorded, func(id uuid.UUID) bool {
+			return slices.ContainsFunc(page, func(c node.ChunkInfo) bool { return c.ID == id })
+		})
+		if len(missing) > 0 {
+			// Chunk can be written and recorded after page was listed, so
+			// inventory is listed again after replicas.
+			page, err := r.list(ctx, client, after)
+			if err != nil {
+				return nil, errors.Wrap(err, "inventory")
+			}
+			missing = slices.DeleteFunc(missing, func(id uuid.UUID) bool {
+				if len(page) == r.pageSize && bytes.Compare(id[:], page[len(page)-1].ID[:]) > 0 {
+					// Not listed again.
+					return true
+				}
+				return slices.ContainsFunc(page, func(c node.ChunkInfo) bool { return c.ID == id })
+			})
+		}
+		for _, id := range missing {
+			if !r.removeStale(ctx, id, baseURL) {
+				kept = append(kept, Replica{ChunkID: id, Node: baseURL})
+			}
+		}
+		if last == uuid.Max {
+			return kept, nil
+		}
+		after = last
+	}
+}
+
+// list returns page of node inventory that follows chunk after.
+func (r *Repairer) list(ctx context.Context, client NodeClient, after uuid.UUID) ([]node.ChunkInfo, error) {
+	ctx, cancel := context.WithTimeout(ctx, r.listTimeout)
+	defer cancel()
+	return client.Inventory(ctx, after, r.pageSize)
+}
+
+// removeStale removes replica of chunk that is missing on node from
+// metadata, unless it is the last replica of chunk. Returns false if replica
+// is kept.
+func (r *Repairer) removeStale(ctx context.Context, id uuid.UUID, baseURL string) bool {
+	err := r.h.storage.RemoveReportedReplica(ctx, id, baseURL)
+	var lastReplica *LastReplicaErr
+	if errors.As(err, &lastReplica) {
+		return false
+	}
+	if err != nil {
+		zctx.From(ctx).Warn("Failed to remove stale replica",
+			zap.String("chunkID", id.String()),
+			zap.String("node", baseURL),
+			zap.Error(err),
+		)
+		return false
+	}
+	r.staleReplicas.Add(ctx, 1)
+	return true
+}
+
+// repairChunk creates missing copies of chunk on least filled nodes that
+// don't have it yet.
+func (r *Repairer) repairChunk(
+	ctx context.Context,
+	file *File,
+	chunk *Chunk,
+	healthy []string,
+	missing int,
+	stats []NodeStat,
+) (rerr error) {
+	ctx, span := r.tracer.Start(ctx, "Repairer.RepairChunk",
+		trace.WithAttributes(
+			attribute.String("fileName", file.Name),
+			attribute.String("chunkID", chunk.ID.String()),
+			attribute.Int("chunkIndex", chunk.Index),
+			attribute.Int("healthy", len(healthy)),
+			attribute.Int("missing", missing),
+		),
+	)
+	defer func() {
+		if rerr != nil {
+			span.RecordError(rerr)
+		}
+		span.End()
+	}()
+	if len(healthy) == 0 && !file.Erasure() {
+		return errChunkLost
+	}
+
+	// Prefer nodes without other shards of the same stripe, so single node
+	// failure still costs at most one shard.
+	exclude := slices.Clone(chunk.Nodes)
+	if file.Erasure() {
+		for _, shard := range file.stripe(*chunk) {
+			exclude = append(exclude, shard.Nodes...)
+		}
+	}
+	candidates := slices.DeleteFunc(slices.Clone(stats), func(stat NodeStat) bool {
+		return slices.Contains(exclude, stat.BaseURL) || !r.h.fits(stat, chunk.Size)
+	})
+	if len(candidates) == 0 && file.Erasure() {
+		candidates = slices.DeleteFunc(slices.Clone(stats), func(stat NodeStat) bool {
+			return slices.Contains(chunk.Nodes, stat.BaseURL) || !r.h.fits(stat, chunk.Size)
+		})
+	}
+	if len(candidates) == 0 {
+		return ErrNoNodes
+	}
+	candidates = r.h.spread(candidates, stats, exclude)
+	targets := r.h.place(candidates, 1, min(missing, r.h.countDomains(candidates)), chunk.Size)[0]
+
+	for _, target := range targets {
+		source := func(w io.Writer) error {
+			if len(healthy) == 0 {
+				return r.h.reconstructChunk(ctx, file, *chunk, w)
+			}
+			src := *chunk
+			src.Nodes = healthy
+			return r.h.readReplicas(ctx, src, 0, chunk.Size, w)
+		}
+		client := r.h.GetClient(target.BaseURL)
+		written, err := r.h.copyChunk(ctx, *chunk, client, source)
+		if err != nil {
+			return errors.Wrapf(err, "copy to %s", target.BaseURL)
+		}
+		if err := r.h.storage.AddReplica(ctx, *chunk, target.BaseURL); err != nil {
+			if deleteErr := r.h.deleteWritten(ctx, client, chunk.ID, written); deleteErr != nil {
+				zctx.From(ctx).Warn("Failed to delete chunk",
+					zap.String("chunkID", chunk.ID.String()),
+					zap.Error(deleteErr),
+				)
+			}
+			return errors.Wrap(err, "add replica")
+		}
+		chunk.Nodes = append(chunk.Nodes, target.BaseURL)
+		healthy = append(healthy, target.BaseURL)
+		for i := range stats {
+			if stats[i].BaseURL == target.BaseURL {
+				stats[i].TotalChunks++
+				stats[i].TotalSize += chunk.Size
+			}
+		}
+		zctx.From(ctx).Info("Repaired chunk",
+			zap.String("fileName", file.Name),
+			zap.String("chunkID", chunk.ID.String()),
+			zap.String("node", target.BaseURL),
+		)
+	}
+
+	return nil
+}
+
+// copyChunk writes chunk produced by source to target node, that verifies
+// its checksum, so corrupted source never replaces chunk with the same ID
+// that is already stored on target.
+func (h *Handler) copyChunk(ctx context.Context, chunk Chunk, target NodeClient, source func(w io.Writer) error) (node.WriteResult, error) {
+	var (
+		pr, pw = io.Pipe()
+		g      errgroup.Group
+	)
+	g.Go(func() error {
+		err := source(pw)
+		_ = pw.CloseWithError(err)
+		return err
+	})
+	written, writeErr := target.Write(ctx, chunk.ID, pr, chunk.Checksum)
+	// Unblock source if write failed before reading everything.
+	_ = pr.CloseWithError(writeErr)
+	if err := g.Wait(); err != nil {
+		return node.WriteResult{}, errors.Wrap(err, "read")
+	}
+	if writeErr != nil {
+		return node.WriteResult{}, errors.Wrap(writeErr, "write")
+	}
+	return written, nil
+}
@@ -0,0 +1,186 @@
+package front
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	noopMeter "go.opentelemetry.io/otel/metric/noop"
+	noopTracer "go.opentelemetry.io/otel/trace/noop"
+
+	"github.com/ernado/stor/internal/node"
+)
+
+func newTestRepairer(t *testing.T, opts HandlerOptions) (*Repairer, *httptest.Server, *inMemoryStorage, *inMemoryNodes) {
+	t.Helper()
+	var (
+		ctx   = context.Background()
+		stor  = newInMemoryStorage()
+		nodes = newInMemoryNodes()
+	)
+	handler, err := NewHandler(ctx, nodes, stor, noopTracer.NewTracerProvider(), noopMeter.NewMeterProvider(), opts)
+	require.NoError(t, err)
+	server := httptest.NewServer(handler)
+	t.Cleanup(server.Close)
+	repairer, err := NewRepairer(handler, RepairOptions{Rate: 1000, PageSize: 2}, noopTracer.NewTracerProvider(), noopMeter.NewMeterProvider())
+	require.NoError(t, err)
+	return repairer, server, stor, nodes
+}
+
+// requireHealthy checks that every chunk of file has at least n replicas
+// that are present on nodes that are up.
+func requireHealthy(t *testing.T, stor *inMemoryStorage, nodes *inMemoryNodes, name string, n int) {
+	t.Helper()
+	file, err := stor.File(context.Background(), name)
+	require.NoError(t, err)
+	for _, chunk := range file.Chunks {
+		var healthy int
+		for _, baseURL := range chunk.Nodes {
+			node := nodes.nodes[baseURL]
+			if _, ok := node.chunks[chunk.ID]; ok && !node.down {
+				healthy++
+			}
+		}
+		require.GreaterOrEqual(t, healthy, n, "chunk %d", chunk.Index)
+	}
+}
+
+func TestRepairer(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("Replicated", func(t *testing.T) {
+		repairer, server, stor, nodes := newTestRepairer(t, HandlerOptions{
+			ReplicationFactor: 2,
+			Chunking:          ChunkPolicy{Size: 1000},
+		})
+		registerNodes(t, server, nodes, "node1:8080", "node2:8080", "node3:8080", "node4:8080")
+		data := randomBytes(t, 4096)
+		resp := uploadFile(t, server, "replicated.bin", data)
+		require.Equal(t, http.StatusOK, resp.StatusCode)
+
+		file, err := stor.File(ctx, "replicated.bin")
+		require.NoError(t, err)
+		// Lose whole node and single replica on another one.
+		down := file.Chunks[0].Nodes[0]
+		nodes.nodes[down].setDown(true)
+		stale := file.Chunks[1].Nodes[0]
+		if stale == down {
+			stale = file.Chunks[1].Nodes[1]
+		}
+		require.NoError(t, nodes.nodes[stale].Delete(ctx, file.Chunks[1].ID))
+
+		require.NoError(t, repairer.Repair(ctx))
+		requireHealthy(t, stor, nodes, "replicated.bin", 2)
+
+		file, err = stor.File(ctx, "replicated.bin")
+		require.NoError(t, err)
+		if slices.Contains(file.Chunks[1].Nodes, stale) {
+			// Replica can be re-created on the same node.
+			_, ok := nodes.nodes[stale].chunks[file.Chunks[1].ID]
+			require.True(t, ok, "stale replica should be removed")
+		}
+		require.Contains(t, file.Chunks[0].Nodes, down, "replica on unhealthy node should be kept")
+
+		// Second node failure is survived after repair.
+		other := file.Chunks[0].Nodes[1]
+		nodes.nodes[other].setDown(true)
+		_, downloaded, err := downloadFile(t, server, "replicated.bin")
+		require.NoError(t, err)
+		require.Equal(t, data, downloaded)
+	})
+	t.Run("Erasure", func(t *testing.T) {
+		repairer, server, stor, nodes := newTestRepairer(t, HandlerOptions{})
+		registerNodes(t, server, nodes, "node1:8080", "node2:8080", "node3:8080", "node4:8080")
+		data := randomBytes(t, 4095)
+		resp := uploadFileTo(t, server, "/upload?dataShards=2&parityShards=1", "ec.bin", data)
+		require.Equal(t, http.StatusOK, resp.StatusCode)
+
+		file, err := stor.File(ctx, "ec.bin")
+		require.NoError(t, err)
+		for _, chunk := range file.Chunks {
+			// Lose each shard in turn.
+			down := chunk.Nodes[0]
+			nodes.nodes[down].setDown(true)
+			require.NoError(t, repairer.Repair(ctx))
+			requireHealthy(t, stor, nodes, "ec.bin", 1)
+			nodes.nodes[down].setDown(false)
+			// Node returns empty.
+			for id := range nodes.nodes[down].chunks {
+				require.NoError(t, nodes.nodes[down].Delete(ctx, id))
+			}
+		}
+		require.NoError(t, repairer.Repair(ctx))
+		requireHealthy(t, stor, nodes, "ec.bin", 1)
+
+		_, downloaded, err := downloadFile(t, server, "ec.bin")
+		require.NoError(t, err)
+		require.Equal(t, data, downloaded)
+	})
+	t.Run("ErasureMissing", func(t *testing.T) {
+		repairer, server, stor, nodes := newTestRepairer(t, HandlerOptions{})
+		registerNodes(t, server, nodes, "node1:8080", "node2:8080", "node3:8080", "node4:8080")
+		data := randomBytes(t, 4095)
+		resp := uploadFileTo(t, server, "/upload?dataShards=2&parityShards=1", "ec.bin", data)
+		require.Equal(t, http.StatusOK, resp.StatusCode)
+
+		file, err := stor.File(ctx, "ec.bin")
+		require.NoError(t, err)
+		// The only replica of shard is missing on healthy node.
+		shard := file.Chunks[0]
+		require.NoError(t, nodes.nodes[shard.Nodes[0]].Delete(ctx, shard.ID))
+
+		require.NoError(t, repairer.Repair(ctx))
+		requireHealthy(t, stor, nodes, "ec.bin", 1)
+		file, err = stor.File(ctx, "ec.bin")
+		require.NoError(t, err)
+		require.Len(t, file.Chunks[0].Nodes, 1, "stale replica should be removed")
+
+		_, downloaded, err := downloadFile(t, server, "ec.bin")
+		require.NoError(t, err)
+		require.Equal(t, data, downloaded)
+	})
+	t.Run("Lost", func(t *testing.T) {
+		repairer, server, stor, nodes := newTestRepairer(t, HandlerOptions{})
+		registerNodes(t, server, nodes, "node1:8080", "node2:8080")
+		resp := uploadFile(t, server, "lost.bin", randomBytes(t, 1024))
+		require.Equal(t, http.StatusOK, resp.StatusCode)
+
+		file, err := stor.File(ctx, "lost.bin")
+		require.NoError(t, err)
+		nodes.nodes[file.Chunks[0].Nodes[0]].setDown(true)
+		require.NoError(t, repairer.Repair(ctx), "lost chunks should not fail repair pass")
+	})
+	t.Run("CorruptedSource", func(t *testing.T) {
+		repairer, server, stor, nodes := newTestRepairer(t, HandlerOptions{})
+		registerNodes(t, server, nodes, "node1:8080")
+		data := randomBytes(t, 1024)
+		resp := uploadFile(t, server, "corrupted.bin", data)
+		require.Equal(t, http.StatusOK, resp.StatusCode)
+
+		// Chunk that is already stored on target is not replaced.
+		file, err := stor.File(ctx, "corrupted.bin")
+		require.NoError(t, err)
+		chunk := file.Chunks[0]
+		corrupted := slices.Clone(data)
+		corrupted[0] ^= 0xff
+		_, err = repairer.h.copyChunk(ctx, chunk, repairer.h.GetClient("node1:8080"), func(w io.Writer) error {
+			_, err := w.Write(corrupted)
+			return err
+		})
+		require.ErrorIs(t, err, node.ErrChecksumMismatch)
+		require.Equal(t, data, nodes.nodes["node1:8080"].chunks[chunk.ID])
+	})
+	t.Run("Run", func(t *testing.T) {
+		repairer, server, _, nodes := newTestRepairer(t, HandlerOptions{})
+		registerNodes(t, server, nodes, "node1:8080")
+		repairer.interval = time.Millisecond
+		ctx, cancel := context.WithTimeout(ctx, 50*time.Millisecond)
+		defer cancel()
+		require.ErrorIs(t, repairer.Run(ctx), context.DeadlineExceeded)
+	})
+}
@@ -0,0 +1,752 @@
+package front
+
+import (
+	"cmp"
+	"context"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/go-faster/errors"
+	"github.com/go-faster/sdk/zctx"
+	"github.com/google/uuid"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/trace"
+	"go.uber.org/zap"
+
+	"github.com/ernado/stor/internal/node"
+)
+
+// Limits of S3 API.
+const (
+	s3MaxKeys      = 1000
+	s3MaxKeyLength = 1024
+	s3MaxParts     = 10000
+	// Maximum size of XML request body.
+	s3MaxXMLSize = 1024 * 1024
+
+	s3Namespace = "http://s3.amazonaws.com/doc/2006-03-01/"
+	s3Time      = "2006-01-02T15:04:05.000Z"
+)
+
+// s3Subresources are query parameters of S3 operations that are not
+// supported, so such requests are not mistaken for object operations.
+var s3Subresources = []string{
+	"acl", "attributes", "cors", "encryption", "legal-hold", "lifecycle",
+	"location", "logging", "notification", "object-lock", "policy",
+	"replication", "restore", "retention", "select", "tagging", "torrent",
+	"versionId", "versioning", "versions", "website",
+}
+
+// S3Options configures S3-compatible API.
+type S3Options struct {
+	// Credentials maps access key ID to secret access key.
+	Credentials map[string]string
+	// Region of signature credential scope, us-east-1 by default.
+	Region string
+}
+
+func (o *S3Options) setDefaults() {
+	if o.Region == "" {
+		o.Region = "us-east-1"
+	}
+}
+
+// S3 serves subset of S3 API with path-style addressing on top of Handler.
+//
+// Object of bucket is file named s3KeysPrefix+"<bucket>/<key>", so it is
+// stored like any other file, but can't be accessed through Handler API,
+// which is not authenticated. Requests are authenticated with Signature
+// Version 4.
+type S3 struct {
+	h           *Handler
+	credentials map[string]string
+	region      string
+	tracer      trace.Tracer
+
+	requests metric.Int64Counter
+}
+
+func NewS3(h *Handler, opts S3Options, tracerProvider trace.TracerProvider, meterProvider metric.MeterProvider) (*S3, error) {
+	opts.setDefaults()
+	if len(opts.Credentials) == 0 {
+		return nil, errors.New("credentials are required")
+	}
+	const name = "stor.front.s3"
+	s := &S3{
+		h:           h,
+		credentials: opts.Credentials,
+		region:      opts.Region,
+		tracer:      tracerProvider.Tracer(name),
+	}
+	meter := meterProvider.Meter(name)
+	var err error
+	if s.requests, err = meter.Int64Counter("s3.requests"); err != nil {
+		return nil, errors.Wrap(err, "s3.requests")
+	}
+	return s, nil
+}
+
+// s3Error is error of S3 API.
+type s3Error struct {
+	Status  int
+	Code    string
+	Message string
+}
+
+func s3Err(status int, code, message string) *s3Error {
+	return &s3Error{Status: status, Code: code, Message: message}
+}
+
+func (e *s3Error) Error() string {
+	return e.Code + ": " + e.Message
+}
+
+// s3ErrorOf maps error of operation to S3 error.
+func s3ErrorOf(err error) *s3Error {
+	var (
+		apiErr         *s3Error
+		fileNotFound   *FileNotFoundErr
+		bucketNotFound *BucketNotFoundErr
+		bucketExists   *BucketExistsErr
+		uploadNotFound *UploadNotFoundErr
+		partChanged    *PartChangedErr
+		unavailable    *ChunkUnavailableErr
+	)
+	switch {
+	case errors.As(err, &apiErr):
+		return apiErr
+	case errors.As(err, &fileNotFound):
+		return s3Err(http.StatusNotFound, "NoSuchKey", err.Error())
+	case errors.As(err, &bucketNotFound):
+		return s3Err(http.StatusNotFound, "NoSuchBucket", err.Error())
+	case errors.As(err, &bucketExists):
+		return s3Err(http.StatusConflict, "BucketAlreadyOwnedByYou", err.Error())
+	case errors.As(err, &uploadNotFound):
+		return s3Err(http.StatusNotFound, "NoSuchUpload", err.Error())
+	case errors.As(err, &partChanged):
+		return s3Err(http.StatusBadRequest, "InvalidPart", err.Error())
+	case errors.Is(err, errUnsatisfiableRange):
+		return s3Err(http.StatusRequestedRangeNotSatisfiable, "InvalidRange", err.Error())
+	case errors.Is(err, ErrInsufficientCapacity), errors.Is(err, node.ErrNoSpace):
+		return s3Err(http.StatusInsufficientStorage, "InsufficientStorage", err.Error())
+	case errors.Is(err, ErrNoNodes), errors.As(err, &unavailable):
+		return s3Err(http.StatusServiceUnavailable, "ServiceUnavailable", err.Error())
+	default:
+		return s3Err(http.StatusInternalServerError, "InternalError", err.Error())
+	}
+}
+
+type s3ErrorResponse struct {
+	XMLName  xml.Name `xml:"Error"`
+	Code     string
+	Message  string
+	Resource string
+}
+
+func writeXML(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/xml")
+	w.WriteHeader(status)
+	_, _ = io.WriteString(w, xml.Header)
+	_ = xml.NewEncoder(w).Encode(v)
+}
+
+// s3KeysPrefix is the prefix of names of object files. File names can't
+// contain NUL, so it never clashes with name of file uploaded through Handler.
+const s3KeysPrefix = "\x00s3/"
+
+// s3Request is authenticated request to bucket or object.
+type s3Request struct {
+	Bucket string
+	Key    string
+	sig    *sigV4Signature
+}
+
+// prefix returns prefix of names of object files in bucket.
+func (req *s3Request) prefix() string {
+	return s3KeysPrefix + req.Bucket + "/"
+}
+
+// name returns name of object file.
+func (req *s3Request) name() string {
+	return req.prefix() + req.Key
+}
+
+// s3Operation handles authenticated request. Error is returned only if
+// response is not sent yet.
+type s3Operation func(ctx context.Context, w http.ResponseWriter, r *http.Request, req *s3Request) error
+
+// route returns name and handler of request operation, or nil if it is not
+// supported.
+func (s *S3) route(r *http.Request, bucket, key string) (string, s3Operation) {
+	q := r.URL.Query()
+	if slices.ContainsFunc(s3Subresources, q.Has) {
+		return "", nil
+	}
+	switch {
+	case bucket == "":
+		if r.Method == http.MethodGet {
+			return "ListBuckets", s.listBuckets
+		}
+	case key == "":
+		switch r.Method {
+		case http.MethodPut:
+			return "CreateBucket", s.createBucket
+		case http.MethodHead:
+			return "HeadBucket", s.headBucket
+		case http.MethodDelete:
+			return "DeleteBucket", s.deleteBucket
+		case http.MethodGet:
+			if q.Get("list-type") == "2" && !q.Has("uploads") {
+				return "ListObjectsV2", s.listObjects
+			}
+		}
+	default:
+		switch r.Method {
+		case http.MethodPut:
+			switch {
+			case q.Has("uploadId"):
+				return "UploadPart", s.uploadPart
+			case r.Header.Get("X-Amz-Copy-Source") == "":
+				return "PutObject", s.putObject
+			}
+		case http.MethodGet:
+			if !q.Has("uploadId") {
+				return "GetObject", s.getObject
+			}
+		case http.MethodHead:
+			return "HeadObject", s.getObject
+		case http.MethodPost:
+			switch {
+			case q.Has("uploads"):
+				return "CreateMultipartUpload", s.createMultipartUpload
+			case q.Has("uploadId"):
+				return "CompleteMultipartUpload", s.completeMultipartUpload
+			}
+		case http.MethodDelete:
+			if q.Has("uploadId") {
+				return "AbortMultipartUpload", s.abortMultipartUpload
+			}
+			return "DeleteObject", s.deleteObject
+		}
+	}
+	return "", nil
+}
+
+func (s *S3) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	bucket, key, _ := strings.Cut(strings.TrimPrefix(r.URL.Path, "/"), "/")
+	operation, handle := s.route(r, bucket, key)
+	operation = cmp.Or(operation, "Unsupported")
+
+	ctx, span := s.tracer.Start(r.Context(), "s3."+operation)
+	defer span.End()
+	span.SetAttributes(
+		attribute.String("bucket", bucket),
+		attribute.String("key", key),
+	)
+
+	code := "OK"
+	if err := s.serve(ctx, w, r, bucket, key, handle); err != nil {
+		e := s3ErrorOf(err)
+		code = e.Code
+		if e.Status >= http.StatusInternalServerError {
+			zctx.From(ctx).Error("S3 request failed",
+				zap.String("operation", operation),
+				zap.Error(err),
+			)
+		}
+		writeXML(w, e.Status, s3ErrorResponse{
+			Code:     e.Code,
+			Message:  e.Message,
+			Resource: r.URL.Path,
+		})
+	}
+	s.requests.Add(ctx, 1, metric.WithAttributes(
+		attribute.String("operation", operation),
+		attribute.String("code", code),
+	))
+}
+
+func (s *S3) serve(ctx context.Context, w http.ResponseWriter, r *http.Request, bucket, key string, handle s3Operation) error {
+	sig, err := s.authenticate(r)
+	if err != nil {
+		return err
+	}
+	if handle == nil {
+		return s3Err(http.StatusNotImplemented, "NotImplemented", "operation is not supported")
+	}
+	req := &s3Request{
+		Bucket: bucket,
+		Key:    key,
+		sig:    sig,
+	}
+	if bucket != "" && !validBucketName(bucket) {
+		return s3Err(http.StatusBadRequest, "InvalidBucketName", "invalid bucket name")
+	}
+	if key != "" {
+		if len(key) > s3MaxKeyLength {
+			return s3Err(http.StatusBadRequest, "KeyTooLongError", "key is too long")
+		}
+		if err := validateFileName(req.Key); err != nil {
+			return s3Err(http.StatusBadRequest, "InvalidArgument", err.Error())
+		}
+	}
+	return handle(ctx, w, r, req)
+}
+
+// validBucketName reports whether name is valid S3 bucket name: 3 to 63
+// lowercase letters, digits, dots and hyphens, starting and ending with
+// letter or digit.
+func validBucketName(name string) bool {
+	if len(name) < 3 || len(name) > 63 {
+		return false
+	}
+	for i := 0; i < len(name); i++ {
+		c := name[i]
+		alnum := 'a' <= c && c <= 'z' || '0' <= c && c <= '9'
+		if !alnum && (i == 0 || i == len(name)-1 || c != '.' && c != '-') {
+			return false
+		}
+	}
+	return true
+}
+
+type s3Owner struct {
+	ID          string
+	DisplayName string
+}
+
+var s3DefaultOwner = s3Owner{ID: "stor", DisplayName: "stor"}
+
+type s3Bucket struct {
+	Name         string
+	CreationDate string
+}
+
+type listAllMyBucketsResult struct {
+	XMLName xml.Name   `xml:"ListAllMyBucketsResult"`
+	XMLNS   string     `xml:"xmlns,attr"`
+	Owner   s3Owner    `xml:"Owner"`
+	Buckets []s3Bucket `xml:"Buckets>Bucket"`
+}
+
+func (s *S3) listBuckets(ctx context.Context, w http.ResponseWriter, _ *http.Request, _ *s3Request) error {
+	buckets, err := s.h.storage.Buckets(ctx)
+	if err != nil {
+		return err
+	}
+	result := listAllMyBucketsResult{
+		XMLNS: s3Namespace,
+		Owner: s3DefaultOwner,
+	}
+	for _, bucket := range buckets {
+		result.Buckets = append(result.Buckets, s3Bucket{
+			Name:         bucket.Name,
+			CreationDate: bucket.CreatedAt.UTC().Format(s3Time),
+		})
+	}
+	writeXML(w, http.StatusOK, result)
+	return nil
+}
+
+func (s *S3) createBucket(ctx context.Context, w http.ResponseWriter, _ *http.Request, req *s3Request) error {
+	if err := s.h.storage.AddBucket(ctx, Bucket{
+		Name:      req.Bucket,
+		CreatedAt: s.h.now(),
+	}); err != nil {
+		return err
+	}
+	zctx.From(ctx).Info("Created bucket", zap.String("bucket", req.Bucket))
+	w.Header().Set("Location", "/"+req.Bucket)
+	w.WriteHeader(http.StatusOK)
+	return nil
+}
+
+func (s *S3) headBucket(ctx context.Context, w http.ResponseWriter, _ *http.Request, req *s3Request) error {
+	if _, err := s.h.storage.Bucket(ctx, req.Bucket); err != nil {
+		return err
+	}
+	w.WriteHeader(http.StatusOK)
+	return nil
+}
+
+// deleteBucket removes bucket if it has no objects.
+func (s *S3) deleteBucket(ctx context.Context, w http.ResponseWriter, _ *http.Request, req *s3Request) error {
+	if _, err := s.h.storage.Bucket(ctx, req.Bucket); err != nil {
+		return err
+	}
+	prefix := req.prefix()
+	files, err := s.h.storage.Files(ctx, prefix, prefix, 1)
+	if err != nil {
+		return err
+	}
+	if len(files) > 0 {
+		return s3Err(http.StatusConflict, "BucketNotEmpty", "bucket is not empty")
+	}
+	if err := s.h.storage.RemoveBucket(ctx, req.Bucket); err != nil {
+		return err
+	}
+	zctx.From(ctx).Info("Removed bucket", zap.String("bucket", req.Bucket))
+	w.WriteHeader(http.StatusNoContent)
+	return nil
+}
+
+type s3Object struct {
+	Key          string
+	LastModified string
+	ETag         string `xml:",omitempty"`
+	Size         int64
+	StorageClass string
+}
+
+type s3CommonPrefix struct {
+	Prefix string
+}
+
+type listBucketResult struct {
+	XMLName               xml.Name `xml:"ListBucketResult"`
+	XMLNS                 string   `xml:"xmlns,attr"`
+	Name                  string
+	Prefix                string
+	Delimiter             string `xml:",omitempty"`
+	MaxKeys               int
+	KeyCount              int
+	IsTruncated           bool
+	ContinuationToken     string           `xml:",omitempty"`
+	NextContinuationToken string           `xml:",omitempty"`
+	StartAfter            string           `xml:",omitempty"`
+	Contents              []s3Object       `xml:"Contents"`
+	CommonPrefixes        []s3CommonPrefix `xml:"CommonPrefixes"`
+}
+
+// listObjects lists objects of bucket with ListObjectsV2. Continuation
+// token is encoded key to continue from.
+func (s *S3) listObjects(ctx context.Context, w http.ResponseWriter, r *http.Request, req *s3Request) error {
+	if _, err := s.h.storage.Bucket(ctx, req.Bucket); err != nil {
+		return err
+	}
+	var (
+		q            = r.URL.Query()
+		bucketPrefix = req.prefix()
+		result       = listBucketResult{
+			XMLNS:             s3Namespace,
+			Name:              req.Bucket,
+			Prefix:            q.Get("prefix"),
+			Delimiter:         q.Get("delimiter"),
+			MaxKeys:           s3MaxKeys,
+			ContinuationToken: q.Get("continuation-token"),
+			StartAfter:        q.Get("start-after"),
+		}
+		from = bucketPrefix + result.Prefix
+	)
+	if v := q.Get("max-keys"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 {
+			return s3Err(http.StatusBadRequest, "InvalidArgument", "invalid max-keys")
+		}
+		result.MaxKeys = min(n, s3MaxKeys)
+	}
+	if result.StartAfter != "" {
+		from = max(from, bucketPrefix+result.StartAfter+"\x00")
+	}
+	if result.ContinuationToken != "" {
+		key, err := base64.RawURLEncoding.DecodeString(result.ContinuationToken)
+		if err != nil {
+			return s3Err(http.StatusBadRequest, "InvalidArgument", "invalid continuation-token")
+		}
+		from = max(from, bucketPrefix+string(key))
+	}
+
+	if result.MaxKeys > 0 {
+		list, err := s.h.list(ctx, bucketPrefix, result.Prefix, result.Delimiter, from, result.MaxKeys)
+		if err != nil {
+			return err
+		}
+		for _, file := range list.Files {
+			object := s3Object{
+				Key:          strings.TrimPrefix(file.Name, bucketPrefix),
+				Size:         file.Size,
+				StorageClass: "STANDARD",
+			}
+			if !file.CreatedAt.IsZero() {
+				object.LastModified = file.CreatedAt.UTC().Format(s3Time)
+			}
+			if file.Checksum != nil {
+				object.ETag = formatETag(file.Checksum, file.PartCount)
+			}
+			result.Contents = append(result.Contents, object)
+		}
+		for _, prefix := range list.Prefixes {
+			result.CommonPrefixes = append(result.CommonPrefixes, s3CommonPrefix{
+				Prefix: strings.TrimPrefix(prefix, bucketPrefix),
+			})
+		}
+		if list.Cursor != "" {
+			result.IsTruncated = true
+			result.NextContinuationToken = base64.RawURLEncoding.EncodeToString(
+				[]byte(strings.TrimPrefix(list.Cursor, bucketPrefix)),
+			)
+		}
+	}
+	result.KeyCount = len(result.Contents) + len(result.CommonPrefixes)
+	writeXML(w, http.StatusOK, result)
+	return nil
+}
+
+// chunker returns chunker of objects and parts, which follows chunking
+// policy of front.
+func (s *S3) chunker() Chunker {
+	return newChunker(s.h.chunking.Mode, s.h.chunking.Size)
+}
+
+// writeObject writes request body as chunks of file, verifying its
+// checksums. Returns nodes that every chunk was written to, so they can be
+// removed if request fails.
+func (s *S3) writeObject(ctx context.Context, r *http.Request, req *s3Request, file *File) ([][]replicaWrite, error) {
+	body, err := req.sig.body(r)
+	if err != nil {
+		return nil, err
+	}
+	return s.h.writeFile(ctx, body, s.chunker(), file)
+}
+
+func (s *S3) putObject(ctx context.Context, w http.ResponseWriter, r *http.Request, req *s3Request) error {
+	if _, err := s.h.storage.Bucket(ctx, req.Bucket); err != nil {
+		return err
+	}
+	file := File{
+		Name:        req.name(),
+		ContentType: r.Header.Get("Content-Type"),
+		CreatedAt:   s.h.now(),
+	}
+	targets, err := s.writeObject(ctx, r, req, &file)
+	if err == nil {
+		err = s.h.addFile(ctx, &file)
+	}
+	if err != nil {
+		s.h.removeChunks(ctx, file.Chunks, targets)
+		return err
+	}
+
+	w.Header().Set("ETag", formatETag(file.Checksum, file.PartCount))
+	w.Header().Set("x-amz-version-id", file.Version.String())
+	w.WriteHeader(http.StatusOK)
+	return nil
+}
+
+// getObject serves GetObject and HeadObject.
+func (s *S3) getObject(ctx context.Context, w http.ResponseWriter, r *http.Request, req *s3Request) error {
+	file, err := s.h.storage.File(ctx, req.name())
+	if err != nil {
+		var fileNotFound *FileNotFoundErr
+		if errors.As(err, &fileNotFound) {
+			// Missing bucket is reported instead of missing key.
+			if _, bucketErr := s.h.storage.Bucket(ctx, req.Bucket); bucketErr != nil {
+				return bucketErr
+			}
+		}
+		return err
+	}
+	return s.h.serveFile(ctx, w, r, file)
+}
+
+// deleteObject removes object, missing object is not an error.
+func (s *S3) deleteObject(ctx context.Context, w http.ResponseWriter, _ *http.Request, req *s3Request) error {
+	if err := s.h.storage.RemoveFile(ctx, req.name()); err != nil {
+		var fileNotFound *FileNotFoundErr
+		if !errors.As(err, &fileNotFound) {
+			return err
+		}
+	}
+	s.h.notifyCollector()
+	w.WriteHeader(http.StatusNoContent)
+	return nil
+}
+
+type initiateMultipartUploadResult struct {
+	XMLName  xml.Name `xml:"InitiateMultipartUploadResult"`
+	XMLNS    string   `xml:"xmlns,attr"`
+	Bucket   string
+	Key      string
+	UploadID string `xml:"UploadId"`
+}
+
+func (s *S3) createMultipartUpload(ctx context.Context, w http.ResponseWriter, r *http.Request, req *s3Request) error {
+	if _, err := s.h.storage.Bucket(ctx, req.Bucket); err != nil {
+		return err
+	}
+	now := s.h.now()
+	upload := Upload{
+		ID:          uuid.New(),
+		Name:        req.name(),
+		ContentType: r.Header.Get("Content-Type"),
+		CreatedAt:   now,
+		UpdatedAt:   now,
+	}
+	if err := s.h.storage.AddUpload(ctx, upload); err != nil {
+		return err
+	}
+	zctx.From(ctx).Info("Created multipart upload",
+		zap.String("fileName", upload.Name),
+		zap.String("uploadID", upload.ID.String()),
+	)
+	writeXML(w, http.StatusOK, initiateMultipartUploadResult{
+		XMLNS:    s3Namespace,
+		Bucket:   req.Bucket,
+		Key:      req.Key,
+		UploadID: upload.ID.String(),
+	})
+	return nil
+}
+
+// upload returns multipart upload of request to object.
+func (s *S3) upload(ctx context.Context, r *http.Request, req *s3Request) (*Upload, error) {
+	id, err := uuid.Parse(r.URL.Query().Get("uploadId"))
+	if err != nil {
+		return nil, s3Err(http.StatusNotFound, "NoSuchUpload", "invalid upload id")
+	}
+	upload, err := s.h.storage.Upload(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if upload.Name != req.name() || upload.Length != 0 || s.h.expired(upload) {
+		// Resumable uploads are not exposed.
+		return nil, &UploadNotFoundErr{Upload: id}
+	}
+	return upload, nil
+}
+
+func (s *S3) uploadPart(ctx context.Context, w http.ResponseWriter, r *http.Request, req *s3Request) error {
+	number, err := strconv.Atoi(r.URL.Query().Get("partNumber"))
+	if err != nil || number < 1 || number > s3MaxParts {
+		return s3Err(http.StatusBadRequest, "InvalidArgument", fmt.Sprintf("part number must be in [1, %d]", s3MaxParts))
+	}
+	upload, err := s.upload(ctx, r, req)
+	if err != nil {
+		return err
+	}
+	file := File{Name: upload.Name}
+	targets, err := s.writeObject(ctx, r, req, &file)
+	if err == nil {
+		err = s.h.storage.AddPart(ctx, upload.ID, Part{
+			Number:    number,
+			Size:      file.Size,
+			Checksum:  file.Checksum,
+			CreatedAt: s.h.now(),
+			Chunks:    file.Chunks,
+		})
+	}
+	if err != nil {
+		s.h.removeChunks(ctx, file.Chunks, targets)
+		return err
+	}
+	// Chunks of replaced part.
+	s.h.notifyCollector()
+
+	// Parts are not versions of object, so version ID is not sent.
+	w.Header().Set("ETag", formatETag(file.Checksum, 0))
+	w.WriteHeader(http.StatusOK)
+	return nil
+}
+
+type completeMultipartUpload struct {
+	XMLName xml.Name `xml:"CompleteMultipartUpload"`
+	Parts   []struct {
+		PartNumber int
+		ETag       string
+	} `xml:"Part"`
+}
+
+type completeMultipartUploadResult struct {
+	XMLName  xml.Name `xml:"CompleteMultipartUploadResult"`
+	XMLNS    string   `xml:"xmlns,attr"`
+	Location string
+	Bucket   string
+	Key      string
+	ETag     string
+}
+
+// completeMultipartUpload publishes file that consists of chunks of listed
+// parts. Parts that are not listed are discarded.
+func (s *S3) completeMultipartUpload(ctx context.Context, w http.ResponseWriter, r *http.Request, req *s3Request) error {
+	upload, err := s.upload(ctx, r, req)
+	if err != nil {
+		return err
+	}
+	body, err := req.sig.body(r)
+	if err != nil {
+		return err
+	}
+	data, err := io.ReadAll(io.LimitReader(body, s3MaxXMLSize))
+	if err != nil {
+		return errors.Wrap(err, "read body")
+	}
+	var complete completeMultipartUpload
+	if err := xml.Unmarshal(data, &complete); err != nil || len(complete.Parts) == 0 {
+		return s3Err(http.StatusBadRequest, "MalformedXML", "invalid list of parts")
+	}
+	parts, err := s.h.storage.Parts(ctx, upload.ID)
+	if err != nil {
+		return err
+	}
+
+	var (
+		selected []Part
+		prev     int
+	)
+	for _, listed := range complete.Parts {
+		if listed.PartNumber <= prev {
+			return s3Err(http.StatusBadRequest, "InvalidPartOrder", "parts must be listed in ascending order")
+		}
+		prev = listed.PartNumber
+		i := slices.IndexFunc(parts, func(p Part) bool { return p.Number == listed.PartNumber })
+		if i < 0 || strings.Trim(listed.ETag, `"`) != hex.EncodeToString(parts[i].Checksum) {
+			return s3Err(http.StatusBadRequest, "InvalidPart", fmt.Sprintf("part %d is not found", listed.PartNumber))
+		}
+		selected = append(selected, parts[i])
+	}
+	file := assembleFile(upload, selected, s.h.now())
+	if err := s.h.completeFile(ctx, upload.ID, selected, &file); err != nil {
+		return err
+	}
+	zctx.From(ctx).Info("Completed multipart upload",
+		zap.String("fileName", file.Name),
+		zap.String("uploadID", upload.ID.String()),
+		zap.Int("parts", len(complete.Parts)),
+	)
+	// Chunks of discarded parts.
+	s.h.notifyCollector()
+
+	writeXML(w, http.StatusOK, completeMultipartUploadResult{
+		XMLNS:    s3Namespace,
+		Location: "/" + req.Bucket + "/" + req.Key,
+		Bucket:   req.Bucket,
+		Key:      req.Key,
+		ETag:     formatETag(file.Checksum, file.PartCount),
+	})
+	return nil
+}
+
+func (s *S3) abortMultipartUpload(ctx context.Context, w http.ResponseWriter, r *http.Request, req *s3Request) error {
+	upload, err := s.upload(ctx, r, req)
+	if err != nil {
+		return err
+	}
+	if err := s.h.storage.RemoveUpload(ctx, upload.ID); err != nil {
+		return err
+	}
+	zctx.From(ctx).Info("Aborted multipart upload",
+		zap.String("fileName", upload.Name),
+		zap.String("uploadID", upload.ID.String()),
+	)
+	s.h.notifyCollector()
+	w.WriteHeader(http.StatusNoContent)
+	return nil
+}
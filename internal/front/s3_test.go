@@ -0,0 +1,454 @@
+package front
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/aws/smithy-go"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/require"
+	noopMeter "go.opentelemetry.io/otel/metric/noop"
+	noopTracer "go.opentelemetry.io/otel/trace/noop"
+)
+
+const (
+	testAccessKey = "test-access-key"
+	testSecretKey = "test-secret-key"
+)
+
+// newS3Client returns S3 client of server with credentials.
+func newS3Client(server *httptest.Server, accessKey, secretKey string) *s3.Client {
+	return s3.New(s3.Options{
+		Region:       "us-east-1",
+		BaseEndpoint: aws.String(server.URL),
+		UsePathStyle: true,
+		HTTPClient:   server.Client(),
+		// Payload checksums are sent, in trailer of aws-chunked body over TLS.
+		RequestChecksumCalculation: aws.RequestChecksumCalculationWhenSupported,
+		Credentials: aws.CredentialsProviderFunc(func(context.Context) (aws.Credentials, error) {
+			return aws.Credentials{AccessKeyID: accessKey, SecretAccessKey: secretKey}, nil
+		}),
+	})
+}
+
+// requireS3Error checks that err is S3 error with code.
+func requireS3Error(t *testing.T, err error, code string) {
+	t.Helper()
+	var apiErr smithy.APIError
+	require.ErrorAs(t, err, &apiErr)
+	require.Equal(t, code, apiErr.ErrorCode())
+}
+
+// newTestS3 returns in-memory storage and S3 gateway of front with three
+// nodes.
+func newTestS3(t *testing.T) (*inMemoryStorage, *S3) {
+	t.Helper()
+	var (
+		ctx   = context.Background()
+		stor  = newInMemoryStorage()
+		nodes = newInMemoryNodes()
+	)
+	handler, err := NewHandler(ctx, nodes, stor, noopTracer.NewTracerProvider(), noopMeter.NewMeterProvider(), HandlerOptions{
+		ReplicationFactor: 2,
+		Chunking:          ChunkPolicy{Size: 1000},
+	})
+	require.NoError(t, err)
+	server := httptest.NewServer(handler)
+	t.Cleanup(server.Close)
+	registerNodes(t, server, nodes, "node1:8080", "node2:8080", "node3:8080")
+
+	gateway, err := NewS3(handler, S3Options{
+		Credentials: map[string]string{testAccessKey: testSecretKey},
+	}, noopTracer.NewTracerProvider(), noopMeter.NewMeterProvider())
+	require.NoError(t, err)
+	return stor, gateway
+}
+
+func TestS3(t *testing.T) {
+	ctx := context.Background()
+	stor, gateway := newTestS3(t)
+	s3Server := httptest.NewServer(gateway)
+	t.Cleanup(s3Server.Close)
+	client := newS3Client(s3Server, testAccessKey, testSecretKey)
+
+	t.Run("Buckets", func(t *testing.T) {
+		_, err := client.CreateBucket(ctx, &s3.CreateBucketInput{Bucket: aws.String("photos")})
+		require.NoError(t, err)
+		_, err = client.CreateBucket(ctx, &s3.CreateBucketInput{Bucket: aws.String("photos")})
+		requireS3Error(t, err, "BucketAlreadyOwnedByYou")
+		_, err = client.CreateBucket(ctx, &s3.CreateBucketInput{Bucket: aws.String("Invalid_Name")})
+		requireS3Error(t, err, "InvalidBucketName")
+
+		_, err = client.HeadBucket(ctx, &s3.HeadBucketInput{Bucket: aws.String("photos")})
+		require.NoError(t, err)
+		_, err = client.HeadBucket(ctx, &s3.HeadBucketInput{Bucket: aws.String("missing")})
+		require.ErrorAs(t, err, new(*types.NotFound))
+
+		_, err = client.CreateBucket(ctx, &s3.CreateBucketInput{Bucket: aws.String("docs")})
+		require.NoError(t, err)
+		out, err := client.ListBuckets(ctx, &s3.ListBucketsInput{})
+		require.NoError(t, err)
+		var names []string
+		for _, bucket := range out.Buckets {
+			names = append(names, aws.ToString(bucket.Name))
+			require.False(t, aws.ToTime(bucket.CreationDate).IsZero())
+		}
+		require.Equal(t, []string{"docs", "photos"}, names)
+
+		_, err = client.DeleteBucket(ctx, &s3.DeleteBucketInput{Bucket: aws.String("docs")})
+		require.NoError(t, err)
+		_, err = client.DeleteBucket(ctx, &s3.DeleteBucketInput{Bucket: aws.String("docs")})
+		requireS3Error(t, err, "NoSuchBucket")
+	})
+	t.Run("Objects", func(t *testing.T) {
+		data := randomBytes(t, 2500)
+		put, err := client.PutObject(ctx, &s3.PutObjectInput{
+			Bucket:      aws.String("photos"),
+			Key:         aws.String("2024/a b+c.jpg"),
+			Body:        bytes.NewReader(data),
+			ContentType: aws.String("image/jpeg"),
+		})
+		require.NoError(t, err)
+		sum := sha256.Sum256(data)
+		require.Equal(t, `"`+hex.EncodeToString(sum[:])+`"`, aws.ToString(put.ETag))
+
+		// Object is regular file.
+		file, err := stor.File(ctx, s3KeysPrefix+"photos/2024/a b+c.jpg")
+		require.NoError(t, err)
+		require.Equal(t, int64(2500), file.Size)
+		require.Equal(t, 3, file.ChunkCount)
+
+		// Objects are not accessible through front API, which is not
+		// authenticated.
+		front := httptest.NewServer(gateway.h)
+		t.Cleanup(front.Close)
+		escaped := url.PathEscape(s3KeysPrefix + "photos/2024/a b+c.jpg")
+		resp, err := front.Client().Get(front.URL + "/download/" + escaped)
+		require.NoError(t, err)
+		requireErrorResponse(t, resp, http.StatusBadRequest)
+		req, err := http.NewRequest(http.MethodDelete, front.URL+"/files/"+escaped, http.NoBody)
+		require.NoError(t, err)
+		resp, err = front.Client().Do(req)
+		require.NoError(t, err)
+		requireErrorResponse(t, resp, http.StatusBadRequest)
+		req, err = http.NewRequest(http.MethodPut, front.URL+"/files/"+escaped, bytes.NewReader(data))
+		require.NoError(t, err)
+		resp, err = front.Client().Do(req)
+		require.NoError(t, err)
+		requireErrorResponse(t, resp, http.StatusBadRequest)
+		list, err := gateway.h.list(ctx, "", "", "", "", 100)
+		require.NoError(t, err)
+		require.Empty(t, list.Files)
+
+		get, err := client.GetObject(ctx, &s3.GetObjectInput{
+			Bucket: aws.String("photos"),
+			Key:    aws.String("2024/a b+c.jpg"),
+		})
+		require.NoError(t, err)
+		got, err := io.ReadAll(get.Body)
+		require.NoError(t, err)
+		_ = get.Body.Close()
+		require.Equal(t, data, got)
+		require.Equal(t, "image/jpeg", aws.ToString(get.ContentType))
+
+		get, err = client.GetObject(ctx, &s3.GetObjectInput{
+			Bucket: aws.String("photos"),
+			Key:    aws.String("2024/a b+c.jpg"),
+			Range:  aws.String("bytes=900-1099"),
+		})
+		require.NoError(t, err)
+		got, err = io.ReadAll(get.Body)
+		require.NoError(t, err)
+		_ = get.Body.Close()
+		require.Equal(t, data[900:1100], got)
+		require.Equal(t, "bytes 900-1099/2500", aws.ToString(get.ContentRange))
+
+		head, err := client.HeadObject(ctx, &s3.HeadObjectInput{
+			Bucket: aws.String("photos"),
+			Key:    aws.String("2024/a b+c.jpg"),
+		})
+		require.NoError(t, err)
+		require.Equal(t, int64(2500), aws.ToInt64(head.ContentLength))
+		require.Equal(t, aws.ToString(put.ETag), aws.ToString(head.ETag))
+		require.WithinDuration(t, time.Now(), aws.ToTime(head.LastModified), time.Minute)
+
+		_, err = client.GetObject(ctx, &s3.GetObjectInput{
+			Bucket: aws.String("photos"),
+			Key:    aws.String("missing.jpg"),
+		})
+		require.ErrorAs(t, err, new(*types.NoSuchKey))
+		_, err = client.GetObject(ctx, &s3.GetObjectInput{
+			Bucket: aws.String("missing"),
+			Key:    aws.String("a.jpg"),
+		})
+		requireS3Error(t, err, "NoSuchBucket")
+		_, err = client.PutObject(ctx, &s3.PutObjectInput{
+			Bucket: aws.String("missing"),
+			Key:    aws.String("a.jpg"),
+			Body:   bytes.NewReader(data),
+		})
+		requireS3Error(t, err, "NoSuchBucket")
+
+		_, err = client.DeleteObject(ctx, &s3.DeleteObjectInput{
+			Bucket: aws.String("photos"),
+			Key:    aws.String("2024/a b+c.jpg"),
+		})
+		require.NoError(t, err)
+		_, err = stor.File(ctx, s3KeysPrefix+"photos/2024/a b+c.jpg")
+		require.ErrorAs(t, err, new(*FileNotFoundErr))
+		// Deletion of missing object succeeds.
+		_, err = client.DeleteObject(ctx, &s3.DeleteObjectInput{
+			Bucket: aws.String("photos"),
+			Key:    aws.String("2024/a b+c.jpg"),
+		})
+		require.NoError(t, err)
+	})
+	t.Run("Streaming", func(t *testing.T) {
+		tlsServer := httptest.NewTLSServer(gateway)
+		t.Cleanup(tlsServer.Close)
+		client := newS3Client(tlsServer, testAccessKey, testSecretKey)
+
+		data := randomBytes(t, 3500)
+		_, err := client.PutObject(ctx, &s3.PutObjectInput{
+			Bucket: aws.String("photos"),
+			Key:    aws.String("streamed.bin"),
+			// Body of unknown size.
+			Body: io.MultiReader(bytes.NewReader(data)),
+		})
+		require.NoError(t, err)
+		file, err := stor.File(ctx, s3KeysPrefix+"photos/streamed.bin")
+		require.NoError(t, err)
+		sum := sha256.Sum256(data)
+		require.Equal(t, sum[:], file.Checksum)
+		require.Equal(t, int64(3500), file.Size)
+	})
+	t.Run("List", func(t *testing.T) {
+		_, err := client.CreateBucket(ctx, &s3.CreateBucketInput{Bucket: aws.String("list")})
+		require.NoError(t, err)
+		keys := []string{"a.txt", "dir/1.txt", "dir/2.txt", "dir/sub/3.txt", "e.txt"}
+		for _, key := range keys {
+			_, err := client.PutObject(ctx, &s3.PutObjectInput{
+				Bucket: aws.String("list"),
+				Key:    aws.String(key),
+				Body:   strings.NewReader(key),
+			})
+			require.NoError(t, err)
+		}
+		// Files of other bucket are not listed.
+		require.NoError(t, stor.AddFile(ctx, File{Name: "lists/x.txt"}))
+
+		var listed []string
+		paginator := s3.NewListObjectsV2Paginator(client, &s3.ListObjectsV2Input{
+			Bucket:  aws.String("list"),
+			MaxKeys: aws.Int32(2),
+		})
+		for paginator.HasMorePages() {
+			page, err := paginator.NextPage(ctx)
+			require.NoError(t, err)
+			for _, object := range page.Contents {
+				listed = append(listed, aws.ToString(object.Key))
+				require.Equal(t, int64(len(aws.ToString(object.Key))), aws.ToInt64(object.Size))
+			}
+		}
+		require.Equal(t, keys, listed)
+
+		out, err := client.ListObjectsV2(ctx, &s3.ListObjectsV2Input{
+			Bucket:    aws.String("list"),
+			Prefix:    aws.String("dir/"),
+			Delimiter: aws.String("/"),
+		})
+		require.NoError(t, err)
+		require.Len(t, out.Contents, 2)
+		require.Equal(t, "dir/1.txt", aws.ToString(out.Contents[0].Key))
+		require.Len(t, out.CommonPrefixes, 1)
+		require.Equal(t, "dir/sub/", aws.ToString(out.CommonPrefixes[0].Prefix))
+		require.False(t, aws.ToBool(out.IsTruncated))
+
+		out, err = client.ListObjectsV2(ctx, &s3.ListObjectsV2Input{
+			Bucket:     aws.String("list"),
+			StartAfter: aws.String("dir/sub/3.txt"),
+		})
+		require.NoError(t, err)
+		require.Len(t, out.Contents, 1)
+		require.Equal(t, "e.txt", aws.ToString(out.Contents[0].Key))
+
+		_, err = client.DeleteBucket(ctx, &s3.DeleteBucketInput{Bucket: aws.String("list")})
+		requireS3Error(t, err, "BucketNotEmpty")
+	})
+	t.Run("Multipart", func(t *testing.T) {
+		var (
+			key   = aws.String("big.bin")
+			parts = [][]byte{randomBytes(t, 1500), bytes.Repeat([]byte{1}, 1200), randomBytes(t, 700)}
+		)
+		create, err := client.CreateMultipartUpload(ctx, &s3.CreateMultipartUploadInput{
+			Bucket:      aws.String("photos"),
+			Key:         key,
+			ContentType: aws.String("application/x-big"),
+		})
+		require.NoError(t, err)
+		var completed []types.CompletedPart
+		for i, part := range parts {
+			out, err := client.UploadPart(ctx, &s3.UploadPartInput{
+				Bucket:     aws.String("photos"),
+				Key:        key,
+				UploadId:   create.UploadId,
+				PartNumber: aws.Int32(int32(i + 1)),
+				Body:       bytes.NewReader(part),
+			})
+			require.NoError(t, err)
+			completed = append(completed, types.CompletedPart{
+				ETag:       out.ETag,
+				PartNumber: aws.Int32(int32(i + 1)),
+			})
+		}
+		// Parts can be listed in any subset, but in order.
+		_, err = client.CompleteMultipartUpload(ctx, &s3.CompleteMultipartUploadInput{
+			Bucket:   aws.String("photos"),
+			Key:      key,
+			UploadId: create.UploadId,
+			MultipartUpload: &types.CompletedMultipartUpload{
+				Parts: []types.CompletedPart{completed[2], completed[0]},
+			},
+		})
+		requireS3Error(t, err, "InvalidPartOrder")
+		_, err = client.CompleteMultipartUpload(ctx, &s3.CompleteMultipartUploadInput{
+			Bucket:   aws.String("photos"),
+			Key:      key,
+			UploadId: create.UploadId,
+			MultipartUpload: &types.CompletedMultipartUpload{
+				Parts: []types.CompletedPart{{ETag: completed[0].ETag, PartNumber: aws.Int32(2)}},
+			},
+		})
+		requireS3Error(t, err, "InvalidPart")
+		uploaded, err := stor.Parts(ctx, uuid.MustParse(aws.ToString(create.UploadId)))
+		require.NoError(t, err)
+		require.Len(t, uploaded, 3)
+		out, err := client.CompleteMultipartUpload(ctx, &s3.CompleteMultipartUploadInput{
+			Bucket:   aws.String("photos"),
+			Key:      key,
+			UploadId: create.UploadId,
+			MultipartUpload: &types.CompletedMultipartUpload{
+				Parts: []types.CompletedPart{completed[0], completed[2]},
+			},
+		})
+		require.NoError(t, err)
+		require.True(t, strings.HasSuffix(aws.ToString(out.ETag), `-2"`), aws.ToString(out.ETag))
+
+		file, err := stor.File(ctx, s3KeysPrefix+"photos/big.bin")
+		require.NoError(t, err)
+		require.Equal(t, int64(2200), file.Size)
+		require.Equal(t, 3, file.ChunkCount)
+		get, err := client.GetObject(ctx, &s3.GetObjectInput{
+			Bucket: aws.String("photos"),
+			Key:    key,
+		})
+		require.NoError(t, err)
+		got, err := io.ReadAll(get.Body)
+		require.NoError(t, err)
+		_ = get.Body.Close()
+		require.Equal(t, append(append([]byte{}, parts[0]...), parts[2]...), got)
+		require.Equal(t, "application/x-big", aws.ToString(get.ContentType))
+
+		// Composite ETag is recorded, so it is the same everywhere.
+		require.Equal(t, aws.ToString(out.ETag), aws.ToString(get.ETag))
+		head, err := client.HeadObject(ctx, &s3.HeadObjectInput{
+			Bucket: aws.String("photos"),
+			Key:    key,
+		})
+		require.NoError(t, err)
+		require.Equal(t, aws.ToString(out.ETag), aws.ToString(head.ETag))
+		list, err := client.ListObjectsV2(ctx, &s3.ListObjectsV2Input{
+			Bucket: aws.String("photos"),
+			Prefix: key,
+		})
+		require.NoError(t, err)
+		require.Len(t, list.Contents, 1)
+		require.Equal(t, aws.ToString(out.ETag), aws.ToString(list.Contents[0].ETag))
+
+		// Upload is removed on completion.
+		_, err = client.UploadPart(ctx, &s3.UploadPartInput{
+			Bucket:     aws.String("photos"),
+			Key:        key,
+			UploadId:   create.UploadId,
+			PartNumber: aws.Int32(1),
+			Body:       bytes.NewReader(parts[0]),
+		})
+		requireS3Error(t, err, "NoSuchUpload")
+
+		// Replicas of discarded part are garbage.
+		garbage := stor.garbageKeys()
+		for _, chunk := range uploaded[1].Chunks {
+			for _, baseURL := range chunk.Nodes {
+				require.Contains(t, garbage, Replica{ChunkID: chunk.ID, Node: baseURL})
+			}
+		}
+	})
+	t.Run("Abort", func(t *testing.T) {
+		create, err := client.CreateMultipartUpload(ctx, &s3.CreateMultipartUploadInput{
+			Bucket: aws.String("photos"),
+			Key:    aws.String("aborted.bin"),
+		})
+		require.NoError(t, err)
+		_, err = client.UploadPart(ctx, &s3.UploadPartInput{
+			Bucket:     aws.String("photos"),
+			Key:        aws.String("aborted.bin"),
+			UploadId:   create.UploadId,
+			PartNumber: aws.Int32(1),
+			Body:       bytes.NewReader(randomBytes(t, 100)),
+		})
+		require.NoError(t, err)
+		// Upload belongs to its key.
+		_, err = client.AbortMultipartUpload(ctx, &s3.AbortMultipartUploadInput{
+			Bucket:   aws.String("photos"),
+			Key:      aws.String("other.bin"),
+			UploadId: create.UploadId,
+		})
+		requireS3Error(t, err, "NoSuchUpload")
+		_, err = client.AbortMultipartUpload(ctx, &s3.AbortMultipartUploadInput{
+			Bucket:   aws.String("photos"),
+			Key:      aws.String("aborted.bin"),
+			UploadId: create.UploadId,
+		})
+		require.NoError(t, err)
+		_, err = stor.Upload(ctx, uuid.MustParse(aws.ToString(create.UploadId)))
+		require.ErrorAs(t, err, new(*UploadNotFoundErr))
+		_, err = stor.File(ctx, s3KeysPrefix+"photos/aborted.bin")
+		require.ErrorAs(t, err, new(*FileNotFoundErr))
+	})
+	t.Run("Auth", func(t *testing.T) {
+		_, err := newS3Client(s3Server, testAccessKey, "wrong").ListBuckets(ctx, &s3.ListBucketsInput{})
+		requireS3Error(t, err, "SignatureDoesNotMatch")
+		_, err = newS3Client(s3Server, "unknown", testSecretKey).ListBuckets(ctx, &s3.ListBucketsInput{})
+		requireS3Error(t, err, "InvalidAccessKeyId")
+
+		resp, err := s3Server.Client().Get(s3Server.URL + "/photos/big.bin")
+		require.NoError(t, err)
+		_ = resp.Body.Close()
+		require.Equal(t, http.StatusForbidden, resp.StatusCode)
+
+		presigned, err := s3.NewPresignClient(client).PresignGetObject(ctx, &s3.GetObjectInput{
+			Bucket: aws.String("photos"),
+			Key:    aws.String("big.bin"),
+		})
+		require.NoError(t, err)
+		resp, err = s3Server.Client().Get(presigned.URL)
+		require.NoError(t, err)
+		got, err := io.ReadAll(resp.Body)
+		require.NoError(t, err)
+		_ = resp.Body.Close()
+		require.Equal(t, http.StatusOK, resp.StatusCode)
+		require.Len(t, got, 2200)
+	})
+}
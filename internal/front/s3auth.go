@@ -0,0 +1,423 @@
+package front
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha1" // #nosec G505
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"hash"
+	"hash/crc32"
+	"io"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-faster/errors"
+)
+
+// Signature Version 4 constants.
+const (
+	sigV4Algorithm = "AWS4-HMAC-SHA256"
+	sigV4Service   = "s3"
+	sigV4Request   = "aws4_request"
+	sigV4Time      = "20060102T150405Z"
+	sigV4Date      = "20060102"
+	// Maximum difference between request time and server time.
+	sigV4MaxSkew = 15 * time.Minute
+	// Maximum expiration of presigned URL.
+	sigV4MaxExpires = 7 * 24 * time.Hour
+
+	unsignedPayload          = "UNSIGNED-PAYLOAD"
+	streamingUnsignedTrailer = "STREAMING-UNSIGNED-PAYLOAD-TRAILER"
+)
+
+// sigV4Credential is the credential scope of signature.
+type sigV4Credential struct {
+	AccessKey string
+	Date      string
+	Region    string
+	Service   string
+}
+
+func (c sigV4Credential) scope() string {
+	return strings.Join([]string{c.Date, c.Region, c.Service, sigV4Request}, "/")
+}
+
+func parseSigV4Credential(v string) (sigV4Credential, error) {
+	parts := strings.Split(v, "/")
+	if len(parts) != 5 || parts[4] != sigV4Request {
+		return sigV4Credential{}, errors.Errorf("invalid credential %q", v)
+	}
+	return sigV4Credential{
+		AccessKey: parts[0],
+		Date:      parts[1],
+		Region:    parts[2],
+		Service:   parts[3],
+	}, nil
+}
+
+// sigV4Signature is the signature of request, from Authorization header or
+// from query of presigned URL.
+type sigV4Signature struct {
+	Credential    sigV4Credential
+	SignedHeaders []string
+	Signature     string
+	Time          time.Time
+	// PayloadHash is hex SHA-256 of body, or one of special values.
+	PayloadHash string
+	// Presigned is true for signature from query.
+	Presigned bool
+}
+
+// parseSigV4 parses signature of request.
+func parseSigV4(r *http.Request) (*sigV4Signature, error) {
+	var (
+		sig       sigV4Signature
+		err       error
+		fields    = make(map[string]string)
+		timestamp string
+	)
+	if q := r.URL.Query(); q.Has("X-Amz-Algorithm") {
+		if q.Get("X-Amz-Algorithm") != sigV4Algorithm {
+			return nil, errors.Errorf("unsupported algorithm %q", q.Get("X-Amz-Algorithm"))
+		}
+		sig.Presigned = true
+		fields["Credential"] = q.Get("X-Amz-Credential")
+		fields["SignedHeaders"] = q.Get("X-Amz-SignedHeaders")
+		fields["Signature"] = q.Get("X-Amz-Signature")
+		timestamp = q.Get("X-Amz-Date")
+		sig.PayloadHash = unsignedPayload
+	} else {
+		algorithm, rest, _ := strings.Cut(r.Header.Get("Authorization"), " ")
+		if algorithm != sigV4Algorithm {
+			return nil, errors.Errorf("unsupported algorithm %q", algorithm)
+		}
+		for _, field := range strings.Split(rest, ",") {
+			k, v, _ := strings.Cut(strings.TrimSpace(field), "=")
+			fields[k] = v
+		}
+		timestamp = r.Header.Get("X-Amz-Date")
+		if sig.PayloadHash = r.Header.Get("X-Amz-Content-Sha256"); sig.PayloadHash == "" {
+			return nil, errors.New("x-amz-content-sha256 header is required")
+		}
+	}
+	if sig.Credential, err = parseSigV4Credential(fields["Credential"]); err != nil {
+		return nil, err
+	}
+	if fields["SignedHeaders"] == "" || fields["Signature"] == "" {
+		return nil, errors.New("signed headers and signature are required")
+	}
+	sig.SignedHeaders = strings.Split(fields["SignedHeaders"], ";")
+	sig.Signature = fields["Signature"]
+	if sig.Time, err = time.Parse(sigV4Time, timestamp); err != nil {
+		return nil, errors.Wrap(err, "parse date")
+	}
+	if sig.Time.Format(sigV4Date) != sig.Credential.Date {
+		return nil, errors.Errorf("credential date %q does not match request date", sig.Credential.Date)
+	}
+	return &sig, nil
+}
+
+// sigV4Escape escapes s as URI component of canonical request.
+func sigV4Escape(s string) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if 'A' <= c && c <= 'Z' || 'a' <= c && c <= 'z' || '0' <= c && c <= '9' ||
+			c == '-' || c == '.' || c == '_' || c == '~' {
+			b.WriteByte(c)
+			continue
+		}
+		b.WriteString("%" + strings.ToUpper(hex.EncodeToString([]byte{c})))
+	}
+	return b.String()
+}
+
+// canonicalQuery returns canonical query string of request, without
+// signature of presigned URL.
+func canonicalQuery(rawQuery string) string {
+	var params []string
+	for _, param := range strings.Split(rawQuery, "&") {
+		if param == "" {
+			continue
+		}
+		k, v, _ := strings.Cut(param, "=")
+		if dk, err := url.QueryUnescape(k); err == nil {
+			k = dk
+		}
+		if dv, err := url.QueryUnescape(v); err == nil {
+			v = dv
+		}
+		if k == "X-Amz-Signature" {
+			continue
+		}
+		params = append(params, sigV4Escape(k)+"="+sigV4Escape(v))
+	}
+	slices.Sort(params)
+	return strings.Join(params, "&")
+}
+
+// canonicalHeader returns canonical value of signed header.
+func canonicalHeader(r *http.Request, name string) string {
+	switch name {
+	case "host":
+		return r.Host
+	case "content-length":
+		if r.Header.Get("Content-Length") == "" {
+			return strconv.FormatInt(r.ContentLength, 10)
+		}
+	}
+	values := r.Header.Values(name)
+	for i, v := range values {
+		values[i] = strings.Join(strings.Fields(v), " ")
+	}
+	return strings.Join(values, ",")
+}
+
+// canonicalRequest returns canonical request that is signed by client.
+func (sig *sigV4Signature) canonicalRequest(r *http.Request) string {
+	// S3 paths are not normalized, so path is taken as sent.
+	path, rawQuery, _ := strings.Cut(r.RequestURI, "?")
+	if path == "" || strings.Contains(path, "://") {
+		path = r.URL.EscapedPath()
+		rawQuery = r.URL.RawQuery
+	}
+	var b strings.Builder
+	b.WriteString(r.Method + "\n")
+	b.WriteString(path + "\n")
+	b.WriteString(canonicalQuery(rawQuery) + "\n")
+	for _, name := range sig.SignedHeaders {
+		b.WriteString(name + ":" + canonicalHeader(r, name) + "\n")
+	}
+	b.WriteString("\n")
+	b.WriteString(strings.Join(sig.SignedHeaders, ";") + "\n")
+	b.WriteString(sig.PayloadHash)
+	return b.String()
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	h := hmac.New(sha256.New, key)
+	_, _ = h.Write([]byte(data))
+	return h.Sum(nil)
+}
+
+// sign returns signature of canonical request with secret key.
+func (sig *sigV4Signature) sign(secretKey, canonicalRequest string) string {
+	requestHash := sha256.Sum256([]byte(canonicalRequest))
+	stringToSign := strings.Join([]string{
+		sigV4Algorithm,
+		sig.Time.Format(sigV4Time),
+		sig.Credential.scope(),
+		hex.EncodeToString(requestHash[:]),
+	}, "\n")
+	key := hmacSHA256([]byte("AWS4"+secretKey), sig.Credential.Date)
+	key = hmacSHA256(key, sig.Credential.Region)
+	key = hmacSHA256(key, sig.Credential.Service)
+	key = hmacSHA256(key, sigV4Request)
+	return hex.EncodeToString(hmacSHA256(key, stringToSign))
+}
+
+// authenticate verifies Signature Version 4 of request and returns it.
+func (s *S3) authenticate(r *http.Request) (*sigV4Signature, error) {
+	if r.Header.Get("Authorization") == "" && !r.URL.Query().Has("X-Amz-Algorithm") {
+		return nil, s3Err(http.StatusForbidden, "AccessDenied", "anonymous access is not allowed")
+	}
+	sig, err := parseSigV4(r)
+	if err != nil {
+		return nil, s3Err(http.StatusBadRequest, "AuthorizationHeaderMalformed", err.Error())
+	}
+	if sig.Credential.Region != s.region || sig.Credential.Service != sigV4Service {
+		return nil, s3Err(http.StatusBadRequest, "AuthorizationHeaderMalformed",
+			"credential scope must be "+s.region+"/"+sigV4Service)
+	}
+	secretKey, ok := s.credentials[sig.Credential.AccessKey]
+	if !ok {
+		return nil, s3Err(http.StatusForbidden, "InvalidAccessKeyId", "access key does not exist")
+	}
+	now := s.h.now()
+	if sig.Presigned {
+		expires, err := strconv.Atoi(r.URL.Query().Get("X-Amz-Expires"))
+		if err != nil || expires < 0 || time.Duration(expires)*time.Second > sigV4MaxExpires {
+			return nil, s3Err(http.StatusBadRequest, "AuthorizationQueryParametersError", "invalid X-Amz-Expires")
+		}
+		if now.After(sig.Time.Add(time.Duration(expires) * time.Second)) {
+			return nil, s3Err(http.StatusForbidden, "AccessDenied", "request has expired")
+		}
+	} else if d := now.Sub(sig.Time); d > sigV4MaxSkew || d < -sigV4MaxSkew {
+		return nil, s3Err(http.StatusForbidden, "RequestTimeTooSkewed", "request time is too far from server time")
+	}
+	want := sig.sign(secretKey, sig.canonicalRequest(r))
+	if !hmac.Equal([]byte(want), []byte(sig.Signature)) {
+		return nil, s3Err(http.StatusForbidden, "SignatureDoesNotMatch", "signature does not match")
+	}
+	return sig, nil
+}
+
+// s3Checksums are flexible checksum algorithms of S3 clients by header.
+var s3Checksums = map[string]func() hash.Hash{
+	"x-amz-checksum-crc32":  func() hash.Hash { return crc32.NewIEEE() },
+	"x-amz-checksum-crc32c": func() hash.Hash { return crc32.New(crc32.MakeTable(crc32.Castagnoli)) },
+	"x-amz-checksum-sha1":   sha1.New,
+	"x-amz-checksum-sha256": sha256.New,
+}
+
+// body returns request body that is verified against payload hash and
+// checksum of request, if any, at the end of it.
+func (sig *sigV4Signature) body(r *http.Request) (io.Reader, error) {
+	var (
+		body    io.Reader = r.Body
+		trailer http.Header
+	)
+	switch hash := sig.PayloadHash; {
+	case hash == unsignedPayload:
+	case hash == streamingUnsignedTrailer:
+		chunked := newAWSChunkedReader(r.Body)
+		body, trailer = chunked, chunked.trailer
+	case strings.HasPrefix(hash, "STREAMING-"):
+		return nil, s3Err(http.StatusNotImplemented, "NotImplemented", "payload signing mode is not supported")
+	default:
+		sum, err := hex.DecodeString(hash)
+		if err != nil || len(sum) != sha256.Size {
+			return nil, s3Err(http.StatusBadRequest, "InvalidArgument", "invalid x-amz-content-sha256")
+		}
+		body = &verifyingReader{
+			r:        body,
+			hash:     sha256.New(),
+			expected: func() []byte { return sum },
+			err: s3Err(http.StatusBadRequest, "XAmzContentSHA256Mismatch",
+				"payload does not match x-amz-content-sha256"),
+		}
+	}
+
+	for name, newHash := range s3Checksums {
+		var expected func() []byte
+		switch {
+		case r.Header.Get(name) != "":
+			expected = func() []byte {
+				v, _ := base64.StdEncoding.DecodeString(r.Header.Get(name))
+				return v
+			}
+		case trailer != nil && strings.EqualFold(r.Header.Get("X-Amz-Trailer"), name):
+			expected = func() []byte {
+				v, _ := base64.StdEncoding.DecodeString(trailer.Get(name))
+				return v
+			}
+		default:
+			continue
+		}
+		body = &verifyingReader{
+			r:        body,
+			hash:     newHash(),
+			expected: expected,
+			err:      s3Err(http.StatusBadRequest, "BadDigest", "payload does not match "+name),
+		}
+	}
+	return body, nil
+}
+
+// verifyingReader returns err at the end of data if its digest does not
+// match expected one.
+type verifyingReader struct {
+	r        io.Reader
+	hash     hash.Hash
+	expected func() []byte
+	err      error
+}
+
+func (v *verifyingReader) Read(p []byte) (int, error) {
+	n, err := v.r.Read(p)
+	_, _ = v.hash.Write(p[:n])
+	if errors.Is(err, io.EOF) && !bytes.Equal(v.expected(), v.hash.Sum(nil)) {
+		return n, v.err
+	}
+	return n, err
+}
+
+// awsChunkedReader decodes aws-chunked content encoding of streaming
+// uploads, collecting trailing headers. Chunk signatures are ignored.
+type awsChunkedReader struct {
+	r       *bufio.Reader
+	left    int64
+	done    bool
+	trailer http.Header
+}
+
+func newAWSChunkedReader(r io.Reader) *awsChunkedReader {
+	return &awsChunkedReader{
+		r:       bufio.NewReader(r),
+		trailer: make(http.Header),
+	}
+}
+
+// line reads line without CRLF.
+func (c *awsChunkedReader) line() (string, error) {
+	line, err := c.r.ReadSlice('\n')
+	if err != nil {
+		if errors.Is(err, io.EOF) {
+			err = io.ErrUnexpectedEOF
+		}
+		return "", errors.Wrap(err, "read line")
+	}
+	return strings.TrimRight(string(line), "\r\n"), nil
+}
+
+// next starts the next chunk, reading trailer after the last one.
+func (c *awsChunkedReader) next() error {
+	line, err := c.line()
+	if err != nil {
+		return err
+	}
+	size, _, _ := strings.Cut(line, ";")
+	n, err := strconv.ParseInt(size, 16, 64)
+	if err != nil || n < 0 {
+		return errors.Errorf("invalid chunk size %q", size)
+	}
+	if n > 0 {
+		c.left = n
+		return nil
+	}
+	for {
+		line, err := c.line()
+		if err != nil {
+			return err
+		}
+		if line == "" {
+			c.done = true
+			return nil
+		}
+		k, v, _ := strings.Cut(line, ":")
+		c.trailer.Add(k, strings.TrimSpace(v))
+	}
+}
+
+func (c *awsChunkedReader) Read(p []byte) (int, error) {
+	if c.left == 0 && !c.done {
+		if err := c.next(); err != nil {
+			return 0, err
+		}
+	}
+	if c.done {
+		return 0, io.EOF
+	}
+	n, err := c.r.Read(p[:min(int64(len(p)), c.left)])
+	c.left -= int64(n)
+	if errors.Is(err, io.EOF) {
+		return n, io.ErrUnexpectedEOF
+	}
+	if err != nil {
+		return n, err
+	}
+	if c.left == 0 {
+		// Chunk data is followed by CRLF.
+		if line, err := c.line(); err != nil || line != "" {
+			return n, errors.New("invalid chunk end")
+		}
+	}
+	return n, nil
+}
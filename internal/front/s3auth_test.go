@@ -0,0 +1,109 @@
+package front
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/xml"
+	"hash/crc32"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	v4 "github.com/aws/aws-sdk-go-v2/aws/signer/v4"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAWSChunkedReader(t *testing.T) {
+	crc := crc32.ChecksumIEEE([]byte("hello world"))
+	trailer := base64.StdEncoding.EncodeToString([]byte{byte(crc >> 24), byte(crc >> 16), byte(crc >> 8), byte(crc)})
+	body := "5\r\nhello\r\n6;chunk-signature=abc\r\n world\r\n0\r\nx-amz-checksum-crc32:" + trailer + "\r\n\r\n"
+
+	r := newAWSChunkedReader(strings.NewReader(body))
+	data, err := io.ReadAll(r)
+	require.NoError(t, err)
+	require.Equal(t, "hello world", string(data))
+	require.Equal(t, trailer, r.trailer.Get("x-amz-checksum-crc32"))
+
+	for _, body := range []string{
+		"5\r\nhel",
+		"5\r\nhello\r\n",
+		"5\r\nhelloXX6\r\n world\r\n0\r\n\r\n",
+		"x\r\nhello\r\n0\r\n\r\n",
+	} {
+		_, err := io.ReadAll(newAWSChunkedReader(strings.NewReader(body)))
+		require.Error(t, err, "%q", body)
+	}
+}
+
+func TestS3Payload(t *testing.T) {
+	ctx := context.Background()
+	stor, gateway := newTestS3(t)
+	server := httptest.NewServer(gateway)
+	t.Cleanup(server.Close)
+	require.NoError(t, stor.AddBucket(ctx, Bucket{Name: "bucket"}))
+
+	// put signs PUT request of object with payload hash and sends it.
+	put := func(t *testing.T, key, body, payloadHash string, header http.Header, signedAt time.Time) *http.Response {
+		t.Helper()
+		req, err := http.NewRequest(http.MethodPut, server.URL+"/bucket/"+key, strings.NewReader(body))
+		require.NoError(t, err)
+		for k, v := range header {
+			req.Header[k] = v
+		}
+		req.Header.Set("X-Amz-Content-Sha256", payloadHash)
+		require.NoError(t, v4.NewSigner().SignHTTP(ctx, aws.Credentials{
+			AccessKeyID:     testAccessKey,
+			SecretAccessKey: testSecretKey,
+		}, req, payloadHash, "s3", "us-east-1", signedAt))
+		resp, err := server.Client().Do(req)
+		require.NoError(t, err)
+		t.Cleanup(func() { _ = resp.Body.Close() })
+		return resp
+	}
+	// requireCode checks that response is S3 error with code.
+	requireCode := func(t *testing.T, resp *http.Response, status int, code string) {
+		t.Helper()
+		require.Equal(t, status, resp.StatusCode)
+		var e s3ErrorResponse
+		require.NoError(t, xml.NewDecoder(resp.Body).Decode(&e))
+		require.Equal(t, code, e.Code)
+	}
+	sum := sha256.Sum256([]byte("content"))
+	payloadHash := hex.EncodeToString(sum[:])
+
+	t.Run("Signed", func(t *testing.T) {
+		resp := put(t, "signed.txt", "content", payloadHash, nil, time.Now())
+		require.Equal(t, http.StatusOK, resp.StatusCode)
+		file, err := stor.File(ctx, s3KeysPrefix+"bucket/signed.txt")
+		require.NoError(t, err)
+		require.Equal(t, sum[:], file.Checksum)
+	})
+	t.Run("Mismatch", func(t *testing.T) {
+		resp := put(t, "tampered.txt", "tampered", payloadHash, nil, time.Now())
+		requireCode(t, resp, http.StatusBadRequest, "XAmzContentSHA256Mismatch")
+		_, err := stor.File(ctx, s3KeysPrefix+"bucket/tampered.txt")
+		require.ErrorAs(t, err, new(*FileNotFoundErr))
+	})
+	t.Run("BadDigest", func(t *testing.T) {
+		resp := put(t, "crc.txt", "content", unsignedPayload, http.Header{
+			"X-Amz-Checksum-Crc32": {"AAAAAA=="},
+		}, time.Now())
+		requireCode(t, resp, http.StatusBadRequest, "BadDigest")
+		_, err := stor.File(ctx, s3KeysPrefix+"bucket/crc.txt")
+		require.ErrorAs(t, err, new(*FileNotFoundErr))
+	})
+	t.Run("Skew", func(t *testing.T) {
+		resp := put(t, "old.txt", "content", payloadHash, nil, time.Now().Add(-time.Hour))
+		requireCode(t, resp, http.StatusForbidden, "RequestTimeTooSkewed")
+	})
+	t.Run("SignedStreaming", func(t *testing.T) {
+		resp := put(t, "stream.txt", "content", "STREAMING-AWS4-HMAC-SHA256-PAYLOAD", nil, time.Now())
+		requireCode(t, resp, http.StatusNotImplemented, "NotImplemented")
+	})
+}
@@ -2,8 +2,11 @@ package front
 
 import (
 	"context"
+	"fmt"
+	"maps"
 	"path"
 	"slices"
+	"time"
 
 	"github.com/go-faster/errors"
 	"github.com/google/uuid"
@@ -13,6 +16,8 @@ import (
 	"github.com/ydb-platform/ydb-go-sdk/v3/table/options"
 	"github.com/ydb-platform/ydb-go-sdk/v3/table/types"
 	"go.opentelemetry.io/otel/trace"
+
+	"github.com/ernado/stor/internal/node"
 )
 
 var _ HandlerStorage = (*YDBStorage)(nil)
@@ -41,14 +46,18 @@ func (y YDBStorage) NodeStats(ctx context.Context) ([]NodeStat, error) {
 	stats := make(map[string]NodeStat)
 	for _, node := range nodes {
 		stats[node.BaseURL] = NodeStat{
-			BaseURL: node.BaseURL,
+			BaseURL:  node.BaseURL,
+			LastSeen: node.LastSeen,
+			Status:   node.Status,
+			Draining: node.Draining,
+			Topology: node.Topology,
 		}
 	}
 
 	if err := y.db.Query().Do(ctx,
 		func(ctx context.Context, s query.Session) error {
 			res, err := s.Query(ctx,
-				`SELECT node, count(1) as total_count, sum(size) as total_size FROM chunks GROUP BY node ORDER BY total_size DESC;`,
+				`SELECT node, count(1) as total_count, sum(size) as total_size FROM replicas GROUP BY node ORDER BY total_size DESC;`,
 			)
 			for rs, err := range res.ResultSets(ctx) {
 				if err != nil {
@@ -66,11 +75,11 @@ func (y YDBStorage) NodeStats(ctx context.Context) ([]NodeStat, error) {
 					if err := row.ScanStruct(&v); err != nil {
 						return errors.Wrap(err, "scan")
 					}
-					stats[v.Node] = NodeStat{
-						BaseURL:     v.Node,
-						TotalChunks: int(v.Count),
-						TotalSize:   int64(v.Size),
-					}
+					stat := stats[v.Node]
+					stat.BaseURL = v.Node
+					stat.TotalChunks = int(v.Count)
+					stat.TotalSize = int64(v.Size)
+					stats[v.Node] = stat
 				}
 			}
 			if err != nil {
@@ -97,46 +106,72 @@ func (y YDBStorage) RemoveFile(ctx context.Context, name string) error {
 	ctx, span := y.tracer.Start(ctx, "meta.RemoveFile")
 	defer span.End()
 
-	if err := y.db.Table().DoTx(ctx,
-		func(ctx context.Context, tx table.TransactionActor) (err error) {
-			res, err := tx.Execute(ctx, `DECLARE $fileName AS UTF8;
-			DELETE FROM files
+	if err := y.db.Query().DoTx(ctx,
+		func(ctx context.Context, tx query.TxActor) (err error) {
+			// File with its noncurrent versions.
+			prefix := versionKeyPrefix(name)
+			res, err := tx.Query(ctx, `DECLARE $fileName AS UTF8;
+			DECLARE $from AS UTF8;
+			DECLARE $end AS UTF8;
+			SELECT
+			  name
+			FROM
+			  files
 			WHERE
-			  name = $fileName;`,
-				table.NewQueryParameters(
-					table.ValueParam("$fileName", types.UTF8Value(name)),
+			  name = $fileName OR (name >= $from AND name < $end);`,
+				query.WithParameters(
+					table.NewQueryParameters(
+						table.ValueParam("$fileName", types.UTF8Value(name)),
+						table.ValueParam("$from", types.UTF8Value(prefix)),
+						table.ValueParam("$end", types.UTF8Value(prefixEnd(prefix))),
+					),
 				),
 			)
 			if err != nil {
-				return errors.Wrap(err, "execute")
+				return errors.Wrap(err, "query file")
 			}
-			if err = res.Err(); err != nil {
-				return errors.Wrap(err, "result")
+			var (
+				files  = make(map[string][]Chunk)
+				names  []types.Value
+				exists bool
+			)
+			for rs, err := range res.ResultSets(ctx) {
+				if err != nil {
+					return errors.Wrap(err, "result set")
+				}
+				for row, err := range rs.Rows(ctx) {
+					if err != nil {
+						return errors.Wrap(err, "row")
+					}
+					var v string
+					if err := row.Scan(&v); err != nil {
+						return errors.Wrap(err, "scan")
+					}
+					exists = exists || v == name
+					files[v] = nil
+					names = append(names, types.UTF8Value(v))
+				}
 			}
-			if err := res.Close(); err != nil {
-				return errors.Wrap(err, "close")
+			if !exists {
+				return &FileNotFoundErr{File: name}
 			}
-
-			res, err = tx.Execute(ctx, `DECLARE $fileName AS UTF8;
-			DELETE FROM chunks
+			if err := replaceChunks(ctx, tx, files); err != nil {
+				return errors.Wrap(err, "replace chunks")
+			}
+			if err := tx.Exec(ctx, `DECLARE $names AS List<UTF8>;
+			DELETE FROM files
 			WHERE
-			  file = $fileName;`,
-				table.NewQueryParameters(
-					table.ValueParam("$fileName", types.UTF8Value(name)),
+			  name IN $names;`,
+				query.WithParameters(
+					table.NewQueryParameters(
+						table.ValueParam("$names", types.ListValue(names...)),
+					),
 				),
-			)
-			if err != nil {
-				return errors.Wrap(err, "execute")
-			}
-			if err = res.Err(); err != nil {
-				return errors.Wrap(err, "result")
-			}
-			if err := res.Close(); err != nil {
-				return errors.Wrap(err, "close")
+			); err != nil {
+				return errors.Wrap(err, "delete file")
 			}
-
 			return nil
-		}, table.WithIdempotent(),
+		}, query.WithIdempotent(),
 	); err != nil {
 		return errors.Wrap(err, "delete file")
 	}
@@ -144,89 +179,299 @@ func (y YDBStorage) RemoveFile(ctx context.Context, name string) error {
 	return nil
 }
 
-func (y YDBStorage) CreateTables(ctx context.Context) error {
-	ctx, span := y.tracer.Start(ctx, "meta.CreateTables")
-	defer span.End()
-
-	if err := y.db.Table().Do(ctx,
-		func(ctx context.Context, s table.Session) (err error) {
-			return s.CreateTable(ctx, path.Join(y.db.Name(), "files"),
-				options.WithColumn("name", types.TypeUTF8),
-				options.WithColumn("size", types.TypeUint64),
-				options.WithPrimaryKeyColumn("name"),
-			)
-		},
-	); err != nil {
-		return errors.Wrap(err, "create files table")
+// replaceChunks replaces chunks of every file in transaction with chunks
+// from files, which maps file name to its new chunks, and counts references
+// of files to every chunk.
+//
+// Replicas of chunks that are no longer referenced by any file are moved
+// to garbage.
+func replaceChunks(ctx context.Context, tx query.TxActor, files map[string][]Chunk) error {
+	names := slices.Sorted(maps.Keys(files))
+	// Reads should be done before writes in transaction.
+	var (
+		oldRefs = make(map[uuid.UUID]uint64)
+		delta   = make(map[uuid.UUID]int64)
+		ids     []uuid.UUID
+	)
+	for _, name := range names {
+		old, err := txFileChunkIDs(ctx, tx, name)
+		if err != nil {
+			return errors.Wrap(err, "file chunks")
+		}
+		for _, id := range old {
+			if _, ok := delta[id]; !ok {
+				ids = append(ids, id)
+			}
+			oldRefs[id]++
+			delta[id]--
+		}
 	}
-	if err := y.db.Table().Do(ctx,
-		func(ctx context.Context, s table.Session) (err error) {
-			return s.CreateTable(ctx, path.Join(y.db.Name(), "chunks"),
-				options.WithColumn("file", types.TypeUTF8),
-				options.WithColumn("index", types.TypeUint64),
-				options.WithColumn("id", types.TypeUUID),
-				options.WithColumn("offset", types.TypeUint64),
-				options.WithColumn("size", types.TypeUint64),
-				options.WithColumn("node", types.TypeUTF8),
-				options.WithPrimaryKeyColumn("file", "index"),
-			)
-		},
-	); err != nil {
-		return errors.Wrap(err, "create chunks table")
+	for _, name := range names {
+		for _, chunk := range files[name] {
+			if _, ok := delta[chunk.ID]; !ok {
+				ids = append(ids, chunk.ID)
+			}
+			delta[chunk.ID]++
+		}
 	}
-	if err := y.db.Table().Do(ctx,
-		func(ctx context.Context, s table.Session) (err error) {
-			return s.CreateTable(ctx, path.Join(y.db.Name(), "nodes"),
-				options.WithColumn("base_url", types.TypeUTF8),
-				options.WithPrimaryKeyColumn("base_url"),
-			)
-		},
-	); err != nil {
-		return errors.Wrap(err, "create nodes table")
+	refs, err := txChunkRefs(ctx, tx, ids)
+	if err != nil {
+		return errors.Wrap(err, "chunk refs")
 	}
-	return nil
-}
 
-type FileNotFoundErr struct {
-	File string
+	for _, name := range names {
+		if err := txWriteChunks(ctx, tx, name, files[name], refs, oldRefs); err != nil {
+			return errors.Wrap(err, "write chunks")
+		}
+	}
+
+	for _, id := range ids {
+		n, ok := refs[id]
+		if !ok {
+			// Chunks that were uploaded before reference counting are
+			// referenced only by this file.
+			n = oldRefs[id]
+		}
+		if delta[id] == 0 && ok {
+			continue
+		}
+		if n := int64(n) + delta[id]; n > 0 {
+			if err := tx.Exec(ctx, `
+		  DECLARE $id AS UUID;
+		  DECLARE $refs AS UInt64;
+		  UPSERT INTO chunk_refs ( id, refs )
+		  VALUES ( $id, $refs );
+		`,
+				query.WithParameters(
+					table.NewQueryParameters(
+						table.ValueParam("$id", types.UuidValue(id)),
+						table.ValueParam("$refs", types.Uint64Value(uint64(n))),
+					),
+				),
+			); err != nil {
+				return errors.Wrap(err, "upsert refs")
+			}
+			continue
+		}
+		if err := tx.Exec(ctx, `
+		  DECLARE $id AS UUID;
+		  DELETE FROM chunk_refs
+		  WHERE
+		    id = $id;
+		  UPSERT INTO garbage ( id, node, released_at )
+		  SELECT
+		    id,
+		    node,
+		    CurrentUtcTimestamp() AS released_at
+		  FROM
+		    replicas
+		  WHERE
+		    id = $id;
+		  DELETE FROM replicas
+		  WHERE
+		    id = $id;
+		`,
+			query.WithParameters(
+				table.NewQueryParameters(
+					table.ValueParam("$id", types.UuidValue(id)),
+				),
+			),
+		); err != nil {
+			return errors.Wrap(err, "release chunk")
+		}
+	}
+
+	return nil
 }
 
-func (e *FileNotFoundErr) Error() string {
-	return "file not found: " + e.File
+// txWriteChunks replaces chunk rows of file in transaction, recording
+// replicas of chunks that were not referenced before.
+func txWriteChunks(ctx context.Context, tx query.TxActor, name string, chunks []Chunk, refs, oldRefs map[uuid.UUID]uint64) error {
+	if err := tx.Exec(ctx, `DECLARE $fileName AS UTF8;
+			DELETE FROM chunks
+			WHERE
+			  file = $fileName;`,
+		query.WithParameters(
+			table.NewQueryParameters(
+				table.ValueParam("$fileName", types.UTF8Value(name)),
+			),
+		),
+	); err != nil {
+		return errors.Wrap(err, "delete chunks")
+	}
+	for _, chunk := range chunks {
+		if err := tx.Exec(ctx, `
+		  DECLARE $file AS UTF8;
+		  DECLARE $index AS UInt64;
+		  DECLARE $id AS UUID;
+		  DECLARE $offset AS UInt64;
+		  DECLARE $size AS UInt64;
+		  DECLARE $checksum AS String;
+		  UPSERT INTO chunks ( file, index, id, offset, size, checksum )
+		  VALUES ( $file, $index, $id, $offset, $size, $checksum );
+		`,
+			query.WithParameters(
+				table.NewQueryParameters(
+					table.ValueParam("$file", types.UTF8Value(name)),
+					table.ValueParam("$index", types.Uint64Value(uint64(chunk.Index))),
+					table.ValueParam("$id", types.UuidValue(chunk.ID)),
+					table.ValueParam("$offset", types.Uint64Value(uint64(chunk.Offset))),
+					table.ValueParam("$size", types.Uint64Value(uint64(chunk.Size))),
+					table.ValueParam("$checksum", types.BytesValue(chunk.Checksum)),
+				),
+			),
+		); err != nil {
+			return errors.Wrap(err, "upsert chunk")
+		}
+		if _, ok := refs[chunk.ID]; ok || oldRefs[chunk.ID] > 0 {
+			// Replicas of referenced chunk are already recorded and can be
+			// changed by repair or rebalance since upload has read them.
+			continue
+		}
+		for _, node := range chunk.Nodes {
+			// Chunk with the same content can be in garbage.
+			if err := tx.Exec(ctx, `
+		  DECLARE $id AS UUID;
+		  DECLARE $node AS UTF8;
+		  DECLARE $size AS UInt64;
+		  UPSERT INTO replicas ( id, node, size )
+		  VALUES ( $id, $node, $size );
+		  DELETE FROM garbage
+		  WHERE
+		    id = $id AND node = $node;
+		`,
+				query.WithParameters(
+					table.NewQueryParameters(
+						table.ValueParam("$id", types.UuidValue(chunk.ID)),
+						table.ValueParam("$node", types.UTF8Value(node)),
+						table.ValueParam("$size", types.Uint64Value(uint64(chunk.Size))),
+					),
+				),
+			); err != nil {
+				return errors.Wrap(err, "upsert replica")
+			}
+		}
+	}
+	return nil
 }
 
-type ChunksNotFound struct {
-	File string
+// txFileChunkIDs returns IDs of file chunks in transaction.
+func txFileChunkIDs(ctx context.Context, tx query.TxActor, name string) ([]uuid.UUID, error) {
+	res, err := tx.Query(ctx,
+		`DECLARE $fileName AS UTF8;
+			SELECT
+			  id
+			FROM
+			  chunks
+			WHERE
+			  file = $fileName;`,
+		query.WithParameters(
+			table.NewQueryParameters(
+				table.ValueParam("$fileName", types.UTF8Value(name)),
+			),
+		),
+	)
+	if err != nil {
+		return nil, errors.Wrap(err, "query")
+	}
+	var ids []uuid.UUID
+	for rs, err := range res.ResultSets(ctx) {
+		if err != nil {
+			return nil, errors.Wrap(err, "result set")
+		}
+		for row, err := range rs.Rows(ctx) {
+			if err != nil {
+				return nil, errors.Wrap(err, "row")
+			}
+			var v struct {
+				ID uuid.UUID `sql:"id"`
+			}
+			if err := row.ScanStruct(&v); err != nil {
+				return nil, errors.Wrap(err, "scan")
+			}
+			ids = append(ids, v.ID)
+		}
+	}
+	return ids, nil
 }
 
-func (e *ChunksNotFound) Error() string {
-	return "chunks not found: " + e.File
+// txChunkRefs returns reference counts of chunks that have them in
+// transaction.
+func txChunkRefs(ctx context.Context, tx query.TxActor, ids []uuid.UUID) (map[uuid.UUID]uint64, error) {
+	refs := make(map[uuid.UUID]uint64)
+	if len(ids) == 0 {
+		return refs, nil
+	}
+	values := make([]types.Value, len(ids))
+	for i, id := range ids {
+		values[i] = types.UuidValue(id)
+	}
+	res, err := tx.Query(ctx,
+		`DECLARE $ids AS List<UUID>;
+			SELECT
+			  id,
+			  refs
+			FROM
+			  chunk_refs
+			WHERE
+			  id IN $ids;`,
+		query.WithParameters(
+			table.NewQueryParameters(
+				table.ValueParam("$ids", types.ListValue(values...)),
+			),
+		),
+	)
+	if err != nil {
+		return nil, errors.Wrap(err, "query")
+	}
+	for rs, err := range res.ResultSets(ctx) {
+		if err != nil {
+			return nil, errors.Wrap(err, "result set")
+		}
+		for row, err := range rs.Rows(ctx) {
+			if err != nil {
+				return nil, errors.Wrap(err, "row")
+			}
+			var v struct {
+				ID   uuid.UUID `sql:"id"`
+				Refs uint64    `sql:"refs"`
+			}
+			if err := row.ScanStruct(&v); err != nil {
+				return nil, errors.Wrap(err, "scan")
+			}
+			refs[v.ID] = v.Refs
+		}
+	}
+	return refs, nil
 }
 
-func (y YDBStorage) File(ctx context.Context, name string) (*File, error) {
-	ctx, span := y.tracer.Start(ctx, "meta.File")
+func (y YDBStorage) ChunkReplicas(ctx context.Context, id uuid.UUID) ([]string, error) {
+	ctx, span := y.tracer.Start(ctx, "meta.ChunkReplicas")
 	defer span.End()
 
-	// Fetch file from YDB.
-	var file File
+	var nodes []string
 	if err := y.db.Query().Do(ctx,
 		func(ctx context.Context, s query.Session) error {
+			nodes = nodes[:0]
 			res, err := s.Query(ctx,
-				`DECLARE $fileName AS UTF8;
+				`DECLARE $id AS UUID;
 			SELECT
-			  name,
-			  size,
+			  node
 			FROM
-			  files
+			  replicas
 			WHERE
-			  name = $fileName;`,
+			  id = $id
+			ORDER BY
+			  node;`,
 				query.WithParameters(
 					table.NewQueryParameters(
-						table.ValueParam("$fileName", types.UTF8Value(name)),
+						table.ValueParam("$id", types.UuidValue(id)),
 					),
 				),
 			)
-
+			if err != nil {
+				return errors.Wrap(err, "query")
+			}
 			for rs, err := range res.ResultSets(ctx) {
 				if err != nil {
 					return errors.Wrap(err, "result set")
@@ -236,50 +481,57 @@ func (y YDBStorage) File(ctx context.Context, name string) (*File, error) {
 						return errors.Wrap(err, "row")
 					}
 					var v struct {
-						Name string `sql:"name"`
-						Size uint64 `sql:"size"`
+						Node string `sql:"node"`
 					}
 					if err := row.ScanStruct(&v); err != nil {
 						return errors.Wrap(err, "scan")
 					}
-					file.Name = v.Name
-					file.Size = int64(v.Size)
+					nodes = append(nodes, v.Node)
 				}
 			}
-			if err != nil {
-				return errors.Wrap(err, "query")
-			}
 			return nil
 		},
 	); err != nil {
-		return nil, errors.Wrap(err, "query")
+		return nil, errors.Wrap(err, "do")
 	}
 
-	if file.Name == "" {
-		return nil, &FileNotFoundErr{File: name}
-	}
+	return nodes, nil
+}
+
+func (y YDBStorage) RecordedChunks(ctx context.Context, baseURL string, ids []uuid.UUID) ([]uuid.UUID, error) {
+	ctx, span := y.tracer.Start(ctx, "meta.RecordedChunks")
+	defer span.End()
 
+	if len(ids) == 0 {
+		return nil, nil
+	}
+	values := make([]types.Value, len(ids))
+	for i, id := range ids {
+		values[i] = types.UuidValue(id)
+	}
+	var recorded []uuid.UUID
 	if err := y.db.Query().Do(ctx,
 		func(ctx context.Context, s query.Session) error {
+			recorded = recorded[:0]
 			res, err := s.Query(ctx,
-				`DECLARE $fileName AS UTF8;
+				`DECLARE $node AS UTF8;
+			DECLARE $ids AS List<UUID>;
 			SELECT
-			  index,
-              id,
-			  offset,
-			  size,
-			  node
+			  id
 			FROM
-			  chunks
+			  replicas
 			WHERE
-			  file = $fileName;`,
+			  node = $node AND id IN $ids;`,
 				query.WithParameters(
 					table.NewQueryParameters(
-						table.ValueParam("$fileName", types.UTF8Value(name)),
+						table.ValueParam("$node", types.UTF8Value(baseURL)),
+						table.ValueParam("$ids", types.ListValue(values...)),
 					),
 				),
 			)
-
+			if err != nil {
+				return errors.Wrap(err, "query")
+			}
 			for rs, err := range res.ResultSets(ctx) {
 				if err != nil {
 					return errors.Wrap(err, "result set")
@@ -289,85 +541,98 @@ func (y YDBStorage) File(ctx context.Context, name string) (*File, error) {
 						return errors.Wrap(err, "row")
 					}
 					var v struct {
-						Index  uint64    `sql:"index"`
-						ID     uuid.UUID `sql:"id"`
-						Offset uint64    `sql:"offset"`
-						Size   uint64    `sql:"size"`
-						Node   string    `sql:"node"`
+						ID uuid.UUID `sql:"id"`
 					}
 					if err := row.ScanStruct(&v); err != nil {
 						return errors.Wrap(err, "scan")
 					}
-					file.Chunks = append(file.Chunks, Chunk{
-						Index:       int(v.Index),
-						ID:          v.ID,
-						Offset:      int64(v.Offset),
-						Size:        int64(v.Size),
-						NodeBaseURL: v.Node,
-					})
+					recorded = append(recorded, v.ID)
 				}
 			}
-			if err != nil {
-				return errors.Wrap(err, "query")
-			}
 			return nil
 		},
 	); err != nil {
 		return nil, errors.Wrap(err, "do")
 	}
-	if len(file.Chunks) == 0 {
-		return nil, &ChunksNotFound{File: name}
-	}
 
-	return &file, nil
+	return recorded, nil
 }
 
-func (y YDBStorage) AddFile(ctx context.Context, file File) error {
-	ctx, span := y.tracer.Start(ctx, "meta.AddFile")
+func (y YDBStorage) RecordedRange(ctx context.Context, baseURL string, after, last uuid.UUID) ([]uuid.UUID, error) {
+	ctx, span := y.tracer.Start(ctx, "meta.RecordedRange")
 	defer span.End()
 
-	if err := y.db.Table().DoTx( // Do retry operation on errors with best effort
-		ctx, // context manages exiting from Do
-		func(ctx context.Context, tx table.TransactionActor) (err error) { // retry operation
-			res, err := tx.Execute(ctx, `
-          DECLARE $name AS UTF8;
-          DECLARE $size AS UInt64;
-          UPSERT INTO files ( name, size )
-          VALUES ( $name, $size );
-        `,
-				table.NewQueryParameters(
-					table.ValueParam("$name", types.UTF8Value(file.Name)),
-					table.ValueParam("$size", types.Uint64Value(uint64(file.Size))),
+	var recorded []uuid.UUID
+	if err := y.db.Query().Do(ctx,
+		func(ctx context.Context, s query.Session) error {
+			recorded = recorded[:0]
+			// IDs are compared as strings, as node inventory is ordered by
+			// names of chunk files.
+			res, err := s.Query(ctx,
+				`DECLARE $node AS UTF8;
+			DECLARE $after AS UTF8;
+			DECLARE $last AS UTF8;
+			SELECT
+			  id
+			FROM
+			  replicas
+			WHERE
+			  node = $node
+			  AND CAST(id AS Utf8) > $after
+			  AND CAST(id AS Utf8) <= $last;`,
+				query.WithParameters(
+					table.NewQueryParameters(
+						table.ValueParam("$node", types.UTF8Value(baseURL)),
+						table.ValueParam("$after", types.UTF8Value(after.String())),
+						table.ValueParam("$last", types.UTF8Value(last.String())),
+					),
 				),
 			)
 			if err != nil {
-				return errors.Wrap(err, "execute")
-			}
-			if err = res.Err(); err != nil {
-				return errors.Wrap(err, "result")
-			}
-			if err := res.Close(); err != nil {
-				return errors.Wrap(err, "close")
+				return errors.Wrap(err, "query")
 			}
-
-			for _, chunk := range file.Chunks {
-				res, err = tx.Execute(ctx, `
-		  DECLARE $file AS UTF8;
-		  DECLARE $index AS UInt64;
-		  DECLARE $id AS UUID;
-		  DECLARE $offset AS UInt64;
-		  DECLARE $size AS UInt64;
-		  DECLARE $node AS UTF8;
-		  UPSERT INTO chunks ( file, index, id, offset, size, node )
-		  VALUES ( $file, $index, $id, $offset, $size, $node );
-		`,
+			for rs, err := range res.ResultSets(ctx) {
+				if err != nil {
+					return errors.Wrap(err, "result set")
+				}
+				for row, err := range rs.Rows(ctx) {
+					if err != nil {
+						return errors.Wrap(err, "row")
+					}
+					var v struct {
+						ID uuid.UUID `sql:"id"`
+					}
+					if err := row.ScanStruct(&v); err != nil {
+						return errors.Wrap(err, "scan")
+					}
+					recorded = append(recorded, v.ID)
+				}
+			}
+			return nil
+		},
+	); err != nil {
+		return nil, errors.Wrap(err, "do")
+	}
+
+	return recorded, nil
+}
+
+func (y YDBStorage) AddGarbage(ctx context.Context, replicas []Replica) error {
+	ctx, span := y.tracer.Start(ctx, "meta.AddGarbage")
+	defer span.End()
+
+	if err := y.db.Table().DoTx(ctx,
+		func(ctx context.Context, tx table.TransactionActor) (err error) {
+			for _, replica := range replicas {
+				res, err := tx.Execute(ctx, `
+          DECLARE $id AS UUID;
+          DECLARE $node AS UTF8;
+          UPSERT INTO garbage ( id, node )
+          VALUES ( $id, $node );
+        `,
 					table.NewQueryParameters(
-						table.ValueParam("$file", types.UTF8Value(file.Name)),
-						table.ValueParam("$index", types.Uint64Value(uint64(chunk.Index))),
-						table.ValueParam("$id", types.UuidValue(chunk.ID)),
-						table.ValueParam("$offset", types.Uint64Value(uint64(chunk.Offset))),
-						table.ValueParam("$size", types.Uint64Value(uint64(chunk.Size))),
-						table.ValueParam("$node", types.UTF8Value(chunk.NodeBaseURL)),
+						table.ValueParam("$id", types.UuidValue(replica.ChunkID)),
+						table.ValueParam("$node", types.UTF8Value(replica.Node)),
 					),
 				)
 				if err != nil {
@@ -380,23 +645,186 @@ func (y YDBStorage) AddFile(ctx context.Context, file File) error {
 					return errors.Wrap(err, "close")
 				}
 			}
+			return nil
+		}, table.WithIdempotent(),
+	); err != nil {
+		return errors.Wrap(err, "upsert garbage")
+	}
+
+	return nil
+}
+
+func (y YDBStorage) Garbage(ctx context.Context, after Replica, limit int) ([]Replica, error) {
+	ctx, span := y.tracer.Start(ctx, "meta.Garbage")
+	defer span.End()
+
+	var replicas []Replica
+	if err := y.db.Query().Do(ctx,
+		func(ctx context.Context, s query.Session) error {
+			replicas = replicas[:0]
+			res, err := s.Query(ctx,
+				`DECLARE $id AS UUID;
+			DECLARE $node AS UTF8;
+			DECLARE $limit AS UInt64;
+			SELECT
+			  id,
+			  node,
+			  not_before,
+			  released_at
+			FROM
+			  garbage
+			WHERE
+			  id > $id OR (id = $id AND node > $node)
+			ORDER BY
+			  id, node
+			LIMIT $limit;`,
+				query.WithParameters(
+					table.NewQueryParameters(
+						table.ValueParam("$id", types.UuidValue(after.ChunkID)),
+						table.ValueParam("$node", types.UTF8Value(after.Node)),
+						table.ValueParam("$limit", types.Uint64Value(uint64(limit))),
+					),
+				),
+			)
+			if err != nil {
+				return errors.Wrap(err, "query")
+			}
+			for rs, err := range res.ResultSets(ctx) {
+				if err != nil {
+					return errors.Wrap(err, "result set")
+				}
+				for row, err := range rs.Rows(ctx) {
+					if err != nil {
+						return errors.Wrap(err, "row")
+					}
+					var v struct {
+						ID         uuid.UUID  `sql:"id"`
+						Node       string     `sql:"node"`
+						NotBefore  *time.Time `sql:"not_before"`
+						ReleasedAt *time.Time `sql:"released_at"`
+					}
+					if err := row.ScanStruct(&v); err != nil {
+						return errors.Wrap(err, "scan")
+					}
+					replica := Replica{ChunkID: v.ID, Node: v.Node}
+					if v.NotBefore != nil {
+						replica.NotBefore = *v.NotBefore
+					}
+					if v.ReleasedAt != nil {
+						replica.ReleasedAt = *v.ReleasedAt
+					}
+					replicas = append(replicas, replica)
+				}
+			}
+			return nil
+		},
+	); err != nil {
+		return nil, errors.Wrap(err, "do")
+	}
 
+	return replicas, nil
+}
+
+func (y YDBStorage) RemoveGarbage(ctx context.Context, replica Replica) error {
+	ctx, span := y.tracer.Start(ctx, "meta.RemoveGarbage")
+	defer span.End()
+
+	if err := y.db.Table().DoTx(ctx,
+		func(ctx context.Context, tx table.TransactionActor) (err error) {
+			res, err := tx.Execute(ctx, `
+          DECLARE $id AS UUID;
+          DECLARE $node AS UTF8;
+          DELETE FROM garbage
+          WHERE
+            id = $id AND node = $node;
+        `,
+				table.NewQueryParameters(
+					table.ValueParam("$id", types.UuidValue(replica.ChunkID)),
+					table.ValueParam("$node", types.UTF8Value(replica.Node)),
+				),
+			)
+			if err != nil {
+				return errors.Wrap(err, "execute")
+			}
+			if err = res.Err(); err != nil {
+				return errors.Wrap(err, "result")
+			}
+			if err := res.Close(); err != nil {
+				return errors.Wrap(err, "close")
+			}
 			return nil
 		}, table.WithIdempotent(),
 	); err != nil {
-		return errors.Wrap(err, "upsert file")
+		return errors.Wrap(err, "delete garbage")
 	}
+
 	return nil
 }
 
-func (y YDBStorage) Nodes(ctx context.Context) ([]Node, error) {
-	ctx, span := y.tracer.Start(ctx, "meta.Nodes")
+func (y YDBStorage) NodeGarbage(ctx context.Context, baseURL string) (int, error) {
+	ctx, span := y.tracer.Start(ctx, "meta.NodeGarbage")
 	defer span.End()
 
-	var nodes []Node
+	var count uint64
+	if err := y.db.Query().DoTx(ctx,
+		func(ctx context.Context, tx query.TxActor) (err error) {
+			count, err = txCount(ctx, tx, `DECLARE $node AS UTF8;
+			SELECT
+			  COUNT(*) AS count
+			FROM
+			  garbage
+			WHERE
+			  node = $node;`,
+				query.WithParameters(
+					table.NewQueryParameters(
+						table.ValueParam("$node", types.UTF8Value(baseURL)),
+					),
+				),
+			)
+			return err
+		},
+		query.WithIdempotent(),
+		query.WithTxSettings(query.TxSettings(query.WithSnapshotReadOnly())),
+	); err != nil {
+		return 0, errors.Wrap(err, "count garbage")
+	}
+
+	return int(count), nil
+}
+
+func (y YDBStorage) Replicas(ctx context.Context, after Replica, limit int) ([]Replica, error) {
+	ctx, span := y.tracer.Start(ctx, "meta.Replicas")
+	defer span.End()
+
+	var replicas []Replica
 	if err := y.db.Query().Do(ctx,
 		func(ctx context.Context, s query.Session) error {
-			res, err := s.Query(ctx, `SELECT base_url FROM nodes;`)
+			replicas = replicas[:0]
+			res, err := s.Query(ctx,
+				`DECLARE $id AS UUID;
+			DECLARE $node AS UTF8;
+			DECLARE $limit AS UInt64;
+			SELECT
+			  id,
+			  node
+			FROM
+			  replicas
+			WHERE
+			  id > $id OR (id = $id AND node > $node)
+			ORDER BY
+			  id, node
+			LIMIT $limit;`,
+				query.WithParameters(
+					table.NewQueryParameters(
+						table.ValueParam("$id", types.UuidValue(after.ChunkID)),
+						table.ValueParam("$node", types.UTF8Value(after.Node)),
+						table.ValueParam("$limit", types.Uint64Value(uint64(limit))),
+					),
+				),
+			)
+			if err != nil {
+				return errors.Wrap(err, "query")
+			}
 			for rs, err := range res.ResultSets(ctx) {
 				if err != nil {
 					return errors.Wrap(err, "result set")
@@ -405,38 +833,187 @@ func (y YDBStorage) Nodes(ctx context.Context) ([]Node, error) {
 					if err != nil {
 						return errors.Wrap(err, "row")
 					}
-					var node Node
-					if err := row.Scan(&node.BaseURL); err != nil {
+					var v struct {
+						ID   uuid.UUID `sql:"id"`
+						Node string    `sql:"node"`
+					}
+					if err := row.ScanStruct(&v); err != nil {
 						return errors.Wrap(err, "scan")
 					}
-					nodes = append(nodes, node)
+					replicas = append(replicas, Replica{ChunkID: v.ID, Node: v.Node})
 				}
 			}
+			return nil
+		},
+	); err != nil {
+		return nil, errors.Wrap(err, "do")
+	}
+
+	return replicas, nil
+}
+
+func (y YDBStorage) Files(ctx context.Context, prefix, from string, limit int) ([]FileInfo, error) {
+	ctx, span := y.tracer.Start(ctx, "meta.Files")
+	defer span.End()
+
+	// Names with prefix are the range [prefix, prefixEnd(prefix)) of
+	// primary key.
+	from = max(from, prefix)
+	params := []table.ParameterOption{
+		table.ValueParam("$from", types.UTF8Value(from)),
+		table.ValueParam("$limit", types.Uint64Value(uint64(limit))),
+	}
+	q := `DECLARE $from AS UTF8;
+			DECLARE $limit AS UInt64;
+			SELECT name, size, chunk_count, created_at, checksum, part_count
+			FROM files
+			WHERE name >= $from
+			ORDER BY name
+			LIMIT $limit;`
+	if end := prefixEnd(prefix); end != "" {
+		params = append(params, table.ValueParam("$end", types.UTF8Value(end)))
+		q = `DECLARE $from AS UTF8;
+			DECLARE $end AS UTF8;
+			DECLARE $limit AS UInt64;
+			SELECT name, size, chunk_count, created_at, checksum, part_count
+			FROM files
+			WHERE name >= $from AND name < $end
+			ORDER BY name
+			LIMIT $limit;`
+	}
+
+	var files []FileInfo
+	if err := y.db.Query().Do(ctx,
+		func(ctx context.Context, s query.Session) error {
+			files = files[:0]
+			res, err := s.Query(ctx, q,
+				query.WithParameters(table.NewQueryParameters(params...)),
+			)
 			if err != nil {
 				return errors.Wrap(err, "query")
 			}
+			for rs, err := range res.ResultSets(ctx) {
+				if err != nil {
+					return errors.Wrap(err, "result set")
+				}
+				for row, err := range rs.Rows(ctx) {
+					if err != nil {
+						return errors.Wrap(err, "row")
+					}
+					var v struct {
+						Name       string     `sql:"name"`
+						Size       uint64     `sql:"size"`
+						ChunkCount *uint64    `sql:"chunk_count"`
+						CreatedAt  *time.Time `sql:"created_at"`
+						Checksum   *[]byte    `sql:"checksum"`
+						PartCount  *uint64    `sql:"part_count"`
+					}
+					if err := row.ScanStruct(&v); err != nil {
+						return errors.Wrap(err, "scan")
+					}
+					file := FileInfo{
+						Name: v.Name,
+						Size: int64(v.Size),
+					}
+					if v.ChunkCount != nil {
+						file.ChunkCount = int(*v.ChunkCount)
+					}
+					if v.CreatedAt != nil {
+						file.CreatedAt = *v.CreatedAt
+					}
+					if v.Checksum != nil && len(*v.Checksum) > 0 {
+						file.Checksum = *v.Checksum
+					}
+					if v.PartCount != nil {
+						file.PartCount = int(*v.PartCount)
+					}
+					files = append(files, file)
+				}
+			}
 			return nil
 		},
 	); err != nil {
 		return nil, errors.Wrap(err, "do")
 	}
 
-	return nodes, nil
+	return files, nil
 }
 
-func (y YDBStorage) AddNode(ctx context.Context, node Node) error {
-	ctx, span := y.tracer.Start(ctx, "meta.AddNode")
+func (y YDBStorage) AddReplica(ctx context.Context, chunk Chunk, node string) error {
+	ctx, span := y.tracer.Start(ctx, "meta.AddReplica")
+	defer span.End()
+
+	params := query.WithParameters(
+		table.NewQueryParameters(
+			table.ValueParam("$id", types.UuidValue(chunk.ID)),
+			table.ValueParam("$node", types.UTF8Value(node)),
+			table.ValueParam("$size", types.Uint64Value(uint64(chunk.Size))),
+		),
+	)
+	if err := y.db.Query().DoTx(ctx,
+		func(ctx context.Context, tx query.TxActor) (err error) {
+			// Released chunk has neither references nor replicas, and
+			// chunks uploaded before reference counting have replicas only.
+			refs, err := txCount(ctx, tx, `
+          DECLARE $id AS UUID;
+          DECLARE $node AS UTF8;
+          DECLARE $size AS UInt64;
+          SELECT COUNT(*) AS count FROM chunk_refs WHERE id = $id;
+        `,
+				params,
+			)
+			if err != nil {
+				return errors.Wrap(err, "count refs")
+			}
+			replicas, err := txCount(ctx, tx, `
+          DECLARE $id AS UUID;
+          DECLARE $node AS UTF8;
+          DECLARE $size AS UInt64;
+          SELECT COUNT(*) AS count FROM replicas WHERE id = $id;
+        `,
+				params,
+			)
+			if err != nil {
+				return errors.Wrap(err, "count replicas")
+			}
+			if refs+replicas == 0 {
+				return &ChunkReleasedErr{Chunk: chunk.ID}
+			}
+
+			if err := tx.Exec(ctx, `
+          DECLARE $id AS UUID;
+          DECLARE $node AS UTF8;
+          DECLARE $size AS UInt64;
+          UPSERT INTO replicas ( id, node, size )
+          VALUES ( $id, $node, $size );
+        `,
+				params,
+			); err != nil {
+				return errors.Wrap(err, "upsert")
+			}
+			return nil
+		}, query.WithIdempotent(),
+	); err != nil {
+		return errors.Wrap(err, "upsert replica")
+	}
+
+	return nil
+}
+
+func (y YDBStorage) RemoveReplica(ctx context.Context, chunkID uuid.UUID, node string) error {
+	ctx, span := y.tracer.Start(ctx, "meta.RemoveReplica")
 	defer span.End()
 
 	if err := y.db.Table().DoTx(ctx,
 		func(ctx context.Context, tx table.TransactionActor) (err error) {
-			res, err := tx.Execute(ctx, `
-          DECLARE $base_url AS UTF8;
-          UPSERT INTO nodes ( base_url )
-          VALUES ( $base_url );
-        `,
+			res, err := tx.Execute(ctx, `DECLARE $id AS UUID;
+			DECLARE $node AS UTF8;
+			DELETE FROM replicas
+			WHERE
+			  id = $id AND node = $node;`,
 				table.NewQueryParameters(
-					table.ValueParam("$base_url", types.UTF8Value(node.BaseURL)),
+					table.ValueParam("$id", types.UuidValue(chunkID)),
+					table.ValueParam("$node", types.UTF8Value(node)),
 				),
 			)
 			if err != nil {
@@ -452,8 +1029,1976 @@ func (y YDBStorage) AddNode(ctx context.Context, node Node) error {
 			return nil
 		}, table.WithIdempotent(),
 	); err != nil {
-		return errors.Wrap(err, "upsert node")
+		return errors.Wrap(err, "delete replica")
+	}
+
+	return nil
+}
+
+func (y YDBStorage) RemoveReportedReplica(ctx context.Context, chunkID uuid.UUID, node string) error {
+	ctx, span := y.tracer.Start(ctx, "meta.RemoveReportedReplica")
+	defer span.End()
+
+	params := query.WithParameters(
+		table.NewQueryParameters(
+			table.ValueParam("$id", types.UuidValue(chunkID)),
+			table.ValueParam("$node", types.UTF8Value(node)),
+		),
+	)
+	if err := y.db.Query().DoTx(ctx,
+		func(ctx context.Context, tx query.TxActor) (err error) {
+			nodes, err := txCount(ctx, tx, `DECLARE $id AS UUID;
+			DECLARE $node AS UTF8;
+			SELECT
+			  COUNT(*) AS count
+			FROM
+			  nodes
+			WHERE
+			  base_url = $node;`,
+				params,
+			)
+			if err != nil {
+				return errors.Wrap(err, "count nodes")
+			}
+			if nodes == 0 {
+				return &NodeNotFoundErr{Node: node}
+			}
+			others, err := txCount(ctx, tx, `DECLARE $id AS UUID;
+			DECLARE $node AS UTF8;
+			SELECT
+			  COUNT(*) AS count
+			FROM
+			  replicas
+			WHERE
+			  id = $id AND node != $node;`,
+				params,
+			)
+			if err != nil {
+				return errors.Wrap(err, "count replicas")
+			}
+			if others == 0 {
+				return &LastReplicaErr{Chunk: chunkID, Node: node}
+			}
+
+			if err := tx.Exec(ctx, `DECLARE $id AS UUID;
+			DECLARE $node AS UTF8;
+			DELETE FROM replicas
+			WHERE
+			  id = $id AND node = $node;`,
+				params,
+			); err != nil {
+				return errors.Wrap(err, "delete")
+			}
+			return nil
+		}, query.WithIdempotent(),
+	); err != nil {
+		return errors.Wrap(err, "remove reported replica")
+	}
+
+	return nil
+}
+
+// txCount returns count selected by query as count column in transaction.
+func txCount(ctx context.Context, tx query.TxActor, q string, params query.ExecuteOption) (uint64, error) {
+	row, err := tx.QueryRow(ctx, q, params)
+	if err != nil {
+		return 0, errors.Wrap(err, "query")
+	}
+	var v struct {
+		Count uint64 `sql:"count"`
+	}
+	if err := row.ScanStruct(&v); err != nil {
+		return 0, errors.Wrap(err, "scan")
 	}
+	return v.Count, nil
+}
+
+func (y YDBStorage) MoveReplica(ctx context.Context, chunk Chunk, from, to string, deleteAt time.Time) error {
+	ctx, span := y.tracer.Start(ctx, "meta.MoveReplica")
+	defer span.End()
+
+	params := query.WithParameters(
+		table.NewQueryParameters(
+			table.ValueParam("$id", types.UuidValue(chunk.ID)),
+			table.ValueParam("$from", types.UTF8Value(from)),
+			table.ValueParam("$to", types.UTF8Value(to)),
+			table.ValueParam("$size", types.Uint64Value(uint64(chunk.Size))),
+			table.ValueParam("$delete_at", types.TimestampValueFromTime(deleteAt)),
+		),
+	)
+	if err := y.db.Query().DoTx(ctx,
+		func(ctx context.Context, tx query.TxActor) (err error) {
+			// Replica is removed when chunk is released or reported, and
+			// its copy must not be recorded then.
+			n, err := txCount(ctx, tx, `
+          DECLARE $id AS UUID;
+          DECLARE $from AS UTF8;
+          DECLARE $to AS UTF8;
+          DECLARE $size AS UInt64;
+          DECLARE $delete_at AS Timestamp;
+          SELECT COUNT(*) AS count FROM replicas WHERE id = $id AND node = $from;
+        `,
+				params,
+			)
+			if err != nil {
+				return errors.Wrap(err, "count replicas")
+			}
+			if n == 0 {
+				return &ReplicaNotFoundErr{Chunk: chunk.ID, Node: from}
+			}
 
+			if err := tx.Exec(ctx, `
+          DECLARE $id AS UUID;
+          DECLARE $from AS UTF8;
+          DECLARE $to AS UTF8;
+          DECLARE $size AS UInt64;
+          DECLARE $delete_at AS Timestamp;
+          DELETE FROM replicas
+          WHERE
+            id = $id AND node = $from;
+          UPSERT INTO replicas ( id, node, size )
+          VALUES ( $id, $to, $size );
+          UPSERT INTO garbage ( id, node, not_before )
+          VALUES ( $id, $from, $delete_at );
+        `,
+				params,
+			); err != nil {
+				return errors.Wrap(err, "replace")
+			}
+			return nil
+		}, query.WithIdempotent(),
+	); err != nil {
+		return errors.Wrap(err, "move replica")
+	}
+
+	return nil
+}
+
+func (y YDBStorage) NodeReplicas(ctx context.Context, baseURL string, after uuid.UUID, limit int) ([]Chunk, error) {
+	ctx, span := y.tracer.Start(ctx, "meta.NodeReplicas")
+	defer span.End()
+
+	var chunks []Chunk
+	if err := y.db.Query().Do(ctx,
+		func(ctx context.Context, s query.Session) error {
+			chunks = chunks[:0]
+			res, err := s.Query(ctx,
+				`DECLARE $node AS UTF8;
+			DECLARE $after AS UUID;
+			DECLARE $limit AS UInt64;
+			$ids = SELECT
+			  id
+			FROM
+			  replicas
+			WHERE
+			  node = $node AND id > $after
+			ORDER BY
+			  id
+			LIMIT $limit;
+			SELECT
+			  d.id AS id,
+			  r.node AS node,
+			  r.size AS size,
+			  c.checksum AS checksum
+			FROM
+			  $ids AS d
+			  INNER JOIN replicas AS r ON d.id = r.id
+			  LEFT JOIN chunks VIEW chunks_id AS c ON d.id = c.id
+			ORDER BY
+			  id, node;`,
+				query.WithParameters(
+					table.NewQueryParameters(
+						table.ValueParam("$node", types.UTF8Value(baseURL)),
+						table.ValueParam("$after", types.UuidValue(after)),
+						table.ValueParam("$limit", types.Uint64Value(uint64(limit))),
+					),
+				),
+			)
+			if err != nil {
+				return errors.Wrap(err, "query")
+			}
+			for rs, err := range res.ResultSets(ctx) {
+				if err != nil {
+					return errors.Wrap(err, "result set")
+				}
+				for row, err := range rs.Rows(ctx) {
+					if err != nil {
+						return errors.Wrap(err, "row")
+					}
+					var v struct {
+						ID       uuid.UUID `sql:"id"`
+						Node     string    `sql:"node"`
+						Size     uint64    `sql:"size"`
+						Checksum *[]byte   `sql:"checksum"`
+					}
+					if err := row.ScanStruct(&v); err != nil {
+						return errors.Wrap(err, "scan")
+					}
+					if n := len(chunks); n == 0 || chunks[n-1].ID != v.ID {
+						chunk := Chunk{
+							ID:   v.ID,
+							Size: int64(v.Size),
+						}
+						if v.Checksum != nil && len(*v.Checksum) > 0 {
+							chunk.Checksum = *v.Checksum
+						}
+						chunks = append(chunks, chunk)
+					}
+					// Row per replica, and per file that shares chunk.
+					last := &chunks[len(chunks)-1]
+					if !slices.Contains(last.Nodes, v.Node) {
+						last.Nodes = append(last.Nodes, v.Node)
+					}
+				}
+			}
+			return nil
+		},
+	); err != nil {
+		return nil, errors.Wrap(err, "do")
+	}
+
+	return chunks, nil
+}
+
+func (y YDBStorage) CreateTables(ctx context.Context) error {
+	ctx, span := y.tracer.Start(ctx, "meta.CreateTables")
+	defer span.End()
+
+	if err := y.db.Table().Do(ctx,
+		func(ctx context.Context, s table.Session) (err error) {
+			return s.CreateTable(ctx, path.Join(y.db.Name(), "files"),
+				options.WithColumn("name", types.TypeUTF8),
+				options.WithColumn("size", types.TypeUint64),
+				options.WithColumn("data_shards", types.TypeUint64),
+				options.WithColumn("parity_shards", types.TypeUint64),
+				options.WithColumn("checksum", types.TypeString),
+				options.WithColumn("chunk_count", types.TypeUint64),
+				options.WithColumn("created_at", types.TypeTimestamp),
+				options.WithColumn("content_type", types.TypeUTF8),
+				options.WithColumn("version", types.TypeUUID),
+				options.WithColumn("part_count", types.TypeUint64),
+				options.WithPrimaryKeyColumn("name"),
+			)
+		},
+	); err != nil {
+		return errors.Wrap(err, "create files table")
+	}
+	if err := y.db.Table().Do(ctx,
+		func(ctx context.Context, s table.Session) (err error) {
+			return s.CreateTable(ctx, path.Join(y.db.Name(), "chunks"),
+				options.WithColumn("file", types.TypeUTF8),
+				options.WithColumn("index", types.TypeUint64),
+				options.WithColumn("id", types.TypeUUID),
+				options.WithColumn("offset", types.TypeUint64),
+				options.WithColumn("size", types.TypeUint64),
+				options.WithColumn("checksum", types.TypeString),
+				options.WithPrimaryKeyColumn("file", "index"),
+				// Files that reference chunk.
+				options.WithIndex("chunks_id",
+					options.WithIndexColumns("id"),
+					options.WithIndexType(options.GlobalIndex()),
+				),
+			)
+		},
+	); err != nil {
+		return errors.Wrap(err, "create chunks table")
+	}
+	if err := y.db.Table().Do(ctx,
+		func(ctx context.Context, s table.Session) (err error) {
+			// Location of every chunk replica.
+			return s.CreateTable(ctx, path.Join(y.db.Name(), "replicas"),
+				options.WithColumn("id", types.TypeUUID),
+				options.WithColumn("node", types.TypeUTF8),
+				options.WithColumn("size", types.TypeUint64),
+				options.WithPrimaryKeyColumn("id", "node"),
+			)
+		},
+	); err != nil {
+		return errors.Wrap(err, "create replicas table")
+	}
+	if err := y.db.Table().Do(ctx,
+		func(ctx context.Context, s table.Session) (err error) {
+			// Number of files that reference every chunk.
+			return s.CreateTable(ctx, path.Join(y.db.Name(), "chunk_refs"),
+				options.WithColumn("id", types.TypeUUID),
+				options.WithColumn("refs", types.TypeUint64),
+				options.WithPrimaryKeyColumn("id"),
+			)
+		},
+	); err != nil {
+		return errors.Wrap(err, "create chunk_refs table")
+	}
+	if err := y.db.Table().Do(ctx,
+		func(ctx context.Context, s table.Session) (err error) {
+			// Replicas that should be deleted from nodes.
+			return s.CreateTable(ctx, path.Join(y.db.Name(), "garbage"),
+				options.WithColumn("id", types.TypeUUID),
+				options.WithColumn("node", types.TypeUTF8),
+				// Replicas moved to other node are kept until then.
+				options.WithColumn("not_before", types.TypeTimestamp),
+				// Replicas of released chunks are kept for grace period of
+				// Collector since then.
+				options.WithColumn("released_at", types.TypeTimestamp),
+				options.WithPrimaryKeyColumn("id", "node"),
+			)
+		},
+	); err != nil {
+		return errors.Wrap(err, "create garbage table")
+	}
+	if err := y.db.Table().Do(ctx,
+		func(ctx context.Context, s table.Session) (err error) {
+			return s.CreateTable(ctx, path.Join(y.db.Name(), "buckets"),
+				options.WithColumn("name", types.TypeUTF8),
+				options.WithColumn("created_at", types.TypeTimestamp),
+				options.WithPrimaryKeyColumn("name"),
+			)
+		},
+	); err != nil {
+		return errors.Wrap(err, "create buckets table")
+	}
+	if err := y.db.Table().Do(ctx,
+		func(ctx context.Context, s table.Session) (err error) {
+			// Multipart uploads in progress.
+			return s.CreateTable(ctx, path.Join(y.db.Name(), "uploads"),
+				options.WithColumn("id", types.TypeUUID),
+				options.WithColumn("name", types.TypeUTF8),
+				options.WithColumn("content_type", types.TypeUTF8),
+				options.WithColumn("length", types.TypeUint64),
+				options.WithColumn("created_at", types.TypeTimestamp),
+				options.WithColumn("updated_at", types.TypeTimestamp),
+				options.WithPrimaryKeyColumn("id"),
+			)
+		},
+	); err != nil {
+		return errors.Wrap(err, "create uploads table")
+	}
+	if err := y.db.Table().Do(ctx,
+		func(ctx context.Context, s table.Session) (err error) {
+			// Parts of multipart uploads, their chunks are in chunks table
+			// under partKey.
+			return s.CreateTable(ctx, path.Join(y.db.Name(), "parts"),
+				options.WithColumn("upload", types.TypeUUID),
+				options.WithColumn("number", types.TypeUint64),
+				options.WithColumn("size", types.TypeUint64),
+				options.WithColumn("checksum", types.TypeString),
+				options.WithColumn("created_at", types.TypeTimestamp),
+				options.WithPrimaryKeyColumn("upload", "number"),
+			)
+		},
+	); err != nil {
+		return errors.Wrap(err, "create parts table")
+	}
+	if err := y.db.Table().Do(ctx,
+		func(ctx context.Context, s table.Session) (err error) {
+			return s.CreateTable(ctx, path.Join(y.db.Name(), "nodes"),
+				options.WithColumn("base_url", types.TypeUTF8),
+				options.WithColumn("last_seen", types.TypeTimestamp),
+				options.WithColumn("status", types.TypeUTF8),
+				options.WithColumn("status_error", types.TypeUTF8),
+				options.WithColumn("draining", types.TypeBool),
+				options.WithColumn("total_bytes", types.TypeUint64),
+				options.WithColumn("free_bytes", types.TypeUint64),
+				options.WithColumn("total_inodes", types.TypeUint64),
+				options.WithColumn("free_inodes", types.TypeUint64),
+				options.WithColumn("zone", types.TypeUTF8),
+				options.WithColumn("rack", types.TypeUTF8),
+				options.WithColumn("host", types.TypeUTF8),
+				options.WithPrimaryKeyColumn("base_url"),
+			)
+		},
+	); err != nil {
+		return errors.Wrap(err, "create nodes table")
+	}
+	return nil
+}
+
+type FileNotFoundErr struct {
+	File string
+}
+
+func (e *FileNotFoundErr) Error() string {
+	return "file not found: " + e.File
+}
+
+type BucketNotFoundErr struct {
+	Bucket string
+}
+
+func (e *BucketNotFoundErr) Error() string {
+	return "bucket not found: " + e.Bucket
+}
+
+type BucketExistsErr struct {
+	Bucket string
+}
+
+func (e *BucketExistsErr) Error() string {
+	return "bucket already exists: " + e.Bucket
+}
+
+type UploadNotFoundErr struct {
+	Upload uuid.UUID
+}
+
+func (e *UploadNotFoundErr) Error() string {
+	return "upload not found: " + e.Upload.String()
+}
+
+// PartChangedErr means that part of multipart upload is missing or was
+// replaced after it was listed for completion.
+type PartChangedErr struct {
+	Upload uuid.UUID
+	Number int
+}
+
+func (e *PartChangedErr) Error() string {
+	return fmt.Sprintf("part %d of upload %s changed", e.Number, e.Upload)
+}
+
+// ChunkReleasedErr means that chunk is no longer referenced by any file or
+// upload, so its replicas are not recorded.
+type ChunkReleasedErr struct {
+	Chunk uuid.UUID
+}
+
+func (e *ChunkReleasedErr) Error() string {
+	return "chunk released: " + e.Chunk.String()
+}
+
+// ReplicaNotFoundErr means that chunk has no replica on node.
+type ReplicaNotFoundErr struct {
+	Chunk uuid.UUID
+	Node  string
+}
+
+func (e *ReplicaNotFoundErr) Error() string {
+	return fmt.Sprintf("replica of chunk %s on %s not found", e.Chunk, e.Node)
+}
+
+// NodeNotFoundErr means that node is not registered.
+type NodeNotFoundErr struct {
+	Node string
+}
+
+func (e *NodeNotFoundErr) Error() string {
+	return "node not found: " + e.Node
+}
+
+// LastReplicaErr means that replica can't be removed, as chunk has no other
+// replicas.
+type LastReplicaErr struct {
+	Chunk uuid.UUID
+	Node  string
+}
+
+func (e *LastReplicaErr) Error() string {
+	return fmt.Sprintf("replica of chunk %s on %s is the last one", e.Chunk, e.Node)
+}
+
+type ChunksNotFound struct {
+	File string
+}
+
+func (e *ChunksNotFound) Error() string {
+	return "chunks not found: " + e.File
+}
+
+func (y YDBStorage) File(ctx context.Context, name string) (*File, error) {
+	ctx, span := y.tracer.Start(ctx, "meta.File")
+	defer span.End()
+
+	// Fetch file from YDB.
+	var (
+		file File
+		// Whether chunk count is recorded, it is missing for old files.
+		counted bool
+	)
+	// File and its chunks are read from the same snapshot, so chunks of
+	// concurrently replaced version are not mixed in.
+	if err := y.db.Query().DoTx(ctx,
+		func(ctx context.Context, tx query.TxActor) error {
+			file, counted = File{}, false
+			res, err := tx.Query(ctx,
+				`DECLARE $fileName AS UTF8;
+			SELECT
+			  name,
+			  size,
+			  data_shards,
+			  parity_shards,
+			  checksum,
+			  chunk_count,
+			  created_at,
+			  content_type,
+			  version,
+			  part_count,
+			FROM
+			  files
+			WHERE
+			  name = $fileName;
+			SELECT
+			  c.index AS index,
+			  c.id AS id,
+			  c.offset AS offset,
+			  c.size AS size,
+			  c.checksum AS checksum,
+			  r.node AS node
+			FROM
+			  chunks AS c
+			  LEFT JOIN replicas AS r ON c.id = r.id
+			WHERE
+			  c.file = $fileName
+			ORDER BY
+			  index, node;`,
+				query.WithParameters(
+					table.NewQueryParameters(
+						table.ValueParam("$fileName", types.UTF8Value(name)),
+					),
+				),
+			)
+			if err != nil {
+				return errors.Wrap(err, "query")
+			}
+
+			for rs, err := range res.ResultSets(ctx) {
+				if err != nil {
+					return errors.Wrap(err, "result set")
+				}
+				for row, err := range rs.Rows(ctx) {
+					if err != nil {
+						return errors.Wrap(err, "row")
+					}
+					if rs.Index() == 0 {
+						// File row.
+						var v struct {
+							Name         string     `sql:"name"`
+							Size         uint64     `sql:"size"`
+							DataShards   *uint64    `sql:"data_shards"`
+							ParityShards *uint64    `sql:"parity_shards"`
+							Checksum     *[]byte    `sql:"checksum"`
+							ChunkCount   *uint64    `sql:"chunk_count"`
+							CreatedAt    *time.Time `sql:"created_at"`
+							ContentType  *string    `sql:"content_type"`
+							Version      *uuid.UUID `sql:"version"`
+							PartCount    *uint64    `sql:"part_count"`
+						}
+						if err := row.ScanStruct(&v); err != nil {
+							return errors.Wrap(err, "scan file")
+						}
+						file.Name = v.Name
+						file.Size = int64(v.Size)
+						if v.DataShards != nil && v.ParityShards != nil {
+							file.DataShards = int(*v.DataShards)
+							file.ParityShards = int(*v.ParityShards)
+						}
+						if v.Checksum != nil && len(*v.Checksum) > 0 {
+							file.Checksum = *v.Checksum
+						}
+						if v.ChunkCount != nil {
+							file.ChunkCount = int(*v.ChunkCount)
+							counted = true
+						}
+						if v.CreatedAt != nil {
+							file.CreatedAt = *v.CreatedAt
+						}
+						if v.ContentType != nil {
+							file.ContentType = *v.ContentType
+						}
+						if v.Version != nil {
+							file.Version = *v.Version
+						}
+						if v.PartCount != nil {
+							file.PartCount = int(*v.PartCount)
+						}
+						continue
+					}
+					var v struct {
+						Index    uint64    `sql:"index"`
+						ID       uuid.UUID `sql:"id"`
+						Offset   uint64    `sql:"offset"`
+						Size     uint64    `sql:"size"`
+						Checksum *[]byte   `sql:"checksum"`
+						Node     *string   `sql:"node"`
+					}
+					if err := row.ScanStruct(&v); err != nil {
+						return errors.Wrap(err, "scan chunk")
+					}
+					if n := len(file.Chunks); n == 0 || file.Chunks[n-1].Index != int(v.Index) {
+						chunk := Chunk{
+							Index:  int(v.Index),
+							ID:     v.ID,
+							Offset: int64(v.Offset),
+							Size:   int64(v.Size),
+						}
+						if v.Checksum != nil && len(*v.Checksum) > 0 {
+							chunk.Checksum = *v.Checksum
+						}
+						file.Chunks = append(file.Chunks, chunk)
+					}
+					if v.Node != nil {
+						// Row per replica.
+						last := &file.Chunks[len(file.Chunks)-1]
+						last.Nodes = append(last.Nodes, *v.Node)
+					}
+				}
+			}
+			return nil
+		},
+		query.WithIdempotent(),
+		query.WithTxSettings(query.TxSettings(query.WithSnapshotReadOnly())),
+	); err != nil {
+		return nil, errors.Wrap(err, "do")
+	}
+
+	if file.Name == "" {
+		return nil, &FileNotFoundErr{File: name}
+	}
+	if counted && len(file.Chunks) != file.ChunkCount || !counted && len(file.Chunks) == 0 {
+		return nil, &ChunksNotFound{File: name}
+	}
+
+	return &file, nil
+}
+
+func (y YDBStorage) ChunkFile(ctx context.Context, id uuid.UUID) (*File, error) {
+	ctx, span := y.tracer.Start(ctx, "meta.ChunkFile")
+	defer span.End()
+
+	var (
+		name  string
+		found bool
+	)
+	if err := y.db.Query().Do(ctx,
+		func(ctx context.Context, s query.Session) error {
+			found = false
+			res, err := s.Query(ctx,
+				`DECLARE $id AS UUID;
+			SELECT
+			  c.file AS file
+			FROM
+			  chunks VIEW chunks_id AS c
+			  INNER JOIN files AS f ON c.file = f.name
+			WHERE
+			  c.id = $id
+			LIMIT 1;`,
+				query.WithParameters(
+					table.NewQueryParameters(
+						table.ValueParam("$id", types.UuidValue(id)),
+					),
+				),
+			)
+			if err != nil {
+				return errors.Wrap(err, "query")
+			}
+			for rs, err := range res.ResultSets(ctx) {
+				if err != nil {
+					return errors.Wrap(err, "result set")
+				}
+				for row, err := range rs.Rows(ctx) {
+					if err != nil {
+						return errors.Wrap(err, "row")
+					}
+					var v struct {
+						File string `sql:"file"`
+					}
+					if err := row.ScanStruct(&v); err != nil {
+						return errors.Wrap(err, "scan")
+					}
+					name, found = v.File, true
+				}
+			}
+			return nil
+		},
+	); err != nil {
+		return nil, errors.Wrap(err, "do")
+	}
+	if !found {
+		// Chunk of multipart upload, or released one.
+		return nil, &FileNotFoundErr{File: "with chunk " + id.String()}
+	}
+
+	return y.File(ctx, name)
+}
+
+func (y YDBStorage) AddFile(ctx context.Context, file File) error {
+	ctx, span := y.tracer.Start(ctx, "meta.AddFile")
+	defer span.End()
+
+	if err := y.db.Query().DoTx(ctx,
+		func(ctx context.Context, tx query.TxActor) (err error) {
+			return txReplaceFile(ctx, tx, file, map[string][]Chunk{})
+		}, query.WithIdempotent(),
+	); err != nil {
+		return errors.Wrap(err, "upsert file")
+	}
+	return nil
+}
+
+// txReplaceFile makes file the current version of its name in transaction,
+// keeping replaced version as noncurrent one. Chunks of other keys in files
+// are replaced along with them.
+func txReplaceFile(ctx context.Context, tx query.TxActor, file File, files map[string][]Chunk) error {
+	current, err := txFile(ctx, tx, file.Name)
+	if err != nil {
+		return errors.Wrap(err, "current file")
+	}
+	files[file.Name] = file.Chunks
+	if current != nil {
+		// Chunks of replaced version are moved under version key.
+		current.Name = versionKey(file.Name, current.Version)
+		files[current.Name] = current.Chunks
+	}
+	if err := replaceChunks(ctx, tx, files); err != nil {
+		return errors.Wrap(err, "replace chunks")
+	}
+	if current != nil {
+		if err := txUpsertFile(ctx, tx, *current); err != nil {
+			return errors.Wrap(err, "keep version")
+		}
+	}
+	return txUpsertFile(ctx, tx, file)
+}
+
+// txFile returns file with its chunks, without replicas, or nil if it does
+// not exist in transaction.
+func txFile(ctx context.Context, tx query.TxActor, name string) (*File, error) {
+	res, err := tx.Query(ctx,
+		`DECLARE $fileName AS UTF8;
+			SELECT
+			  name,
+			  size,
+			  data_shards,
+			  parity_shards,
+			  checksum,
+			  chunk_count,
+			  created_at,
+			  content_type,
+			  version,
+			  part_count,
+			FROM
+			  files
+			WHERE
+			  name = $fileName;
+			SELECT
+			  index,
+			  id,
+			  offset,
+			  size,
+			  checksum
+			FROM
+			  chunks
+			WHERE
+			  file = $fileName
+			ORDER BY
+			  index;`,
+		query.WithParameters(
+			table.NewQueryParameters(
+				table.ValueParam("$fileName", types.UTF8Value(name)),
+			),
+		),
+	)
+	if err != nil {
+		return nil, errors.Wrap(err, "query")
+	}
+	var (
+		file  File
+		found bool
+	)
+	for rs, err := range res.ResultSets(ctx) {
+		if err != nil {
+			return nil, errors.Wrap(err, "result set")
+		}
+		for row, err := range rs.Rows(ctx) {
+			if err != nil {
+				return nil, errors.Wrap(err, "row")
+			}
+			if rs.Index() == 0 {
+				// File row.
+				var v struct {
+					Name         string     `sql:"name"`
+					Size         uint64     `sql:"size"`
+					DataShards   *uint64    `sql:"data_shards"`
+					ParityShards *uint64    `sql:"parity_shards"`
+					Checksum     *[]byte    `sql:"checksum"`
+					ChunkCount   *uint64    `sql:"chunk_count"`
+					CreatedAt    *time.Time `sql:"created_at"`
+					ContentType  *string    `sql:"content_type"`
+					Version      *uuid.UUID `sql:"version"`
+					PartCount    *uint64    `sql:"part_count"`
+				}
+				if err := row.ScanStruct(&v); err != nil {
+					return nil, errors.Wrap(err, "scan file")
+				}
+				found = true
+				file.Name = v.Name
+				file.Size = int64(v.Size)
+				if v.DataShards != nil && v.ParityShards != nil {
+					file.DataShards = int(*v.DataShards)
+					file.ParityShards = int(*v.ParityShards)
+				}
+				if v.Checksum != nil {
+					file.Checksum = *v.Checksum
+				}
+				if v.ChunkCount != nil {
+					file.ChunkCount = int(*v.ChunkCount)
+				}
+				if v.CreatedAt != nil {
+					file.CreatedAt = *v.CreatedAt
+				}
+				if v.ContentType != nil {
+					file.ContentType = *v.ContentType
+				}
+				if v.Version != nil {
+					file.Version = *v.Version
+				}
+				if v.PartCount != nil {
+					file.PartCount = int(*v.PartCount)
+				}
+				continue
+			}
+			var v struct {
+				Index    uint64    `sql:"index"`
+				ID       uuid.UUID `sql:"id"`
+				Offset   uint64    `sql:"offset"`
+				Size     uint64    `sql:"size"`
+				Checksum *[]byte   `sql:"checksum"`
+			}
+			if err := row.ScanStruct(&v); err != nil {
+				return nil, errors.Wrap(err, "scan chunk")
+			}
+			chunk := Chunk{
+				Index:  int(v.Index),
+				ID:     v.ID,
+				Offset: int64(v.Offset),
+				Size:   int64(v.Size),
+			}
+			if v.Checksum != nil {
+				chunk.Checksum = *v.Checksum
+			}
+			file.Chunks = append(file.Chunks, chunk)
+		}
+	}
+	if !found {
+		return nil, nil
+	}
+	return &file, nil
+}
+
+// txUpsertFile adds or replaces file row in transaction.
+func txUpsertFile(ctx context.Context, tx query.TxActor, file File) error {
+	createdAt := types.NullValue(types.TypeTimestamp)
+	if !file.CreatedAt.IsZero() {
+		createdAt = types.OptionalValue(types.TimestampValueFromTime(file.CreatedAt))
+	}
+	if err := tx.Exec(ctx, `
+          DECLARE $name AS UTF8;
+          DECLARE $size AS UInt64;
+          DECLARE $data_shards AS UInt64;
+          DECLARE $parity_shards AS UInt64;
+          DECLARE $checksum AS String;
+          DECLARE $chunk_count AS UInt64;
+          DECLARE $created_at AS Optional<Timestamp>;
+          DECLARE $content_type AS UTF8;
+          DECLARE $version AS UUID;
+          DECLARE $part_count AS UInt64;
+          UPSERT INTO files ( name, size, data_shards, parity_shards, checksum, chunk_count, created_at, content_type, version, part_count )
+          VALUES ( $name, $size, $data_shards, $parity_shards, $checksum, $chunk_count, $created_at, $content_type, $version, $part_count );
+        `,
+		query.WithParameters(
+			table.NewQueryParameters(
+				table.ValueParam("$name", types.UTF8Value(file.Name)),
+				table.ValueParam("$size", types.Uint64Value(uint64(file.Size))),
+				table.ValueParam("$data_shards", types.Uint64Value(uint64(file.DataShards))),
+				table.ValueParam("$parity_shards", types.Uint64Value(uint64(file.ParityShards))),
+				table.ValueParam("$checksum", types.BytesValue(file.Checksum)),
+				table.ValueParam("$chunk_count", types.Uint64Value(uint64(file.ChunkCount))),
+				table.ValueParam("$created_at", createdAt),
+				table.ValueParam("$content_type", types.UTF8Value(file.ContentType)),
+				table.ValueParam("$version", types.UuidValue(file.Version)),
+				table.ValueParam("$part_count", types.Uint64Value(uint64(file.PartCount))),
+			),
+		),
+	); err != nil {
+		return errors.Wrap(err, "upsert file")
+	}
+	return nil
+}
+
+func (y YDBStorage) Nodes(ctx context.Context) ([]Node, error) {
+	ctx, span := y.tracer.Start(ctx, "meta.Nodes")
+	defer span.End()
+
+	var nodes []Node
+	if err := y.db.Query().Do(ctx,
+		func(ctx context.Context, s query.Session) error {
+			nodes = nodes[:0]
+			res, err := s.Query(ctx, `SELECT
+			  base_url,
+			  last_seen,
+			  status,
+			  status_error,
+			  draining,
+			  total_bytes,
+			  free_bytes,
+			  total_inodes,
+			  free_inodes,
+			  zone,
+			  rack,
+			  host
+			FROM
+			  nodes;`)
+			for rs, err := range res.ResultSets(ctx) {
+				if err != nil {
+					return errors.Wrap(err, "result set")
+				}
+				for row, err := range rs.Rows(ctx) {
+					if err != nil {
+						return errors.Wrap(err, "row")
+					}
+					var v struct {
+						BaseURL     string     `sql:"base_url"`
+						LastSeen    *time.Time `sql:"last_seen"`
+						Status      *string    `sql:"status"`
+						StatusError *string    `sql:"status_error"`
+						Draining    *bool      `sql:"draining"`
+						TotalBytes  *uint64    `sql:"total_bytes"`
+						FreeBytes   *uint64    `sql:"free_bytes"`
+						TotalInodes *uint64    `sql:"total_inodes"`
+						FreeInodes  *uint64    `sql:"free_inodes"`
+						Zone        *string    `sql:"zone"`
+						Rack        *string    `sql:"rack"`
+						Host        *string    `sql:"host"`
+					}
+					if err := row.ScanStruct(&v); err != nil {
+						return errors.Wrap(err, "scan")
+					}
+					n := Node{BaseURL: v.BaseURL}
+					if v.LastSeen != nil {
+						n.LastSeen = *v.LastSeen
+					}
+					if v.Status != nil {
+						n.Status.State = *v.Status
+					}
+					if v.StatusError != nil {
+						n.Status.Error = *v.StatusError
+					}
+					if v.Draining != nil {
+						n.Draining = *v.Draining
+					}
+					if v.TotalBytes != nil && *v.TotalBytes > 0 {
+						capacity := node.Capacity{TotalBytes: *v.TotalBytes}
+						if v.FreeBytes != nil {
+							capacity.FreeBytes = *v.FreeBytes
+						}
+						if v.TotalInodes != nil {
+							capacity.TotalInodes = *v.TotalInodes
+						}
+						if v.FreeInodes != nil {
+							capacity.FreeInodes = *v.FreeInodes
+						}
+						n.Status.Capacity = &capacity
+					}
+					if v.Zone != nil {
+						n.Topology.Zone = *v.Zone
+					}
+					if v.Rack != nil {
+						n.Topology.Rack = *v.Rack
+					}
+					if v.Host != nil {
+						n.Topology.Host = *v.Host
+					}
+					nodes = append(nodes, n)
+				}
+			}
+			if err != nil {
+				return errors.Wrap(err, "query")
+			}
+			return nil
+		},
+	); err != nil {
+		return nil, errors.Wrap(err, "do")
+	}
+
+	return nodes, nil
+}
+
+func (y YDBStorage) AddNode(ctx context.Context, node Node) error {
+	ctx, span := y.tracer.Start(ctx, "meta.AddNode")
+	defer span.End()
+
+	// Zero capacity means that it was not reported.
+	var totalBytes, freeBytes, totalInodes, freeInodes uint64
+	if c := node.Status.Capacity; c != nil {
+		totalBytes, freeBytes = c.TotalBytes, c.FreeBytes
+		totalInodes, freeInodes = c.TotalInodes, c.FreeInodes
+	}
+
+	if err := y.db.Table().DoTx(ctx,
+		func(ctx context.Context, tx table.TransactionActor) (err error) {
+			res, err := tx.Execute(ctx, `
+          DECLARE $base_url AS UTF8;
+          DECLARE $last_seen AS Timestamp;
+          DECLARE $status AS UTF8;
+          DECLARE $status_error AS UTF8;
+          DECLARE $total_bytes AS UInt64;
+          DECLARE $free_bytes AS UInt64;
+          DECLARE $total_inodes AS UInt64;
+          DECLARE $free_inodes AS UInt64;
+          DECLARE $zone AS UTF8;
+          DECLARE $rack AS UTF8;
+          DECLARE $host AS UTF8;
+          UPSERT INTO nodes (
+            base_url, last_seen, status, status_error,
+            total_bytes, free_bytes, total_inodes, free_inodes,
+            zone, rack, host
+          )
+          VALUES (
+            $base_url, $last_seen, $status, $status_error,
+            $total_bytes, $free_bytes, $total_inodes, $free_inodes,
+            $zone, $rack, $host
+          );
+        `,
+				table.NewQueryParameters(
+					table.ValueParam("$base_url", types.UTF8Value(node.BaseURL)),
+					table.ValueParam("$last_seen", types.TimestampValueFromTime(node.LastSeen)),
+					table.ValueParam("$status", types.UTF8Value(node.Status.State)),
+					table.ValueParam("$status_error", types.UTF8Value(node.Status.Error)),
+					table.ValueParam("$total_bytes", types.Uint64Value(totalBytes)),
+					table.ValueParam("$free_bytes", types.Uint64Value(freeBytes)),
+					table.ValueParam("$total_inodes", types.Uint64Value(totalInodes)),
+					table.ValueParam("$free_inodes", types.Uint64Value(freeInodes)),
+					table.ValueParam("$zone", types.UTF8Value(node.Topology.Zone)),
+					table.ValueParam("$rack", types.UTF8Value(node.Topology.Rack)),
+					table.ValueParam("$host", types.UTF8Value(node.Topology.Host)),
+				),
+			)
+			if err != nil {
+				return errors.Wrap(err, "execute")
+			}
+			if err = res.Err(); err != nil {
+				return errors.Wrap(err, "result")
+			}
+			if err := res.Close(); err != nil {
+				return errors.Wrap(err, "close")
+			}
+
+			return nil
+		}, table.WithIdempotent(),
+	); err != nil {
+		return errors.Wrap(err, "upsert node")
+	}
+
+	return nil
+}
+
+func (y YDBStorage) UpdateNode(ctx context.Context, baseURL string, lastSeen time.Time, status node.Status) error {
+	ctx, span := y.tracer.Start(ctx, "meta.UpdateNode")
+	defer span.End()
+
+	// Zero capacity means that it was not reported.
+	var totalBytes, freeBytes, totalInodes, freeInodes uint64
+	if c := status.Capacity; c != nil {
+		totalBytes, freeBytes = c.TotalBytes, c.FreeBytes
+		totalInodes, freeInodes = c.TotalInodes, c.FreeInodes
+	}
+
+	params := query.WithParameters(
+		table.NewQueryParameters(
+			table.ValueParam("$base_url", types.UTF8Value(baseURL)),
+			table.ValueParam("$last_seen", types.TimestampValueFromTime(lastSeen)),
+			table.ValueParam("$status", types.UTF8Value(status.State)),
+			table.ValueParam("$status_error", types.UTF8Value(status.Error)),
+			table.ValueParam("$total_bytes", types.Uint64Value(totalBytes)),
+			table.ValueParam("$free_bytes", types.Uint64Value(freeBytes)),
+			table.ValueParam("$total_inodes", types.Uint64Value(totalInodes)),
+			table.ValueParam("$free_inodes", types.Uint64Value(freeInodes)),
+		),
+	)
+	const declare = `DECLARE $base_url AS UTF8;
+			DECLARE $last_seen AS Timestamp;
+			DECLARE $status AS UTF8;
+			DECLARE $status_error AS UTF8;
+			DECLARE $total_bytes AS UInt64;
+			DECLARE $free_bytes AS UInt64;
+			DECLARE $total_inodes AS UInt64;
+			DECLARE $free_inodes AS UInt64;
+			`
+	if err := y.db.Query().DoTx(ctx,
+		func(ctx context.Context, tx query.TxActor) (err error) {
+			nodes, err := txCount(ctx, tx, declare+`SELECT
+			  COUNT(*) AS count
+			FROM
+			  nodes
+			WHERE
+			  base_url = $base_url;`,
+				params,
+			)
+			if err != nil {
+				return errors.Wrap(err, "count nodes")
+			}
+			if nodes == 0 {
+				return &NodeNotFoundErr{Node: baseURL}
+			}
+			if err := tx.Exec(ctx, declare+`UPDATE nodes
+			SET
+			  last_seen = $last_seen,
+			  status = $status,
+			  status_error = $status_error,
+			  total_bytes = $total_bytes,
+			  free_bytes = $free_bytes,
+			  total_inodes = $total_inodes,
+			  free_inodes = $free_inodes
+			WHERE
+			  base_url = $base_url;`,
+				params,
+			); err != nil {
+				return errors.Wrap(err, "update")
+			}
+			return nil
+		}, query.WithIdempotent(),
+	); err != nil {
+		return errors.Wrap(err, "update node")
+	}
+
+	return nil
+}
+
+func (y YDBStorage) SetNodeDraining(ctx context.Context, baseURL string, draining bool) error {
+	ctx, span := y.tracer.Start(ctx, "meta.SetNodeDraining")
+	defer span.End()
+
+	if err := y.db.Table().DoTx(ctx,
+		func(ctx context.Context, tx table.TransactionActor) (err error) {
+			res, err := tx.Execute(ctx, `
+          DECLARE $base_url AS UTF8;
+          DECLARE $draining AS Bool;
+          UPDATE nodes
+          SET draining = $draining
+          WHERE base_url = $base_url;
+        `,
+				table.NewQueryParameters(
+					table.ValueParam("$base_url", types.UTF8Value(baseURL)),
+					table.ValueParam("$draining", types.BoolValue(draining)),
+				),
+			)
+			if err != nil {
+				return errors.Wrap(err, "execute")
+			}
+			if err = res.Err(); err != nil {
+				return errors.Wrap(err, "result")
+			}
+			if err := res.Close(); err != nil {
+				return errors.Wrap(err, "close")
+			}
+
+			return nil
+		}, table.WithIdempotent(),
+	); err != nil {
+		return errors.Wrap(err, "update node")
+	}
+
+	return nil
+}
+
+func (y YDBStorage) RemoveNode(ctx context.Context, baseURL string) error {
+	ctx, span := y.tracer.Start(ctx, "meta.RemoveNode")
+	defer span.End()
+
+	if err := y.db.Table().DoTx(ctx,
+		func(ctx context.Context, tx table.TransactionActor) (err error) {
+			res, err := tx.Execute(ctx, `DECLARE $base_url AS UTF8;
+			DELETE FROM nodes
+			WHERE
+			  base_url = $base_url;`,
+				table.NewQueryParameters(
+					table.ValueParam("$base_url", types.UTF8Value(baseURL)),
+				),
+			)
+			if err != nil {
+				return errors.Wrap(err, "execute")
+			}
+			if err = res.Err(); err != nil {
+				return errors.Wrap(err, "result")
+			}
+			if err := res.Close(); err != nil {
+				return errors.Wrap(err, "close")
+			}
+
+			return nil
+		}, table.WithIdempotent(),
+	); err != nil {
+		return errors.Wrap(err, "delete node")
+	}
+
+	return nil
+}
+
+// uploadKeyPrefix returns prefix of keys of multipart upload part chunks
+// in chunks table. File names can't contain NUL, so it never clashes with
+// file name.
+func uploadKeyPrefix(id uuid.UUID) string {
+	return "\x00upload/" + id.String() + "/"
+}
+
+// partKey returns key of part chunks in chunks table.
+func partKey(id uuid.UUID, number int) string {
+	return fmt.Sprintf("%s%05d", uploadKeyPrefix(id), number)
+}
+
+// versionKeysPrefix is the prefix of names of all noncurrent versions.
+const versionKeysPrefix = "\x00version/"
+
+// versionKeyPrefix returns prefix of names of noncurrent versions of file in
+// files and chunks tables. File names can't contain NUL, so it never clashes
+// with file name or prefix of other file versions.
+func versionKeyPrefix(name string) string {
+	return versionKeysPrefix + name + "\x00"
+}
+
+// versionKey returns name of noncurrent version of file. Keys of versions
+// are ordered by time of upload.
+func versionKey(name string, version uuid.UUID) string {
+	return versionKeyPrefix(name) + version.String()
+}
+
+func (y YDBStorage) AddBucket(ctx context.Context, bucket Bucket) error {
+	ctx, span := y.tracer.Start(ctx, "meta.AddBucket")
+	defer span.End()
+
+	if err := y.db.Query().DoTx(ctx,
+		func(ctx context.Context, tx query.TxActor) (err error) {
+			row, err := tx.QueryRow(ctx, `DECLARE $name AS UTF8;
+			SELECT
+			  COUNT(*) AS count
+			FROM
+			  buckets
+			WHERE
+			  name = $name;`,
+				query.WithParameters(
+					table.NewQueryParameters(
+						table.ValueParam("$name", types.UTF8Value(bucket.Name)),
+					),
+				),
+			)
+			if err != nil {
+				return errors.Wrap(err, "query bucket")
+			}
+			var v struct {
+				Count uint64 `sql:"count"`
+			}
+			if err := row.ScanStruct(&v); err != nil {
+				return errors.Wrap(err, "scan")
+			}
+			if v.Count > 0 {
+				return &BucketExistsErr{Bucket: bucket.Name}
+			}
+			if err := tx.Exec(ctx, `
+          DECLARE $name AS UTF8;
+          DECLARE $created_at AS Timestamp;
+          UPSERT INTO buckets ( name, created_at )
+          VALUES ( $name, $created_at );
+        `,
+				query.WithParameters(
+					table.NewQueryParameters(
+						table.ValueParam("$name", types.UTF8Value(bucket.Name)),
+						table.ValueParam("$created_at", types.TimestampValueFromTime(bucket.CreatedAt)),
+					),
+				),
+			); err != nil {
+				return errors.Wrap(err, "upsert bucket")
+			}
+			return nil
+		}, query.WithIdempotent(),
+	); err != nil {
+		return errors.Wrap(err, "add bucket")
+	}
+
+	return nil
+}
+
+func (y YDBStorage) Bucket(ctx context.Context, name string) (*Bucket, error) {
+	ctx, span := y.tracer.Start(ctx, "meta.Bucket")
+	defer span.End()
+
+	buckets, err := y.buckets(ctx, &name)
+	if err != nil {
+		return nil, err
+	}
+	if len(buckets) == 0 {
+		return nil, &BucketNotFoundErr{Bucket: name}
+	}
+	return &buckets[0], nil
+}
+
+func (y YDBStorage) Buckets(ctx context.Context) ([]Bucket, error) {
+	ctx, span := y.tracer.Start(ctx, "meta.Buckets")
+	defer span.End()
+
+	return y.buckets(ctx, nil)
+}
+
+// buckets returns bucket with name, or all buckets if name is nil.
+func (y YDBStorage) buckets(ctx context.Context, name *string) ([]Bucket, error) {
+	var (
+		q      = `SELECT name, created_at FROM buckets ORDER BY name;`
+		params []table.ParameterOption
+	)
+	if name != nil {
+		q = `DECLARE $name AS UTF8;
+			SELECT name, created_at FROM buckets WHERE name = $name;`
+		params = append(params, table.ValueParam("$name", types.UTF8Value(*name)))
+	}
+	var buckets []Bucket
+	if err := y.db.Query().Do(ctx,
+		func(ctx context.Context, s query.Session) error {
+			buckets = buckets[:0]
+			res, err := s.Query(ctx, q,
+				query.WithParameters(table.NewQueryParameters(params...)),
+			)
+			if err != nil {
+				return errors.Wrap(err, "query")
+			}
+			for rs, err := range res.ResultSets(ctx) {
+				if err != nil {
+					return errors.Wrap(err, "result set")
+				}
+				for row, err := range rs.Rows(ctx) {
+					if err != nil {
+						return errors.Wrap(err, "row")
+					}
+					var v struct {
+						Name      string     `sql:"name"`
+						CreatedAt *time.Time `sql:"created_at"`
+					}
+					if err := row.ScanStruct(&v); err != nil {
+						return errors.Wrap(err, "scan")
+					}
+					bucket := Bucket{Name: v.Name}
+					if v.CreatedAt != nil {
+						bucket.CreatedAt = *v.CreatedAt
+					}
+					buckets = append(buckets, bucket)
+				}
+			}
+			return nil
+		},
+	); err != nil {
+		return nil, errors.Wrap(err, "do")
+	}
+
+	return buckets, nil
+}
+
+func (y YDBStorage) RemoveBucket(ctx context.Context, name string) error {
+	ctx, span := y.tracer.Start(ctx, "meta.RemoveBucket")
+	defer span.End()
+
+	if err := y.db.Query().DoTx(ctx,
+		func(ctx context.Context, tx query.TxActor) (err error) {
+			row, err := tx.QueryRow(ctx, `DECLARE $name AS UTF8;
+			SELECT
+			  COUNT(*) AS count
+			FROM
+			  buckets
+			WHERE
+			  name = $name;`,
+				query.WithParameters(
+					table.NewQueryParameters(
+						table.ValueParam("$name", types.UTF8Value(name)),
+					),
+				),
+			)
+			if err != nil {
+				return errors.Wrap(err, "query bucket")
+			}
+			var v struct {
+				Count uint64 `sql:"count"`
+			}
+			if err := row.ScanStruct(&v); err != nil {
+				return errors.Wrap(err, "scan")
+			}
+			if v.Count == 0 {
+				return &BucketNotFoundErr{Bucket: name}
+			}
+			if err := tx.Exec(ctx, `DECLARE $name AS UTF8;
+			DELETE FROM buckets
+			WHERE
+			  name = $name;`,
+				query.WithParameters(
+					table.NewQueryParameters(
+						table.ValueParam("$name", types.UTF8Value(name)),
+					),
+				),
+			); err != nil {
+				return errors.Wrap(err, "delete bucket")
+			}
+			return nil
+		}, query.WithIdempotent(),
+	); err != nil {
+		return errors.Wrap(err, "remove bucket")
+	}
+
+	return nil
+}
+
+func (y YDBStorage) AddUpload(ctx context.Context, upload Upload) error {
+	ctx, span := y.tracer.Start(ctx, "meta.AddUpload")
+	defer span.End()
+
+	if err := y.db.Table().DoTx(ctx,
+		func(ctx context.Context, tx table.TransactionActor) (err error) {
+			res, err := tx.Execute(ctx, `
+          DECLARE $id AS UUID;
+          DECLARE $name AS UTF8;
+          DECLARE $content_type AS UTF8;
+          DECLARE $length AS Uint64;
+          DECLARE $created_at AS Timestamp;
+          DECLARE $updated_at AS Timestamp;
+          UPSERT INTO uploads ( id, name, content_type, length, created_at, updated_at )
+          VALUES ( $id, $name, $content_type, $length, $created_at, $updated_at );
+        `,
+				table.NewQueryParameters(
+					table.ValueParam("$id", types.UuidValue(upload.ID)),
+					table.ValueParam("$name", types.UTF8Value(upload.Name)),
+					table.ValueParam("$content_type", types.UTF8Value(upload.ContentType)),
+					table.ValueParam("$length", types.Uint64Value(uint64(max(upload.Length, 0)))),
+					table.ValueParam("$created_at", types.TimestampValueFromTime(upload.CreatedAt)),
+					table.ValueParam("$updated_at", types.TimestampValueFromTime(upload.UpdatedAt)),
+				),
+			)
+			if err != nil {
+				return errors.Wrap(err, "execute")
+			}
+			if err = res.Err(); err != nil {
+				return errors.Wrap(err, "result")
+			}
+			return res.Close()
+		}, table.WithIdempotent(),
+	); err != nil {
+		return errors.Wrap(err, "upsert upload")
+	}
+
+	return nil
+}
+
+func (y YDBStorage) Upload(ctx context.Context, id uuid.UUID) (*Upload, error) {
+	ctx, span := y.tracer.Start(ctx, "meta.Upload")
+	defer span.End()
+
+	uploads, err := y.uploads(ctx, `DECLARE $id AS UUID;
+			SELECT id, name, content_type, length, created_at, updated_at FROM uploads WHERE id = $id;`,
+		table.ValueParam("$id", types.UuidValue(id)),
+	)
+	if err != nil {
+		return nil, err
+	}
+	if len(uploads) == 0 {
+		return nil, &UploadNotFoundErr{Upload: id}
+	}
+
+	return &uploads[0], nil
+}
+
+func (y YDBStorage) Uploads(ctx context.Context, updatedBefore time.Time, limit int) ([]Upload, error) {
+	ctx, span := y.tracer.Start(ctx, "meta.Uploads")
+	defer span.End()
+
+	// Uploads created before updated_at was introduced don't have it.
+	return y.uploads(ctx, `DECLARE $before AS Timestamp;
+			DECLARE $limit AS Uint64;
+			SELECT id, name, content_type, length, created_at, updated_at FROM uploads
+			WHERE COALESCE(updated_at, created_at) < $before
+			LIMIT $limit;`,
+		table.ValueParam("$before", types.TimestampValueFromTime(updatedBefore)),
+		table.ValueParam("$limit", types.Uint64Value(uint64(max(limit, 0)))),
+	)
+}
+
+// uploads returns multipart uploads selected by query q.
+func (y YDBStorage) uploads(ctx context.Context, q string, params ...table.ParameterOption) ([]Upload, error) {
+	var uploads []Upload
+	if err := y.db.Query().Do(ctx,
+		func(ctx context.Context, s query.Session) error {
+			uploads = uploads[:0]
+			res, err := s.Query(ctx, q,
+				query.WithParameters(table.NewQueryParameters(params...)),
+			)
+			if err != nil {
+				return errors.Wrap(err, "query")
+			}
+			for rs, err := range res.ResultSets(ctx) {
+				if err != nil {
+					return errors.Wrap(err, "result set")
+				}
+				for row, err := range rs.Rows(ctx) {
+					if err != nil {
+						return errors.Wrap(err, "row")
+					}
+					var v struct {
+						ID          uuid.UUID  `sql:"id"`
+						Name        string     `sql:"name"`
+						ContentType *string    `sql:"content_type"`
+						Length      *uint64    `sql:"length"`
+						CreatedAt   *time.Time `sql:"created_at"`
+						UpdatedAt   *time.Time `sql:"updated_at"`
+					}
+					if err := row.ScanStruct(&v); err != nil {
+						return errors.Wrap(err, "scan")
+					}
+					upload := Upload{
+						ID:   v.ID,
+						Name: v.Name,
+					}
+					if v.ContentType != nil {
+						upload.ContentType = *v.ContentType
+					}
+					if v.Length != nil {
+						upload.Length = int64(*v.Length)
+					}
+					if v.CreatedAt != nil {
+						upload.CreatedAt = *v.CreatedAt
+					}
+					upload.UpdatedAt = upload.CreatedAt
+					if v.UpdatedAt != nil {
+						upload.UpdatedAt = *v.UpdatedAt
+					}
+					uploads = append(uploads, upload)
+				}
+			}
+			return nil
+		},
+	); err != nil {
+		return nil, errors.Wrap(err, "do")
+	}
+
+	return uploads, nil
+}
+
+// txUploadParts returns numbers of parts of multipart upload in
+// transaction, or *UploadNotFoundErr.
+func txUploadParts(ctx context.Context, tx query.TxActor, id uuid.UUID) ([]int, error) {
+	row, err := tx.QueryRow(ctx, `DECLARE $id AS UUID;
+			SELECT
+			  COUNT(*) AS count
+			FROM
+			  uploads
+			WHERE
+			  id = $id;`,
+		query.WithParameters(
+			table.NewQueryParameters(
+				table.ValueParam("$id", types.UuidValue(id)),
+			),
+		),
+	)
+	if err != nil {
+		return nil, errors.Wrap(err, "query upload")
+	}
+	var v struct {
+		Count uint64 `sql:"count"`
+	}
+	if err := row.ScanStruct(&v); err != nil {
+		return nil, errors.Wrap(err, "scan")
+	}
+	if v.Count == 0 {
+		return nil, &UploadNotFoundErr{Upload: id}
+	}
+
+	res, err := tx.Query(ctx, `DECLARE $id AS UUID;
+			SELECT
+			  number
+			FROM
+			  parts
+			WHERE
+			  upload = $id
+			ORDER BY
+			  number;`,
+		query.WithParameters(
+			table.NewQueryParameters(
+				table.ValueParam("$id", types.UuidValue(id)),
+			),
+		),
+	)
+	if err != nil {
+		return nil, errors.Wrap(err, "query parts")
+	}
+	var numbers []int
+	for rs, err := range res.ResultSets(ctx) {
+		if err != nil {
+			return nil, errors.Wrap(err, "result set")
+		}
+		for row, err := range rs.Rows(ctx) {
+			if err != nil {
+				return nil, errors.Wrap(err, "row")
+			}
+			var v struct {
+				Number uint64 `sql:"number"`
+			}
+			if err := row.ScanStruct(&v); err != nil {
+				return nil, errors.Wrap(err, "scan")
+			}
+			numbers = append(numbers, int(v.Number))
+		}
+	}
+	return numbers, nil
+}
+
+func (y YDBStorage) AddPart(ctx context.Context, id uuid.UUID, part Part) error {
+	ctx, span := y.tracer.Start(ctx, "meta.AddPart")
+	defer span.End()
+
+	if err := y.db.Query().DoTx(ctx,
+		func(ctx context.Context, tx query.TxActor) (err error) {
+			if _, err := txUploadParts(ctx, tx, id); err != nil {
+				return errors.Wrap(err, "upload parts")
+			}
+			return txAddPart(ctx, tx, id, part)
+		}, query.WithIdempotent(),
+	); err != nil {
+		return errors.Wrap(err, "add part")
+	}
+
+	return nil
+}
+
+func (y YDBStorage) AppendPart(ctx context.Context, id uuid.UUID, part Part) error {
+	ctx, span := y.tracer.Start(ctx, "meta.AppendPart")
+	defer span.End()
+
+	if err := y.db.Query().DoTx(ctx,
+		func(ctx context.Context, tx query.TxActor) (err error) {
+			numbers, err := txUploadParts(ctx, tx, id)
+			if err != nil {
+				return errors.Wrap(err, "upload parts")
+			}
+			// Parts of resumable upload are numbered without gaps, so the
+			// count is the number of the last one. Concurrent append of the
+			// same number conflicts on commit, and its retry fails here.
+			if len(numbers) != part.Number-1 {
+				return &PartChangedErr{Upload: id, Number: part.Number}
+			}
+			return txAddPart(ctx, tx, id, part)
+		}, query.WithIdempotent(),
+	); err != nil {
+		return errors.Wrap(err, "append part")
+	}
+
+	return nil
+}
+
+// txAddPart adds or replaces part of multipart upload and prolongs upload in
+// transaction.
+func txAddPart(ctx context.Context, tx query.TxActor, id uuid.UUID, part Part) error {
+	if err := replaceChunks(ctx, tx, map[string][]Chunk{partKey(id, part.Number): part.Chunks}); err != nil {
+		return errors.Wrap(err, "replace chunks")
+	}
+	if err := tx.Exec(ctx, `
+          DECLARE $upload AS UUID;
+          DECLARE $number AS UInt64;
+          DECLARE $size AS UInt64;
+          DECLARE $checksum AS String;
+          DECLARE $created_at AS Timestamp;
+          UPSERT INTO parts ( upload, number, size, checksum, created_at )
+          VALUES ( $upload, $number, $size, $checksum, $created_at );
+          UPDATE uploads
+          SET updated_at = $created_at
+          WHERE id = $upload;
+        `,
+		query.WithParameters(
+			table.NewQueryParameters(
+				table.ValueParam("$upload", types.UuidValue(id)),
+				table.ValueParam("$number", types.Uint64Value(uint64(part.Number))),
+				table.ValueParam("$size", types.Uint64Value(uint64(part.Size))),
+				table.ValueParam("$checksum", types.BytesValue(part.Checksum)),
+				table.ValueParam("$created_at", types.TimestampValueFromTime(part.CreatedAt)),
+			),
+		),
+	); err != nil {
+		return errors.Wrap(err, "upsert part")
+	}
+	return nil
+}
+
+func (y YDBStorage) Parts(ctx context.Context, id uuid.UUID) ([]Part, error) {
+	ctx, span := y.tracer.Start(ctx, "meta.Parts")
+	defer span.End()
+
+	var parts []Part
+	if err := y.db.Query().DoTx(ctx,
+		func(ctx context.Context, tx query.TxActor) (err error) {
+			parts, err = txParts(ctx, tx, id)
+			return err
+		},
+		query.WithIdempotent(),
+		query.WithTxSettings(query.TxSettings(query.WithSnapshotReadOnly())),
+	); err != nil {
+		return nil, errors.Wrap(err, "do")
+	}
+
+	return parts, nil
+}
+
+// txParts returns parts of multipart upload with their chunks ordered by
+// number in transaction.
+func txParts(ctx context.Context, tx query.TxActor, id uuid.UUID) ([]Part, error) {
+	var parts []Part
+	res, err := tx.Query(ctx,
+		`DECLARE $id AS UUID;
+			SELECT
+			  number,
+			  size,
+			  checksum,
+			  created_at
+			FROM
+			  parts
+			WHERE
+			  upload = $id
+			ORDER BY
+			  number;`,
+		query.WithParameters(
+			table.NewQueryParameters(
+				table.ValueParam("$id", types.UuidValue(id)),
+			),
+		),
+	)
+	if err != nil {
+		return nil, errors.Wrap(err, "query parts")
+	}
+	for rs, err := range res.ResultSets(ctx) {
+		if err != nil {
+			return nil, errors.Wrap(err, "result set")
+		}
+		for row, err := range rs.Rows(ctx) {
+			if err != nil {
+				return nil, errors.Wrap(err, "row")
+			}
+			var v struct {
+				Number    uint64     `sql:"number"`
+				Size      uint64     `sql:"size"`
+				Checksum  *[]byte    `sql:"checksum"`
+				CreatedAt *time.Time `sql:"created_at"`
+			}
+			if err := row.ScanStruct(&v); err != nil {
+				return nil, errors.Wrap(err, "scan")
+			}
+			part := Part{
+				Number: int(v.Number),
+				Size:   int64(v.Size),
+			}
+			if v.Checksum != nil && len(*v.Checksum) > 0 {
+				part.Checksum = *v.Checksum
+			}
+			if v.CreatedAt != nil {
+				part.CreatedAt = *v.CreatedAt
+			}
+			parts = append(parts, part)
+		}
+	}
+
+	// Chunks of all parts are the range of keys with upload prefix.
+	keys := make(map[string]int, len(parts))
+	for i, part := range parts {
+		keys[partKey(id, part.Number)] = i
+	}
+	prefix := uploadKeyPrefix(id)
+	res, err = tx.Query(ctx,
+		`DECLARE $from AS UTF8;
+			DECLARE $to AS UTF8;
+			SELECT
+			  c.file AS file,
+			  c.index AS index,
+			  c.id AS id,
+			  c.offset AS offset,
+			  c.size AS size,
+			  c.checksum AS checksum,
+			  r.node AS node
+			FROM
+			  chunks AS c
+			  LEFT JOIN replicas AS r ON c.id = r.id
+			WHERE
+			  c.file >= $from AND c.file < $to
+			ORDER BY
+			  file, index, node;`,
+		query.WithParameters(
+			table.NewQueryParameters(
+				table.ValueParam("$from", types.UTF8Value(prefix)),
+				table.ValueParam("$to", types.UTF8Value(prefixEnd(prefix))),
+			),
+		),
+	)
+	if err != nil {
+		return nil, errors.Wrap(err, "query chunks")
+	}
+	for rs, err := range res.ResultSets(ctx) {
+		if err != nil {
+			return nil, errors.Wrap(err, "result set")
+		}
+		for row, err := range rs.Rows(ctx) {
+			if err != nil {
+				return nil, errors.Wrap(err, "row")
+			}
+			var v struct {
+				File     string    `sql:"file"`
+				Index    uint64    `sql:"index"`
+				ID       uuid.UUID `sql:"id"`
+				Offset   uint64    `sql:"offset"`
+				Size     uint64    `sql:"size"`
+				Checksum *[]byte   `sql:"checksum"`
+				Node     *string   `sql:"node"`
+			}
+			if err := row.ScanStruct(&v); err != nil {
+				return nil, errors.Wrap(err, "scan")
+			}
+			i, ok := keys[v.File]
+			if !ok {
+				continue
+			}
+			chunks := &parts[i].Chunks
+			if n := len(*chunks); n == 0 || (*chunks)[n-1].Index != int(v.Index) {
+				chunk := Chunk{
+					Index:  int(v.Index),
+					ID:     v.ID,
+					Offset: int64(v.Offset),
+					Size:   int64(v.Size),
+				}
+				if v.Checksum != nil && len(*v.Checksum) > 0 {
+					chunk.Checksum = *v.Checksum
+				}
+				*chunks = append(*chunks, chunk)
+			}
+			if v.Node != nil {
+				// Row per replica.
+				last := &(*chunks)[len(*chunks)-1]
+				last.Nodes = append(last.Nodes, *v.Node)
+			}
+		}
+	}
+	return parts, nil
+}
+
+func (y YDBStorage) CompleteUpload(ctx context.Context, id uuid.UUID, parts []Part, file File) error {
+	ctx, span := y.tracer.Start(ctx, "meta.CompleteUpload")
+	defer span.End()
+
+	if err := y.db.Query().DoTx(ctx,
+		func(ctx context.Context, tx query.TxActor) (err error) {
+			if _, err := txUploadParts(ctx, tx, id); err != nil {
+				return errors.Wrap(err, "upload parts")
+			}
+			// File is assembled from chunks that are recorded now, so
+			// concurrently replaced part is not published without its
+			// references.
+			recorded, err := txParts(ctx, tx, id)
+			if err != nil {
+				return errors.Wrap(err, "parts")
+			}
+			selected, err := selectParts(id, recorded, parts)
+			if err != nil {
+				return err
+			}
+			file := file
+			assembleChunks(&file, selected)
+			// Chunks of parts are moved to file.
+			files := make(map[string][]Chunk)
+			for _, part := range recorded {
+				files[partKey(id, part.Number)] = nil
+			}
+			if err := txReplaceFile(ctx, tx, file, files); err != nil {
+				return errors.Wrap(err, "replace file")
+			}
+			return txRemoveUpload(ctx, tx, id)
+		}, query.WithIdempotent(),
+	); err != nil {
+		return errors.Wrap(err, "complete upload")
+	}
+
+	return nil
+}
+
+func (y YDBStorage) RemoveUpload(ctx context.Context, id uuid.UUID) error {
+	ctx, span := y.tracer.Start(ctx, "meta.RemoveUpload")
+	defer span.End()
+
+	if err := y.db.Query().DoTx(ctx,
+		func(ctx context.Context, tx query.TxActor) (err error) {
+			return txAbortUpload(ctx, tx, id)
+		}, query.WithIdempotent(),
+	); err != nil {
+		return errors.Wrap(err, "remove upload")
+	}
+
+	return nil
+}
+
+func (y YDBStorage) RemoveStaleUpload(ctx context.Context, id uuid.UUID, updatedBefore time.Time) error {
+	ctx, span := y.tracer.Start(ctx, "meta.RemoveStaleUpload")
+	defer span.End()
+
+	if err := y.db.Query().DoTx(ctx,
+		func(ctx context.Context, tx query.TxActor) (err error) {
+			// Part can be added after upload was listed as stale.
+			stale, err := txCount(ctx, tx, `DECLARE $id AS UUID;
+			DECLARE $before AS Timestamp;
+			SELECT
+			  COUNT(*) AS count
+			FROM
+			  uploads
+			WHERE
+			  id = $id AND COALESCE(updated_at, created_at) < $before;`,
+				query.WithParameters(
+					table.NewQueryParameters(
+						table.ValueParam("$id", types.UuidValue(id)),
+						table.ValueParam("$before", types.TimestampValueFromTime(updatedBefore)),
+					),
+				),
+			)
+			if err != nil {
+				return errors.Wrap(err, "count stale")
+			}
+			if stale == 0 {
+				return &UploadNotFoundErr{Upload: id}
+			}
+			return txAbortUpload(ctx, tx, id)
+		}, query.WithIdempotent(),
+	); err != nil {
+		return errors.Wrap(err, "remove stale upload")
+	}
+
+	return nil
+}
+
+// txAbortUpload removes multipart upload with all its parts and releases
+// their chunks in transaction.
+func txAbortUpload(ctx context.Context, tx query.TxActor, id uuid.UUID) error {
+	numbers, err := txUploadParts(ctx, tx, id)
+	if err != nil {
+		return errors.Wrap(err, "upload parts")
+	}
+	files := make(map[string][]Chunk)
+	for _, number := range numbers {
+		files[partKey(id, number)] = nil
+	}
+	if err := replaceChunks(ctx, tx, files); err != nil {
+		return errors.Wrap(err, "replace chunks")
+	}
+	return txRemoveUpload(ctx, tx, id)
+}
+
+// txRemoveUpload removes rows of multipart upload and its parts in
+// transaction.
+func txRemoveUpload(ctx context.Context, tx query.TxActor, id uuid.UUID) error {
+	if err := tx.Exec(ctx, `DECLARE $id AS UUID;
+			DELETE FROM parts
+			WHERE
+			  upload = $id;
+			DELETE FROM uploads
+			WHERE
+			  id = $id;`,
+		query.WithParameters(
+			table.NewQueryParameters(
+				table.ValueParam("$id", types.UuidValue(id)),
+			),
+		),
+	); err != nil {
+		return errors.Wrap(err, "delete upload")
+	}
 	return nil
 }
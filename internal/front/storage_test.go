@@ -14,6 +14,7 @@ import (
 	"go.opentelemetry.io/otel/trace/noop"
 
 	"github.com/ernado/stor/internal/integration"
+	"github.com/ernado/stor/internal/node"
 )
 
 func newYDB(t *testing.T) *ydb.Driver {
@@ -54,6 +55,18 @@ func newYDB(t *testing.T) *ydb.Driver {
 	return db
 }
 
+// garbageKeys returns chunk and node of every replica in garbage.
+func garbageKeys(ctx context.Context, t *testing.T, storage YDBStorage) []Replica {
+	t.Helper()
+	replicas, err := storage.Garbage(ctx, Replica{}, 10)
+	require.NoError(t, err)
+	var keys []Replica
+	for _, replica := range replicas {
+		keys = append(keys, Replica{ChunkID: replica.ChunkID, Node: replica.Node})
+	}
+	return keys
+}
+
 func TestIntegrationYDBStorage(t *testing.T) {
 	integration.Skip(t)
 	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
@@ -88,31 +101,66 @@ func TestIntegrationYDBStorage(t *testing.T) {
 		for i, node := range nodes {
 			require.Contains(t, nodesURLs, node.BaseURL, "node %d", i)
 		}
+
+		// Heartbeat updates only registered node.
+		lastSeen := time.Now().UTC().Truncate(time.Microsecond)
+		status := node.Status{
+			State:    node.StateOK,
+			Capacity: &node.Capacity{TotalBytes: 100, FreeBytes: 50},
+		}
+		require.NoError(t, storage.UpdateNode(ctx, nodesURLs[0], lastSeen, status))
+		nodes, err = storage.Nodes(ctx)
+		require.NoError(t, err)
+		require.Len(t, nodes, 3)
+		for _, n := range nodes {
+			if n.BaseURL == nodesURLs[0] {
+				require.True(t, lastSeen.Equal(n.LastSeen))
+				require.Equal(t, status, n.Status)
+			}
+		}
+		var notFound *NodeNotFoundErr
+		require.ErrorAs(t, storage.UpdateNode(ctx, "http://localhost:8090", lastSeen, status), &notFound)
 	}
 	{
 		ctx, cancel := context.WithTimeout(ctx, timeout)
 		defer cancel()
 		t.Log("Inserting files")
+		shared := Chunk{
+			Nodes:    []string{"http://localhost:8080"},
+			Index:    0,
+			ID:       uuid.New(),
+			Offset:   0,
+			Size:     1024,
+			Checksum: []byte{4, 5, 6},
+		}
 		files := []File{
 			{
-				Name: "file1",
+				Name:        "file1",
+				ContentType: "text/plain",
+				Checksum:    []byte{1, 2, 3},
+				ChunkCount:  2,
+				CreatedAt:   time.Unix(1700000000, 0),
 				Chunks: []Chunk{
+					shared,
 					{
-						NodeBaseURL: "http://localhost:8080",
-						Index:       0,
-						ID:          uuid.New(),
-						Offset:      0,
-						Size:        1024,
-					},
-					{
-						NodeBaseURL: "http://localhost:8081",
-						Index:       1,
-						ID:          uuid.New(),
-						Offset:      1024,
-						Size:        1024,
+						Nodes:  []string{"http://localhost:8081"},
+						Index:  1,
+						ID:     uuid.New(),
+						Offset: 1024,
+						Size:   1024,
 					},
 				},
 			},
+			{
+				Name:       "file2",
+				Checksum:   []byte{4, 5, 6},
+				ChunkCount: 1,
+				Chunks:     []Chunk{shared},
+			},
+			{
+				Name:     "empty",
+				Checksum: []byte{7, 8, 9},
+			},
 		}
 		for _, file := range files {
 			require.NoError(t, storage.AddFile(ctx, file))
@@ -120,16 +168,244 @@ func TestIntegrationYDBStorage(t *testing.T) {
 		stats, err := storage.NodeStats(ctx)
 		require.NoError(t, err, "fetch node stats")
 		require.Len(t, stats, 3)
-		for _, file := range files {
+		replicas, err := storage.ChunkReplicas(ctx, shared.ID)
+		require.NoError(t, err)
+		require.Equal(t, shared.Nodes, replicas)
+		var (
+			notFound    *NodeNotFoundErr
+			lastReplica *LastReplicaErr
+		)
+		require.ErrorAs(t, storage.RemoveReportedReplica(ctx, shared.ID, "http://localhost:9090"), &notFound)
+		require.ErrorAs(t, storage.RemoveReportedReplica(ctx, shared.ID, shared.Nodes[0]), &lastReplica)
+		replicas, err = storage.ChunkReplicas(ctx, shared.ID)
+		require.NoError(t, err)
+		require.Equal(t, shared.Nodes, replicas, "last replica should be kept")
+		var released *ChunkReleasedErr
+		require.ErrorAs(t, storage.AddReplica(ctx, Chunk{ID: uuid.New(), Size: 1024}, shared.Nodes[0]), &released)
+		var replicaNotFound *ReplicaNotFoundErr
+		require.ErrorAs(t, storage.MoveReplica(ctx, shared, "http://localhost:8082", "http://localhost:8081", time.Now()), &replicaNotFound)
+		replicas, err = storage.ChunkReplicas(ctx, shared.ID)
+		require.NoError(t, err)
+		require.Equal(t, shared.Nodes, replicas, "replica should not be moved from missing one")
+
+		listed, err := storage.Files(ctx, "file", "", 10)
+		require.NoError(t, err)
+		require.Equal(t, []FileInfo{
+			{Name: "file1", ChunkCount: 2, CreatedAt: files[0].CreatedAt},
+			{Name: "file2", ChunkCount: 1},
+		}, listed)
+		listed, err = storage.Files(ctx, "", "file1\x00", 1)
+		require.NoError(t, err)
+		require.Equal(t, []FileInfo{{Name: "file2", ChunkCount: 1}}, listed)
+
+		// Replicas are listed page by page.
+		all, err := storage.Replicas(ctx, Replica{}, 10)
+		require.NoError(t, err)
+		require.Len(t, all, 2)
+		page, err := storage.Replicas(ctx, all[0], 10)
+		require.NoError(t, err)
+		require.Equal(t, all[1:], page)
+		recorded, err := storage.RecordedRange(ctx, "http://localhost:8081", uuid.Nil, uuid.Max)
+		require.NoError(t, err)
+		require.Equal(t, []uuid.UUID{files[0].Chunks[1].ID}, recorded)
+		nodeChunks, err := storage.NodeReplicas(ctx, shared.Nodes[0], uuid.Nil, 10)
+		require.NoError(t, err)
+		require.Equal(t, []Chunk{{
+			ID:       shared.ID,
+			Size:     shared.Size,
+			Nodes:    shared.Nodes,
+			Checksum: shared.Checksum,
+		}}, nodeChunks)
+		chunkFile, err := storage.ChunkFile(ctx, files[0].Chunks[1].ID)
+		require.NoError(t, err)
+		require.Equal(t, "file1", chunkFile.Name)
+		var fileNotFound *FileNotFoundErr
+		_, err = storage.ChunkFile(ctx, uuid.New())
+		require.ErrorAs(t, err, &fileNotFound)
+
+		// Shared chunk is released only with the last file.
+		garbage := [][]Replica{
+			{{ChunkID: files[0].Chunks[1].ID, Node: "http://localhost:8081"}},
+			{{ChunkID: shared.ID, Node: "http://localhost:8080"}},
+			nil,
+		}
+		for i, file := range files {
 			f, err := storage.File(ctx, file.Name)
 			require.NoError(t, err)
 			require.Equal(t, file, *f)
 
 			require.NoError(t, storage.RemoveFile(ctx, file.Name))
+			replicas, err := storage.Garbage(ctx, Replica{}, 10)
+			require.NoError(t, err)
+			for _, replica := range replicas {
+				require.False(t, replica.ReleasedAt.IsZero(), "release time should be recorded")
+			}
+			require.Equal(t, garbage[i], garbageKeys(ctx, t, storage))
+			for _, replica := range replicas {
+				require.NoError(t, storage.RemoveGarbage(ctx, replica))
+			}
+
 			_, err = storage.File(ctx, file.Name)
 			require.Error(t, err)
 			var nf *FileNotFoundErr
 			require.ErrorAs(t, err, &nf)
+			require.ErrorAs(t, storage.RemoveFile(ctx, file.Name), &nf)
+		}
+	}
+	{
+		ctx, cancel := context.WithTimeout(ctx, timeout)
+		defer cancel()
+		t.Log("Inserting buckets")
+		created := time.Unix(1700000000, 0)
+		require.NoError(t, storage.AddBucket(ctx, Bucket{Name: "photos", CreatedAt: created}))
+		var exists *BucketExistsErr
+		require.ErrorAs(t, storage.AddBucket(ctx, Bucket{Name: "photos"}), &exists)
+		require.NoError(t, storage.AddBucket(ctx, Bucket{Name: "docs", CreatedAt: created}))
+		buckets, err := storage.Buckets(ctx)
+		require.NoError(t, err)
+		require.Equal(t, []Bucket{
+			{Name: "docs", CreatedAt: created},
+			{Name: "photos", CreatedAt: created},
+		}, buckets)
+		require.NoError(t, storage.RemoveBucket(ctx, "docs"))
+		var notFound *BucketNotFoundErr
+		_, err = storage.Bucket(ctx, "docs")
+		require.ErrorAs(t, err, &notFound)
+		require.ErrorAs(t, storage.RemoveBucket(ctx, "docs"), &notFound)
+	}
+	{
+		ctx, cancel := context.WithTimeout(ctx, timeout)
+		defer cancel()
+		t.Log("Inserting multipart upload")
+		upload := Upload{
+			ID:          uuid.New(),
+			Name:        "photos/big.bin",
+			ContentType: "image/jpeg",
+			Length:      1536,
+			CreatedAt:   time.Unix(1700000000, 0),
+			UpdatedAt:   time.Unix(1700000000, 0),
+		}
+		require.NoError(t, storage.AddUpload(ctx, upload))
+		got, err := storage.Upload(ctx, upload.ID)
+		require.NoError(t, err)
+		require.Equal(t, upload, *got)
+		uploads, err := storage.Uploads(ctx, upload.CreatedAt.Add(time.Second), 10)
+		require.NoError(t, err)
+		require.Equal(t, []Upload{upload}, uploads)
+		uploads, err = storage.Uploads(ctx, upload.CreatedAt, 10)
+		require.NoError(t, err)
+		require.Empty(t, uploads)
+
+		parts := []Part{
+			{
+				Number:    1,
+				Size:      1024,
+				Checksum:  []byte{1},
+				CreatedAt: upload.CreatedAt,
+				Chunks: []Chunk{{
+					Nodes:    []string{"http://localhost:8080"},
+					ID:       uuid.New(),
+					Size:     1024,
+					Checksum: []byte{2},
+				}},
+			},
+			{
+				Number:    2,
+				Size:      512,
+				Checksum:  []byte{3},
+				CreatedAt: upload.CreatedAt.Add(time.Minute),
+				Chunks: []Chunk{{
+					Nodes:    []string{"http://localhost:8081"},
+					ID:       uuid.New(),
+					Size:     512,
+					Checksum: []byte{4},
+				}},
+			},
+		}
+		for _, part := range parts {
+			require.NoError(t, storage.AddPart(ctx, upload.ID, part))
+		}
+		listed, err := storage.Parts(ctx, upload.ID)
+		require.NoError(t, err)
+		require.Equal(t, parts, listed)
+		// Upload is prolonged by the last part.
+		got, err = storage.Upload(ctx, upload.ID)
+		require.NoError(t, err)
+		require.Equal(t, parts[1].CreatedAt, got.UpdatedAt)
+		var appended *PartChangedErr
+		require.ErrorAs(t, storage.AppendPart(ctx, upload.ID, parts[1]), &appended)
+		// Upload that was updated since given time is not stale.
+		var updated *UploadNotFoundErr
+		require.ErrorAs(t, storage.RemoveStaleUpload(ctx, upload.ID, parts[1].CreatedAt), &updated)
+		_, err = storage.Upload(ctx, upload.ID)
+		require.NoError(t, err)
+
+		// Part that changed since it was listed is not completed.
+		file := File{Name: upload.Name}
+		var changed *PartChangedErr
+		require.ErrorAs(t, storage.CompleteUpload(ctx, upload.ID, []Part{{Number: 1, Checksum: []byte{5}}}, file), &changed)
+		require.Equal(t, 1, changed.Number)
+
+		// Only the first part is completed, the second one is garbage.
+		require.NoError(t, storage.CompleteUpload(ctx, upload.ID, []Part{{Number: 1, Checksum: []byte{1}}}, file))
+		f, err := storage.File(ctx, file.Name)
+		require.NoError(t, err)
+		require.Equal(t, int64(1024), f.Size)
+		require.Equal(t, parts[0].Chunks, f.Chunks)
+		garbage := garbageKeys(ctx, t, storage)
+		require.Equal(t, []Replica{{ChunkID: parts[1].Chunks[0].ID, Node: "http://localhost:8081"}}, garbage)
+
+		var notFound *UploadNotFoundErr
+		_, err = storage.Upload(ctx, upload.ID)
+		require.ErrorAs(t, err, &notFound)
+		require.ErrorAs(t, storage.AddPart(ctx, upload.ID, parts[0]), &notFound)
+		require.ErrorAs(t, storage.RemoveUpload(ctx, upload.ID), &notFound)
+	}
+	{
+		ctx, cancel := context.WithTimeout(ctx, timeout)
+		defer cancel()
+		t.Log("Replacing file versions")
+		var files []File
+		for i := range 2 {
+			file := File{
+				Name:       "versioned",
+				Version:    uuid.Must(uuid.NewV7()),
+				Size:       1024,
+				Checksum:   []byte{byte(i)},
+				ChunkCount: 1,
+				Chunks: []Chunk{{
+					Nodes: []string{"http://localhost:8080"},
+					ID:    uuid.New(),
+					Size:  1024,
+				}},
+			}
+			require.NoError(t, storage.AddFile(ctx, file))
+			files = append(files, file)
 		}
+		// Replaced version is kept with its chunks.
+		key := versionKey("versioned", files[0].Version)
+		f, err := storage.File(ctx, key)
+		require.NoError(t, err)
+		require.Equal(t, files[0].Version, f.Version)
+		require.Equal(t, files[0].Chunks, f.Chunks)
+		f, err = storage.File(ctx, "versioned")
+		require.NoError(t, err)
+		require.Equal(t, files[1], *f)
+		replica := Replica{ChunkID: files[0].Chunks[0].ID, Node: "http://localhost:8080"}
+		garbage := garbageKeys(ctx, t, storage)
+		require.NotContains(t, garbage, replica)
+		listed, err := storage.Files(ctx, versionKeyPrefix("versioned"), "", 10)
+		require.NoError(t, err)
+		require.Len(t, listed, 1)
+		require.Equal(t, key, listed[0].Name)
+
+		// File is removed with all its versions.
+		require.NoError(t, storage.RemoveFile(ctx, "versioned"))
+		garbage = garbageKeys(ctx, t, storage)
+		require.Contains(t, garbage, replica)
+		require.Contains(t, garbage, Replica{ChunkID: files[1].Chunks[0].ID, Node: "http://localhost:8080"})
+		var nf *FileNotFoundErr
+		_, err = storage.File(ctx, key)
+		require.ErrorAs(t, err, &nf)
 	}
 }
@@ -0,0 +1,405 @@
+package front
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"unicode/utf8"
+
+	"github.com/go-faster/errors"
+	"github.com/go-faster/sdk/zctx"
+	"github.com/google/uuid"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+	"go.uber.org/zap"
+	"golang.org/x/sync/errgroup"
+	"golang.org/x/sync/semaphore"
+)
+
+// uploadBody uploads file from raw request body.
+func (h *Handler) uploadBody(w http.ResponseWriter, r *http.Request) {
+	ctx, span := h.tracer.Start(r.Context(), "handler.UploadBody")
+	defer span.End()
+
+	h.uploadStream(ctx, w, r, r.PathValue("fileName"), r.Header.Get("Content-Type"), r.Body)
+}
+
+// uploadMultipart uploads first file of multipart form, reading it
+// directly from request body.
+func (h *Handler) uploadMultipart(w http.ResponseWriter, r *http.Request) {
+	ctx, span := h.tracer.Start(r.Context(), "handler.UploadMultipart")
+	defer span.End()
+
+	mr, err := r.MultipartReader()
+	if err != nil {
+		httpError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	for {
+		part, err := mr.NextPart()
+		if errors.Is(err, io.EOF) {
+			httpError(w, "file is required", http.StatusBadRequest)
+			return
+		}
+		if err != nil {
+			httpError(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if part.FileName() == "" {
+			// Skip non-file fields.
+			continue
+		}
+		zctx.From(ctx).Info("Selected file from form", zap.String("formKey", part.FormName()))
+		h.uploadStream(ctx, w, r, part.FileName(), part.Header.Get("Content-Type"), part)
+		return
+	}
+}
+
+// uploadStream uploads file from r of unknown size.
+func (h *Handler) uploadStream(ctx context.Context, w http.ResponseWriter, r *http.Request, name, contentType string, body io.Reader) {
+	if err := validateFileName(name); err != nil {
+		httpError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	file := File{
+		Name:        name,
+		ContentType: contentType,
+		CreatedAt:   h.now(),
+	}
+	var err error
+	if file.DataShards, file.ParityShards, err = parseErasure(r); err != nil {
+		httpError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	chunker, err := h.chunking.chunker(r)
+	if err != nil {
+		httpError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if _, ok := chunker.(CDCChunker); ok && file.Erasure() {
+		httpError(w, "content-defined chunking is not supported for erasure coding", http.StatusBadRequest)
+		return
+	}
+	trace.SpanFromContext(ctx).AddEvent("Splitting file into chunks",
+		trace.WithAttributes(
+			attribute.String("fileName", name),
+			attribute.Int64("maxChunkSize", chunker.MaxSize()),
+			attribute.Int("replicationFactor", h.replicationFactor),
+			attribute.Int("dataShards", file.DataShards),
+			attribute.Int("parityShards", file.ParityShards),
+		),
+	)
+
+	targets, err := h.writeFile(ctx, body, chunker, &file)
+	h.commitUpload(ctx, w, r, file, targets, err)
+}
+
+// errInvalidFileName means that name can't be used as file name.
+var errInvalidFileName = errors.New("invalid file name")
+
+// validateFileName checks that name can be used as file name. Names with
+// NUL are reserved for internal keys, like noncurrent versions and S3
+// objects, so they are rejected by every API that takes file name.
+func validateFileName(name string) error {
+	switch {
+	case name == "":
+		return errors.Wrap(errInvalidFileName, "file name is required")
+	case !utf8.ValidString(name):
+		return errors.Wrap(errInvalidFileName, "file name is not valid UTF-8")
+	case strings.ContainsRune(name, 0):
+		return errors.Wrap(errInvalidFileName, "file name contains NUL")
+	default:
+		return nil
+	}
+}
+
+// writeFile writes chunks of file read from body to nodes, setting its
+// size, checksum and chunks. Returns nodes that every chunk was written to,
+// so they can be removed if upload fails.
+func (h *Handler) writeFile(ctx context.Context, body io.Reader, chunker Chunker, file *File) ([][]replicaWrite, error) {
+	var (
+		hash    = sha256.New()
+		targets [][]replicaWrite
+		err     error
+	)
+	body = io.TeeReader(body, hash)
+	if file.Erasure() {
+		targets, err = h.writeErasure(ctx, body, chunker, file)
+	} else {
+		targets, err = h.writeReplicated(ctx, body, chunker, file)
+	}
+	file.Checksum = hash.Sum(nil)
+	file.ChunkCount = len(file.Chunks)
+	return targets, err
+}
+
+// chunkWriter writes chunks that are read one by one from stream to nodes
+// in background, keeping at most window chunk buffers in memory.
+//
+// Buffers are allocated within upload memory of handler. The first buffer
+// waits for memory, and the following ones are allocated only if memory is
+// available right away, otherwise upload waits for its own buffers, so
+// every upload can make progress.
+type chunkWriter struct {
+	g       *errgroup.Group
+	ctx     context.Context
+	bufs    chan []byte
+	bufSize int64
+	// Number of allocated buffers, at most window.
+	allocated int
+	window    int
+	memory    *semaphore.Weighted
+	// Memory taken by every buffer.
+	weight int64
+	// Data that was read after the end of previous chunk.
+	carry []byte
+}
+
+// newChunkWriter returns chunkWriter with buffers of bufSize bytes.
+func (h *Handler) newChunkWriter(ctx context.Context, bufSize int64) *chunkWriter {
+	g, gCtx := errgroup.WithContext(ctx)
+	return &chunkWriter{
+		g:       g,
+		ctx:     gCtx,
+		bufs:    make(chan []byte, h.uploadWindow),
+		bufSize: bufSize,
+		window:  h.uploadWindow,
+		memory:  h.uploadBuffers,
+		// Buffer that is larger than memory limit takes all of it.
+		weight: min(bufSize, h.uploadMemory),
+	}
+}
+
+// buffer waits for free buffer.
+func (c *chunkWriter) buffer() ([]byte, error) {
+	select {
+	case buf := <-c.bufs:
+		return buf, nil
+	default:
+	}
+	switch {
+	case c.allocated == 0:
+		if err := c.memory.Acquire(c.ctx, c.weight); err != nil {
+			return nil, err
+		}
+	case c.allocated == c.window || !c.memory.TryAcquire(c.weight):
+		select {
+		case buf := <-c.bufs:
+			return buf, nil
+		case <-c.ctx.Done():
+			return nil, c.ctx.Err()
+		}
+	}
+	c.allocated++
+	return make([]byte, c.bufSize), nil
+}
+
+// release releases memory of all buffers.
+func (c *chunkWriter) release() {
+	c.memory.Release(int64(c.allocated) * c.weight)
+	c.allocated = 0
+}
+
+// write calls f in background and releases buf after it returns.
+func (c *chunkWriter) write(buf []byte, f func(ctx context.Context) error) {
+	c.g.Go(func() error {
+		defer func() { c.bufs <- buf }()
+		return f(c.ctx)
+	})
+}
+
+// read reads r into the beginning of buffers and calls chunk with every
+// buffer and size of chunk that chunker cut at its beginning. Chunk should
+// pass buffer to write.
+//
+// Waits for all writes to complete and releases buffers.
+func (c *chunkWriter) read(r io.Reader, chunker Chunker, chunk func(buf []byte, n int) error) error {
+	// Every return waits for writes, so buffers are no longer used.
+	defer c.release()
+	maxSize := chunker.MaxSize()
+	for {
+		buf, err := c.buffer()
+		if err != nil {
+			// Write failed, error is returned by Wait.
+			break
+		}
+		filled := copy(buf, c.carry)
+		n, err := io.ReadFull(r, buf[filled:maxSize])
+		filled += n
+		if err != nil && !errors.Is(err, io.EOF) && !errors.Is(err, io.ErrUnexpectedEOF) {
+			c.bufs <- buf
+			_ = c.g.Wait()
+			return errors.Wrap(err, "read")
+		}
+		if filled == 0 {
+			c.bufs <- buf
+			break
+		}
+		n = chunker.Cut(buf[:filled])
+		// Buffer can be modified by chunk.
+		c.carry = append(c.carry[:0], buf[n:filled]...)
+		if err := chunk(buf, n); err != nil {
+			c.bufs <- buf
+			_ = c.g.Wait()
+			return err
+		}
+	}
+	return c.g.Wait()
+}
+
+// writeReplicated cuts r into chunks and writes every chunk to
+// replicationFactor nodes while next chunks are read.
+//
+// Chunks of CDCChunker are addressed by content, and chunk that is already
+// stored is not written again.
+//
+// Returns clients that were used for every chunk for cleanup.
+func (h *Handler) writeReplicated(ctx context.Context, r io.Reader, chunker Chunker, file *File) ([][]replicaWrite, error) {
+	var (
+		cw       = h.newChunkWriter(ctx, chunker.MaxSize())
+		p        *placer
+		replicas int
+		_, dedup = chunker.(CDCChunker)
+		// Chunks are appended by reader and completed by background writes.
+		chunksMux sync.Mutex
+		chunks    []Chunk
+		targets   [][]replicaWrite
+	)
+	err := cw.read(r, chunker, func(buf []byte, n int) error {
+		if p == nil {
+			// Nodes are selected only for non-empty file.
+			var err error
+			if p, replicas, err = h.replicaPlacer(ctx, chunker.MaxSize()); err != nil {
+				return errors.Wrap(err, "select nodes")
+			}
+		}
+		nodes := p.next(replicas, int64(n))
+		if len(nodes) < h.writeQuorum {
+			return errors.Wrapf(ErrInsufficientCapacity, "select nodes: chunk %d: %d nodes have space left, need %d",
+				len(chunks), len(nodes), h.writeQuorum,
+			)
+		}
+		clients := h.clientsOf(nodes)
+		chunksMux.Lock()
+		chunk := Chunk{
+			Index:  len(chunks),
+			ID:     uuid.New(),
+			Offset: file.Size,
+			Size:   int64(n),
+		}
+		chunks = append(chunks, chunk)
+		writes := make([]replicaWrite, len(clients))
+		for i, client := range clients {
+			writes[i] = replicaWrite{client: client}
+		}
+		targets = append(targets, writes)
+		chunksMux.Unlock()
+		file.Size += chunk.Size
+
+		cw.write(buf, func(ctx context.Context) error {
+			// Chunk with content-addressed ID can be already stored on node,
+			// e.g. when it is not collected yet, and is replaced only by
+			// the same content.
+			var expected []byte
+			if dedup {
+				sum := sha256.Sum256(buf[:n])
+				expected = sum[:]
+				chunk.ID = contentID(sum[:])
+				stored, err := h.storage.ChunkReplicas(ctx, chunk.ID)
+				if err != nil {
+					return errors.Wrapf(err, "chunk %d: get replicas", chunk.Index)
+				}
+				chunksMux.Lock()
+				chunks[chunk.Index].ID = chunk.ID
+				if len(stored) > 0 {
+					chunks[chunk.Index].Nodes = stored
+					chunks[chunk.Index].Checksum = sum[:]
+					// Nothing to clean up.
+					targets[chunk.Index] = nil
+				}
+				chunksMux.Unlock()
+				if len(stored) > 0 {
+					zctx.From(ctx).Debug("Chunk is already stored",
+						zap.String("chunkID", chunk.ID.String()),
+						zap.Int64("size", chunk.Size),
+					)
+					return nil
+				}
+			}
+			// Replica failure does not fail the upload until write quorum
+			// is lost.
+			var (
+				g        errgroup.Group
+				acksMux  sync.Mutex
+				acks     []string
+				checksum []byte
+			)
+			for i, client := range clients {
+				g.Go(func() error {
+					written, err := client.Write(ctx, chunk.ID, bytes.NewReader(buf[:n]), expected)
+					if err != nil {
+						zctx.From(ctx).Warn("Failed to write chunk replica",
+							zap.String("chunkID", chunk.ID.String()),
+							zap.String("node", client.BaseURL()),
+							zap.Error(err),
+						)
+						return nil
+					}
+					acksMux.Lock()
+					acks = append(acks, client.BaseURL())
+					// Every replica is verified against the same source data.
+					checksum = written.Checksum
+					acksMux.Unlock()
+					chunksMux.Lock()
+					targets[chunk.Index][i].written = written
+					chunksMux.Unlock()
+					return nil
+				})
+			}
+			_ = g.Wait()
+			if len(acks) < h.writeQuorum {
+				return errors.Errorf("chunk %d: write quorum not reached: %d < %d",
+					chunk.Index, len(acks), h.writeQuorum,
+				)
+			}
+			chunksMux.Lock()
+			chunks[chunk.Index].Nodes = acks
+			chunks[chunk.Index].Checksum = checksum
+			chunksMux.Unlock()
+			return nil
+		})
+		return nil
+	})
+	if err == nil && dedup {
+		err = h.recheckStored(ctx, chunks, targets)
+	}
+	file.Chunks = chunks
+	return targets, err
+}
+
+// recheckStored checks that chunks that were found already stored are still
+// recorded after the whole file is written, as they could be released
+// meanwhile. Collector keeps replicas of released chunk for its grace
+// period, so chunk that is recorded now can be referenced by file that is
+// added right after.
+//
+// Chunks that were stored by upload have targets.
+func (h *Handler) recheckStored(ctx context.Context, chunks []Chunk, targets [][]replicaWrite) error {
+	for i, chunk := range chunks {
+		if targets[i] != nil {
+			continue
+		}
+		stored, err := h.storage.ChunkReplicas(ctx, chunk.ID)
+		if err != nil {
+			return errors.Wrapf(err, "chunk %d: get replicas", chunk.Index)
+		}
+		if len(stored) == 0 {
+			return errors.Wrapf(&ChunkReleasedErr{Chunk: chunk.ID}, "chunk %d", chunk.Index)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,187 @@
+package front
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"fmt"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/go-faster/errors"
+	"github.com/stretchr/testify/require"
+	noopMeter "go.opentelemetry.io/otel/metric/noop"
+	noopTracer "go.opentelemetry.io/otel/trace/noop"
+	"golang.org/x/sync/errgroup"
+)
+
+func putFile(t *testing.T, server *httptest.Server, path string, data []byte) *http.Response {
+	t.Helper()
+	req, err := http.NewRequest(http.MethodPut, server.URL+path, bytes.NewReader(data))
+	require.NoError(t, err)
+	resp, err := server.Client().Do(req)
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = resp.Body.Close() })
+	return resp
+}
+
+func TestHandlerStream(t *testing.T) {
+	var (
+		ctx   = context.Background()
+		stor  = newInMemoryStorage()
+		nodes = newInMemoryNodes()
+	)
+	handler, err := NewHandler(ctx, nodes, stor, noopTracer.NewTracerProvider(), noopMeter.NewMeterProvider(), HandlerOptions{
+		ReplicationFactor: 2,
+		Chunking:          ChunkPolicy{Size: 1000},
+		UploadWindow:      2,
+	})
+	require.NoError(t, err)
+	server := httptest.NewServer(handler)
+	t.Cleanup(server.Close)
+	registerNodes(t, server, nodes, "node1:8080", "node2:8080", "node3:8080")
+
+	requireFile := func(t *testing.T, name string, data []byte) *File {
+		t.Helper()
+		resp, downloaded, err := downloadFile(t, server, name)
+		require.NoError(t, err)
+		require.Equal(t, http.StatusOK, resp.StatusCode)
+		require.Equal(t, data, downloaded)
+
+		file, err := stor.File(ctx, name)
+		require.NoError(t, err)
+		require.Equal(t, int64(len(data)), file.Size)
+		sum := sha256.Sum256(data)
+		require.Equal(t, sum[:], file.Checksum)
+		return file
+	}
+
+	t.Run("Body", func(t *testing.T) {
+		data := randomBytes(t, 4500)
+		require.Equal(t, http.StatusOK, putFile(t, server, "/files/body.bin", data).StatusCode)
+
+		file := requireFile(t, "body.bin", data)
+		require.Len(t, file.Chunks, 5)
+		var offset int64
+		for i, chunk := range file.Chunks {
+			require.Equal(t, i, chunk.Index)
+			require.Equal(t, offset, chunk.Offset)
+			require.Len(t, chunk.Nodes, 2)
+			require.NotEqual(t, chunk.Nodes[0], chunk.Nodes[1])
+			require.NotNil(t, chunk.Checksum)
+			offset += chunk.Size
+		}
+		require.Equal(t, int64(500), file.Chunks[4].Size)
+	})
+	t.Run("Multipart", func(t *testing.T) {
+		data := randomBytes(t, 2000)
+		b := new(bytes.Buffer)
+		mw := multipart.NewWriter(b)
+		require.NoError(t, mw.WriteField("comment", "skipped"))
+		w, err := mw.CreateFormFile("upload", "multipart.bin")
+		require.NoError(t, err)
+		_, err = w.Write(data)
+		require.NoError(t, err)
+		require.NoError(t, mw.Close())
+
+		req, err := http.NewRequest(http.MethodPost, server.URL+"/files", b)
+		require.NoError(t, err)
+		req.Header.Set("Content-Type", mw.FormDataContentType())
+		resp, err := server.Client().Do(req)
+		require.NoError(t, err)
+		_ = resp.Body.Close()
+		require.Equal(t, http.StatusOK, resp.StatusCode)
+
+		file := requireFile(t, "multipart.bin", data)
+		require.Len(t, file.Chunks, 2)
+	})
+	t.Run("Erasure", func(t *testing.T) {
+		// Last stripe is shorter than data shards.
+		data := randomBytes(t, 3001)
+		resp := putFile(t, server, "/files/ec.bin?dataShards=2&parityShards=1", data)
+		require.Equal(t, http.StatusOK, resp.StatusCode)
+
+		file := requireFile(t, "ec.bin", data)
+		require.Len(t, file.Chunks, 4*3)
+		require.Len(t, file.dataChunks(), 4*2)
+		last := file.stripe(file.Chunks[len(file.Chunks)-1])
+		require.Equal(t, []int64{1, 0, 1}, []int64{last[0].Size, last[1].Size, last[2].Size})
+
+		// Any node can be lost.
+		for baseURL, node := range nodes.nodes {
+			node.setDown(true)
+			resp, downloaded, err := downloadFile(t, server, "ec.bin")
+			node.setDown(false)
+			require.NoError(t, err, baseURL)
+			require.Equal(t, http.StatusOK, resp.StatusCode, baseURL)
+			require.Equal(t, data, downloaded, baseURL)
+		}
+	})
+	t.Run("Empty", func(t *testing.T) {
+		require.Equal(t, http.StatusOK, putFile(t, server, "/files/empty.bin", nil).StatusCode)
+		file := requireFile(t, "empty.bin", []byte{})
+		require.Empty(t, file.Chunks)
+	})
+	t.Run("NoQuorum", func(t *testing.T) {
+		nodes.nodes["node1:8080"].setDown(true)
+		nodes.nodes["node2:8080"].setDown(true)
+		defer nodes.nodes["node1:8080"].setDown(false)
+		defer nodes.nodes["node2:8080"].setDown(false)
+
+		resp := putFile(t, server, "/files/no-quorum.bin", randomBytes(t, 10_000))
+		require.Equal(t, http.StatusInternalServerError, resp.StatusCode)
+		_, err := stor.File(ctx, "no-quorum.bin")
+		require.Error(t, err, "file should not be stored")
+	})
+	// Failed upload leaves no chunks on nodes.
+	requireStored(t, stor, nodes)
+}
+
+func TestHandlerUploadMemory(t *testing.T) {
+	var (
+		ctx   = context.Background()
+		stor  = newInMemoryStorage()
+		nodes = newInMemoryNodes()
+	)
+	handler, err := NewHandler(ctx, nodes, stor, noopTracer.NewTracerProvider(), noopMeter.NewMeterProvider(), HandlerOptions{
+		Chunking: ChunkPolicy{Size: 1000},
+		// Single buffer for all uploads.
+		UploadMemory: 1500,
+	})
+	require.NoError(t, err)
+	server := httptest.NewServer(handler)
+	t.Cleanup(server.Close)
+	registerNodes(t, server, nodes, "node1:8080", "node2:8080")
+
+	var (
+		g    errgroup.Group
+		data = randomBytes(t, 4500)
+	)
+	for i := range 4 {
+		g.Go(func() error {
+			path := fmt.Sprintf("/files/file%d.bin", i)
+			req, err := http.NewRequest(http.MethodPut, server.URL+path, bytes.NewReader(data))
+			if err != nil {
+				return err
+			}
+			resp, err := server.Client().Do(req)
+			if err != nil {
+				return err
+			}
+			_ = resp.Body.Close()
+			if resp.StatusCode != http.StatusOK {
+				return errors.Errorf("%s: status %d", path, resp.StatusCode)
+			}
+			return nil
+		})
+	}
+	require.NoError(t, g.Wait())
+	for i := range 4 {
+		_, downloaded, err := downloadFile(t, server, fmt.Sprintf("file%d.bin", i))
+		require.NoError(t, err)
+		require.Equal(t, data, downloaded)
+	}
+	require.True(t, handler.uploadBuffers.TryAcquire(1500), "buffers should be released")
+}
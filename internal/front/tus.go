@@ -0,0 +1,364 @@
+package front
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/go-faster/errors"
+	"github.com/go-faster/sdk/zctx"
+	"github.com/google/uuid"
+	"go.opentelemetry.io/otel/attribute"
+	"go.uber.org/zap"
+)
+
+// Resumable uploads implement core protocol of tus 1.0.0 (https://tus.io)
+// with creation, expiration and termination extensions.
+const (
+	tusVersion     = "1.0.0"
+	tusExtensions  = "creation,expiration,termination"
+	tusContentType = "application/offset+octet-stream"
+)
+
+// tusRequest checks protocol version of request and sets headers that are
+// common for all responses. Responds with error and returns false if
+// version is not supported.
+func tusRequest(w http.ResponseWriter, r *http.Request) bool {
+	w.Header().Set("Tus-Resumable", tusVersion)
+	if r.Header.Get("Tus-Resumable") != tusVersion {
+		w.Header().Set("Tus-Version", tusVersion)
+		httpError(w, "unsupported tus version", http.StatusPreconditionFailed)
+		return false
+	}
+	return true
+}
+
+// parseTusMetadata parses Upload-Metadata header: comma-separated pairs of
+// key and base64-encoded value, value can be omitted.
+func parseTusMetadata(v string) (map[string]string, error) {
+	metadata := make(map[string]string)
+	for _, pair := range strings.Split(v, ",") {
+		pair = strings.TrimSpace(pair)
+		if pair == "" {
+			continue
+		}
+		key, encoded, _ := strings.Cut(pair, " ")
+		value, err := base64.StdEncoding.DecodeString(encoded)
+		if err != nil {
+			return nil, errors.Wrapf(err, "decode %q", key)
+		}
+		metadata[key] = string(value)
+	}
+	return metadata, nil
+}
+
+// partsSize returns total size of parts.
+func partsSize(parts []Part) int64 {
+	var size int64
+	for _, part := range parts {
+		size += part.Size
+	}
+	return size
+}
+
+// lockUpload marks resumable upload as written by request of this front, so
+// concurrent request fails before writing any chunks. Returns false if upload
+// is already locked. Requests to other fronts are excluded by
+// HandlerStorage.AppendPart.
+func (h *Handler) lockUpload(id uuid.UUID) (unlock func(), ok bool) {
+	h.uploadsMux.Lock()
+	defer h.uploadsMux.Unlock()
+	if _, ok := h.uploads[id]; ok {
+		return nil, false
+	}
+	h.uploads[id] = struct{}{}
+	return func() {
+		h.uploadsMux.Lock()
+		defer h.uploadsMux.Unlock()
+		delete(h.uploads, id)
+	}, true
+}
+
+// setUploadExpires sets Upload-Expires header of resumable upload.
+func (h *Handler) setUploadExpires(w http.ResponseWriter, upload *Upload) {
+	w.Header().Set("Upload-Expires", h.expiresAt(upload).UTC().Format(http.TimeFormat))
+}
+
+// tusOptions describes supported protocol.
+func (h *Handler) tusOptions(w http.ResponseWriter, _ *http.Request) {
+	w.Header().Set("Tus-Resumable", tusVersion)
+	w.Header().Set("Tus-Version", tusVersion)
+	w.Header().Set("Tus-Extension", tusExtensions)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// tusCreate creates resumable upload of Upload-Length bytes. File name is
+// taken from filename metadata, content type from filetype.
+func (h *Handler) tusCreate(w http.ResponseWriter, r *http.Request) {
+	ctx, span := h.tracer.Start(r.Context(), "handler.TusCreate")
+	defer span.End()
+
+	if !tusRequest(w, r) {
+		return
+	}
+	length, err := strconv.ParseInt(r.Header.Get("Upload-Length"), 10, 64)
+	if err != nil || length < 0 {
+		httpError(w, "Upload-Length is required", http.StatusBadRequest)
+		return
+	}
+	metadata, err := parseTusMetadata(r.Header.Get("Upload-Metadata"))
+	if err != nil {
+		httpError(w, errors.Wrap(err, "parse Upload-Metadata").Error(), http.StatusBadRequest)
+		return
+	}
+	now := h.now()
+	upload := Upload{
+		ID:          uuid.New(),
+		Name:        metadata["filename"],
+		ContentType: metadata["filetype"],
+		Length:      length,
+		CreatedAt:   now,
+		UpdatedAt:   now,
+	}
+	if err := validateFileName(upload.Name); err != nil {
+		httpError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	span.SetAttributes(
+		attribute.String("fileName", upload.Name),
+		attribute.Int64("length", length),
+	)
+
+	if length == 0 {
+		// Nothing to upload, so file is published right away.
+		file := assembleFile(&upload, nil, upload.CreatedAt)
+		sum := sha256.Sum256(nil)
+		file.Checksum = sum[:]
+		if err := h.addFile(ctx, &file); err != nil {
+			writeError(w, err)
+			return
+		}
+	} else if err := h.storage.AddUpload(ctx, upload); err != nil {
+		writeError(w, err)
+		return
+	}
+	zctx.From(ctx).Info("Created resumable upload",
+		zap.String("fileName", upload.Name),
+		zap.String("uploadID", upload.ID.String()),
+		zap.Int64("length", length),
+	)
+
+	h.setUploadExpires(w, &upload)
+	w.Header().Set("Location", "/tus/"+upload.ID.String())
+	w.WriteHeader(http.StatusCreated)
+}
+
+// tusUpload returns resumable upload of request with its parts, or responds
+// with error and returns false.
+func (h *Handler) tusUpload(ctx context.Context, w http.ResponseWriter, r *http.Request) (*Upload, []Part, bool) {
+	id, err := uuid.Parse(r.PathValue("id"))
+	if err != nil {
+		httpError(w, "upload not found", http.StatusNotFound)
+		return nil, nil, false
+	}
+	upload, err := h.storage.Upload(ctx, id)
+	if err != nil {
+		writeError(w, err)
+		return nil, nil, false
+	}
+	if upload.Length == 0 {
+		// Multipart upload of S3 API.
+		httpError(w, "upload not found", http.StatusNotFound)
+		return nil, nil, false
+	}
+	if h.expired(upload) {
+		httpError(w, "upload expired", http.StatusGone)
+		return nil, nil, false
+	}
+	parts, err := h.storage.Parts(ctx, id)
+	if err != nil {
+		writeError(w, err)
+		return nil, nil, false
+	}
+	return upload, parts, true
+}
+
+// tusComplete publishes file of resumable upload that has all its data.
+func (h *Handler) tusComplete(ctx context.Context, upload *Upload, parts []Part) error {
+	file := assembleFile(upload, parts, h.now())
+	if err := h.completeFile(ctx, upload.ID, parts, &file); err != nil {
+		return errors.Wrap(err, "complete upload")
+	}
+	zctx.From(ctx).Info("Completed resumable upload",
+		zap.String("fileName", file.Name),
+		zap.String("uploadID", upload.ID.String()),
+		zap.Int("parts", len(parts)),
+	)
+	return nil
+}
+
+// tusOffset responds with offset of resumable upload.
+func (h *Handler) tusOffset(w http.ResponseWriter, r *http.Request) {
+	ctx, span := h.tracer.Start(r.Context(), "handler.TusOffset")
+	defer span.End()
+
+	if !tusRequest(w, r) {
+		return
+	}
+	upload, parts, ok := h.tusUpload(ctx, w, r)
+	if !ok {
+		return
+	}
+	offset := partsSize(parts)
+	if offset == upload.Length {
+		// Completion failed after the last part was recorded, client
+		// considers upload done, so it is retried here.
+		if unlock, ok := h.lockUpload(upload.ID); ok {
+			err := h.tusComplete(ctx, upload, parts)
+			unlock()
+			var notFound *UploadNotFoundErr
+			if err != nil && !errors.As(err, &notFound) {
+				writeError(w, err)
+				return
+			}
+		}
+	}
+
+	h.setUploadExpires(w, upload)
+	w.Header().Set("Upload-Offset", strconv.FormatInt(offset, 10))
+	w.Header().Set("Upload-Length", strconv.FormatInt(upload.Length, 10))
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(http.StatusOK)
+}
+
+// tusPatch appends request body to resumable upload at Upload-Offset.
+//
+// Body is written chunk by chunk, and every chunk is recorded as part as
+// soon as it is stored on nodes, so interrupted request is resumed from the
+// end of the last complete chunk. File is published when all data is
+// received.
+func (h *Handler) tusPatch(w http.ResponseWriter, r *http.Request) {
+	ctx, span := h.tracer.Start(r.Context(), "handler.TusPatch")
+	defer span.End()
+
+	if !tusRequest(w, r) {
+		return
+	}
+	if r.Header.Get("Content-Type") != tusContentType {
+		httpError(w, "Content-Type must be "+tusContentType, http.StatusUnsupportedMediaType)
+		return
+	}
+	offset, err := strconv.ParseInt(r.Header.Get("Upload-Offset"), 10, 64)
+	if err != nil || offset < 0 {
+		httpError(w, "Upload-Offset is required", http.StatusBadRequest)
+		return
+	}
+	if id, err := uuid.Parse(r.PathValue("id")); err == nil {
+		unlock, ok := h.lockUpload(id)
+		if !ok {
+			httpError(w, "upload is written by other request", http.StatusLocked)
+			return
+		}
+		defer unlock()
+	}
+	upload, parts, ok := h.tusUpload(ctx, w, r)
+	if !ok {
+		return
+	}
+	if current := partsSize(parts); offset != current {
+		httpError(w, fmt.Sprintf("offset %d does not match upload offset %d", offset, current), http.StatusConflict)
+		return
+	}
+	span.SetAttributes(
+		attribute.String("fileName", upload.Name),
+		attribute.Int64("offset", offset),
+	)
+
+	for offset < upload.Length {
+		var (
+			size = min(h.chunking.Size, upload.Length-offset)
+			file = File{Name: upload.Name}
+		)
+		targets, err := h.writeFile(ctx, io.LimitReader(r.Body, size), FixedChunker{Size: size}, &file)
+		if err == nil && file.Size == 0 {
+			// Body ended.
+			break
+		}
+		part := Part{
+			Number:    len(parts) + 1,
+			Size:      file.Size,
+			Checksum:  file.Checksum,
+			CreatedAt: h.now(),
+			Chunks:    file.Chunks,
+		}
+		if err == nil {
+			// Fails if other request appended part since parts were read.
+			err = h.storage.AppendPart(ctx, upload.ID, part)
+		}
+		if err != nil {
+			h.removeChunks(ctx, file.Chunks, targets)
+			zctx.From(ctx).Warn("Resumable upload interrupted",
+				zap.String("uploadID", upload.ID.String()),
+				zap.Int64("offset", offset),
+				zap.Error(err),
+			)
+			writeError(w, err)
+			return
+		}
+		parts = append(parts, part)
+		offset += file.Size
+		if file.Size < size {
+			// Body ended in the middle of chunk.
+			break
+		}
+	}
+	if offset == upload.Length {
+		if err := h.tusComplete(ctx, upload, parts); err != nil {
+			writeError(w, err)
+			return
+		}
+	}
+
+	h.setUploadExpires(w, upload)
+	w.Header().Set("Upload-Offset", strconv.FormatInt(offset, 10))
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// tusTerminate removes resumable upload with its parts.
+func (h *Handler) tusTerminate(w http.ResponseWriter, r *http.Request) {
+	ctx, span := h.tracer.Start(r.Context(), "handler.TusTerminate")
+	defer span.End()
+
+	if !tusRequest(w, r) {
+		return
+	}
+	if id, err := uuid.Parse(r.PathValue("id")); err == nil {
+		unlock, ok := h.lockUpload(id)
+		if !ok {
+			httpError(w, "upload is written by other request", http.StatusLocked)
+			return
+		}
+		defer unlock()
+	}
+	upload, _, ok := h.tusUpload(ctx, w, r)
+	if !ok {
+		return
+	}
+	if err := h.storage.RemoveUpload(ctx, upload.ID); err != nil {
+		writeError(w, err)
+		return
+	}
+	zctx.From(ctx).Info("Terminated resumable upload",
+		zap.String("fileName", upload.Name),
+		zap.String("uploadID", upload.ID.String()),
+	)
+	// Chunks of removed parts.
+	h.notifyCollector()
+
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,302 @@
+package front
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/go-faster/errors"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/require"
+	noopMeter "go.opentelemetry.io/otel/metric/noop"
+	noopTracer "go.opentelemetry.io/otel/trace/noop"
+)
+
+func TestParseTusMetadata(t *testing.T) {
+	encode := base64.StdEncoding.EncodeToString
+	metadata, err := parseTusMetadata("filename " + encode([]byte("dir/a b.txt")) + ", is_confidential,filetype " + encode([]byte("text/plain")))
+	require.NoError(t, err)
+	require.Equal(t, map[string]string{
+		"filename":        "dir/a b.txt",
+		"is_confidential": "",
+		"filetype":        "text/plain",
+	}, metadata)
+
+	_, err = parseTusMetadata("filename !!!")
+	require.Error(t, err)
+}
+
+// sendTus sends tus request to server.
+func sendTus(t *testing.T, server *httptest.Server, method, path string, header http.Header, body io.Reader) *http.Response {
+	t.Helper()
+	req, err := http.NewRequest(method, server.URL+path, body)
+	require.NoError(t, err)
+	req.Header.Set("Tus-Resumable", "1.0.0")
+	for k, v := range header {
+		req.Header[k] = v
+	}
+	resp, err := server.Client().Do(req)
+	require.NoError(t, err)
+	_ = resp.Body.Close()
+	return resp
+}
+
+// createTus creates resumable upload and returns its location.
+func createTus(t *testing.T, server *httptest.Server, name string, length int) string {
+	t.Helper()
+	resp := sendTus(t, server, http.MethodPost, "/tus", http.Header{
+		"Upload-Length":   {strconv.Itoa(length)},
+		"Upload-Metadata": {"filename " + base64.StdEncoding.EncodeToString([]byte(name))},
+	}, http.NoBody)
+	require.Equal(t, http.StatusCreated, resp.StatusCode)
+	require.Equal(t, "1.0.0", resp.Header.Get("Tus-Resumable"))
+	require.NotEmpty(t, resp.Header.Get("Upload-Expires"))
+	return resp.Header.Get("Location")
+}
+
+// patchTus sends data at offset to resumable upload.
+func patchTus(t *testing.T, server *httptest.Server, location string, offset int, data io.Reader) *http.Response {
+	t.Helper()
+	return sendTus(t, server, http.MethodPatch, location, http.Header{
+		"Content-Type":  {"application/offset+octet-stream"},
+		"Upload-Offset": {strconv.Itoa(offset)},
+	}, data)
+}
+
+// tusUploadOffset returns offset of resumable upload.
+func tusUploadOffset(t *testing.T, server *httptest.Server, location string) (*http.Response, int) {
+	t.Helper()
+	resp := sendTus(t, server, http.MethodHead, location, nil, nil)
+	if resp.StatusCode != http.StatusOK {
+		return resp, -1
+	}
+	offset, err := strconv.Atoi(resp.Header.Get("Upload-Offset"))
+	require.NoError(t, err)
+	return resp, offset
+}
+
+// failingReader returns error after data of r.
+type failingReader struct {
+	r io.Reader
+}
+
+func (f failingReader) Read(p []byte) (int, error) {
+	n, err := f.r.Read(p)
+	if errors.Is(err, io.EOF) {
+		return n, errors.New("connection lost")
+	}
+	return n, err
+}
+
+// racingStorage appends part of other front before every append.
+type racingStorage struct {
+	*inMemoryStorage
+	racing Part
+}
+
+func (s *racingStorage) AppendPart(ctx context.Context, id uuid.UUID, part Part) error {
+	racing := s.racing
+	racing.Number = part.Number
+	if err := s.inMemoryStorage.AppendPart(ctx, id, racing); err != nil {
+		return err
+	}
+	return s.inMemoryStorage.AppendPart(ctx, id, part)
+}
+
+func TestTusConcurrentAppend(t *testing.T) {
+	var (
+		ctx   = context.Background()
+		stor  = &racingStorage{inMemoryStorage: newInMemoryStorage(), racing: Part{Size: 1000}}
+		nodes = newInMemoryNodes()
+	)
+	handler, err := NewHandler(ctx, nodes, stor, noopTracer.NewTracerProvider(), noopMeter.NewMeterProvider(), HandlerOptions{
+		Chunking: ChunkPolicy{Size: 1000},
+	})
+	require.NoError(t, err)
+	server := httptest.NewServer(handler)
+	t.Cleanup(server.Close)
+	registerNodes(t, server, nodes, "node1:8080")
+
+	location := createTus(t, server, "racing.bin", 2000)
+	resp := patchTus(t, server, location, 0, bytes.NewReader(randomBytes(t, 1000)))
+	require.Equal(t, http.StatusConflict, resp.StatusCode)
+
+	// Only part of other request is recorded, chunk of this one is removed.
+	parts, err := stor.Parts(ctx, uuid.MustParse(location[len("/tus/"):]))
+	require.NoError(t, err)
+	require.Len(t, parts, 1)
+	require.Empty(t, parts[0].Chunks)
+	node := nodes.nodes["node1:8080"]
+	node.mux.Lock()
+	defer node.mux.Unlock()
+	require.Empty(t, node.chunks)
+}
+
+func TestTus(t *testing.T) {
+	var (
+		ctx   = context.Background()
+		stor  = newInMemoryStorage()
+		nodes = newInMemoryNodes()
+	)
+	handler, err := NewHandler(ctx, nodes, stor, noopTracer.NewTracerProvider(), noopMeter.NewMeterProvider(), HandlerOptions{
+		ReplicationFactor: 2,
+		Chunking:          ChunkPolicy{Size: 1000},
+		UploadTTL:         time.Hour,
+	})
+	require.NoError(t, err)
+	server := httptest.NewServer(handler)
+	t.Cleanup(server.Close)
+	registerNodes(t, server, nodes, "node1:8080", "node2:8080", "node3:8080")
+
+	t.Run("Options", func(t *testing.T) {
+		req, err := http.NewRequest(http.MethodOptions, server.URL+"/tus", http.NoBody)
+		require.NoError(t, err)
+		resp, err := server.Client().Do(req)
+		require.NoError(t, err)
+		_ = resp.Body.Close()
+		require.Equal(t, http.StatusNoContent, resp.StatusCode)
+		require.Equal(t, "1.0.0", resp.Header.Get("Tus-Version"))
+		require.Equal(t, "creation,expiration,termination", resp.Header.Get("Tus-Extension"))
+	})
+	t.Run("Version", func(t *testing.T) {
+		req, err := http.NewRequest(http.MethodPost, server.URL+"/tus", http.NoBody)
+		require.NoError(t, err)
+		req.Header.Set("Upload-Length", "10")
+		resp, err := server.Client().Do(req)
+		require.NoError(t, err)
+		_ = resp.Body.Close()
+		require.Equal(t, http.StatusPreconditionFailed, resp.StatusCode)
+	})
+	t.Run("Upload", func(t *testing.T) {
+		data := randomBytes(t, 3500)
+		location := createTus(t, server, "tus.bin", len(data))
+		resp, offset := tusUploadOffset(t, server, location)
+		require.Equal(t, http.StatusOK, resp.StatusCode)
+		require.Equal(t, 0, offset)
+		require.Equal(t, "3500", resp.Header.Get("Upload-Length"))
+
+		// Partial chunk at the end of request is kept.
+		resp = patchTus(t, server, location, 0, bytes.NewReader(data[:1500]))
+		require.Equal(t, http.StatusNoContent, resp.StatusCode)
+		require.Equal(t, "1500", resp.Header.Get("Upload-Offset"))
+		_, offset = tusUploadOffset(t, server, location)
+		require.Equal(t, 1500, offset)
+
+		resp = patchTus(t, server, location, 1000, bytes.NewReader(data[1000:]))
+		require.Equal(t, http.StatusConflict, resp.StatusCode)
+		resp = sendTus(t, server, http.MethodPatch, location, http.Header{
+			"Upload-Offset": {"1500"},
+		}, bytes.NewReader(data[1500:]))
+		require.Equal(t, http.StatusUnsupportedMediaType, resp.StatusCode)
+
+		// File is not visible until upload is complete.
+		_, err := stor.File(ctx, "tus.bin")
+		require.ErrorAs(t, err, new(*FileNotFoundErr))
+
+		resp = patchTus(t, server, location, 1500, bytes.NewReader(data[1500:]))
+		require.Equal(t, http.StatusNoContent, resp.StatusCode)
+		require.Equal(t, "3500", resp.Header.Get("Upload-Offset"))
+
+		file, err := stor.File(ctx, "tus.bin")
+		require.NoError(t, err)
+		require.Equal(t, int64(3500), file.Size)
+		// 1000, 500, 1000, 1000.
+		require.Equal(t, 4, file.ChunkCount)
+		require.Equal(t, 4, file.PartCount)
+		require.NotNil(t, file.Checksum)
+		resp, downloaded, err := downloadFile(t, server, "tus.bin")
+		require.NoError(t, err)
+		require.Equal(t, http.StatusOK, resp.StatusCode)
+		require.Equal(t, data, downloaded)
+
+		resp, _ = tusUploadOffset(t, server, location)
+		require.Equal(t, http.StatusNotFound, resp.StatusCode)
+	})
+	t.Run("Resume", func(t *testing.T) {
+		data := randomBytes(t, 3500)
+		location := createTus(t, server, "resumed.bin", len(data))
+
+		// Connection is lost in the middle of the third chunk.
+		req, err := http.NewRequest(http.MethodPatch, server.URL+location, failingReader{r: bytes.NewReader(data[:2500])})
+		require.NoError(t, err)
+		req.ContentLength = int64(len(data))
+		req.Header.Set("Tus-Resumable", "1.0.0")
+		req.Header.Set("Content-Type", "application/offset+octet-stream")
+		req.Header.Set("Upload-Offset", "0")
+		_, err = server.Client().Do(req)
+		require.Error(t, err)
+
+		// Received data is kept, upload is resumed from reported offset.
+		require.Eventually(t, func() bool {
+			_, offset := tusUploadOffset(t, server, location)
+			return offset >= 2000
+		}, time.Second*5, time.Millisecond*10)
+		var resp *http.Response
+		require.Eventually(t, func() bool {
+			_, offset := tusUploadOffset(t, server, location)
+			resp = patchTus(t, server, location, offset, bytes.NewReader(data[offset:]))
+			return resp.StatusCode == http.StatusNoContent
+		}, time.Second*5, time.Millisecond*10)
+		require.Equal(t, "3500", resp.Header.Get("Upload-Offset"))
+
+		resp, downloaded, err := downloadFile(t, server, "resumed.bin")
+		require.NoError(t, err)
+		require.Equal(t, http.StatusOK, resp.StatusCode)
+		require.Equal(t, data, downloaded)
+	})
+	t.Run("Empty", func(t *testing.T) {
+		createTus(t, server, "empty.bin", 0)
+		file, err := stor.File(ctx, "empty.bin")
+		require.NoError(t, err)
+		require.Zero(t, file.Size)
+	})
+	t.Run("Terminate", func(t *testing.T) {
+		location := createTus(t, server, "terminated.bin", 2000)
+		resp := patchTus(t, server, location, 0, bytes.NewReader(randomBytes(t, 1000)))
+		require.Equal(t, http.StatusNoContent, resp.StatusCode)
+
+		resp = sendTus(t, server, http.MethodDelete, location, nil, nil)
+		require.Equal(t, http.StatusNoContent, resp.StatusCode)
+		resp, _ = tusUploadOffset(t, server, location)
+		require.Equal(t, http.StatusNotFound, resp.StatusCode)
+		_, err := stor.File(ctx, "terminated.bin")
+		require.ErrorAs(t, err, new(*FileNotFoundErr))
+	})
+	t.Run("Expire", func(t *testing.T) {
+		location := createTus(t, server, "expired.bin", 2000)
+		resp := patchTus(t, server, location, 0, bytes.NewReader(randomBytes(t, 1000)))
+		require.Equal(t, http.StatusNoContent, resp.StatusCode)
+		id := uuid.MustParse(location[len("/tus/"):])
+		parts, err := stor.Parts(ctx, id)
+		require.NoError(t, err)
+		require.Len(t, parts, 1)
+
+		now := time.Now().Add(2 * time.Hour)
+		handler.now = func() time.Time { return now }
+		t.Cleanup(func() { handler.now = time.Now })
+		resp, _ = tusUploadOffset(t, server, location)
+		require.Equal(t, http.StatusGone, resp.StatusCode)
+		resp = patchTus(t, server, location, 1000, bytes.NewReader(randomBytes(t, 1000)))
+		require.Equal(t, http.StatusGone, resp.StatusCode)
+
+		expirer, err := NewUploadExpirer(handler, UploadExpirerOptions{}, noopTracer.NewTracerProvider(), noopMeter.NewMeterProvider())
+		require.NoError(t, err)
+		require.NoError(t, expirer.Expire(ctx))
+		_, err = stor.Upload(ctx, id)
+		require.ErrorAs(t, err, new(*UploadNotFoundErr))
+
+		// Replicas of written chunks are garbage.
+		garbage := stor.garbageKeys()
+		for _, chunk := range parts[0].Chunks {
+			for _, baseURL := range chunk.Nodes {
+				require.Contains(t, garbage, Replica{ChunkID: chunk.ID, Node: baseURL})
+			}
+		}
+	})
+}
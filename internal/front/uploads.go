@@ -0,0 +1,201 @@
+package front
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"slices"
+	"time"
+
+	"github.com/go-faster/errors"
+	"github.com/go-faster/sdk/zctx"
+	"github.com/google/uuid"
+	"go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/trace"
+	"go.uber.org/zap"
+)
+
+// assembleFile returns file of upload that consists of chunks of parts in
+// given order, no data is copied. Checksum of content would require reading
+// it, so composite checksum of parts is recorded instead.
+func assembleFile(upload *Upload, parts []Part, createdAt time.Time) File {
+	file := File{
+		Name:        upload.Name,
+		ContentType: upload.ContentType,
+		CreatedAt:   createdAt,
+	}
+	assembleChunks(&file, parts)
+	if len(parts) > 0 {
+		file.Checksum = partsChecksum(parts)
+		file.PartCount = len(parts)
+	}
+	return file
+}
+
+// partsChecksum returns SHA-256 of concatenated checksums of parts.
+func partsChecksum(parts []Part) []byte {
+	h := sha256.New()
+	for _, part := range parts {
+		_, _ = h.Write(part.Checksum)
+	}
+	return h.Sum(nil)
+}
+
+// assembleChunks sets chunks and size of file to ones of parts in given
+// order.
+func assembleChunks(file *File, parts []Part) {
+	file.Size = 0
+	file.Chunks = nil
+	for _, part := range parts {
+		for _, chunk := range part.Chunks {
+			chunk.Index = len(file.Chunks)
+			chunk.Offset += file.Size
+			file.Chunks = append(file.Chunks, chunk)
+		}
+		file.Size += part.Size
+	}
+	file.ChunkCount = len(file.Chunks)
+}
+
+// selectParts returns recorded parts with numbers of expected ones, in
+// order of expected, or *PartChangedErr if any of them is missing or was
+// replaced by part with different checksum.
+func selectParts(id uuid.UUID, recorded, expected []Part) ([]Part, error) {
+	selected := make([]Part, 0, len(expected))
+	for _, part := range expected {
+		i := slices.IndexFunc(recorded, func(p Part) bool { return p.Number == part.Number })
+		if i < 0 || !bytes.Equal(recorded[i].Checksum, part.Checksum) {
+			return nil, &PartChangedErr{Upload: id, Number: part.Number}
+		}
+		selected = append(selected, recorded[i])
+	}
+	return selected, nil
+}
+
+// expiresAt returns time when incomplete upload expires, which is prolonged
+// by every recorded part.
+func (h *Handler) expiresAt(upload *Upload) time.Time {
+	return upload.UpdatedAt.Add(h.uploadTTL)
+}
+
+// expired reports whether incomplete upload has expired.
+func (h *Handler) expired(upload *Upload) bool {
+	return h.now().After(h.expiresAt(upload))
+}
+
+// UploadExpirerOptions configures UploadExpirer.
+type UploadExpirerOptions struct {
+	// Interval between expiration passes. Defaults to 10 minutes.
+	Interval time.Duration
+	// BatchSize is the number of uploads that are fetched at once.
+	// Defaults to 100.
+	BatchSize int
+}
+
+func (o *UploadExpirerOptions) setDefaults() {
+	if o.Interval <= 0 {
+		o.Interval = 10 * time.Minute
+	}
+	if o.BatchSize <= 0 {
+		o.BatchSize = 100
+	}
+}
+
+// UploadExpirer removes multipart and resumable uploads that got no parts
+// within upload TTL of handler. Chunks of their parts are deleted
+// from nodes by Collector.
+type UploadExpirer struct {
+	h         *Handler
+	interval  time.Duration
+	batchSize int
+
+	tracer  trace.Tracer
+	expired metric.Int64Counter
+}
+
+func NewUploadExpirer(
+	h *Handler,
+	opts UploadExpirerOptions,
+	tracerProvider trace.TracerProvider,
+	meterProvider metric.MeterProvider,
+) (*UploadExpirer, error) {
+	opts.setDefaults()
+	const name = "stor.front"
+	e := &UploadExpirer{
+		h:         h,
+		interval:  opts.Interval,
+		batchSize: opts.BatchSize,
+		tracer:    tracerProvider.Tracer(name),
+	}
+
+	meter := meterProvider.Meter(name)
+	var err error
+	if e.expired, err = meter.Int64Counter("uploads.expired"); err != nil {
+		return nil, errors.Wrap(err, "uploads.expired")
+	}
+
+	return e, nil
+}
+
+// Run removes expired uploads every interval until ctx is done.
+func (e *UploadExpirer) Run(ctx context.Context) error {
+	ticker := time.NewTicker(e.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+		if err := e.Expire(ctx); err != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			zctx.From(ctx).Error("Upload expiration failed", zap.Error(err))
+		}
+	}
+}
+
+// Expire removes all expired uploads.
+func (e *UploadExpirer) Expire(ctx context.Context) (rerr error) {
+	ctx, span := e.tracer.Start(ctx, "UploadExpirer.Expire")
+	defer func() {
+		if rerr != nil {
+			span.RecordError(rerr)
+		}
+		span.End()
+	}()
+
+	updatedBefore := e.h.now().Add(-e.h.uploadTTL)
+	var removed int
+	for {
+		uploads, err := e.h.storage.Uploads(ctx, updatedBefore, e.batchSize)
+		if err != nil {
+			return errors.Wrap(err, "uploads")
+		}
+		for _, upload := range uploads {
+			if err := e.h.storage.RemoveStaleUpload(ctx, upload.ID, updatedBefore); err != nil {
+				var notFound *UploadNotFoundErr
+				if errors.As(err, &notFound) {
+					// Completed, aborted or updated concurrently.
+					continue
+				}
+				return errors.Wrap(err, "remove upload")
+			}
+			zctx.From(ctx).Info("Removed expired upload",
+				zap.String("fileName", upload.Name),
+				zap.String("uploadID", upload.ID.String()),
+			)
+			e.expired.Add(ctx, 1)
+			removed++
+		}
+		if len(uploads) < e.batchSize {
+			break
+		}
+	}
+	if removed > 0 {
+		// Chunks of removed parts.
+		e.h.notifyCollector()
+	}
+	return nil
+}
@@ -0,0 +1,360 @@
+package front
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/go-faster/errors"
+	"github.com/go-faster/sdk/zctx"
+	"github.com/google/uuid"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/trace"
+	"go.uber.org/zap"
+)
+
+// FileVersion describes version of file in versions API.
+type FileVersion struct {
+	// Version is nil for file uploaded before versioning was introduced.
+	Version   uuid.UUID `json:"version"`
+	Size      int64     `json:"size"`
+	CreatedAt time.Time `json:"createdAt"`
+	// Current is set for version that name points to.
+	Current bool `json:"current"`
+}
+
+// addFile records file as new version of its name and removes noncurrent
+// versions that are out of retention policy.
+func (h *Handler) addFile(ctx context.Context, file *File) error {
+	file.Version = uuid.Must(uuid.NewV7())
+	if err := h.storage.AddFile(ctx, *file); err != nil {
+		return err
+	}
+	h.pruneVersions(ctx, file.Name)
+	return nil
+}
+
+// completeFile completes upload with id as new version of file that consists
+// of parts like addFile.
+func (h *Handler) completeFile(ctx context.Context, id uuid.UUID, parts []Part, file *File) error {
+	file.Version = uuid.Must(uuid.NewV7())
+	if err := h.storage.CompleteUpload(ctx, id, parts, *file); err != nil {
+		return err
+	}
+	h.pruneVersions(ctx, file.Name)
+	return nil
+}
+
+// versions returns noncurrent versions of file, from the oldest to the
+// newest one.
+func (h *Handler) versions(ctx context.Context, name string) ([]FileInfo, error) {
+	var (
+		prefix   = versionKeyPrefix(name)
+		from     = prefix
+		versions []FileInfo
+	)
+	for {
+		files, err := h.storage.Files(ctx, prefix, from, DefaultListLimit)
+		if err != nil {
+			return nil, errors.Wrap(err, "files")
+		}
+		versions = append(versions, files...)
+		if len(files) < DefaultListLimit {
+			return versions, nil
+		}
+		from = files[len(files)-1].Name + "\x00"
+	}
+}
+
+// versionExpired reports whether noncurrent version has outlived version TTL.
+func (h *Handler) versionExpired(version FileInfo) bool {
+	return h.versionTTL > 0 && h.now().After(version.CreatedAt.Add(h.versionTTL))
+}
+
+// retained reports whether noncurrent version with given number of newer
+// noncurrent versions is retained by policy.
+func (h *Handler) retained(version FileInfo, newer int) bool {
+	switch {
+	case h.keepVersions == 0 && h.versionTTL == 0:
+		return false
+	case h.keepVersions > 0 && newer >= h.keepVersions:
+		return false
+	default:
+		return !h.versionExpired(version)
+	}
+}
+
+// pruneVersions removes noncurrent versions of file that are not retained by
+// KeepVersions and VersionTTL. Failure is only logged, as new version is
+// already published and remaining versions are removed by the next upload
+// or by VersionExpirer.
+func (h *Handler) pruneVersions(ctx context.Context, name string) {
+	ctx, span := h.tracer.Start(ctx, "handler.PruneVersions")
+	defer span.End()
+
+	lg := zctx.From(ctx).With(zap.String("fileName", name))
+	versions, err := h.versions(ctx, name)
+	if err != nil {
+		lg.Warn("Failed to list versions", zap.Error(err))
+		return
+	}
+	var removed int
+	for i, version := range versions {
+		if h.retained(version, len(versions)-1-i) {
+			continue
+		}
+		if err := h.storage.RemoveFile(ctx, version.Name); err != nil {
+			var notFound *FileNotFoundErr
+			if errors.As(err, &notFound) {
+				// Removed concurrently.
+				continue
+			}
+			lg.Warn("Failed to remove version", zap.Error(err))
+			break
+		}
+		removed++
+	}
+	span.SetAttributes(attribute.Int("removed", removed))
+	if removed > 0 {
+		// Chunks of removed versions.
+		h.notifyCollector()
+	}
+}
+
+var errInvalidVersion = errors.New("invalid version")
+
+// versionParam returns version of file requested by version parameter, ok is
+// false if it is not set.
+func versionParam(r *http.Request) (version uuid.UUID, ok bool, err error) {
+	if !r.URL.Query().Has("version") {
+		return uuid.Nil, false, nil
+	}
+	if version, err = uuid.Parse(r.URL.Query().Get("version")); err != nil {
+		return uuid.Nil, false, errors.Wrapf(errInvalidVersion, "parse version: %v", err)
+	}
+	return version, true, nil
+}
+
+// fileVersion returns file with version, which is either current or
+// noncurrent one.
+func (h *Handler) fileVersion(ctx context.Context, name string, version uuid.UUID) (*File, error) {
+	file, err := h.storage.File(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+	if file.Version == version {
+		return file, nil
+	}
+	// Current file is read first, so version that is replaced concurrently
+	// is found by its version key.
+	file, err = h.storage.File(ctx, versionKey(name, version))
+	var notFound *FileNotFoundErr
+	if errors.As(err, &notFound) {
+		return nil, &FileNotFoundErr{File: name + "@" + version.String()}
+	}
+	if err != nil {
+		return nil, err
+	}
+	file.Name = name
+	return file, nil
+}
+
+// requestedFile returns file with name, or its version requested by version
+// parameter.
+func (h *Handler) requestedFile(ctx context.Context, r *http.Request, name string) (*File, error) {
+	if err := validateFileName(name); err != nil {
+		return nil, err
+	}
+	version, ok, err := versionParam(r)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return h.storage.File(ctx, name)
+	}
+	return h.fileVersion(ctx, name, version)
+}
+
+// listVersions lists versions of file, the newest first.
+func (h *Handler) listVersions(w http.ResponseWriter, r *http.Request) {
+	ctx, span := h.tracer.Start(r.Context(), "handler.ListVersions")
+	defer span.End()
+
+	name := r.PathValue("fileName")
+	span.SetAttributes(attribute.String("fileName", name))
+	if err := validateFileName(name); err != nil {
+		writeError(w, err)
+		return
+	}
+	file, err := h.storage.File(ctx, name)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	versions, err := h.versions(ctx, name)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	list := []FileVersion{{
+		Version:   file.Version,
+		Size:      file.Size,
+		CreatedAt: file.CreatedAt,
+		Current:   true,
+	}}
+	for _, version := range slices.Backward(versions) {
+		v, err := uuid.Parse(strings.TrimPrefix(version.Name, versionKeyPrefix(name)))
+		if err != nil {
+			httpError(w, errors.Wrapf(err, "parse version of %q", version.Name).Error(), http.StatusInternalServerError)
+			return
+		}
+		if v == file.Version {
+			// Replaced concurrently after file was read.
+			continue
+		}
+		list = append(list, FileVersion{
+			Version:   v,
+			Size:      version.Size,
+			CreatedAt: version.CreatedAt,
+		})
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(list)
+}
+
+// VersionExpirerOptions configures VersionExpirer.
+type VersionExpirerOptions struct {
+	// Interval between expiration passes. Defaults to 10 minutes.
+	Interval time.Duration
+	// BatchSize is the number of versions that are fetched at once.
+	// Defaults to 100.
+	BatchSize int
+}
+
+func (o *VersionExpirerOptions) setDefaults() {
+	if o.Interval <= 0 {
+		o.Interval = 10 * time.Minute
+	}
+	if o.BatchSize <= 0 {
+		o.BatchSize = 100
+	}
+}
+
+// VersionExpirer removes noncurrent versions of files that outlived version
+// TTL of handler, so versions of files that are not uploaded again are
+// removed too. Their chunks are deleted from nodes by Collector.
+type VersionExpirer struct {
+	h         *Handler
+	interval  time.Duration
+	batchSize int
+
+	tracer  trace.Tracer
+	expired metric.Int64Counter
+}
+
+func NewVersionExpirer(
+	h *Handler,
+	opts VersionExpirerOptions,
+	tracerProvider trace.TracerProvider,
+	meterProvider metric.MeterProvider,
+) (*VersionExpirer, error) {
+	opts.setDefaults()
+	const name = "stor.front"
+	e := &VersionExpirer{
+		h:         h,
+		interval:  opts.Interval,
+		batchSize: opts.BatchSize,
+		tracer:    tracerProvider.Tracer(name),
+	}
+
+	meter := meterProvider.Meter(name)
+	var err error
+	if e.expired, err = meter.Int64Counter("versions.expired"); err != nil {
+		return nil, errors.Wrap(err, "versions.expired")
+	}
+
+	return e, nil
+}
+
+// Run removes expired versions every interval until ctx is done.
+func (e *VersionExpirer) Run(ctx context.Context) error {
+	ticker := time.NewTicker(e.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+		if err := e.Expire(ctx); err != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			zctx.From(ctx).Error("Version expiration failed", zap.Error(err))
+		}
+	}
+}
+
+// Expire removes all expired versions. Versions are not expired if handler
+// has no version TTL.
+func (e *VersionExpirer) Expire(ctx context.Context) (rerr error) {
+	ctx, span := e.tracer.Start(ctx, "VersionExpirer.Expire")
+	defer func() {
+		if rerr != nil {
+			span.RecordError(rerr)
+		}
+		span.End()
+	}()
+
+	if e.h.versionTTL <= 0 {
+		return nil
+	}
+	var (
+		from    = versionKeysPrefix
+		removed int
+	)
+	for {
+		versions, err := e.h.storage.Files(ctx, versionKeysPrefix, from, e.batchSize)
+		if err != nil {
+			return errors.Wrap(err, "files")
+		}
+		for _, version := range versions {
+			if !e.h.versionExpired(version) {
+				continue
+			}
+			if err := e.h.storage.RemoveFile(ctx, version.Name); err != nil {
+				var notFound *FileNotFoundErr
+				if errors.As(err, &notFound) {
+					// Pruned concurrently.
+					continue
+				}
+				return errors.Wrap(err, "remove version")
+			}
+			// Names of S3 objects contain NUL too, but versions don't.
+			key := strings.TrimPrefix(version.Name, versionKeysPrefix)
+			i := strings.LastIndexByte(key, 0)
+			name, v := key[:max(i, 0)], key[i+1:]
+			zctx.From(ctx).Info("Removed expired version",
+				zap.String("fileName", name),
+				zap.String("version", v),
+			)
+			e.expired.Add(ctx, 1)
+			removed++
+		}
+		if len(versions) < e.batchSize {
+			break
+		}
+		from = versions[len(versions)-1].Name + "\x00"
+	}
+	if removed > 0 {
+		// Chunks of removed versions.
+		e.h.notifyCollector()
+	}
+	return nil
+}
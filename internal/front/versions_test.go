@@ -0,0 +1,181 @@
+package front
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/require"
+	noopMeter "go.opentelemetry.io/otel/metric/noop"
+	noopTracer "go.opentelemetry.io/otel/trace/noop"
+)
+
+// uploadVersion uploads file and returns its version.
+func uploadVersion(t *testing.T, server *httptest.Server, name string, data []byte) uuid.UUID {
+	t.Helper()
+	resp := uploadFile(t, server, name, data)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	version, err := uuid.Parse(resp.Header.Get("X-File-Version"))
+	require.NoError(t, err)
+	return version
+}
+
+func listVersions(t *testing.T, server *httptest.Server, name string) (*http.Response, []FileVersion) {
+	t.Helper()
+	resp, err := server.Client().Get(server.URL + "/files/" + name + "/versions")
+	require.NoError(t, err)
+	defer func() { _ = resp.Body.Close() }()
+	var versions []FileVersion
+	if resp.StatusCode == http.StatusOK {
+		require.NoError(t, json.NewDecoder(resp.Body).Decode(&versions))
+	}
+	return resp, versions
+}
+
+func downloadVersion(t *testing.T, server *httptest.Server, name, version string) (*http.Response, []byte) {
+	t.Helper()
+	resp, err := server.Client().Get(server.URL + "/download/" + name + "?version=" + version)
+	require.NoError(t, err)
+	defer func() { _ = resp.Body.Close() }()
+	data, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+	return resp, data
+}
+
+func TestVersions(t *testing.T) {
+	var (
+		ctx   = context.Background()
+		stor  = newInMemoryStorage()
+		nodes = newInMemoryNodes()
+	)
+	handler, err := NewHandler(ctx, nodes, stor, noopTracer.NewTracerProvider(), noopMeter.NewMeterProvider(), HandlerOptions{
+		Chunking:     ChunkPolicy{Size: 1000},
+		KeepVersions: 2,
+		VersionTTL:   time.Hour,
+	})
+	require.NoError(t, err)
+	server := httptest.NewServer(handler)
+	t.Cleanup(server.Close)
+	registerNodes(t, server, nodes, "node1:8080")
+
+	var (
+		data     [][]byte
+		versions []uuid.UUID
+	)
+	for range 4 {
+		data = append(data, randomBytes(t, 1500))
+		versions = append(versions, uploadVersion(t, server, "file.bin", data[len(data)-1]))
+	}
+
+	t.Run("Keep", func(t *testing.T) {
+		resp, list := listVersions(t, server, "file.bin")
+		require.Equal(t, http.StatusOK, resp.StatusCode)
+		require.Len(t, list, 3)
+		for i, v := range list {
+			require.Equal(t, versions[3-i], v.Version)
+			require.Equal(t, int64(1500), v.Size)
+			require.Equal(t, i == 0, v.Current)
+		}
+
+		resp, _ = listVersions(t, server, "missing.bin")
+		require.Equal(t, http.StatusNotFound, resp.StatusCode)
+	})
+	t.Run("Download", func(t *testing.T) {
+		resp, downloaded, err := downloadFile(t, server, "file.bin")
+		require.NoError(t, err)
+		require.Equal(t, http.StatusOK, resp.StatusCode)
+		require.Equal(t, versions[3].String(), resp.Header.Get("X-File-Version"))
+		require.Equal(t, data[3], downloaded)
+
+		for _, i := range []int{1, 2, 3} {
+			resp, downloaded := downloadVersion(t, server, "file.bin", versions[i].String())
+			require.Equal(t, http.StatusOK, resp.StatusCode)
+			require.Equal(t, versions[i].String(), resp.Header.Get("X-File-Version"))
+			require.Equal(t, data[i], downloaded)
+		}
+		// Pruned by KeepVersions.
+		resp, _ = downloadVersion(t, server, "file.bin", versions[0].String())
+		require.Equal(t, http.StatusNotFound, resp.StatusCode)
+		resp, _ = downloadVersion(t, server, "file.bin", "latest")
+		require.Equal(t, http.StatusBadRequest, resp.StatusCode)
+	})
+	t.Run("Meta", func(t *testing.T) {
+		resp, err := server.Client().Get(server.URL + "/files/file.bin/meta?version=" + versions[2].String())
+		require.NoError(t, err)
+		defer func() { _ = resp.Body.Close() }()
+		require.Equal(t, http.StatusOK, resp.StatusCode)
+		var meta FileMeta
+		require.NoError(t, json.NewDecoder(resp.Body).Decode(&meta))
+		require.Equal(t, "file.bin", meta.Name)
+		require.Equal(t, versions[2], meta.Version)
+	})
+	t.Run("Listing", func(t *testing.T) {
+		resp, list := listFiles(t, server, url.Values{})
+		require.Equal(t, http.StatusOK, resp.StatusCode)
+		require.Len(t, list.Files, 1)
+		require.Equal(t, "file.bin", list.Files[0].Name)
+	})
+	t.Run("Expire", func(t *testing.T) {
+		uploadVersion(t, server, "expired.bin", randomBytes(t, 100))
+		uploadVersion(t, server, "expired.bin", randomBytes(t, 100))
+		_, list := listVersions(t, server, "expired.bin")
+		require.Len(t, list, 2)
+
+		now := time.Now().Add(time.Hour + time.Minute)
+		handler.now = func() time.Time { return now }
+		t.Cleanup(func() { handler.now = time.Now })
+		expirer, err := NewVersionExpirer(handler, VersionExpirerOptions{BatchSize: 1}, noopTracer.NewTracerProvider(), noopMeter.NewMeterProvider())
+		require.NoError(t, err)
+		require.NoError(t, expirer.Expire(ctx))
+
+		_, list = listVersions(t, server, "expired.bin")
+		require.Len(t, list, 1)
+		_, list = listVersions(t, server, "file.bin")
+		require.Len(t, list, 1)
+		resp, _, err := downloadFile(t, server, "file.bin")
+		require.NoError(t, err)
+		require.Equal(t, http.StatusOK, resp.StatusCode)
+	})
+	t.Run("Delete", func(t *testing.T) {
+		uploadVersion(t, server, "deleted.bin", randomBytes(t, 100))
+		uploadVersion(t, server, "deleted.bin", randomBytes(t, 100))
+		require.Equal(t, http.StatusAccepted, deleteFile(t, server, "deleted.bin").StatusCode)
+
+		resp, _ := listVersions(t, server, "deleted.bin")
+		require.Equal(t, http.StatusNotFound, resp.StatusCode)
+		files, err := stor.Files(ctx, versionKeyPrefix("deleted.bin"), "", 10)
+		require.NoError(t, err)
+		require.Empty(t, files)
+	})
+}
+
+func TestVersionsDisabled(t *testing.T) {
+	var (
+		ctx   = context.Background()
+		stor  = newInMemoryStorage()
+		nodes = newInMemoryNodes()
+	)
+	handler, err := NewHandler(ctx, nodes, stor, noopTracer.NewTracerProvider(), noopMeter.NewMeterProvider(), HandlerOptions{
+		Chunking: ChunkPolicy{Size: 1000},
+	})
+	require.NoError(t, err)
+	server := httptest.NewServer(handler)
+	t.Cleanup(server.Close)
+	registerNodes(t, server, nodes, "node1:8080")
+
+	first := uploadVersion(t, server, "file.bin", randomBytes(t, 1500))
+	uploadVersion(t, server, "file.bin", randomBytes(t, 1500))
+	_, list := listVersions(t, server, "file.bin")
+	require.Len(t, list, 1)
+	resp, _ := downloadVersion(t, server, "file.bin", first.String())
+	require.Equal(t, http.StatusNotFound, resp.StatusCode)
+	garbage, err := stor.Garbage(ctx, Replica{}, 1000)
+	require.NoError(t, err)
+	require.Len(t, garbage, 2)
+}
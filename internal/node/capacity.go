@@ -0,0 +1,10 @@
+package node
+
+// Capacity of file system that stores chunks.
+type Capacity struct {
+	TotalBytes uint64 `json:"totalBytes"`
+	// FreeBytes is the number of bytes available to node.
+	FreeBytes   uint64 `json:"freeBytes"`
+	TotalInodes uint64 `json:"totalInodes"`
+	FreeInodes  uint64 `json:"freeInodes"`
+}
@@ -0,0 +1,22 @@
+package node
+
+import (
+	"syscall"
+
+	"github.com/go-faster/errors"
+)
+
+// diskCapacity returns capacity of file system that contains dir.
+func diskCapacity(dir string) (Capacity, error) {
+	var st syscall.Statfs_t
+	if err := syscall.Statfs(dir, &st); err != nil {
+		return Capacity{}, errors.Wrap(err, "statfs")
+	}
+	bsize := uint64(st.Bsize) // #nosec G115
+	return Capacity{
+		TotalBytes:  st.Blocks * bsize,
+		FreeBytes:   st.Bavail * bsize,
+		TotalInodes: st.Files,
+		FreeInodes:  st.Ffree,
+	}, nil
+}
@@ -0,0 +1,10 @@
+//go:build !linux
+
+package node
+
+import "github.com/go-faster/errors"
+
+// diskCapacity returns capacity of file system that contains dir.
+func diskCapacity(string) (Capacity, error) {
+	return Capacity{}, errors.New("not supported")
+}
@@ -1,10 +1,17 @@
 package node
 
 import (
+	"bytes"
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"io"
+	"io/fs"
 	"os"
 	"path/filepath"
+	"strings"
+	"sync"
+	"time"
 
 	"github.com/go-faster/errors"
 	"github.com/go-faster/sdk/zctx"
@@ -14,15 +21,48 @@ import (
 	"go.uber.org/zap"
 )
 
+// ErrChecksumMismatch is returned when chunk data does not match its checksum.
+var ErrChecksumMismatch = errors.New("checksum mismatch")
+
+// ErrChunkNotFound is returned when chunk is not stored on node.
+var ErrChunkNotFound = errors.New("chunk not found")
+
+// ErrNoSpace is returned when chunk can't be written as node disk is full.
+var ErrNoSpace = errors.New("no space left on node")
+
+// ErrChunkModified is returned when chunk is not deleted as it was written
+// again since modification time delete is conditioned on.
+var ErrChunkModified = errors.New("chunk modified")
+
+// ErrRangeNotSatisfiable is returned when requested range does not fit into
+// chunk.
+var ErrRangeNotSatisfiable = errors.New("range not satisfiable")
+
+// checksumExt is extension of file that persists SHA-256 checksum of chunk
+// next to it.
+const checksumExt = ".sha256"
+
+// quarantineDir is directory inside chunks directory where corrupted chunks
+// are moved to.
+const quarantineDir = "quarantine"
+
 type Chunks struct {
 	dir string
+	// mux serializes placing of written chunks with conditional deletes.
+	mux sync.Mutex
+	// corrupted receives chunks that were quarantined on read, to be
+	// reported by Scrubber.
+	corrupted chan uuid.UUID
 
-	trace         trace.Tracer
-	bytesRead     metric.Int64Counter
-	bytesWrote    metric.Int64Counter
-	chunksRead    metric.Int64Counter
-	chunksWrote   metric.Int64Counter
-	chunksDeleted metric.Int64Counter
+	trace            trace.Tracer
+	bytesRead        metric.Int64Counter
+	bytesWrote       metric.Int64Counter
+	chunksRead       metric.Int64Counter
+	chunksWrote      metric.Int64Counter
+	chunksDeleted    metric.Int64Counter
+	checksumMismatch metric.Int64Counter
+	quarantined      metric.Int64Counter
+	reportsDropped   metric.Int64Counter
 }
 
 func NewChunks(dir string, tracerProvider trace.TracerProvider, meterProvider metric.MeterProvider) (*Chunks, error) {
@@ -49,16 +89,32 @@ func NewChunks(dir string, tracerProvider trace.TracerProvider, meterProvider me
 	if err != nil {
 		return nil, errors.Wrap(err, "chunks deleted")
 	}
+	checksumMismatch, err := meter.Int64Counter("node.chunks.checksum_mismatch")
+	if err != nil {
+		return nil, errors.Wrap(err, "checksum mismatch")
+	}
+	quarantined, err := meter.Int64Counter("node.chunks.quarantined")
+	if err != nil {
+		return nil, errors.Wrap(err, "quarantined")
+	}
+	reportsDropped, err := meter.Int64Counter("node.chunks.reports_dropped")
+	if err != nil {
+		return nil, errors.Wrap(err, "reports dropped")
+	}
 
 	return &Chunks{
-		dir: dir,
-
-		trace:         tracerProvider.Tracer(name),
-		bytesRead:     bytesRead,
-		bytesWrote:    bytesWrote,
-		chunksRead:    chunksRead,
-		chunksWrote:   chunksWrote,
-		chunksDeleted: chunksDeleted,
+		dir:       dir,
+		corrupted: make(chan uuid.UUID, 64),
+
+		trace:            tracerProvider.Tracer(name),
+		bytesRead:        bytesRead,
+		bytesWrote:       bytesWrote,
+		chunksRead:       chunksRead,
+		chunksWrote:      chunksWrote,
+		chunksDeleted:    chunksDeleted,
+		checksumMismatch: checksumMismatch,
+		quarantined:      quarantined,
+		reportsDropped:   reportsDropped,
 	}, nil
 }
 
@@ -67,8 +123,30 @@ func getTargetDir(dir string, id uuid.UUID) string {
 	return filepath.Join(dir, idStr[0:2], idStr[2:4])
 }
 
-// Write chunk to disk.
-func (c *Chunks) Write(ctx context.Context, id uuid.UUID, r io.Reader) (rerr error) {
+func (c *Chunks) path(id uuid.UUID) string {
+	return filepath.Join(getTargetDir(c.dir, id), id.String())
+}
+
+// WriteResult describes chunk written to node.
+type WriteResult struct {
+	// Checksum is SHA-256 checksum of written data.
+	Checksum []byte
+	// ModTime is modification time of written chunk, that is unique for
+	// every write and is changed by writing the same chunk again.
+	ModTime time.Time
+	// Created is set if chunk was not stored on node before.
+	Created bool
+}
+
+// Write chunk to disk and persist its SHA-256 checksum.
+//
+// If checksum is not nil, chunk is rejected with ErrChecksumMismatch when
+// written data does not match it.
+//
+// Chunk and checksum are written to temporary files that are renamed into
+// place only when complete, as IDs are content-addressed and several writers
+// can write the same chunk at once.
+func (c *Chunks) Write(ctx context.Context, id uuid.UUID, r io.Reader, checksum []byte) (_ WriteResult, rerr error) {
 	ctx, span := c.trace.Start(ctx, "Chunks.Write")
 	defer func() {
 		if rerr != nil {
@@ -82,38 +160,206 @@ func (c *Chunks) Write(ctx context.Context, id uuid.UUID, r io.Reader) (rerr err
 	targetDir := getTargetDir(c.dir, id)
 	const dirPerm = 0o755
 	if err := os.MkdirAll(targetDir, dirPerm); err != nil {
-		return errors.Wrap(err, "mkdir")
+		return WriteResult{}, errors.Wrap(err, "mkdir")
 	}
 
-	f, err := os.Create(filepath.Join(targetDir, id.String())) // #nosec G304
-	if err != nil {
-		return errors.Wrap(err, "create")
-	}
+	// Temporary files are not listed as their names are not valid IDs.
+	var temp []string
 	defer func() {
-		_ = f.Close()
-		if rerr != nil {
-			// Cleanup failed chunk.
-			if deleteErr := os.Remove(f.Name()); deleteErr != nil {
-				zctx.From(ctx).Warn("Failed to delete chunk",
+		if rerr == nil {
+			return
+		}
+		// Cleanup failed chunk, leaving chunk of other writers intact.
+		for _, name := range temp {
+			if deleteErr := os.Remove(name); deleteErr != nil && !os.IsNotExist(deleteErr) {
+				zctx.From(ctx).Warn("Failed to delete temporary chunk",
 					zap.Error(deleteErr),
 				)
 			}
 		}
 	}()
+	f, err := os.CreateTemp(targetDir, "."+id.String()+"-*")
+	if err != nil {
+		return WriteResult{}, errors.Wrap(err, "create")
+	}
+	temp = append(temp, f.Name())
+	defer func() { _ = f.Close() }()
 
-	n, err := io.Copy(f, r)
+	h := sha256.New()
+	n, err := io.Copy(io.MultiWriter(f, h), r)
 	c.bytesWrote.Add(ctx, n)
 	if err != nil {
-		return errors.Wrap(err, "copy")
+		return WriteResult{}, errors.Wrap(err, "copy")
+	}
+	sum := h.Sum(nil)
+	if checksum != nil && !bytes.Equal(sum, checksum) {
+		c.checksumMismatch.Add(ctx, 1)
+		return WriteResult{}, errors.Wrapf(ErrChecksumMismatch, "expected %x, got %x", checksum, sum)
+	}
+	if err := f.Sync(); err != nil {
+		return WriteResult{}, errors.Wrap(err, "sync")
 	}
-
 	if err := f.Close(); err != nil {
-		return errors.Wrap(err, "close")
+		return WriteResult{}, errors.Wrap(err, "close")
+	}
+	// Time of write identifies it, as stored with precision of filesystem.
+	now := time.Now()
+	if err := os.Chtimes(f.Name(), now, now); err != nil {
+		return WriteResult{}, errors.Wrap(err, "set modification time")
+	}
+	info, err := os.Stat(f.Name())
+	if err != nil {
+		return WriteResult{}, errors.Wrap(err, "stat")
+	}
+
+	sf, err := os.CreateTemp(targetDir, "."+id.String()+"-*"+checksumExt)
+	if err != nil {
+		return WriteResult{}, errors.Wrap(err, "create checksum")
+	}
+	temp = append(temp, sf.Name())
+	_, err = sf.WriteString(hex.EncodeToString(sum))
+	if err == nil {
+		err = sf.Sync()
+	}
+	if closeErr := sf.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return WriteResult{}, errors.Wrap(err, "write checksum")
+	}
+	const filePerm = 0o644
+	for _, name := range temp {
+		if err := os.Chmod(name, filePerm); err != nil {
+			return WriteResult{}, errors.Wrap(err, "chmod")
+		}
+	}
+
+	c.mux.Lock()
+	created, err := c.place(id, f.Name(), sf.Name())
+	c.mux.Unlock()
+	if err != nil {
+		return WriteResult{}, errors.Wrap(err, "place")
+	}
+	temp = nil
+	if err := syncDir(targetDir); err != nil {
+		return WriteResult{}, errors.Wrap(err, "sync dir")
 	}
 
+	return WriteResult{
+		Checksum: sum,
+		ModTime:  info.ModTime(),
+		Created:  created,
+	}, nil
+}
+
+// place moves written chunk and its checksum from temporary files into
+// place, and reports whether chunk was not stored before.
+func (c *Chunks) place(id uuid.UUID, chunk, checksum string) (bool, error) {
+	// Checksum is placed first, so chunk is never served unverified. Data of
+	// chunk that is replaced is the same, as is its checksum.
+	if err := os.Rename(checksum, c.path(id)+checksumExt); err != nil {
+		return false, errors.Wrap(err, "rename checksum")
+	}
+	// Link fails if chunk exists.
+	err := os.Link(chunk, c.path(id))
+	if err == nil {
+		if err := os.Remove(chunk); err != nil {
+			return true, errors.Wrap(err, "remove temporary")
+		}
+		return true, nil
+	}
+	if !errors.Is(err, fs.ErrExist) {
+		return false, errors.Wrap(err, "link")
+	}
+	if err := os.Rename(chunk, c.path(id)); err != nil {
+		return false, errors.Wrap(err, "rename")
+	}
+	return false, nil
+}
+
+// syncDir persists entries of directory.
+func syncDir(dir string) error {
+	d, err := os.Open(dir) // #nosec G304
+	if err != nil {
+		return errors.Wrap(err, "open")
+	}
+	defer func() { _ = d.Close() }()
+	return d.Sync()
+}
+
+// readChecksum reads persisted checksum of chunk.
+//
+// Returns nil checksum for chunks written before checksums were introduced.
+func (c *Chunks) readChecksum(id uuid.UUID) ([]byte, error) {
+	data, err := os.ReadFile(c.path(id) + checksumExt) // #nosec G304
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, errors.Wrap(err, "read")
+	}
+	sum, err := hex.DecodeString(string(bytes.TrimSpace(data)))
+	if err != nil {
+		return nil, errors.Wrap(err, "decode")
+	}
+	return sum, nil
+}
+
+// verify checks that content of chunk read from r matches its persisted
+// checksum.
+//
+// Chunks without checksum are not verified.
+func (c *Chunks) verify(ctx context.Context, id uuid.UUID, r io.Reader) error {
+	checksum, err := c.readChecksum(id)
+	if err != nil {
+		return errors.Wrap(err, "checksum")
+	}
+	if checksum == nil {
+		return nil
+	}
+	h := sha256.New()
+	if _, err := io.Copy(h, r); err != nil {
+		return errors.Wrap(err, "hash")
+	}
+	if sum := h.Sum(nil); !bytes.Equal(sum, checksum) {
+		c.checksumMismatch.Add(ctx, 1)
+		zctx.From(ctx).Error("Chunk checksum mismatch",
+			zap.String("chunkID", id.String()),
+			zap.String("expected", hex.EncodeToString(checksum)),
+			zap.String("actual", hex.EncodeToString(sum)),
+		)
+		return errors.Wrapf(ErrChecksumMismatch, "expected %x, got %x", checksum, sum)
+	}
 	return nil
 }
 
+// verifyFile verifies chunk read from f like verify, and quarantines and
+// reports chunk on checksum mismatch.
+func (c *Chunks) verifyFile(ctx context.Context, id uuid.UUID, f io.Reader) error {
+	err := c.verify(ctx, id, f)
+	if errors.Is(err, ErrChecksumMismatch) {
+		if qErr := c.Quarantine(ctx, id); qErr != nil {
+			zctx.From(ctx).Warn("Failed to quarantine chunk", zap.Error(qErr))
+		}
+		select {
+		case c.corrupted <- id:
+		default:
+			// Reporting is congested. Front falls back to other replicas
+			// anyway, and quarantined chunk is removed from metadata by
+			// repair as missing on node.
+			c.reportsDropped.Add(ctx, 1)
+			zctx.From(ctx).Warn("Dropped report of corrupted chunk",
+				zap.String("chunkID", id.String()),
+			)
+		}
+	}
+	return err
+}
+
+// Read chunk to w.
+//
+// Chunk is verified against persisted checksum before anything is written,
+// so corrupted chunk is never served and is quarantined instead.
 func (c *Chunks) Read(ctx context.Context, id uuid.UUID, w io.Writer) (rerr error) {
 	ctx, span := c.trace.Start(ctx, "Chunks.Read")
 	defer func() {
@@ -125,12 +371,17 @@ func (c *Chunks) Read(ctx context.Context, id uuid.UUID, w io.Writer) (rerr erro
 		span.End()
 	}()
 
-	filePath := filepath.Join(getTargetDir(c.dir, id), id.String())
-	f, err := os.Open(filePath) // #nosec G304
+	f, err := os.Open(c.path(id)) // #nosec G304
 	if err != nil {
 		return errors.Wrap(err, "open")
 	}
 	defer func() { _ = f.Close() }()
+	if err := c.verifyFile(ctx, id, f); err != nil {
+		return errors.Wrap(err, "verify")
+	}
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		return errors.Wrap(err, "seek")
+	}
 
 	n, err := io.Copy(w, f)
 	c.bytesRead.Add(ctx, n)
@@ -141,7 +392,70 @@ func (c *Chunks) Read(ctx context.Context, id uuid.UUID, w io.Writer) (rerr erro
 	return nil
 }
 
-func (c *Chunks) Delete(ctx context.Context, id uuid.UUID) (rerr error) {
+// ReadRange reads length bytes of chunk starting from offset to w.
+//
+// Range that covers whole chunk is verified like in Read. Partial range is
+// not verified, as hashing whole chunk for every range is too expensive, so
+// its corruption is detected by Scrubber or by caller.
+func (c *Chunks) ReadRange(ctx context.Context, id uuid.UUID, offset, length int64, w io.Writer) (rerr error) {
+	ctx, span := c.trace.Start(ctx, "Chunks.ReadRange")
+	defer func() {
+		if rerr != nil {
+			span.RecordError(rerr)
+		} else {
+			c.chunksRead.Add(ctx, 1)
+		}
+		span.End()
+	}()
+
+	f, err := os.Open(c.path(id)) // #nosec G304
+	if err != nil {
+		return errors.Wrap(err, "open")
+	}
+	defer func() { _ = f.Close() }()
+	info, err := f.Stat()
+	if err != nil {
+		return errors.Wrap(err, "stat")
+	}
+	if offset < 0 || length <= 0 || offset+length > info.Size() {
+		return errors.Wrapf(ErrRangeNotSatisfiable, "%d bytes at %d of %d", length, offset, info.Size())
+	}
+	if offset == 0 && length == info.Size() {
+		if err := c.verifyFile(ctx, id, f); err != nil {
+			return errors.Wrap(err, "verify")
+		}
+	}
+
+	n, err := io.Copy(w, io.NewSectionReader(f, offset, length))
+	c.bytesRead.Add(ctx, n)
+	if err != nil {
+		return errors.Wrap(err, "copy")
+	}
+	if n != length {
+		return errors.Errorf("short read: %d < %d", n, length)
+	}
+
+	return nil
+}
+
+// Stat returns size and modification time of chunk.
+func (c *Chunks) Stat(_ context.Context, id uuid.UUID) (ChunkInfo, error) {
+	info, err := os.Stat(c.path(id))
+	if err != nil {
+		return ChunkInfo{}, errors.Wrap(err, "stat")
+	}
+	return ChunkInfo{
+		ID:      id,
+		Size:    info.Size(),
+		ModTime: info.ModTime(),
+	}, nil
+}
+
+// Delete chunk. Idempotent.
+//
+// If modTime is not zero, chunk is deleted only if it was not written again
+// since, or ErrChunkModified is returned.
+func (c *Chunks) Delete(ctx context.Context, id uuid.UUID, modTime time.Time) (rerr error) {
 	ctx, span := c.trace.Start(ctx, "Chunks.Delete")
 	defer func() {
 		if rerr != nil {
@@ -149,7 +463,21 @@ func (c *Chunks) Delete(ctx context.Context, id uuid.UUID) (rerr error) {
 		}
 		span.End()
 	}()
-	err := os.Remove(filepath.Join(getTargetDir(c.dir, id), id.String()))
+	c.mux.Lock()
+	defer c.mux.Unlock()
+	if !modTime.IsZero() {
+		info, err := os.Stat(c.path(id))
+		if os.IsNotExist(err) {
+			return nil
+		}
+		if err != nil {
+			return errors.Wrap(err, "stat")
+		}
+		if !info.ModTime().Equal(modTime) {
+			return errors.Wrapf(ErrChunkModified, "modified at %s", info.ModTime().Format(time.RFC3339Nano))
+		}
+	}
+	err := os.Remove(c.path(id))
 	if err == nil {
 		c.chunksDeleted.Add(ctx, 1)
 	}
@@ -159,5 +487,188 @@ func (c *Chunks) Delete(ctx context.Context, id uuid.UUID) (rerr error) {
 	if err != nil {
 		return errors.Wrap(err, "remove")
 	}
+	if err := os.Remove(c.path(id) + checksumExt); err != nil && !os.IsNotExist(err) {
+		return errors.Wrap(err, "remove checksum")
+	}
 	return nil
 }
+
+// Quarantine moves chunk with its checksum out of chunks layout, so it is
+// no longer served but is kept for inspection.
+func (c *Chunks) Quarantine(ctx context.Context, id uuid.UUID) (rerr error) {
+	ctx, span := c.trace.Start(ctx, "Chunks.Quarantine")
+	defer func() {
+		if rerr != nil {
+			span.RecordError(rerr)
+		}
+		span.End()
+	}()
+
+	targetDir := filepath.Join(c.dir, quarantineDir)
+	const dirPerm = 0o755
+	if err := os.MkdirAll(targetDir, dirPerm); err != nil {
+		return errors.Wrap(err, "mkdir")
+	}
+	if err := os.Rename(c.path(id), filepath.Join(targetDir, id.String())); err != nil {
+		return errors.Wrap(err, "move chunk")
+	}
+	c.quarantined.Add(ctx, 1)
+	err := os.Rename(c.path(id)+checksumExt, filepath.Join(targetDir, id.String()+checksumExt))
+	if err != nil && !os.IsNotExist(err) {
+		return errors.Wrap(err, "move checksum")
+	}
+
+	zctx.From(ctx).Warn("Quarantined chunk", zap.String("chunkID", id.String()))
+	return nil
+}
+
+// List returns IDs of all chunks in two-level layout of getTargetDir.
+//
+// Quarantined chunks are not listed.
+func (c *Chunks) List(ctx context.Context) (_ []uuid.UUID, rerr error) {
+	_, span := c.trace.Start(ctx, "Chunks.List")
+	defer func() {
+		if rerr != nil {
+			span.RecordError(rerr)
+		}
+		span.End()
+	}()
+
+	var ids []uuid.UUID
+	err := filepath.WalkDir(c.dir, func(path string, d os.DirEntry, err error) error {
+		if err != nil {
+			if path == c.dir && os.IsNotExist(err) {
+				// Nothing was written yet.
+				return filepath.SkipDir
+			}
+			return err
+		}
+		if d.IsDir() {
+			if d.Name() == quarantineDir && filepath.Dir(path) == c.dir {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if strings.HasSuffix(d.Name(), checksumExt) {
+			return nil
+		}
+		id, err := uuid.Parse(d.Name())
+		if err != nil {
+			// Not a chunk.
+			return nil
+		}
+		ids = append(ids, id)
+		return nil
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, "walk")
+	}
+	return ids, nil
+}
+
+// ChunkInfo describes chunk stored on node.
+type ChunkInfo struct {
+	ID      uuid.UUID `json:"id"`
+	Size    int64     `json:"size"`
+	ModTime time.Time `json:"modTime"`
+}
+
+// Inventory returns at most limit chunks with ID greater than after, ordered
+// by ID, so all chunks are listed page by page.
+//
+// Quarantined chunks are not listed.
+func (c *Chunks) Inventory(ctx context.Context, after uuid.UUID, limit int) (_ []ChunkInfo, rerr error) {
+	_, span := c.trace.Start(ctx, "Chunks.Inventory")
+	defer func() {
+		if rerr != nil {
+			span.RecordError(rerr)
+		}
+		span.End()
+	}()
+
+	var (
+		start  = after.String()
+		chunks []ChunkInfo
+	)
+	// Directories of getTargetDir layout and files are walked in lexical
+	// order, that is the order of IDs.
+	err := filepath.WalkDir(c.dir, func(path string, d os.DirEntry, err error) error {
+		if err != nil {
+			if path == c.dir && os.IsNotExist(err) {
+				// Nothing was written yet.
+				return filepath.SkipDir
+			}
+			return err
+		}
+		if d.IsDir() {
+			if path == c.dir {
+				return nil
+			}
+			rel, err := filepath.Rel(c.dir, path)
+			if err != nil {
+				return err
+			}
+			// Prefix of IDs in directory.
+			prefix := strings.ReplaceAll(rel, string(filepath.Separator), "")
+			if d.Name() == quarantineDir || prefix < start[:min(len(prefix), 4)] {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if strings.HasSuffix(d.Name(), checksumExt) {
+			return nil
+		}
+		id, err := uuid.Parse(d.Name())
+		if err != nil || d.Name() <= start {
+			// Not a chunk or already listed.
+			return nil
+		}
+		info, err := d.Info()
+		if os.IsNotExist(err) {
+			// Deleted concurrently.
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		chunks = append(chunks, ChunkInfo{
+			ID:      id,
+			Size:    info.Size(),
+			ModTime: info.ModTime(),
+		})
+		if len(chunks) >= limit {
+			return filepath.SkipAll
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, "walk")
+	}
+	return chunks, nil
+}
+
+// Status checks that chunks can be stored and reports capacity of chunks
+// directory.
+func (c *Chunks) Status(ctx context.Context) Status {
+	const dirPerm = 0o755
+	err := os.MkdirAll(c.dir, dirPerm)
+	if err == nil {
+		// Probe is not listed as it is not a valid chunk ID.
+		var f *os.File
+		if f, err = os.CreateTemp(c.dir, ".probe-*"); err == nil {
+			_ = f.Close()
+			err = os.Remove(f.Name())
+		}
+	}
+	if err != nil {
+		zctx.From(ctx).Error("Chunks directory is not writable", zap.Error(err))
+		return Status{State: StateUnhealthy, Error: err.Error()}
+	}
+	status := Status{State: StateOK}
+	if capacity, err := diskCapacity(c.dir); err != nil {
+		zctx.From(ctx).Warn("Failed to get capacity", zap.Error(err))
+	} else {
+		status.Capacity = &capacity
+	}
+	return status
+}
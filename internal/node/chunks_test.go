@@ -3,8 +3,14 @@ package node
 import (
 	"bytes"
 	"context"
+	"crypto/sha256"
 	"math/rand"
+	"os"
+	"path/filepath"
+	"runtime"
+	"slices"
 	"testing"
+	"time"
 
 	"github.com/google/uuid"
 	"github.com/stretchr/testify/require"
@@ -36,7 +42,11 @@ func TestChunks(t *testing.T) {
 	data := rd.New(t, 1024)
 	ctx := context.Background()
 	id := uuid.New()
-	require.NoError(t, chunks.Write(ctx, id, bytes.NewReader(data)), "write")
+	written, err := chunks.Write(ctx, id, bytes.NewReader(data), nil)
+	require.NoError(t, err, "write")
+	sum := sha256.Sum256(data)
+	require.Equal(t, sum[:], written.Checksum, "checksum")
+	require.True(t, written.Created, "created")
 
 	buf := new(bytes.Buffer)
 	require.NoError(t, chunks.Read(ctx, id, buf), "read")
@@ -44,17 +54,145 @@ func TestChunks(t *testing.T) {
 
 	require.Error(t, chunks.Read(ctx, uuid.Nil, new(bytes.Buffer)), "read non-existent chunk should error")
 
+	buf.Reset()
+	require.NoError(t, chunks.ReadRange(ctx, id, 1000, 24, buf), "read range")
+	require.Equal(t, data[1000:], buf.Bytes(), "read range data should equal to written data")
+	require.ErrorIs(t, chunks.ReadRange(ctx, id, 1000, 25, new(bytes.Buffer)), ErrRangeNotSatisfiable, "read range past end should error")
+
 	// Another data.
 	secondData, secondID := rd.New(t, 512), uuid.New()
 	require.NotEqual(t, id, secondID, "different IDs")
 	require.NotEqual(t, data, secondData, "different data")
-	require.NoError(t, chunks.Write(ctx, secondID, bytes.NewReader(secondData)), "write")
+	secondSum := sha256.Sum256(secondData)
+	_, err = chunks.Write(ctx, secondID, bytes.NewReader(secondData), secondSum[:])
+	require.NoError(t, err, "write with checksum")
 	buf.Reset()
 	require.NoError(t, chunks.Read(ctx, secondID, buf), "read")
 	require.Equal(t, secondData, buf.Bytes(), "read data should equal to written data")
 
+	ids, err := chunks.List(ctx)
+	require.NoError(t, err, "list")
+	require.ElementsMatch(t, []uuid.UUID{id, secondID}, ids)
+
+	// Checksum mismatch on write.
+	thirdID := uuid.New()
+	_, err = chunks.Write(ctx, thirdID, bytes.NewReader(data), secondSum[:])
+	require.ErrorIs(t, err, ErrChecksumMismatch, "write with wrong checksum")
+	require.Error(t, chunks.Read(ctx, thirdID, new(bytes.Buffer)), "rejected chunk should not exist")
+
+	// Failed write of existing chunk.
+	_, err = chunks.Write(ctx, secondID, bytes.NewReader(data), secondSum[:])
+	require.ErrorIs(t, err, ErrChecksumMismatch, "rewrite with wrong checksum")
+	buf.Reset()
+	require.NoError(t, chunks.Read(ctx, secondID, buf), "chunk should be kept on failed rewrite")
+	require.Equal(t, secondData, buf.Bytes())
+	entries, err := os.ReadDir(getTargetDir(chunks.dir, secondID))
+	require.NoError(t, err)
+	for _, e := range entries {
+		require.NotEqual(t, '.', e.Name()[0], "temporary files should be removed")
+	}
+
+	// Corruption on disk.
+	corrupted := bytes.Clone(secondData)
+	corrupted[0] ^= 0xff
+	require.NoError(t, os.WriteFile(chunks.path(secondID), corrupted, 0o600))
+	buf.Reset()
+	require.ErrorIs(t, chunks.Read(ctx, secondID, buf), ErrChecksumMismatch, "read corrupted chunk")
+	require.Zero(t, buf.Len(), "corrupted chunk should not be served")
+
+	// Corruption outside of read range.
+	fourthID := uuid.New()
+	_, err = chunks.Write(ctx, fourthID, bytes.NewReader(data), nil)
+	require.NoError(t, err)
+	corrupted = bytes.Clone(data)
+	corrupted[len(corrupted)-1] ^= 0xff
+	require.NoError(t, os.WriteFile(chunks.path(fourthID), corrupted, 0o600))
+	buf.Reset()
+	require.NoError(t, chunks.ReadRange(ctx, fourthID, 0, 10, buf), "partial range is not verified")
+	require.Equal(t, data[:10], buf.Bytes())
+	buf.Reset()
+	require.ErrorIs(t, chunks.ReadRange(ctx, fourthID, 0, int64(len(data)), buf), ErrChecksumMismatch, "read whole range of corrupted chunk")
+	require.Zero(t, buf.Len(), "corrupted chunk should not be served")
+	require.Error(t, chunks.Read(ctx, fourthID, new(bytes.Buffer)), "corrupted chunk should be quarantined")
+
+	// Conditional delete of chunk that was written again.
+	rewritten, err := chunks.Write(ctx, id, bytes.NewReader(data), nil)
+	require.NoError(t, err, "rewrite")
+	require.False(t, rewritten.Created, "chunk was already stored")
+	require.False(t, rewritten.ModTime.Equal(written.ModTime), "modification time should change")
+	require.ErrorIs(t, chunks.Delete(ctx, id, written.ModTime), ErrChunkModified)
+	info, err := chunks.Stat(ctx, id)
+	require.NoError(t, err, "chunk that was written again should be kept")
+	require.True(t, rewritten.ModTime.Equal(info.ModTime))
+	require.NoError(t, chunks.Delete(ctx, id, rewritten.ModTime), "delete unmodified")
+	require.NoError(t, chunks.Delete(ctx, id, rewritten.ModTime), "delete unmodified idempotent")
+
 	// Delete chunk.
-	require.NoError(t, chunks.Delete(ctx, id), "delete")
+	_, err = chunks.Write(ctx, id, bytes.NewReader(data), nil)
+	require.NoError(t, err)
+	require.NoError(t, chunks.Delete(ctx, id, time.Time{}), "delete")
 	require.Error(t, chunks.Read(ctx, id, new(bytes.Buffer)), "read deleted chunk should error")
-	require.NoError(t, chunks.Delete(ctx, id), "delete idempotent")
+	require.NoError(t, chunks.Delete(ctx, id, time.Time{}), "delete idempotent")
+}
+
+func TestChunksInventory(t *testing.T) {
+	ctx := context.Background()
+	chunks, err := NewChunks(t.TempDir(), noopTracer.NewTracerProvider(), noopMeter.NewMeterProvider())
+	require.NoError(t, err)
+
+	rd := newRandomData()
+	var ids []string
+	for i := range 50 {
+		id := uuid.New()
+		_, err := chunks.Write(ctx, id, bytes.NewReader(rd.New(t, i+1)), nil)
+		require.NoError(t, err)
+		ids = append(ids, id.String())
+	}
+	quarantined := uuid.New()
+	_, err = chunks.Write(ctx, quarantined, bytes.NewReader(rd.New(t, 10)), nil)
+	require.NoError(t, err)
+	require.NoError(t, chunks.Quarantine(ctx, quarantined))
+	slices.Sort(ids)
+
+	var (
+		listed []string
+		after  uuid.UUID
+		start  = time.Now().Add(-time.Minute)
+	)
+	for {
+		page, err := chunks.Inventory(ctx, after, 7)
+		require.NoError(t, err)
+		for _, chunk := range page {
+			listed = append(listed, chunk.ID.String())
+			require.NotZero(t, chunk.Size)
+			require.True(t, chunk.ModTime.After(start))
+		}
+		if len(page) < 7 {
+			break
+		}
+		after = page[len(page)-1].ID
+	}
+	require.Equal(t, ids, listed)
+}
+
+func TestChunksStatus(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	chunks, err := NewChunks(filepath.Join(dir, "chunks"), noopTracer.NewTracerProvider(), noopMeter.NewMeterProvider())
+	require.NoError(t, err)
+	status := chunks.Status(ctx)
+	require.Equal(t, StateOK, status.State)
+	if runtime.GOOS == "linux" {
+		require.NotNil(t, status.Capacity)
+		require.Positive(t, status.Capacity.TotalBytes)
+		require.LessOrEqual(t, status.Capacity.FreeBytes, status.Capacity.TotalBytes)
+	}
+
+	// Directory can't be created over regular file.
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "file"), nil, 0o600))
+	chunks, err = NewChunks(filepath.Join(dir, "file", "chunks"), noopTracer.NewTracerProvider(), noopMeter.NewMeterProvider())
+	require.NoError(t, err)
+	status = chunks.Status(ctx)
+	require.Equal(t, StateUnhealthy, status.State)
+	require.NotEmpty(t, status.Error)
 }
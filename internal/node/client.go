@@ -1,12 +1,23 @@
 package node
 
 import (
+	"bufio"
+	"bytes"
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
 	"io"
 	"net/http"
+	"net/url"
+	"strconv"
+	"time"
 
+	"github.com/cenkalti/backoff/v4"
 	"github.com/go-faster/errors"
 	"github.com/google/uuid"
+	"go.opentelemetry.io/otel/attribute"
 	"go.opentelemetry.io/otel/codes"
 	"go.opentelemetry.io/otel/trace"
 )
@@ -15,30 +26,168 @@ type HTTPClient interface {
 	Do(r *http.Request) (*http.Response, error)
 }
 
+// ClientOptions configures Client.
+type ClientOptions struct {
+	// Attempts is the maximum number of attempts of idempotent request,
+	// one disables retries. Defaults to 3.
+	Attempts int
+	// RetryInterval is the initial interval between attempts, that grows
+	// exponentially. Defaults to 100ms.
+	RetryInterval time.Duration
+}
+
+func (o *ClientOptions) setDefaults() {
+	if o.Attempts <= 0 {
+		o.Attempts = 3
+	}
+	if o.RetryInterval <= 0 {
+		o.RetryInterval = 100 * time.Millisecond
+	}
+}
+
 type Client struct {
-	baseURL string
-	trace   trace.Tracer
-	http    HTTPClient
+	baseURL       string
+	trace         trace.Tracer
+	http          HTTPClient
+	attempts      int
+	retryInterval time.Duration
 }
 
 func (c *Client) BaseURL() string {
 	return c.baseURL
 }
 
-func NewClient(baseURL string, httpClient HTTPClient, tracerProvider trace.TracerProvider) *Client {
+func NewClient(baseURL string, httpClient HTTPClient, tracerProvider trace.TracerProvider, opts ClientOptions) *Client {
+	opts.setDefaults()
 	return &Client{
-		http:    httpClient,
-		baseURL: baseURL,
-		trace:   tracerProvider.Tracer("stor.node.client"),
+		http:          httpClient,
+		baseURL:       baseURL,
+		trace:         tracerProvider.Tracer("stor.node.client"),
+		attempts:      opts.Attempts,
+		retryInterval: opts.RetryInterval,
+	}
+}
+
+// StatusErr is unexpected status code of response.
+//
+// Node responds with http.StatusNotFound to missing chunk and with
+// http.StatusInsufficientStorage if its disk is full, so StatusErr with
+// those codes matches ErrChunkNotFound and ErrNoSpace. Range that does not fit
+// into chunk is responded with http.StatusRequestedRangeNotSatisfiable, that
+// matches ErrRangeNotSatisfiable, and conditional delete of chunk that was
+// written again with http.StatusPreconditionFailed, that matches
+// ErrChunkModified.
+type StatusErr struct {
+	Code int
+}
+
+func (e *StatusErr) Error() string {
+	return fmt.Sprintf("unexpected status code: %d", e.Code)
+}
+
+func (e *StatusErr) Is(target error) bool {
+	switch target {
+	case ErrChunkNotFound:
+		return e.Code == http.StatusNotFound
+	case ErrNoSpace:
+		return e.Code == http.StatusInsufficientStorage
+	case ErrRangeNotSatisfiable:
+		return e.Code == http.StatusRequestedRangeNotSatisfiable
+	case ErrChunkModified:
+		return e.Code == http.StatusPreconditionFailed
+	default:
+		return false
+	}
+}
+
+// writeErr is failure to write response to destination writer, that is not
+// fixed by retry.
+type writeErr struct {
+	Err error
+}
+
+func (e *writeErr) Error() string {
+	return "write: " + e.Err.Error()
+}
+
+func (e *writeErr) Unwrap() error {
+	return e.Err
+}
+
+// retryWriter counts bytes written to W, and wraps its errors in writeErr.
+type retryWriter struct {
+	W io.Writer
+	N int64
+}
+
+func (r *retryWriter) Write(p []byte) (int, error) {
+	n, err := r.W.Write(p)
+	r.N += int64(n)
+	if err != nil {
+		return n, &writeErr{Err: err}
+	}
+	return n, nil
+}
+
+// temporary reports whether request that failed with err can succeed if
+// retried: request was not sent, connection failed or node failed with
+// server error.
+func temporary(err error) bool {
+	var (
+		status *StatusErr
+		write  *writeErr
+	)
+	switch {
+	case errors.Is(err, context.Canceled), errors.Is(err, context.DeadlineExceeded):
+		return false
+	case errors.Is(err, ErrChecksumMismatch), errors.As(err, &write):
+		return false
+	case errors.As(err, &status):
+		if status.Code == http.StatusInsufficientStorage {
+			// Disk is not freed by retry.
+			return false
+		}
+		return status.Code >= http.StatusInternalServerError || status.Code == http.StatusTooManyRequests
+	default:
+		return true
 	}
 }
 
+// retry calls f until it succeeds, fails with error that is not temporary
+// or attempts are exhausted, with exponential backoff between attempts.
+func (c *Client) retry(ctx context.Context, f func() error) error {
+	b := backoff.NewExponentialBackOff()
+	b.InitialInterval = c.retryInterval
+	var attempt int
+	return backoff.Retry(func() error {
+		attempt++
+		err := f()
+		switch {
+		case err == nil:
+			return nil
+		case !temporary(err) || ctx.Err() != nil:
+			return backoff.Permanent(err)
+		}
+		trace.SpanFromContext(ctx).AddEvent("Attempt failed", trace.WithAttributes(
+			attribute.Int("attempt", attempt),
+			attribute.String("error", err.Error()),
+		))
+		return err
+	}, backoff.WithContext(backoff.WithMaxRetries(b, uint64(c.attempts-1)), ctx))
+}
+
 func (c *Client) url(id uuid.UUID) string {
 	return c.baseURL + "/chunks/" + id.String()
 }
 
-// Write chunk from r reader.
-func (c *Client) Write(ctx context.Context, id uuid.UUID, r io.Reader) (rerr error) {
+// Write chunk from r reader. Not retried, as r can't be read again.
+//
+// If checksum is not nil, it is sent to node, that rejects chunk with
+// ErrChecksumMismatch instead of replacing stored one if data does not match.
+//
+// Checksum of result is SHA-256 checksum of chunk, verified to be the same
+// on both sides.
+func (c *Client) Write(ctx context.Context, id uuid.UUID, r io.Reader, checksum []byte) (_ WriteResult, rerr error) {
 	ctx, span := c.trace.Start(ctx, "Write")
 	defer func() {
 		if rerr != nil {
@@ -48,25 +197,54 @@ func (c *Client) Write(ctx context.Context, id uuid.UUID, r io.Reader) (rerr err
 		span.End()
 	}()
 
-	req, err := http.NewRequestWithContext(ctx, http.MethodPut, c.url(id), r)
+	h := sha256.New()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPut, c.url(id), io.TeeReader(r, h))
 	if err != nil {
-		return errors.Wrap(err, "create request")
+		return WriteResult{}, errors.Wrap(err, "create request")
+	}
+	if checksum != nil {
+		req.Header.Set(ChecksumHeader, hex.EncodeToString(checksum))
 	}
 
 	resp, err := c.http.Do(req)
 	if err != nil {
-		return errors.Wrap(err, "do request")
+		return WriteResult{}, errors.Wrap(err, "do request")
 	}
 	defer func() { _ = resp.Body.Close() }()
 
-	if resp.StatusCode != http.StatusOK {
-		return errors.Errorf("unexpected status code: %d", resp.StatusCode)
+	if resp.StatusCode == http.StatusBadRequest && checksum != nil {
+		// Well-formed request is rejected only if data does not match.
+		return WriteResult{}, errors.Wrapf(ErrChecksumMismatch, "sent %x, expected %x", h.Sum(nil), checksum)
+	}
+	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusCreated {
+		return WriteResult{}, &StatusErr{Code: resp.StatusCode}
 	}
 
-	return nil
+	// Node reports checksum of persisted data, that should match sent data.
+	persisted, err := hex.DecodeString(resp.Header.Get(ChecksumHeader))
+	if err != nil {
+		return WriteResult{}, errors.Wrap(err, "decode checksum")
+	}
+	if sum := h.Sum(nil); !bytes.Equal(sum, persisted) {
+		return WriteResult{}, errors.Wrapf(ErrChecksumMismatch, "sent %x, persisted %x", sum, persisted)
+	}
+	modTime, err := time.Parse(time.RFC3339Nano, resp.Header.Get(ModTimeHeader))
+	if err != nil {
+		return WriteResult{}, errors.Wrap(err, "parse modification time")
+	}
+
+	return WriteResult{
+		Checksum: persisted,
+		ModTime:  modTime,
+		Created:  resp.StatusCode == http.StatusCreated,
+	}, nil
 }
 
-// Read chunk to w writer.
+// Read chunk to w writer. Idempotent.
+//
+// Read that fails mid-stream is resumed by range request from the first byte
+// that was not written. Resumed part is not verified by node, so caller
+// should verify whole chunk.
 func (c *Client) Read(ctx context.Context, id uuid.UUID, w io.Writer) (rerr error) {
 	ctx, span := c.trace.Start(ctx, "Read")
 	defer func() {
@@ -77,9 +255,29 @@ func (c *Client) Read(ctx context.Context, id uuid.UUID, w io.Writer) (rerr erro
 		span.End()
 	}()
 
+	var (
+		rw   = &retryWriter{W: w}
+		size = int64(-1)
+	)
+	return c.retry(ctx, func() error {
+		switch {
+		case rw.N == 0:
+			return c.read(ctx, id, rw, &size)
+		case size < 0:
+			return backoff.Permanent(errors.New("size of chunk is unknown, read can't be resumed"))
+		case rw.N < size:
+			return c.readRange(ctx, id, rw.N, size-rw.N, rw)
+		default:
+			return nil
+		}
+	})
+}
+
+// read reads chunk to w, setting size to its length if node reports it.
+func (c *Client) read(ctx context.Context, id uuid.UUID, w io.Writer, size *int64) error {
 	req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.url(id), http.NoBody)
 	if err != nil {
-		return errors.Wrap(err, "create request")
+		return backoff.Permanent(errors.Wrap(err, "create request"))
 	}
 
 	resp, err := c.http.Do(req)
@@ -89,7 +287,10 @@ func (c *Client) Read(ctx context.Context, id uuid.UUID, w io.Writer) (rerr erro
 	defer func() { _ = resp.Body.Close() }()
 
 	if resp.StatusCode != http.StatusOK {
-		return errors.Errorf("unexpected status code: %d", resp.StatusCode)
+		return &StatusErr{Code: resp.StatusCode}
+	}
+	if resp.ContentLength >= 0 {
+		*size = resp.ContentLength
 	}
 
 	if _, err := io.Copy(w, resp.Body); err != nil {
@@ -99,9 +300,15 @@ func (c *Client) Read(ctx context.Context, id uuid.UUID, w io.Writer) (rerr erro
 	return nil
 }
 
-// Delete chunk. Idempotent.
-func (c *Client) Delete(ctx context.Context, id uuid.UUID) (rerr error) {
-	ctx, span := c.trace.Start(ctx, "Delete")
+// ReadRange reads length bytes of chunk starting from offset to w.
+// Idempotent, read that fails mid-stream is resumed.
+func (c *Client) ReadRange(ctx context.Context, id uuid.UUID, offset, length int64, w io.Writer) (rerr error) {
+	ctx, span := c.trace.Start(ctx, "ReadRange",
+		trace.WithAttributes(
+			attribute.Int64("offset", offset),
+			attribute.Int64("length", length),
+		),
+	)
 	defer func() {
 		if rerr != nil {
 			span.RecordError(rerr)
@@ -109,11 +316,22 @@ func (c *Client) Delete(ctx context.Context, id uuid.UUID) (rerr error) {
 		}
 		span.End()
 	}()
+	if length <= 0 {
+		return errors.Errorf("invalid length: %d", length)
+	}
 
-	req, err := http.NewRequestWithContext(ctx, http.MethodDelete, c.url(id), http.NoBody)
+	rw := &retryWriter{W: w}
+	return c.retry(ctx, func() error {
+		return c.readRange(ctx, id, offset+rw.N, length-rw.N, rw)
+	})
+}
+
+func (c *Client) readRange(ctx context.Context, id uuid.UUID, offset, length int64, w io.Writer) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.url(id), http.NoBody)
 	if err != nil {
-		return errors.Wrap(err, "create request")
+		return backoff.Permanent(errors.Wrap(err, "create request"))
 	}
+	req.Header.Set("Range", fmt.Sprintf("bytes=%d-%d", offset, offset+length-1))
 
 	resp, err := c.http.Do(req)
 	if err != nil {
@@ -121,9 +339,198 @@ func (c *Client) Delete(ctx context.Context, id uuid.UUID) (rerr error) {
 	}
 	defer func() { _ = resp.Body.Close() }()
 
-	if resp.StatusCode != http.StatusOK {
-		return errors.Errorf("unexpected status code: %d", resp.StatusCode)
+	if resp.StatusCode != http.StatusPartialContent {
+		return &StatusErr{Code: resp.StatusCode}
+	}
+
+	n, err := io.Copy(w, resp.Body)
+	if err != nil {
+		return errors.Wrap(err, "copy body")
+	}
+	if n != length {
+		return errors.Errorf("short read: %d < %d", n, length)
 	}
 
 	return nil
 }
+
+// List returns IDs of all chunks stored on node. Idempotent.
+func (c *Client) List(ctx context.Context) (ids []uuid.UUID, rerr error) {
+	ctx, span := c.trace.Start(ctx, "List")
+	defer func() {
+		if rerr != nil {
+			span.RecordError(rerr)
+			span.SetStatus(codes.Error, rerr.Error())
+		}
+		span.End()
+	}()
+
+	err := c.retry(ctx, func() error {
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.baseURL+"/chunks", http.NoBody)
+		if err != nil {
+			return backoff.Permanent(errors.Wrap(err, "create request"))
+		}
+
+		resp, err := c.http.Do(req)
+		if err != nil {
+			return errors.Wrap(err, "do request")
+		}
+		defer func() { _ = resp.Body.Close() }()
+
+		if resp.StatusCode != http.StatusOK {
+			return &StatusErr{Code: resp.StatusCode}
+		}
+
+		ids = ids[:0]
+		scanner := bufio.NewScanner(resp.Body)
+		for scanner.Scan() {
+			id, err := uuid.Parse(scanner.Text())
+			if err != nil {
+				return backoff.Permanent(errors.Wrap(err, "parse id"))
+			}
+			ids = append(ids, id)
+		}
+		if err := scanner.Err(); err != nil {
+			return errors.Wrap(err, "read body")
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return ids, nil
+}
+
+// Inventory returns at most limit chunks stored on node with ID greater
+// than after, ordered by ID. Idempotent.
+func (c *Client) Inventory(ctx context.Context, after uuid.UUID, limit int) (chunks []ChunkInfo, rerr error) {
+	ctx, span := c.trace.Start(ctx, "Inventory")
+	defer func() {
+		if rerr != nil {
+			span.RecordError(rerr)
+			span.SetStatus(codes.Error, rerr.Error())
+		}
+		span.End()
+	}()
+
+	query := url.Values{
+		"after": {after.String()},
+		"limit": {strconv.Itoa(limit)},
+	}
+	err := c.retry(ctx, func() error {
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.baseURL+"/inventory?"+query.Encode(), http.NoBody)
+		if err != nil {
+			return backoff.Permanent(errors.Wrap(err, "create request"))
+		}
+
+		resp, err := c.http.Do(req)
+		if err != nil {
+			return errors.Wrap(err, "do request")
+		}
+		defer func() { _ = resp.Body.Close() }()
+
+		if resp.StatusCode != http.StatusOK {
+			return &StatusErr{Code: resp.StatusCode}
+		}
+
+		chunks = nil
+		if err := json.NewDecoder(resp.Body).Decode(&chunks); err != nil {
+			return errors.Wrap(err, "decode")
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return chunks, nil
+}
+
+// Stat returns size and modification time of chunk. Idempotent.
+func (c *Client) Stat(ctx context.Context, id uuid.UUID) (info ChunkInfo, rerr error) {
+	ctx, span := c.trace.Start(ctx, "Stat")
+	defer func() {
+		if rerr != nil {
+			span.RecordError(rerr)
+			span.SetStatus(codes.Error, rerr.Error())
+		}
+		span.End()
+	}()
+
+	err := c.retry(ctx, func() error {
+		req, err := http.NewRequestWithContext(ctx, http.MethodHead, c.url(id), http.NoBody)
+		if err != nil {
+			return backoff.Permanent(errors.Wrap(err, "create request"))
+		}
+
+		resp, err := c.http.Do(req)
+		if err != nil {
+			return errors.Wrap(err, "do request")
+		}
+		defer func() { _ = resp.Body.Close() }()
+
+		if resp.StatusCode != http.StatusOK {
+			return &StatusErr{Code: resp.StatusCode}
+		}
+		modTime, err := time.Parse(time.RFC3339Nano, resp.Header.Get(ModTimeHeader))
+		if err != nil {
+			return backoff.Permanent(errors.Wrap(err, "parse modification time"))
+		}
+		info = ChunkInfo{
+			ID:      id,
+			Size:    resp.ContentLength,
+			ModTime: modTime,
+		}
+		return nil
+	})
+	if err != nil {
+		return ChunkInfo{}, err
+	}
+
+	return info, nil
+}
+
+// Delete chunk. Idempotent.
+func (c *Client) Delete(ctx context.Context, id uuid.UUID) error {
+	return c.delete(ctx, id, time.Time{})
+}
+
+// DeleteUnmodified deletes chunk only if its modification time is still
+// modTime, so chunk that was written again since is kept and
+// ErrChunkModified is returned. Idempotent.
+func (c *Client) DeleteUnmodified(ctx context.Context, id uuid.UUID, modTime time.Time) error {
+	return c.delete(ctx, id, modTime)
+}
+
+func (c *Client) delete(ctx context.Context, id uuid.UUID, modTime time.Time) (rerr error) {
+	ctx, span := c.trace.Start(ctx, "Delete")
+	defer func() {
+		if rerr != nil {
+			span.RecordError(rerr)
+			span.SetStatus(codes.Error, rerr.Error())
+		}
+		span.End()
+	}()
+
+	return c.retry(ctx, func() error {
+		req, err := http.NewRequestWithContext(ctx, http.MethodDelete, c.url(id), http.NoBody)
+		if err != nil {
+			return backoff.Permanent(errors.Wrap(err, "create request"))
+		}
+		if !modTime.IsZero() {
+			req.Header.Set(ModTimeHeader, modTime.Format(time.RFC3339Nano))
+		}
+
+		resp, err := c.http.Do(req)
+		if err != nil {
+			return errors.Wrap(err, "do request")
+		}
+		defer func() { _ = resp.Body.Close() }()
+
+		if resp.StatusCode != http.StatusOK {
+			return &StatusErr{Code: resp.StatusCode}
+		}
+		return nil
+	})
+}
@@ -0,0 +1,137 @@
+package node
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/require"
+	noopTracer "go.opentelemetry.io/otel/trace/noop"
+)
+
+// flakyHTTPClient fails requests and truncates response bodies.
+type flakyHTTPClient struct {
+	HTTPClient
+
+	mux sync.Mutex
+	// failures is the number of requests that fail before being sent.
+	failures int
+	// truncate is the number of bytes after which next response body
+	// fails, zero means no truncation.
+	truncate int64
+	// ranges are Range headers of sent requests.
+	ranges []string
+}
+
+func (f *flakyHTTPClient) Do(req *http.Request) (*http.Response, error) {
+	f.mux.Lock()
+	defer f.mux.Unlock()
+	if f.failures > 0 {
+		f.failures--
+		return nil, errors.New("connection refused")
+	}
+	f.ranges = append(f.ranges, req.Header.Get("Range"))
+	resp, err := f.HTTPClient.Do(req)
+	if err != nil || f.truncate == 0 {
+		return resp, err
+	}
+	resp.Body = &truncatedBody{ReadCloser: resp.Body, N: f.truncate}
+	f.truncate = 0
+	return resp, nil
+}
+
+// truncatedBody fails after N bytes.
+type truncatedBody struct {
+	io.ReadCloser
+	N int64
+}
+
+func (t *truncatedBody) Read(p []byte) (int, error) {
+	if t.N <= 0 {
+		return 0, io.ErrUnexpectedEOF
+	}
+	if int64(len(p)) > t.N {
+		p = p[:t.N]
+	}
+	n, err := t.ReadCloser.Read(p)
+	t.N -= int64(n)
+	return n, err
+}
+
+// failingWriter fails every write.
+type failingWriter struct{}
+
+func (failingWriter) Write([]byte) (int, error) {
+	return 0, errors.New("client disconnected")
+}
+
+func TestClientRetry(t *testing.T) {
+	var (
+		storage = newInMemoryChunks()
+		server  = httptest.NewServer(NewHandler(storage))
+		flaky   = &flakyHTTPClient{HTTPClient: server.Client()}
+		client  = NewClient(server.URL, flaky, noopTracer.NewTracerProvider(), ClientOptions{
+			RetryInterval: time.Millisecond,
+		})
+		data = newRandomData().New(t, 4096)
+		ctx  = context.Background()
+		id   = uuid.New()
+	)
+	t.Cleanup(server.Close)
+	storage.chunks[id] = data
+	reset := func(failures int, truncate int64) {
+		flaky.mux.Lock()
+		defer flaky.mux.Unlock()
+		flaky.failures = failures
+		flaky.truncate = truncate
+		flaky.ranges = nil
+	}
+
+	t.Run("Failures", func(t *testing.T) {
+		reset(2, 0)
+		buf := new(bytes.Buffer)
+		require.NoError(t, client.Read(ctx, id, buf))
+		require.Equal(t, data, buf.Bytes())
+
+		reset(3, 0)
+		require.Error(t, client.Read(ctx, id, new(bytes.Buffer)), "attempts are exhausted")
+		reset(2, 0)
+		ids, err := client.List(ctx)
+		require.NoError(t, err)
+		require.Equal(t, []uuid.UUID{id}, ids)
+	})
+	t.Run("Resume", func(t *testing.T) {
+		reset(0, 1000)
+		buf := new(bytes.Buffer)
+		require.NoError(t, client.Read(ctx, id, buf))
+		require.Equal(t, data, buf.Bytes())
+		require.Equal(t, []string{"", "bytes=1000-4095"}, flaky.ranges)
+
+		reset(0, 100)
+		buf.Reset()
+		require.NoError(t, client.ReadRange(ctx, id, 1000, 2000, buf))
+		require.Equal(t, data[1000:3000], buf.Bytes())
+		require.Equal(t, []string{"bytes=1000-2999", "bytes=1100-2999"}, flaky.ranges)
+	})
+	t.Run("Permanent", func(t *testing.T) {
+		reset(0, 0)
+		require.Error(t, client.Read(ctx, id, failingWriter{}))
+		require.Len(t, flaky.ranges, 1, "write failure is not retried")
+
+		reset(0, 0)
+		require.ErrorIs(t, client.Read(ctx, uuid.New(), new(bytes.Buffer)), ErrChunkNotFound)
+		require.Len(t, flaky.ranges, 1, "missing chunk is not retried")
+		require.ErrorIs(t, &StatusErr{Code: http.StatusInsufficientStorage}, ErrNoSpace)
+
+		require.False(t, temporary(&StatusErr{Code: http.StatusNotFound}))
+		require.True(t, temporary(&StatusErr{Code: http.StatusServiceUnavailable}))
+		require.False(t, temporary(context.Canceled))
+	})
+}
@@ -1,19 +1,58 @@
 package node
 
 import (
+	"bufio"
 	"context"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
 	"io"
+	"io/fs"
 	"net/http"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
 
+	"github.com/go-faster/errors"
 	"github.com/google/uuid"
 )
 
 type HandlerStorage interface {
 	Read(ctx context.Context, id uuid.UUID, w io.Writer) error
-	Write(ctx context.Context, id uuid.UUID, r io.Reader) error
-	Delete(ctx context.Context, id uuid.UUID) error
+	ReadRange(ctx context.Context, id uuid.UUID, offset, length int64, w io.Writer) error
+	// Stat returns size and modification time of chunk.
+	Stat(ctx context.Context, id uuid.UUID) (ChunkInfo, error)
+	Write(ctx context.Context, id uuid.UUID, r io.Reader, checksum []byte) (WriteResult, error)
+	// Delete deletes chunk, only if it was not written since modTime
+	// unless it is zero.
+	Delete(ctx context.Context, id uuid.UUID, modTime time.Time) error
+	List(ctx context.Context) ([]uuid.UUID, error)
+	// Inventory returns at most limit chunks with ID greater than after,
+	// ordered by ID.
+	Inventory(ctx context.Context, after uuid.UUID, limit int) ([]ChunkInfo, error)
 }
 
+// Inventory page size limits.
+const (
+	DefaultInventoryLimit = 1000
+	MaxInventoryLimit     = 10000
+)
+
+// ChecksumHeader holds hex-encoded SHA-256 checksum of chunk.
+//
+// Optional in write request, where chunk is rejected on mismatch.
+// Always set in write response to checksum of persisted data.
+const ChecksumHeader = "X-Checksum"
+
+// ModTimeHeader holds modification time of chunk in RFC 3339 format with
+// nanoseconds, that identifies the write of chunk.
+//
+// Set in write and head responses. Optional in delete request, where chunk
+// is deleted only if it was not written again since, and
+// http.StatusPreconditionFailed is responded otherwise.
+const ModTimeHeader = "X-Mod-Time"
+
 type Handler struct {
 	storage HandlerStorage
 }
@@ -23,6 +62,60 @@ func NewHandler(storage HandlerStorage) http.Handler {
 	mux.HandleFunc("/health", func(w http.ResponseWriter, r *http.Request) {
 		w.WriteHeader(http.StatusOK)
 	})
+	mux.HandleFunc("/chunks", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		// Inventory of chunks, one ID per line.
+		ids, err := storage.List(r.Context())
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "text/plain")
+		bw := bufio.NewWriter(w)
+		for _, id := range ids {
+			_, _ = bw.WriteString(id.String() + "\n")
+		}
+		_ = bw.Flush()
+	})
+	mux.HandleFunc("GET /inventory", func(w http.ResponseWriter, r *http.Request) {
+		// Page of chunks with sizes and modification times, that follow
+		// chunk ID after.
+		var (
+			after = uuid.Nil
+			limit = DefaultInventoryLimit
+			err   error
+		)
+		q := r.URL.Query()
+		if v := q.Get("after"); v != "" {
+			if after, err = uuid.Parse(v); err != nil {
+				http.Error(w, errors.Wrap(err, "parse after").Error(), http.StatusBadRequest)
+				return
+			}
+		}
+		if v := q.Get("limit"); v != "" {
+			if limit, err = strconv.Atoi(v); err != nil {
+				http.Error(w, errors.Wrap(err, "parse limit").Error(), http.StatusBadRequest)
+				return
+			}
+			if limit <= 0 || limit > MaxInventoryLimit {
+				http.Error(w, fmt.Sprintf("limit %d is out of [1, %d]", limit, MaxInventoryLimit), http.StatusBadRequest)
+				return
+			}
+		}
+		chunks, err := storage.Inventory(r.Context(), after, limit)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if chunks == nil {
+			chunks = []ChunkInfo{}
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(chunks)
+	})
 	mux.HandleFunc("/chunks/{id}", func(w http.ResponseWriter, r *http.Request) {
 		id, err := uuid.Parse(r.PathValue("id"))
 		if err != nil {
@@ -31,19 +124,70 @@ func NewHandler(storage HandlerStorage) http.Handler {
 		}
 		ctx := r.Context()
 		switch r.Method {
+		case http.MethodHead:
+			info, err := storage.Stat(ctx, id)
+			if err != nil {
+				w.WriteHeader(errorStatus(err))
+				return
+			}
+			w.Header().Set("Content-Length", strconv.FormatInt(info.Size, 10))
+			w.Header().Set(ModTimeHeader, info.ModTime.Format(time.RFC3339Nano))
 		case http.MethodGet:
+			if rangeHeader := r.Header.Get("Range"); rangeHeader != "" {
+				offset, length, err := parseRange(rangeHeader)
+				if err != nil {
+					http.Error(w, err.Error(), http.StatusRequestedRangeNotSatisfiable)
+					return
+				}
+				w.Header().Set("Content-Range", fmt.Sprintf("bytes %d-%d/*", offset, offset+length-1))
+				pw := &partialWriter{w: w}
+				if err := storage.ReadRange(ctx, id, offset, length, pw); err != nil && !pw.wrote {
+					w.Header().Del("Content-Range")
+					http.Error(w, err.Error(), errorStatus(err))
+				}
+				return
+			}
+			// Length lets client detect truncated response and resume
+			// it by range request.
+			if info, err := storage.Stat(ctx, id); err == nil {
+				w.Header().Set("Content-Length", strconv.FormatInt(info.Size, 10))
+			}
 			if err := storage.Read(ctx, id, w); err != nil {
-				http.Error(w, err.Error(), http.StatusInternalServerError)
+				http.Error(w, err.Error(), errorStatus(err))
 				return
 			}
 		case http.MethodPut:
-			if err := storage.Write(ctx, id, r.Body); err != nil {
-				http.Error(w, err.Error(), http.StatusInternalServerError)
+			var expected []byte
+			if v := r.Header.Get(ChecksumHeader); v != "" {
+				if expected, err = hex.DecodeString(v); err != nil {
+					http.Error(w, errors.Wrap(err, "decode checksum").Error(), http.StatusBadRequest)
+					return
+				}
+			}
+			written, err := storage.Write(ctx, id, r.Body, expected)
+			if errors.Is(err, ErrChecksumMismatch) {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			if err != nil {
+				http.Error(w, err.Error(), errorStatus(err))
 				return
 			}
+			w.Header().Set(ChecksumHeader, hex.EncodeToString(written.Checksum))
+			w.Header().Set(ModTimeHeader, written.ModTime.Format(time.RFC3339Nano))
+			if written.Created {
+				w.WriteHeader(http.StatusCreated)
+			}
 		case http.MethodDelete:
-			if err := storage.Delete(ctx, id); err != nil {
-				http.Error(w, err.Error(), http.StatusInternalServerError)
+			var modTime time.Time
+			if v := r.Header.Get(ModTimeHeader); v != "" {
+				if modTime, err = time.Parse(time.RFC3339Nano, v); err != nil {
+					http.Error(w, errors.Wrap(err, "parse modification time").Error(), http.StatusBadRequest)
+					return
+				}
+			}
+			if err := storage.Delete(ctx, id, modTime); err != nil {
+				http.Error(w, err.Error(), errorStatus(err))
 				return
 			}
 		default:
@@ -52,3 +196,60 @@ func NewHandler(storage HandlerStorage) http.Handler {
 	})
 	return mux
 }
+
+// errorStatus returns status code of response to chunk request that failed
+// with err.
+func errorStatus(err error) int {
+	switch {
+	case errors.Is(err, fs.ErrNotExist):
+		return http.StatusNotFound
+	case errors.Is(err, syscall.ENOSPC):
+		return http.StatusInsufficientStorage
+	case errors.Is(err, ErrRangeNotSatisfiable):
+		return http.StatusRequestedRangeNotSatisfiable
+	case errors.Is(err, ErrChunkModified):
+		return http.StatusPreconditionFailed
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+// parseRange parses single closed range of "bytes=first-last" form.
+//
+// That is the only form requested by [Client.ReadRange].
+func parseRange(s string) (offset, length int64, err error) {
+	spec, ok := strings.CutPrefix(s, "bytes=")
+	if !ok {
+		return 0, 0, errors.New("invalid range unit")
+	}
+	firstStr, lastStr, ok := strings.Cut(spec, "-")
+	if !ok {
+		return 0, 0, errors.New("invalid range")
+	}
+	first, err := strconv.ParseInt(firstStr, 10, 64)
+	if err != nil {
+		return 0, 0, errors.Wrap(err, "parse first byte")
+	}
+	last, err := strconv.ParseInt(lastStr, 10, 64)
+	if err != nil {
+		return 0, 0, errors.Wrap(err, "parse last byte")
+	}
+	if first < 0 || last < first {
+		return 0, 0, errors.New("invalid range")
+	}
+	return first, last - first + 1, nil
+}
+
+// partialWriter writes 206 Partial Content status on first write.
+type partialWriter struct {
+	w     http.ResponseWriter
+	wrote bool
+}
+
+func (p *partialWriter) Write(b []byte) (int, error) {
+	if !p.wrote {
+		p.wrote = true
+		p.w.WriteHeader(http.StatusPartialContent)
+	}
+	return p.w.Write(b)
+}
@@ -3,10 +3,15 @@ package node
 import (
 	"bytes"
 	"context"
-	"errors"
+	"crypto/sha256"
 	"io"
+	"io/fs"
+	"net/http"
 	"net/http/httptest"
+	"slices"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/google/uuid"
 	"github.com/stretchr/testify/require"
@@ -14,35 +19,92 @@ import (
 )
 
 type inMemoryChunks struct {
-	chunks map[uuid.UUID][]byte
+	chunks   map[uuid.UUID][]byte
+	modTimes map[uuid.UUID]time.Time
 }
 
-func (c *inMemoryChunks) Write(_ context.Context, id uuid.UUID, r io.Reader) error {
+func (c *inMemoryChunks) Write(_ context.Context, id uuid.UUID, r io.Reader, checksum []byte) (WriteResult, error) {
 	data, err := io.ReadAll(r)
 	if err != nil {
-		return err
+		return WriteResult{}, err
 	}
+	sum := sha256.Sum256(data)
+	if checksum != nil && !bytes.Equal(sum[:], checksum) {
+		return WriteResult{}, ErrChecksumMismatch
+	}
+	_, exists := c.chunks[id]
 	c.chunks[id] = data
-	return nil
+	c.modTimes[id] = time.Now()
+	return WriteResult{
+		Checksum: sum[:],
+		ModTime:  c.modTimes[id],
+		Created:  !exists,
+	}, nil
 }
 
 func (c *inMemoryChunks) Read(_ context.Context, id uuid.UUID, w io.Writer) error {
 	data, ok := c.chunks[id]
 	if !ok {
-		return errors.New("not found")
+		return fs.ErrNotExist
 	}
 	_, err := w.Write(data)
 	return err
 }
 
-func (c *inMemoryChunks) Delete(_ context.Context, id uuid.UUID) error {
+func (c *inMemoryChunks) ReadRange(_ context.Context, id uuid.UUID, offset, length int64, w io.Writer) error {
+	data, ok := c.chunks[id]
+	if !ok {
+		return fs.ErrNotExist
+	}
+	if offset+length > int64(len(data)) {
+		return ErrRangeNotSatisfiable
+	}
+	_, err := w.Write(data[offset : offset+length])
+	return err
+}
+
+func (c *inMemoryChunks) Stat(_ context.Context, id uuid.UUID) (ChunkInfo, error) {
+	data, ok := c.chunks[id]
+	if !ok {
+		return ChunkInfo{}, fs.ErrNotExist
+	}
+	return ChunkInfo{ID: id, Size: int64(len(data)), ModTime: c.modTimes[id]}, nil
+}
+
+func (c *inMemoryChunks) Delete(_ context.Context, id uuid.UUID, modTime time.Time) error {
+	if _, ok := c.chunks[id]; ok && !modTime.IsZero() && !c.modTimes[id].Equal(modTime) {
+		return ErrChunkModified
+	}
 	delete(c.chunks, id)
+	delete(c.modTimes, id)
 	return nil
 }
 
+func (c *inMemoryChunks) List(_ context.Context) ([]uuid.UUID, error) {
+	var ids []uuid.UUID
+	for id := range c.chunks {
+		ids = append(ids, id)
+	}
+	return ids, nil
+}
+
+func (c *inMemoryChunks) Inventory(_ context.Context, after uuid.UUID, limit int) ([]ChunkInfo, error) {
+	var chunks []ChunkInfo
+	for id, data := range c.chunks {
+		if id.String() > after.String() {
+			chunks = append(chunks, ChunkInfo{ID: id, Size: int64(len(data))})
+		}
+	}
+	slices.SortFunc(chunks, func(a, b ChunkInfo) int {
+		return strings.Compare(a.ID.String(), b.ID.String())
+	})
+	return chunks[:min(limit, len(chunks))], nil
+}
+
 func newInMemoryChunks() *inMemoryChunks {
 	return &inMemoryChunks{
-		chunks: make(map[uuid.UUID][]byte),
+		chunks:   make(map[uuid.UUID][]byte),
+		modTimes: make(map[uuid.UUID]time.Time),
 	}
 }
 
@@ -51,30 +113,94 @@ func TestNewHandler(t *testing.T) {
 		storage = newInMemoryChunks()
 		handler = NewHandler(storage)
 		server  = httptest.NewServer(handler)
-		client  = NewClient(server.URL, server.Client(), noopTracer.NewTracerProvider())
+		client  = NewClient(server.URL, server.Client(), noopTracer.NewTracerProvider(), ClientOptions{})
 		rd      = newRandomData()
 		data    = rd.New(t, 1024)
 		ctx     = context.Background()
 		id      = uuid.New()
 	)
-	require.NoError(t, client.Write(ctx, id, bytes.NewReader(data)), "write")
+	written, err := client.Write(ctx, id, bytes.NewReader(data), nil)
+	require.NoError(t, err, "write")
+	sum := sha256.Sum256(data)
+	require.Equal(t, sum[:], written.Checksum, "checksum")
+	require.True(t, written.Created, "created")
+	info, err := client.Stat(ctx, id)
+	require.NoError(t, err, "stat")
+	require.Equal(t, int64(len(data)), info.Size)
+	require.True(t, written.ModTime.Equal(info.ModTime), "modification time")
+	_, err = client.Stat(ctx, uuid.New())
+	require.ErrorIs(t, err, ErrChunkNotFound, "stat of non-existent chunk")
 	buf := new(bytes.Buffer)
 	require.NoError(t, client.Read(ctx, id, buf), "read")
 	require.Equal(t, data, buf.Bytes(), "read data should equal to written data")
 	require.Equal(t, data, storage.chunks[id], "data should equal to storage data")
 
+	// Read range.
+	buf.Reset()
+	require.NoError(t, client.ReadRange(ctx, id, 100, 200, buf), "read range")
+	require.Equal(t, data[100:300], buf.Bytes(), "read range data should equal to written data")
+	require.ErrorIs(t, client.ReadRange(ctx, id, 1000, 100, new(bytes.Buffer)), ErrRangeNotSatisfiable, "read out of range should error")
+	require.Error(t, client.ReadRange(ctx, uuid.New(), 0, 100, new(bytes.Buffer)), "read range of non-existent chunk should error")
+
 	// Another data.
 	secondData, secondID := rd.New(t, 512), uuid.New()
 	require.NotEqual(t, id, secondID, "different IDs")
 	require.NotEqual(t, data, secondData, "different data")
 
-	require.NoError(t, client.Write(ctx, secondID, bytes.NewReader(secondData)), "write")
+	_, err = client.Write(ctx, secondID, bytes.NewReader(secondData), nil)
+	require.NoError(t, err, "write")
 	buf.Reset()
 	require.NoError(t, client.Read(ctx, secondID, buf), "read")
 	require.Equal(t, secondData, buf.Bytes(), "read data should equal to written data")
 
+	// List chunks.
+	ids, err := client.List(ctx)
+	require.NoError(t, err, "list")
+	require.ElementsMatch(t, []uuid.UUID{id, secondID}, ids)
+
+	// Inventory page by page.
+	first, second := ChunkInfo{ID: id, Size: 1024}, ChunkInfo{ID: secondID, Size: 512}
+	if first.ID.String() > second.ID.String() {
+		first, second = second, first
+	}
+	page, err := client.Inventory(ctx, uuid.Nil, 1)
+	require.NoError(t, err, "inventory")
+	require.Equal(t, []ChunkInfo{first}, page)
+	page, err = client.Inventory(ctx, first.ID, 1)
+	require.NoError(t, err, "inventory")
+	require.Equal(t, []ChunkInfo{second}, page)
+	page, err = client.Inventory(ctx, second.ID, 1)
+	require.NoError(t, err, "inventory")
+	require.Empty(t, page)
+	_, err = client.Inventory(ctx, uuid.Nil, MaxInventoryLimit+1)
+	require.Error(t, err, "limit is bounded")
+
+	// Write with wrong checksum.
+	thirdID := uuid.New()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPut, server.URL+"/chunks/"+thirdID.String(), bytes.NewReader(data))
+	require.NoError(t, err)
+	req.Header.Set(ChecksumHeader, "00")
+	resp, err := server.Client().Do(req)
+	require.NoError(t, err)
+	_ = resp.Body.Close()
+	require.Equal(t, http.StatusBadRequest, resp.StatusCode, "checksum mismatch should be rejected")
+	_, ok := storage.chunks[thirdID]
+	require.False(t, ok, "rejected chunk should not exist")
+	_, err = client.Write(ctx, id, bytes.NewReader(secondData), written.Checksum)
+	require.ErrorIs(t, err, ErrChecksumMismatch, "client sends expected checksum")
+	require.Equal(t, data, storage.chunks[id], "stored chunk should not be replaced")
+
+	// Delete chunk that was written again.
+	rewritten, err := client.Write(ctx, id, bytes.NewReader(data), nil)
+	require.NoError(t, err, "rewrite")
+	require.False(t, rewritten.Created, "chunk was already stored")
+	require.ErrorIs(t, client.DeleteUnmodified(ctx, id, written.ModTime), ErrChunkModified)
+	require.Contains(t, storage.chunks, id, "chunk that was written again should be kept")
+	require.NoError(t, client.DeleteUnmodified(ctx, id, rewritten.ModTime), "delete unmodified")
+	require.NotContains(t, storage.chunks, id, "deleted chunk should not exist")
+
 	// Delete chunk.
 	require.NoError(t, client.Delete(ctx, id), "delete")
-	_, ok := storage.chunks[id]
+	_, ok = storage.chunks[id]
 	require.False(t, ok, "deleted chunk should not exist")
 }
@@ -0,0 +1,82 @@
+package node
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/go-faster/errors"
+	"github.com/go-faster/sdk/zctx"
+	"go.uber.org/zap"
+)
+
+// Node states reported in heartbeats.
+const (
+	// StateOK means that node serves and stores chunks.
+	StateOK = "ok"
+	// StateUnhealthy means that node can't store chunks.
+	StateUnhealthy = "unhealthy"
+)
+
+// Status of node, reported to the front in heartbeats.
+type Status struct {
+	State string `json:"state"`
+	// Error describes unhealthy state.
+	Error string `json:"error,omitempty"`
+	// Capacity of chunks directory, nil if unknown.
+	Capacity *Capacity `json:"capacity,omitempty"`
+}
+
+// Heartbeat sends status to the front every interval until ctx is done.
+//
+// Failed heartbeats are logged and retried on next tick.
+func Heartbeat(
+	ctx context.Context,
+	httpClient HTTPClient,
+	baseURL string,
+	interval time.Duration,
+	status func(ctx context.Context) Status,
+) error {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+		if err := sendHeartbeat(ctx, httpClient, baseURL, status(ctx)); err != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			zctx.From(ctx).Warn("Failed to send heartbeat", zap.Error(err))
+		}
+	}
+}
+
+func sendHeartbeat(ctx context.Context, httpClient HTTPClient, baseURL string, status Status) error {
+	body, err := json.Marshal(status)
+	if err != nil {
+		return errors.Wrap(err, "marshal status")
+	}
+	u := frontURL("/heartbeat", url.Values{
+		"baseURL": []string{baseURL},
+	})
+	req, err := http.NewRequestWithContext(ctx, http.MethodPut, u, bytes.NewReader(body))
+	if err != nil {
+		return errors.Wrap(err, "create request")
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return errors.Wrap(err, "do request")
+	}
+	defer func() { _ = resp.Body.Close() }()
+	if resp.StatusCode != http.StatusOK {
+		return errors.Errorf("unexpected status code: %d", resp.StatusCode)
+	}
+	return nil
+}
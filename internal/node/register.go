@@ -12,27 +12,44 @@ import (
 	"go.uber.org/zap"
 )
 
-// Register itself on the front node.
-func Register(ctx context.Context, httpClient HTTPClient, listenPort string) error {
-	lg := zctx.From(ctx)
-	lg.Info("Registering node")
+// BaseURL returns URL of node that is reachable from the front.
+func BaseURL(listenPort string) (string, error) {
 	hostname, err := os.Hostname()
 	if err != nil {
-		return errors.Wrap(err, "get hostname")
+		return "", errors.Wrap(err, "get hostname")
 	}
-	baseURL := &url.URL{
+	u := &url.URL{
 		Scheme: "http",
 		Host:   net.JoinHostPort(hostname, listenPort),
 	}
+	return u.String(), nil
+}
+
+// frontURL returns URL of front endpoint.
+func frontURL(path string, query url.Values) string {
 	u := &url.URL{
-		Scheme: "http",
-		Host:   net.JoinHostPort("front", "8080"),
-		Path:   "/register",
-		RawQuery: url.Values{
-			"baseURL": []string{baseURL.String()},
-		}.Encode(),
+		Scheme:   "http",
+		Host:     net.JoinHostPort("front", "8080"),
+		Path:     path,
+		RawQuery: query.Encode(),
+	}
+	return u.String()
+}
+
+// Register itself on the front node with topology labels.
+func Register(ctx context.Context, httpClient HTTPClient, listenPort string, topology Topology) error {
+	lg := zctx.From(ctx)
+	lg.Info("Registering node")
+	baseURL, err := BaseURL(listenPort)
+	if err != nil {
+		return errors.Wrap(err, "base url")
+	}
+	query := url.Values{
+		"baseURL": []string{baseURL},
 	}
-	req, err := http.NewRequest(http.MethodPut, u.String(), http.NoBody)
+	topology.encode(query)
+	u := frontURL("/register", query)
+	req, err := http.NewRequest(http.MethodPut, u, http.NoBody)
 	if err != nil {
 		return errors.Wrap(err, "create request")
 	}
@@ -44,6 +61,11 @@ func Register(ctx context.Context, httpClient HTTPClient, listenPort string) err
 	if resp.StatusCode != http.StatusOK {
 		return errors.Errorf("unexpected status code: %d", resp.StatusCode)
 	}
-	lg.Info("Registered", zap.String("baseURL", baseURL.String()))
+	lg.Info("Registered",
+		zap.String("baseURL", baseURL),
+		zap.String("zone", topology.Zone),
+		zap.String("rack", topology.Rack),
+		zap.String("host", topology.Host),
+	)
 	return nil
 }
@@ -0,0 +1,46 @@
+package node
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+
+	"github.com/go-faster/errors"
+	"github.com/google/uuid"
+)
+
+// Reporter reports corrupted chunks to the front, so they are no longer
+// read from this node.
+type Reporter struct {
+	http    HTTPClient
+	baseURL string
+}
+
+// NewReporter creates Reporter for node with baseURL.
+func NewReporter(httpClient HTTPClient, baseURL string) *Reporter {
+	return &Reporter{
+		http:    httpClient,
+		baseURL: baseURL,
+	}
+}
+
+// Report chunk as corrupted.
+func (r *Reporter) Report(ctx context.Context, id uuid.UUID) error {
+	u := frontURL("/report", url.Values{
+		"baseURL": []string{r.baseURL},
+		"chunkID": []string{id.String()},
+	})
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, u, http.NoBody)
+	if err != nil {
+		return errors.Wrap(err, "create request")
+	}
+	resp, err := r.http.Do(req)
+	if err != nil {
+		return errors.Wrap(err, "do request")
+	}
+	defer func() { _ = resp.Body.Close() }()
+	if resp.StatusCode != http.StatusOK {
+		return errors.Errorf("unexpected status code: %d", resp.StatusCode)
+	}
+	return nil
+}
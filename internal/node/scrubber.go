@@ -0,0 +1,234 @@
+package node
+
+import (
+	"context"
+	"io"
+	"os"
+	"time"
+
+	"github.com/go-faster/errors"
+	"github.com/go-faster/sdk/zctx"
+	"github.com/google/uuid"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/trace"
+	"go.uber.org/zap"
+)
+
+// ChunkReporter reports corrupted chunks.
+type ChunkReporter interface {
+	Report(ctx context.Context, id uuid.UUID) error
+}
+
+// ScrubberOptions configures Scrubber.
+type ScrubberOptions struct {
+	// Rate limits scrub reads in bytes per second. Defaults to 10 MiB/s.
+	Rate int64
+	// Interval between scrub passes. Defaults to 24 hours.
+	Interval time.Duration
+}
+
+func (o *ScrubberOptions) setDefaults() {
+	if o.Rate <= 0 {
+		o.Rate = 10 * 1024 * 1024
+	}
+	if o.Interval <= 0 {
+		o.Interval = 24 * time.Hour
+	}
+}
+
+// Scrubber periodically re-verifies checksums of all chunks, quarantining
+// and reporting corrupted or unreadable ones.
+type Scrubber struct {
+	chunks   *Chunks
+	reporter ChunkReporter
+	rate     int64
+	interval time.Duration
+
+	trace        trace.Tracer
+	scrubBytes   metric.Int64Counter
+	scrubChunks  metric.Int64Counter
+	scrubPasses  metric.Int64Counter
+	scrubPending metric.Int64Gauge
+}
+
+// Scrub result attribute values.
+const (
+	scrubOK      = "ok"
+	scrubCorrupt = "corrupt"
+	scrubError   = "error"
+)
+
+func NewScrubber(
+	chunks *Chunks,
+	reporter ChunkReporter,
+	opts ScrubberOptions,
+	tracerProvider trace.TracerProvider,
+	meterProvider metric.MeterProvider,
+) (*Scrubber, error) {
+	opts.setDefaults()
+	const name = "stor.node"
+
+	meter := meterProvider.Meter(name)
+	scrubBytes, err := meter.Int64Counter("node.scrub.bytes")
+	if err != nil {
+		return nil, errors.Wrap(err, "scrub bytes")
+	}
+	scrubChunks, err := meter.Int64Counter("node.scrub.chunks")
+	if err != nil {
+		return nil, errors.Wrap(err, "scrub chunks")
+	}
+	scrubPasses, err := meter.Int64Counter("node.scrub.passes")
+	if err != nil {
+		return nil, errors.Wrap(err, "scrub passes")
+	}
+	scrubPending, err := meter.Int64Gauge("node.scrub.pending")
+	if err != nil {
+		return nil, errors.Wrap(err, "scrub pending")
+	}
+
+	return &Scrubber{
+		chunks:   chunks,
+		reporter: reporter,
+		rate:     opts.Rate,
+		interval: opts.Interval,
+
+		trace:        tracerProvider.Tracer(name),
+		scrubBytes:   scrubBytes,
+		scrubChunks:  scrubChunks,
+		scrubPasses:  scrubPasses,
+		scrubPending: scrubPending,
+	}, nil
+}
+
+// Run scrubs chunks every interval and reports chunks that were
+// quarantined on read until ctx is done.
+func (s *Scrubber) Run(ctx context.Context) error {
+	ticker := time.NewTicker(s.interval)
+	defer ticker.Stop()
+	for {
+		if err := s.Scrub(ctx); err != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			zctx.From(ctx).Error("Scrub failed", zap.Error(err))
+		}
+		for wait := true; wait; {
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case id := <-s.chunks.corrupted:
+				s.report(ctx, id)
+			case <-ticker.C:
+				wait = false
+			}
+		}
+	}
+}
+
+// Scrub makes single pass over all chunks.
+func (s *Scrubber) Scrub(ctx context.Context) (rerr error) {
+	ctx, span := s.trace.Start(ctx, "Scrubber.Scrub")
+	defer func() {
+		if rerr != nil {
+			span.RecordError(rerr)
+		} else {
+			s.scrubPasses.Add(ctx, 1)
+		}
+		span.End()
+	}()
+
+	ids, err := s.chunks.List(ctx)
+	if err != nil {
+		return errors.Wrap(err, "list chunks")
+	}
+	lg := zctx.From(ctx)
+	lg.Info("Scrub started", zap.Int("chunks", len(ids)))
+
+	var corrupted, failed int
+	for i, id := range ids {
+		s.scrubPending.Record(ctx, int64(len(ids)-i))
+		result := s.scrubChunk(ctx, id)
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		s.scrubChunks.Add(ctx, 1, metric.WithAttributes(
+			attribute.String("result", result),
+		))
+		switch result {
+		case scrubCorrupt:
+			corrupted++
+		case scrubError:
+			failed++
+		}
+	}
+	s.scrubPending.Record(ctx, 0)
+
+	lg.Info("Scrub finished",
+		zap.Int("chunks", len(ids)),
+		zap.Int("corrupted", corrupted),
+		zap.Int("failed", failed),
+	)
+	return nil
+}
+
+// scrubChunk verifies single chunk, returning scrub result.
+func (s *Scrubber) scrubChunk(ctx context.Context, id uuid.UUID) string {
+	err := s.verify(ctx, id)
+	switch {
+	case err == nil:
+		return scrubOK
+	case errors.Is(err, os.ErrNotExist):
+		// Deleted concurrently.
+		return scrubOK
+	case ctx.Err() != nil:
+		return scrubError
+	}
+
+	lg := zctx.From(ctx).With(zap.String("chunkID", id.String()))
+	result := scrubError
+	if errors.Is(err, ErrChecksumMismatch) {
+		result = scrubCorrupt
+	}
+	lg.Error("Chunk scrub failed", zap.String("result", result), zap.Error(err))
+	if err := s.chunks.Quarantine(ctx, id); err != nil {
+		lg.Error("Failed to quarantine chunk", zap.Error(err))
+	}
+	s.report(ctx, id)
+	return result
+}
+
+// verify rehashes chunk at throttled rate.
+func (s *Scrubber) verify(ctx context.Context, id uuid.UUID) error {
+	f, err := os.Open(s.chunks.path(id)) // #nosec G304
+	if err != nil {
+		return errors.Wrap(err, "open")
+	}
+	defer func() { _ = f.Close() }()
+
+	cr := &countingReader{R: newThrottledReader(ctx, f, s.rate)}
+	err = s.chunks.verify(ctx, id, cr)
+	s.scrubBytes.Add(ctx, cr.N)
+	return err
+}
+
+func (s *Scrubber) report(ctx context.Context, id uuid.UUID) {
+	if err := s.reporter.Report(ctx, id); err != nil {
+		zctx.From(ctx).Error("Failed to report chunk",
+			zap.String("chunkID", id.String()),
+			zap.Error(err),
+		)
+	}
+}
+
+// countingReader counts bytes read from R.
+type countingReader struct {
+	R io.Reader
+	N int64
+}
+
+func (c *countingReader) Read(p []byte) (n int, err error) {
+	n, err = c.R.Read(p)
+	c.N += int64(n)
+	return n, err
+}
@@ -0,0 +1,94 @@
+package node
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/require"
+	noopMeter "go.opentelemetry.io/otel/metric/noop"
+	noopTracer "go.opentelemetry.io/otel/trace/noop"
+)
+
+type recordingReporter struct {
+	mux      sync.Mutex
+	reported []uuid.UUID
+}
+
+func (r *recordingReporter) Report(_ context.Context, id uuid.UUID) error {
+	r.mux.Lock()
+	defer r.mux.Unlock()
+	r.reported = append(r.reported, id)
+	return nil
+}
+
+func TestScrubber(t *testing.T) {
+	dir := t.TempDir()
+	chunks, err := NewChunks(dir, noopTracer.NewTracerProvider(), noopMeter.NewMeterProvider())
+	require.NoError(t, err)
+	reporter := &recordingReporter{}
+	scrubber, err := NewScrubber(chunks, reporter, ScrubberOptions{}, noopTracer.NewTracerProvider(), noopMeter.NewMeterProvider())
+	require.NoError(t, err)
+
+	ctx := context.Background()
+	require.NoError(t, scrubber.Scrub(ctx), "scrub empty dir")
+
+	rd := newRandomData()
+	ids := make([]uuid.UUID, 3)
+	for i := range ids {
+		ids[i] = uuid.New()
+		_, err := chunks.Write(ctx, ids[i], bytes.NewReader(rd.New(t, 1024)), nil)
+		require.NoError(t, err)
+	}
+	require.NoError(t, scrubber.Scrub(ctx), "scrub healthy chunks")
+	require.Empty(t, reporter.reported)
+
+	// Corrupt single chunk on disk.
+	corrupted := ids[1]
+	data, err := os.ReadFile(chunks.path(corrupted))
+	require.NoError(t, err)
+	data[0] ^= 0xff
+	require.NoError(t, os.WriteFile(chunks.path(corrupted), data, 0o600))
+
+	require.NoError(t, scrubber.Scrub(ctx))
+	require.Equal(t, []uuid.UUID{corrupted}, reporter.reported)
+	require.FileExists(t, filepath.Join(dir, quarantineDir, corrupted.String()), "chunk should be quarantined")
+	require.FileExists(t, filepath.Join(dir, quarantineDir, corrupted.String()+checksumExt))
+	require.Error(t, chunks.Read(ctx, corrupted, new(bytes.Buffer)), "quarantined chunk should not be served")
+	for _, id := range []uuid.UUID{ids[0], ids[2]} {
+		require.NoError(t, chunks.Read(ctx, id, new(bytes.Buffer)), "healthy chunk")
+	}
+
+	// Quarantined chunks are not scrubbed again.
+	require.NoError(t, scrubber.Scrub(ctx))
+	require.Len(t, reporter.reported, 1)
+
+	// Corruption detected on read is quarantined and passed to scrubber.
+	data, err = os.ReadFile(chunks.path(ids[2]))
+	require.NoError(t, err)
+	data[0] ^= 0xff
+	require.NoError(t, os.WriteFile(chunks.path(ids[2]), data, 0o600))
+	require.ErrorIs(t, chunks.Read(ctx, ids[2], new(bytes.Buffer)), ErrChecksumMismatch)
+	require.FileExists(t, filepath.Join(dir, quarantineDir, ids[2].String()))
+	require.Equal(t, ids[2], <-chunks.corrupted)
+}
+
+func TestThrottledReader(t *testing.T) {
+	const rate = 1024
+	data := make([]byte, rate/4)
+	r := newThrottledReader(context.Background(), bytes.NewReader(data), rate)
+	buf := new(bytes.Buffer)
+	_, err := buf.ReadFrom(r)
+	require.NoError(t, err)
+	require.Equal(t, data, buf.Bytes())
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	r = newThrottledReader(ctx, bytes.NewReader(make([]byte, rate*4)), rate)
+	_, err = buf.ReadFrom(r)
+	require.ErrorIs(t, err, context.Canceled)
+}
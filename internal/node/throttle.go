@@ -0,0 +1,47 @@
+package node
+
+import (
+	"context"
+	"io"
+	"time"
+)
+
+// throttledReader limits read rate of R to Rate bytes per second.
+type throttledReader struct {
+	ctx   context.Context
+	r     io.Reader
+	rate  int64
+	start time.Time
+	n     int64
+}
+
+func newThrottledReader(ctx context.Context, r io.Reader, rate int64) *throttledReader {
+	return &throttledReader{
+		ctx:   ctx,
+		r:     r,
+		rate:  rate,
+		start: time.Now(),
+	}
+}
+
+func (t *throttledReader) Read(p []byte) (int, error) {
+	if int64(len(p)) > t.rate {
+		// Prevent bursts longer than a second.
+		p = p[:t.rate]
+	}
+	n, err := t.r.Read(p)
+	t.n += int64(n)
+
+	// Sleep until read bytes fit into rate.
+	expected := time.Duration(float64(t.n) / float64(t.rate) * float64(time.Second))
+	if wait := expected - time.Since(t.start); wait > 0 {
+		timer := time.NewTimer(wait)
+		defer timer.Stop()
+		select {
+		case <-t.ctx.Done():
+			return n, t.ctx.Err()
+		case <-timer.C:
+		}
+	}
+	return n, err
+}
@@ -0,0 +1,41 @@
+package node
+
+import "net/url"
+
+// Topology describes failure domains of node.
+//
+// Empty label means that node does not share the domain with other nodes.
+type Topology struct {
+	Zone string `json:"zone,omitempty"`
+	Rack string `json:"rack,omitempty"`
+	Host string `json:"host,omitempty"`
+}
+
+// Query parameters of topology labels.
+const (
+	ZoneParam = "zone"
+	RackParam = "rack"
+	HostParam = "host"
+)
+
+// ParseTopology parses topology labels from query.
+func ParseTopology(query url.Values) Topology {
+	return Topology{
+		Zone: query.Get(ZoneParam),
+		Rack: query.Get(RackParam),
+		Host: query.Get(HostParam),
+	}
+}
+
+// encode adds non-empty topology labels to query.
+func (t Topology) encode(query url.Values) {
+	for k, v := range map[string]string{
+		ZoneParam: t.Zone,
+		RackParam: t.Rack,
+		HostParam: t.Host,
+	} {
+		if v != "" {
+			query.Set(k, v)
+		}
+	}
+}